@@ -23,6 +23,9 @@ type MuxConfig struct {
 	State    *state.State
 	NS       *nameservice.NameService
 	Evts     *events.Events
+
+	FinalityDepth   uint64
+	MaxRequestBytes int64
 }
 
 // PublicMux constructs a http.Handler with all application routes defined.
@@ -46,10 +49,11 @@ func PublicMux(cfg MuxConfig) http.Handler {
 	
 	// Load the v1 routes.
 	v1.PublicRoutes(app, v1.Config{
-		Log:   cfg.Log,
-		State: cfg.State,
-		NS:    cfg.NS,
-		Evts:  cfg.Evts,
+		Log:           cfg.Log,
+		State:         cfg.State,
+		NS:            cfg.NS,
+		Evts:          cfg.Evts,
+		FinalityDepth: cfg.FinalityDepth,
 	})
 	
 	return app
@@ -61,7 +65,9 @@ func PrivateMux(cfg MuxConfig) http.Handler {
 	app := web.NewApp(
 		cfg.Shutdown,
 		mid.Logger(cfg.Log),
+		mid.Compress(),
 		mid.Errors(cfg.Log),
+		mid.MaxBytes(cfg.MaxRequestBytes),
 		mid.Cors("*"),
 		mid.Panics(),
 	)
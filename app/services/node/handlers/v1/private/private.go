@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -68,7 +69,7 @@ func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *ht
 		return fmt.Errorf("unable to decodde block: %w", err)
 	}
 
-	if err := h.State.ProcessProposedBlock(block); err != nil {
+	if err := h.State.ProcessProposedBlockFrom(block, r.RemoteAddr); err != nil {
 		if errors.Is(err, database.ErrChainForked) {
 			h.State.Reorganize()
 		}
@@ -104,14 +105,40 @@ func (h Handlers) SubmitPeer(ctx context.Context, w http.ResponseWriter, r *http
 	return web.Respond(ctx, w, nil, http.StatusOK)
 }
 
+// SubmitTip is called by a node to notify this node of its latest block. If
+// the node is ahead, the missing blocks are requested from it.
+func (h Handlers) SubmitTip(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var tip peer.Tip
+	if err := web.Decode(r, &tip); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if h.State.ProcessPeerTip(tip) {
+		h.Log.Infow("requesting blocks", "traceid", v.TraceID, "host", tip.Host, "number", tip.Number)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusOK)
+}
+
 // Status returns the current status of the node.
 func (h Handlers) Status(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	latestBlock := h.State.LatestBlock()
 
 	status := peer.Status{
+		NetworkID:         h.State.Genesis().NetworkID(),
 		LatestBlockHash:   latestBlock.Hash(),
 		LatestBlockNumber: latestBlock.Header.Number,
+		TxCount:           h.State.TxCount(),
+		TotalWork:         h.State.TotalWork().String(),
+		MempoolCount:      h.State.MempoolLength(),
 		KnownPeers:        h.State.KnownExternalPeers(),
+		Time:              uint64(time.Now().UTC().UnixMilli()),
+		Version:           h.State.Version(),
 	}
 
 	return web.Respond(ctx, w, status, http.StatusOK)
@@ -119,40 +146,167 @@ func (h Handlers) Status(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 // BlocksByNumber returns all the blocks based on the specified to/from values.
 func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	fromStr := web.Param(r, "from")
-	if fromStr == "latest" || fromStr == "" {
-		fromStr = fmt.Sprintf("%d", state.QueryLatest)
+	from, to, err := h.blockRange(r)
+	if err != nil {
+		return err
 	}
 
-	toStr := web.Param(r, "to")
-	if toStr == "latest" || toStr == "" {
-		toStr = fmt.Sprintf("%d", state.QueryLatest)
+	blocks := h.State.QueryBlocksByNumber(from, to)
+	if len(blocks) == 0 {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
 	}
 
-	from, err := strconv.ParseUint(fromStr, 10, 64)
+	blockData := make([]database.BlockData, len(blocks))
+	for i, block := range blocks {
+		blockData[i] = database.NewBlockData(block)
+	}
+
+	return web.Respond(ctx, w, blockData, http.StatusOK)
+}
+
+// HeadersByNumber returns only the headers of the blocks based on the
+// specified to/from values. Light clients can validate the chain of headers
+// before deciding which full blocks to fetch.
+func (h Handlers) HeadersByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	from, to, err := h.blockRange(r)
 	if err != nil {
-		return v1.NewRequestError(err, http.StatusBadRequest)
+		return err
+	}
+
+	headers := h.State.QueryHeadersByNumber(from, to)
+	if len(headers) == 0 {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	return web.Respond(ctx, w, headers, http.StatusOK)
+}
+
+// BlockTxs returns the transactions in the specified block along with their
+// merkle proofs, without the rest of the block.
+func (h Handlers) BlockTxs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	numStr := web.Param(r, "num")
+	if numStr == "latest" {
+		numStr = fmt.Sprintf("%d", state.QueryLatest)
 	}
-	to, err := strconv.ParseUint(toStr, 10, 64)
+
+	num, err := strconv.ParseUint(numStr, 10, 64)
 	if err != nil {
 		return v1.NewRequestError(err, http.StatusBadRequest)
 	}
 
-	if from > to {
-		return v1.NewRequestError(errors.New("from greater than to"), http.StatusBadRequest)
+	txs, err := h.State.QueryBlockTxs(num)
+	if err != nil {
+		if errors.Is(err, state.ErrBlockNotFound) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+
+		return err
 	}
 
-	blocks := h.State.QueryBlocksByNumber(from, to)
-	if len(blocks) == 0 {
-		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	return web.Respond(ctx, w, txs, http.StatusOK)
+}
+
+// CancelMining signals the node to cancel the mining operation in progress
+// and returns the number of hashes that operation attempted. If mining isn't
+// running, the attempts of the last mining operation are returned. This can
+// be used to measure the effective hashrate of the node.
+func (h Handlers) CancelMining(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	h.State.Worker.SignalCancelMining()
+
+	resp := struct {
+		Status   string `json:"status"`
+		Attempts uint64 `json:"attempts"`
+	}{
+		Status:   "mining cancel signaled",
+		Attempts: h.State.MiningAttempts(),
 	}
 
-	blockData := make([]database.BlockData, len(blocks))
-	for i, block := range blocks {
-		blockData[i] = database.NewBlockData(block)
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// MiningTimings returns the time spent in each phase of the last block
+// mined by this node.
+func (h Handlers) MiningTimings(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.MiningTimings(), http.StatusOK)
+}
+
+// RejectedBlocks returns the blocks recently rejected by this node, starting
+// with the most recent.
+func (h Handlers) RejectedBlocks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.RejectedBlocks(), http.StatusOK)
+}
+
+// Resync forces the node to reset and resync its blockchain from the specified
+// peer, or from all known peers when no peer is provided. Since this wipes the
+// blockchain, the request must be explicitly confirmed with confirm=true.
+func (h Handlers) Resync(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
 	}
 
-	return web.Respond(ctx, w, blockData, http.StatusOK)
+	if r.URL.Query().Get("confirm") != "true" {
+		return v1.NewRequestError(errors.New("resync resets the blockchain, confirm=true is required"), http.StatusBadRequest)
+	}
+
+	host := web.Param(r, "host")
+
+	h.Log.Infow("resync", "traceid", v.TraceID, "host", host)
+
+	before, after, err := h.State.Resync(host)
+	if err != nil {
+		switch {
+		case errors.Is(err, state.ErrResyncInProgress):
+			return v1.NewRequestError(err, http.StatusConflict)
+		case errors.Is(err, state.ErrResyncNoPeer):
+			return v1.NewRequestError(err, http.StatusServiceUnavailable)
+		}
+
+		return err
+	}
+
+	resp := struct {
+		Status string `json:"status"`
+		Before uint64 `json:"before_block_number"`
+		After  uint64 `json:"after_block_number"`
+	}{
+		Status: "resync completed",
+		Before: before,
+		After:  after,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// Rebroadcast queues every transaction in the mempool to be shared with the
+// peers again. This can be used when transactions aren't propagating, like
+// after a network partition heals.
+func (h Handlers) Rebroadcast(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	queued, err := h.State.RebroadcastMempool()
+	if err != nil {
+		if errors.Is(err, state.ErrRebroadcastTooSoon) {
+			return v1.NewRequestError(err, http.StatusTooManyRequests)
+		}
+
+		return err
+	}
+
+	h.Log.Infow("rebroadcast mempool", "traceid", v.TraceID, "queued", queued)
+
+	resp := struct {
+		Status string `json:"status"`
+		Queued int    `json:"queued"`
+	}{
+		Status: "mempool rebroadcast queued",
+		Queued: queued,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
 // Mempool returns the set of uncommitted transactions.
@@ -161,3 +315,71 @@ func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	return web.Respond(ctx, w, txs, http.StatusOK)
 }
+
+// Genesis returns the genesis information so peers can verify they are
+// running the same chain.
+func (h Handlers) Genesis(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	gen := h.State.Genesis()
+
+	return web.Respond(ctx, w, gen, http.StatusOK)
+}
+
+// Version returns the software and protocol version of the node.
+func (h Handlers) Version(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.Version(), http.StatusOK)
+}
+
+// ExportGenesis returns genesis information for a new chain that starts with
+// the current account balances of this chain.
+func (h Handlers) ExportGenesis(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	gen := h.State.ExportGenesis()
+
+	return web.Respond(ctx, w, gen, http.StatusOK)
+}
+
+// /////////////////////////////////////////////////////////////////
+
+// blockRange validates and returns the from/to block numbers in the request.
+// Either value can be latest to represent the latest block in the chain. A
+// range larger than the node's limit is rejected, so a single request can't
+// make the node load the whole chain.
+func (h Handlers) blockRange(r *http.Request) (from uint64, to uint64, err error) {
+	fromStr := web.Param(r, "from")
+	if fromStr == "latest" || fromStr == "" {
+		fromStr = fmt.Sprintf("%d", state.QueryLatest)
+	}
+
+	toStr := web.Param(r, "to")
+	if toStr == "latest" || toStr == "" {
+		toStr = fmt.Sprintf("%d", state.QueryLatest)
+	}
+
+	from, err = strconv.ParseUint(fromStr, 10, 64)
+	if err != nil {
+		return 0, 0, v1.NewRequestError(err, http.StatusBadRequest)
+	}
+	to, err = strconv.ParseUint(toStr, 10, 64)
+	if err != nil {
+		return 0, 0, v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if from > to {
+		return 0, 0, v1.NewRequestError(errors.New("from greater than to"), http.StatusBadRequest)
+	}
+
+	// Only the blocks up to the latest block can be returned, so that's
+	// what counts against the limit.
+	latest := h.State.LatestBlock().Header.Number
+	if from == state.QueryLatest {
+		from = latest
+	}
+	if to > latest {
+		to = latest
+	}
+
+	if limit := h.State.MaxBlockRange(); to >= from && to-from+1 > limit {
+		return 0, 0, v1.NewRequestError(fmt.Errorf("range of %d blocks exceeds the limit of %d, request the blocks in pages of at most %d", to-from+1, limit, limit), http.StatusBadRequest)
+	}
+
+	return from, to, nil
+}
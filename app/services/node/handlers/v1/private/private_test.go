@@ -0,0 +1,456 @@
+package private
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimfeld/httptreemux/v5"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	v1 "github.com/adamwoolhether/blockchain/business/web/v1"
+	"github.com/adamwoolhether/blockchain/business/web/v1/mid"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+	"github.com/adamwoolhether/blockchain/foundation/web"
+)
+
+func Test_RejectedBlocks(t *testing.T) {
+	st, block := newMinedState(t)
+
+	// The block is already in the chain, so proposing it again is rejected.
+	if err := st.ProcessProposedBlockFrom(block, "10.0.0.1:9080"); err == nil {
+		t.Fatal("Should not be able to process the same block twice.")
+	}
+
+	h := Handlers{State: st}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/node/rejected", nil)
+	w := httptest.NewRecorder()
+
+	if err := h.RejectedBlocks(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the rejected blocks: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Should receive a status code of %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var rejected []state.RejectedBlock
+	if err := json.NewDecoder(w.Body).Decode(&rejected); err != nil {
+		t.Fatalf("Should be able to decode the rejected blocks: %v", err)
+	}
+
+	if len(rejected) != 1 {
+		t.Fatalf("Should receive 1 rejected block, got %d", len(rejected))
+	}
+
+	if rejected[0].Hash != block.Hash() || rejected[0].Source != "10.0.0.1:9080" || rejected[0].Reason == "" {
+		t.Logf("got: %+v", rejected[0])
+		t.Logf("exp: hash[%s] source[10.0.0.1:9080]", block.Hash())
+		t.Fatal("Should receive the rejected block.")
+	}
+}
+
+func Test_BlockTxs(t *testing.T) {
+	st, block := newMinedState(t)
+
+	h := Handlers{State: st}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/node/block/1/txs", nil)
+	r = r.WithContext(httptreemux.AddParamsToContext(r.Context(), map[string]string{"num": "1"}))
+	w := httptest.NewRecorder()
+
+	if err := h.BlockTxs(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the block transactions: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Should receive a status code of %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var txs []state.TxProof
+	if err := json.NewDecoder(w.Body).Decode(&txs); err != nil {
+		t.Fatalf("Should be able to decode the block transactions: %v", err)
+	}
+
+	values := block.MerkleTree.Values()
+	if len(txs) != len(values) {
+		t.Fatalf("Should receive %d transactions, got %d", len(values), len(txs))
+	}
+
+	for i, tx := range txs {
+		if tx.Tx.SignatureString() != values[i].SignatureString() {
+			t.Fatalf("Should receive transaction %s, got %s", values[i].SignatureString(), tx.Tx.SignatureString())
+		}
+		if len(tx.Proof) == 0 || len(tx.Proof) != len(tx.ProofOrder) {
+			t.Fatalf("Should receive a merkle proof for transaction %s, got %v %v", tx.Tx.SignatureString(), tx.Proof, tx.ProofOrder)
+		}
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/node/block/2/txs", nil)
+	r = r.WithContext(httptreemux.AddParamsToContext(r.Context(), map[string]string{"num": "2"}))
+	w = httptest.NewRecorder()
+
+	err := h.BlockTxs(context.Background(), w, r)
+
+	var reqErr *v1.RequestError
+	if !errors.As(err, &reqErr) || reqErr.Status != http.StatusNotFound {
+		t.Fatalf("Should receive a %d error for a block that doesn't exist, got %v", http.StatusNotFound, err)
+	}
+}
+
+func Test_Status(t *testing.T) {
+	st, block := newMinedState(t)
+
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	// Leave a transaction pending in the mempool.
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   2,
+		FromID:  "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		ToID:    "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+		t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+	}
+
+	h := Handlers{State: st}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/node/status", nil)
+	w := httptest.NewRecorder()
+
+	if err := h.Status(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the status: %v", err)
+	}
+
+	var status peer.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("Should be able to decode the status: %v", err)
+	}
+
+	if status.LatestBlockNumber != 1 || status.LatestBlockHash != block.Hash() {
+		t.Fatalf("Should receive the latest block, got blk[%d] hash[%s]", status.LatestBlockNumber, status.LatestBlockHash)
+	}
+
+	if status.TxCount != 1 {
+		t.Fatalf("Should receive a transaction count of 1, got %d", status.TxCount)
+	}
+
+	if status.MempoolCount != 1 {
+		t.Fatalf("Should receive a mempool count of 1, got %d", status.MempoolCount)
+	}
+}
+
+func Test_Version(t *testing.T) {
+	const build = "v1.2.3"
+
+	st, _ := newMinedState(t, func(cfg *state.Config) {
+		cfg.Build = build
+	})
+
+	h := Handlers{State: st}
+	exp := peer.Version{Build: build, Protocol: peer.ProtocolVersion}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/node/version", nil)
+	w := httptest.NewRecorder()
+
+	if err := h.Version(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the version: %v", err)
+	}
+
+	var version peer.Version
+	if err := json.NewDecoder(w.Body).Decode(&version); err != nil {
+		t.Fatalf("Should be able to decode the version: %v", err)
+	}
+
+	if version != exp {
+		t.Logf("got: %+v", version)
+		t.Logf("exp: %+v", exp)
+		t.Fatal("Should receive the version of the node.")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/node/status", nil)
+	w = httptest.NewRecorder()
+
+	if err := h.Status(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the status: %v", err)
+	}
+
+	var status peer.Status
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("Should be able to decode the status: %v", err)
+	}
+
+	if status.Version != exp {
+		t.Logf("got: %+v", status.Version)
+		t.Logf("exp: %+v", exp)
+		t.Fatal("Should receive the version of the node in the status.")
+	}
+}
+
+func Test_CompressedStatusAndMempool(t *testing.T) {
+	st, block := newMinedState(t)
+
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	// Leave a transaction pending in the mempool.
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   2,
+		FromID:  "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		ToID:    "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+		t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+	}
+
+	h := Handlers{State: st}
+
+	app := web.NewApp(make(chan os.Signal, 1), mid.Compress())
+	app.Handle(http.MethodGet, "v1", "/node/status", h.Status)
+	app.Handle(http.MethodGet, "v1", "/node/tx/list", h.Mempool)
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	// The responses are gzip encoded when the client accepts it.
+	for _, path := range []string{"/v1/node/status", "/v1/node/tx/list"} {
+		r, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Should be able to construct the request: %v", err)
+		}
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			t.Fatalf("Should be able to send the request for %s: %v", path, err)
+		}
+
+		if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+			resp.Body.Close()
+			t.Fatalf("Should receive a gzip encoded response for %s, got %q", path, enc)
+		}
+
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			t.Fatalf("Should be able to read the gzip response for %s: %v", path, err)
+		}
+
+		var v any
+		err = json.NewDecoder(gz).Decode(&v)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Should be able to decode the gzip response for %s: %v", path, err)
+		}
+	}
+
+	// The node requests and decompresses the responses from a peer.
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	status, err := st.NetRequestPeerStatus(pr)
+	if err != nil {
+		t.Fatalf("Should be able to request the peer status: %v", err)
+	}
+
+	if status.LatestBlockNumber != 1 || status.LatestBlockHash != block.Hash() || status.MempoolCount != 1 {
+		t.Fatalf("Should receive the peer status, got blk[%d] hash[%s] mempool[%d]", status.LatestBlockNumber, status.LatestBlockHash, status.MempoolCount)
+	}
+
+	txs, err := st.NetRequestPeerMempool(pr)
+	if err != nil {
+		t.Fatalf("Should be able to request the peer mempool: %v", err)
+	}
+
+	if len(txs) != 1 || txs[0].Nonce != 2 {
+		t.Fatalf("Should receive the peer mempool, got %v", txs)
+	}
+}
+
+func Test_BlockRangeLimit(t *testing.T) {
+	const limit = 2
+
+	st, _ := newMinedState(t, func(cfg *state.Config) {
+		cfg.MaxBlockRange = limit
+	})
+
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	// Grow the chain past the limit.
+	for nonce := uint64(2); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			ToID:    "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+			Value:   1,
+		}
+
+		signedTx, err := tx.Sign(pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign the transaction: %v", err)
+		}
+
+		if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+			t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+		}
+
+		if _, err := st.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Should be able to mine a block: %v", err)
+		}
+	}
+
+	h := Handlers{State: st}
+
+	type table struct {
+		name   string
+		from   string
+		to     string
+		blocks int
+	}
+
+	tt := []table{
+		{name: "within limit", from: "2", to: "3", blocks: 2},
+		{name: "past latest", from: "3", to: "4", blocks: 1},
+		{name: "over limit", from: "1", to: "3"},
+		{name: "over limit to latest", from: "1", to: "latest"},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/node/block/list/"+tst.from+"/"+tst.to, nil)
+			r = r.WithContext(httptreemux.AddParamsToContext(r.Context(), map[string]string{"from": tst.from, "to": tst.to}))
+			w := httptest.NewRecorder()
+
+			err := h.BlocksByNumber(context.Background(), w, r)
+
+			if tst.blocks == 0 {
+				var reqErr *v1.RequestError
+				if !errors.As(err, &reqErr) || reqErr.Status != http.StatusBadRequest {
+					t.Fatalf("Test %s:\tShould receive a %d error for a range over the limit, got %v", tst.name, http.StatusBadRequest, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to get the blocks: %v", tst.name, err)
+			}
+
+			var blocks []database.BlockData
+			if err := json.NewDecoder(w.Body).Decode(&blocks); err != nil {
+				t.Fatalf("Test %s:\tShould be able to decode the blocks: %v", tst.name, err)
+			}
+
+			if len(blocks) != tst.blocks {
+				t.Fatalf("Test %s:\tShould receive %d blocks, got %d", tst.name, tst.blocks, len(blocks))
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// =============================================================================
+
+// newMinedState constructs a state backed by memory storage and mines a
+// single block with one transaction. The options can change the config of
+// the state.
+func newMinedState(t *testing.T, options ...func(cfg *state.Config)) (*state.State, database.Block) {
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	cfg := state.Config{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Host:          "localhost:9080",
+		Storage:       storage,
+		Genesis: genesis.Genesis{
+			Date:          time.Now().Add(-24 * time.Hour),
+			ChainID:       1,
+			TransPerBlock: 10,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances: map[string]uint64{
+				"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 1000000,
+			},
+		},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewSet(),
+		EvHandler:      func(v string, args ...any) {},
+	}
+
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	st, err := state.New(cfg)
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		ToID:    "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+		t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+	}
+
+	block, err := st.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	return st, block
+}
@@ -1,9 +1,22 @@
 package public
 
 import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 )
 
+// Set of values used to paginate and sort lists.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+
+	sortByAccount = "account"
+	sortByBalance = "balance"
+)
+
 type acct struct {
 	Account database.AccountID `json:"account"`
 	Name    string             `json:"name"`
@@ -11,12 +24,59 @@ type acct struct {
 	Nonce   uint64             `json:"nonce"`
 }
 
+type acctAt struct {
+	Number  uint64             `json:"number"`
+	Account database.AccountID `json:"account"`
+	Balance uint64             `json:"balance"`
+	Nonce   uint64             `json:"nonce"`
+}
+
 type acctInfo struct {
 	LatestBlock string `json:"latest_block"`
 	Uncommitted int    `json:"uncommitted"`
+	Total       int    `json:"total"`
+	Page        int    `json:"page"`
+	Size        int    `json:"size"`
 	Accounts    []acct `json:"database"`
 }
 
+type stateRoot struct {
+	Number    uint64             `json:"number"`
+	BlockHash string             `json:"block_hash"`
+	StateRoot string             `json:"state_root"`
+	Accounts  []database.Account `json:"accounts"`
+}
+
+type merkleTree struct {
+	Number     uint64     `json:"number"`
+	MerkleRoot string     `json:"merkle_root"`
+	Levels     [][]string `json:"levels"`
+}
+
+type earning struct {
+	Account database.AccountID `json:"account"`
+	Name    string             `json:"name"`
+	Earned  uint64             `json:"earned"`
+}
+
+type registeredName struct {
+	Name    string             `json:"name"`
+	Account database.AccountID `json:"account"`
+}
+
+type nonceRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+type pendingNonces struct {
+	Account        database.AccountID `json:"account"`
+	ConfirmedNonce uint64             `json:"confirmed_nonce"`
+	Pending        []uint64           `json:"pending_nonces"`
+	Gaps           []nonceRange       `json:"gaps"`
+	Blocked        []uint64           `json:"blocked_nonces"`
+}
+
 type tx struct {
 	FromAccount database.AccountID `json:"from"`
 	FromName    string             `json:"from_name"`
@@ -27,6 +87,8 @@ type tx struct {
 	Value       uint64             `json:"value"`
 	Tip         uint64             `json:"tip"`
 	Data        []byte             `json:"data"`
+	DataText    string             `json:"data_text,omitempty"`
+	Category    string             `json:"category"`
 	TimeStamp   uint64             `json:"timestamp"`
 	GasPrice    uint64             `json:"gas_price"`
 	GasUnits    uint64             `json:"gas_units"`
@@ -35,6 +97,20 @@ type tx struct {
 	ProofOrder  []int64            `json:"proof_order"`
 }
 
+type nextTx struct {
+	Position    int                `json:"position"`
+	FromAccount database.AccountID `json:"from"`
+	FromName    string             `json:"from_name"`
+	To          database.AccountID `json:"to"`
+	ToName      string             `json:"to_name"`
+	Nonce       uint64             `json:"nonce"`
+	Value       uint64             `json:"value"`
+	Tip         uint64             `json:"tip"`
+	GasPrice    uint64             `json:"gas_price"`
+	GasUnits    uint64             `json:"gas_units"`
+	Sig         string             `json:"sig"`
+}
+
 type block struct {
 	Number        uint64             `json:"number"`
 	PrevBlockHash string             `json:"prev_block_hash"`
@@ -45,5 +121,100 @@ type block struct {
 	StateRoot     string             `json:"state_root"`
 	TransRoot     string             `json:"trans_root"`
 	Nonce         uint64             `json:"nonce"`
+	Confirmations uint64             `json:"confirmations"`
+	Finalized     bool               `json:"finalized"`
+	TxCount       int                `json:"tx_count"`
 	Transactions  []tx               `json:"txs"`
 }
+
+// confirmations returns the number of blocks mined on top of the block and
+// if the block is buried deep enough to be considered final.
+func confirmations(latest uint64, number uint64, depth uint64) (uint64, bool) {
+	if number > latest {
+		return 0, false
+	}
+
+	confirms := latest - number
+
+	return confirms, confirms >= depth
+}
+
+// pageAccounts sorts the accounts and returns the specified page. Accounts
+// are sorted by account id, or by balance from highest to lowest. Pages
+// start at 1 and a page past the end of the list is empty.
+func pageAccounts(accounts []acct, sortBy string, page int, size int) []acct {
+	switch sortBy {
+	case sortByBalance:
+		sort.Slice(accounts, func(i, j int) bool {
+			if accounts[i].Balance != accounts[j].Balance {
+				return accounts[i].Balance > accounts[j].Balance
+			}
+			return accounts[i].Account < accounts[j].Account
+		})
+	default:
+		sort.Slice(accounts, func(i, j int) bool {
+			return accounts[i].Account < accounts[j].Account
+		})
+	}
+
+	// Check the page against the number of pages before calculating the
+	// start so a large page number can't overflow.
+	pages := (len(accounts) + size - 1) / size
+	if page > pages {
+		return []acct{}
+	}
+
+	start := (page - 1) * size
+
+	end := start + size
+	if end > len(accounts) {
+		end = len(accounts)
+	}
+
+	return accounts[start:end]
+}
+
+// nonceGaps returns the ranges of nonces missing between the confirmed nonce
+// and the sorted pending nonces, along with the pending nonces that can't be
+// mined until those gaps are filled. Pending nonces at or below the confirmed
+// nonce are already used and are ignored.
+func nonceGaps(confirmed uint64, pending []uint64) ([]nonceRange, []uint64) {
+	gaps := make([]nonceRange, 0)
+	blocked := make([]uint64, 0)
+
+	next := confirmed + 1
+	for _, nonce := range pending {
+		if nonce < next {
+			continue
+		}
+
+		if nonce > next {
+			gaps = append(gaps, nonceRange{From: next, To: nonce - 1})
+		}
+
+		if len(gaps) > 0 {
+			blocked = append(blocked, nonce)
+		}
+
+		next = nonce + 1
+	}
+
+	return gaps, blocked
+}
+
+// dataText returns the transaction data as text when it's valid UTF-8 made
+// up of printable characters, so memos can be shown without decoding. An
+// empty string is returned for binary data.
+func dataText(data []byte) string {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return ""
+	}
+
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return ""
+		}
+	}
+
+	return string(data)
+}
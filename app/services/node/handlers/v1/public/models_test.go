@@ -0,0 +1,201 @@
+package public
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+func Test_Confirmations(t *testing.T) {
+	type table struct {
+		name      string
+		latest    uint64
+		number    uint64
+		depth     uint64
+		confirms  uint64
+		finalized bool
+	}
+
+	tt := []table{
+		{name: "tip", latest: 10, number: 10, depth: 6, confirms: 0, finalized: false},
+		{name: "below depth", latest: 10, number: 5, depth: 6, confirms: 5, finalized: false},
+		{name: "at depth", latest: 10, number: 4, depth: 6, confirms: 6, finalized: true},
+		{name: "past depth", latest: 10, number: 1, depth: 6, confirms: 9, finalized: true},
+		{name: "zero depth", latest: 10, number: 10, depth: 0, confirms: 0, finalized: true},
+		{name: "ahead of tip", latest: 10, number: 11, depth: 6, confirms: 0, finalized: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			confirms, finalized := confirmations(tst.latest, tst.number, tst.depth)
+			if confirms != tst.confirms || finalized != tst.finalized {
+				t.Logf("got: %d confirmations, finalized %t", confirms, finalized)
+				t.Logf("exp: %d confirmations, finalized %t", tst.confirms, tst.finalized)
+				t.Fatalf("Test %s:\tShould get back the right confirmations.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_NonceGaps(t *testing.T) {
+	type table struct {
+		name      string
+		confirmed uint64
+		pending   []uint64
+		gaps      []nonceRange
+		blocked   []uint64
+	}
+
+	tt := []table{
+		{name: "no pending", confirmed: 3, pending: []uint64{}, gaps: []nonceRange{}, blocked: []uint64{}},
+		{name: "no gaps", confirmed: 3, pending: []uint64{4, 5, 6}, gaps: []nonceRange{}, blocked: []uint64{}},
+		{name: "gap after confirmed", confirmed: 3, pending: []uint64{5, 6}, gaps: []nonceRange{{From: 4, To: 4}}, blocked: []uint64{5, 6}},
+		{name: "gap between pending", confirmed: 0, pending: []uint64{1, 2, 5, 9}, gaps: []nonceRange{{From: 3, To: 4}, {From: 6, To: 8}}, blocked: []uint64{5, 9}},
+		{name: "already confirmed", confirmed: 3, pending: []uint64{2, 3, 4}, gaps: []nonceRange{}, blocked: []uint64{}},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			gaps, blocked := nonceGaps(tst.confirmed, tst.pending)
+			if !reflect.DeepEqual(gaps, tst.gaps) || !reflect.DeepEqual(blocked, tst.blocked) {
+				t.Logf("got: gaps %v, blocked %v", gaps, blocked)
+				t.Logf("exp: gaps %v, blocked %v", tst.gaps, tst.blocked)
+				t.Fatalf("Test %s:\tShould get back the right nonce gaps.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_PageAccounts(t *testing.T) {
+	accounts := func() []acct {
+		return []acct{
+			{Account: "0xC", Balance: 20},
+			{Account: "0xA", Balance: 10},
+			{Account: "0xE", Balance: 50},
+			{Account: "0xB", Balance: 20},
+			{Account: "0xD", Balance: 0},
+		}
+	}
+
+	ids := func(accounts []acct) []database.AccountID {
+		ids := make([]database.AccountID, len(accounts))
+		for i, a := range accounts {
+			ids[i] = a.Account
+		}
+		return ids
+	}
+
+	type table struct {
+		name   string
+		sortBy string
+		page   int
+		size   int
+		exp    []database.AccountID
+	}
+
+	tt := []table{
+		{name: "by account", sortBy: sortByAccount, page: 1, size: 5, exp: []database.AccountID{"0xA", "0xB", "0xC", "0xD", "0xE"}},
+		{name: "by balance", sortBy: sortByBalance, page: 1, size: 5, exp: []database.AccountID{"0xE", "0xB", "0xC", "0xA", "0xD"}},
+		{name: "first page", sortBy: sortByAccount, page: 1, size: 2, exp: []database.AccountID{"0xA", "0xB"}},
+		{name: "middle page", sortBy: sortByAccount, page: 2, size: 2, exp: []database.AccountID{"0xC", "0xD"}},
+		{name: "last partial page", sortBy: sortByAccount, page: 3, size: 2, exp: []database.AccountID{"0xE"}},
+		{name: "past last page", sortBy: sortByAccount, page: 4, size: 2, exp: []database.AccountID{}},
+		{name: "huge page", sortBy: sortByAccount, page: math.MaxInt, size: 1000, exp: []database.AccountID{}},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			got := ids(pageAccounts(accounts(), tst.sortBy, tst.page, tst.size))
+			if !reflect.DeepEqual(got, tst.exp) {
+				t.Logf("got: %v", got)
+				t.Logf("exp: %v", tst.exp)
+				t.Fatalf("Test %s:\tShould get back the right page of accounts.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_PageParams(t *testing.T) {
+	type table struct {
+		name    string
+		query   string
+		page    int
+		size    int
+		sortBy  string
+		success bool
+	}
+
+	tt := []table{
+		{name: "defaults", query: "", page: 1, size: defaultPageSize, sortBy: sortByAccount, success: true},
+		{name: "all set", query: "?page=3&size=10&sort=balance", page: 3, size: 10, sortBy: sortByBalance, success: true},
+		{name: "zero page", query: "?page=0", success: false},
+		{name: "bad page", query: "?page=abc", success: false},
+		{name: "zero size", query: "?size=0", success: false},
+		{name: "size too large", query: fmt.Sprintf("?size=%d", maxPageSize+1), success: false},
+		{name: "bad sort", query: "?sort=nonce", success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/accounts/list"+tst.query, nil)
+			page, size, sortBy, err := pageParams(r)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to parse the page params: %v", tst.name, err)
+				}
+				if page != tst.page || size != tst.size || sortBy != tst.sortBy {
+					t.Logf("got: page %d, size %d, sort %s", page, size, sortBy)
+					t.Logf("exp: page %d, size %d, sort %s", tst.page, tst.size, tst.sortBy)
+					t.Fatalf("Test %s:\tShould get back the right page params.", tst.name)
+				}
+			default:
+				if err == nil {
+					t.Fatalf("Test %s:\tShould not be able to parse the page params.", tst.name)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_DataText(t *testing.T) {
+	type table struct {
+		name string
+		data []byte
+		exp  string
+	}
+
+	tt := []table{
+		{name: "empty", data: nil, exp: ""},
+		{name: "ascii memo", data: []byte("rent for march"), exp: "rent for march"},
+		{name: "utf8 memo", data: []byte("café ☕\n"), exp: "café ☕\n"},
+		{name: "invalid utf8", data: []byte{0xff, 0xfe, 0xfd}, exp: ""},
+		{name: "control bytes", data: []byte{0x00, 0x01, 0x02}, exp: ""},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			if got := dataText(tst.data); got != tst.exp {
+				t.Logf("got: %q", got)
+				t.Logf("exp: %q", tst.exp)
+				t.Fatalf("Test %s:\tShould get back the right data text.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
@@ -3,8 +3,11 @@ package public
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap"
@@ -28,6 +31,10 @@ type Handlers struct {
 	WS    websocket.Upgrader
 	NS    *nameservice.NameService
 	Evts  *events.Events
+
+	// FinalityDepth is the number of confirmations after which a block
+	// is reported as finalized.
+	FinalityDepth uint64
 }
 
 // Events handles a web socket to provide events to a client.
@@ -37,6 +44,17 @@ func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return err
 	}
 
+	// Acquire the channel before the upgrade so a client over the maximum
+	// number of subscribers can still be sent an http error.
+	ch, err := h.Evts.Acquire(v.TraceID)
+	if err != nil {
+		if errors.Is(err, events.ErrTooManySubscribers) {
+			return v1.NewRequestError(err, http.StatusServiceUnavailable)
+		}
+		return err
+	}
+	defer h.Evts.Release(v.TraceID)
+
 	h.WS.CheckOrigin = func(r *http.Request) bool { return true } // required to bypass CORS issues, this is a security issue!.
 
 	// "hijack"" the http connection to a websocket connection
@@ -46,9 +64,6 @@ func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 	defer c.Close()
 
-	ch := h.Evts.Acquire(v.TraceID)
-	defer h.Evts.Release(v.TraceID)
-
 	ticker := time.NewTicker(time.Second)
 
 	for {
@@ -99,6 +114,43 @@ func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWr
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
+// RawTransaction returns the signed transaction pending in the mempool with
+// the specified signature. The response can be submitted as is to another
+// node to rebroadcast the transaction.
+func (h Handlers) RawTransaction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	sig := web.Param(r, "sig")
+
+	tx, err := h.State.QueryMempoolTx(sig)
+	if err != nil {
+		if errors.Is(err, state.ErrTxNotFound) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+		return err
+	}
+
+	return web.Respond(ctx, w, tx.SignedTx, http.StatusOK)
+}
+
+// LookupName returns the account a name is registered to on the chain.
+func (h Handlers) LookupName(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	name := web.Param(r, "name")
+
+	accountID, err := h.State.LookupName(name)
+	if err != nil {
+		if errors.Is(err, database.ErrNameNotFound) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+		return err
+	}
+
+	resp := registeredName{
+		Name:    name,
+		Account: accountID,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
 // Genesis return the genesis block information.
 func (h Handlers) Genesis(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	gen := h.State.Genesis()
@@ -128,6 +180,8 @@ func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Re
 			Value:       t.Value,
 			Tip:         t.Tip,
 			Data:        t.Data,
+			DataText:    dataText(t.Data),
+			Category:    t.Category.String(),
 			TimeStamp:   t.TimeStamp,
 			GasPrice:    t.GasPrice,
 			GasUnits:    t.GasUnits,
@@ -138,9 +192,67 @@ func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Re
 	return web.Respond(ctx, w, txs, http.StatusOK)
 }
 
-// Accounts returns the current balances for all users.
+// NextBlock returns the uncommitted transactions that would be mined into
+// the next block right now, along with their position in the block, so users
+// can see if their transaction made the cut.
+func (h Handlers) NextBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	next := h.State.NextBlockTxs()
+
+	txs := make([]nextTx, len(next))
+	for i, t := range next {
+		txs[i] = nextTx{
+			Position:    i,
+			FromAccount: t.FromID,
+			FromName:    h.NS.Lookup(t.FromID),
+			To:          t.ToID,
+			ToName:      h.NS.Lookup(t.ToID),
+			Nonce:       t.Nonce,
+			Value:       t.Value,
+			Tip:         t.Tip,
+			GasPrice:    t.GasPrice,
+			GasUnits:    t.GasUnits,
+			Sig:         t.SignatureString(),
+		}
+	}
+
+	return web.Respond(ctx, w, txs, http.StatusOK)
+}
+
+// MempoolStats returns a summary of the uncommitted transactions for
+// monitoring the mempool.
+func (h Handlers) MempoolStats(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	stats := h.State.MempoolStats()
+
+	return web.Respond(ctx, w, stats, http.StatusOK)
+}
+
+// FeeMarket returns the distribution of the tips and gas prices paid in the
+// most recent blocks, along with the tips offered in the mempool, so wallets
+// can pick a competitive tip. The number of blocks sampled can be set with
+// the blocks query parameter.
+func (h Handlers) FeeMarket(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var blocks uint64
+	if v := r.URL.Query().Get("blocks"); v != "" {
+		var err error
+		blocks, err = strconv.ParseUint(v, 10, 64)
+		if err != nil || blocks < 1 || blocks > state.MaxFeeMarketBlocks {
+			return v1.NewRequestError(fmt.Errorf("invalid blocks %q, must be between 1 and %d", v, state.MaxFeeMarketBlocks), http.StatusBadRequest)
+		}
+	}
+
+	fm, err := h.State.FeeMarket(blocks)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, fm, http.StatusOK)
+}
+
+// Accounts returns the current balances for all users. The list of all
+// accounts is paginated using the page and size query parameters and can be
+// sorted by account id or balance using the sort query parameter.
 func (h Handlers) Accounts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	accountStr := web.Param(r, "accountID")
+	accountStr := web.Param(r, "account")
 
 	var accounts map[database.AccountID]database.Account
 	switch accountStr {
@@ -159,27 +271,226 @@ func (h Handlers) Accounts(ctx context.Context, w http.ResponseWriter, r *http.R
 		accounts = map[database.AccountID]database.Account{accountID: account}
 	}
 
+	page, size, sortBy, err := pageParams(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
 	resp := make([]acct, 0, len(accounts))
 	for account, info := range accounts {
 		acct := acct{
 			Account: account,
-			Name:    h.NS.Lookup(account),
 			Balance: info.Balance,
 			Nonce:   info.Nonce,
 		}
 		resp = append(resp, acct)
 	}
 
+	resp = pageAccounts(resp, sortBy, page, size)
+	for i := range resp {
+		resp[i].Name = h.NS.Lookup(resp[i].Account)
+	}
+
 	ai := acctInfo{
 		LatestBlock: h.State.LatestBlock().Hash(),
 		Uncommitted: len(h.State.Mempool()),
+		Total:       len(accounts),
+		Page:        page,
+		Size:        size,
 		Accounts:    resp,
 	}
 
 	return web.Respond(ctx, w, ai, http.StatusOK)
 }
 
-// BlocksByAccount returns all the blocks and their details.
+// PendingNonces returns the confirmed nonce for the specified account along
+// with the nonces of its transactions in the mempool, reporting any gaps that
+// keep the later transactions from being mined.
+func (h Handlers) PendingNonces(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// An account that isn't in the database yet hasn't confirmed any
+	// transactions, but can still have transactions in the mempool.
+	var confirmed uint64
+	if account, err := h.State.QueryAccount(accountID); err == nil {
+		confirmed = account.Nonce
+	}
+
+	pending := h.State.PendingNonces(accountID)
+	gaps, blocked := nonceGaps(confirmed, pending)
+
+	resp := pendingNonces{
+		Account:        accountID,
+		ConfirmedNonce: confirmed,
+		Pending:        pending,
+		Gaps:           gaps,
+		Blocked:        blocked,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// AccountAt returns the specified account as it was after the specified
+// block was applied.
+func (h Handlers) AccountAt(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	number := h.State.LatestBlock().Header.Number
+	if numberStr := web.Param(r, "block"); numberStr != "latest" {
+		number, err = strconv.ParseUint(numberStr, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+
+	account, err := h.State.QueryAccountAt(accountID, number)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := acctAt{
+		Number:  number,
+		Account: accountID,
+		Balance: account.Balance,
+		Nonce:   account.Nonce,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// StateRoot returns the state root stored in the specified block along with
+// the sorted set of accounts used to calculate it. Hashing the JSON encoding
+// of the accounts reproduces the state root. Only the latest block is
+// currently supported.
+func (h Handlers) StateRoot(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	numberStr := web.Param(r, "block")
+	if numberStr == "latest" || numberStr == "" {
+		numberStr = fmt.Sprintf("%d", state.QueryLatest)
+	}
+
+	number, err := strconv.ParseUint(numberStr, 10, 64)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	blk, accounts, err := h.State.QueryStateRoot(number)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := stateRoot{
+		Number:    blk.Header.Number,
+		BlockHash: blk.Hash(),
+		StateRoot: blk.Header.StateRoot,
+		Accounts:  accounts,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// Earnings returns how much each account earned for mining the blocks in
+// the range set by the from and to query parameters, highest earner first.
+// The range defaults to the whole chain.
+func (h Handlers) Earnings(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	from := uint64(1)
+	to := state.QueryLatest
+
+	for _, param := range []struct {
+		name  string
+		value *uint64
+	}{
+		{name: "from", value: &from},
+		{name: "to", value: &to},
+	} {
+		switch v := r.URL.Query().Get(param.name); v {
+		case "":
+		case "latest":
+			*param.value = state.QueryLatest
+		default:
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return v1.NewRequestError(fmt.Errorf("invalid %s %q", param.name, v), http.StatusBadRequest)
+			}
+			*param.value = n
+		}
+	}
+
+	earned, err := h.State.BeneficiaryEarnings(from, to)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := make([]earning, 0, len(earned))
+	for accountID, amount := range earned {
+		resp = append(resp, earning{
+			Account: accountID,
+			Name:    h.NS.Lookup(accountID),
+			Earned:  amount,
+		})
+	}
+
+	sort.Slice(resp, func(i, j int) bool {
+		if resp[i].Earned != resp[j].Earned {
+			return resp[i].Earned > resp[j].Earned
+		}
+		return resp[i].Account < resp[j].Account
+	})
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// MerkleTree returns the hashes of the merkle tree of the transactions in
+// the specified block, level by level from the leaves to the root.
+func (h Handlers) MerkleTree(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	numStr := web.Param(r, "num")
+	if numStr == "latest" {
+		numStr = fmt.Sprintf("%d", state.QueryLatest)
+	}
+
+	num, err := strconv.ParseUint(numStr, 10, 64)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	blk, err := h.State.QueryBlock(num)
+	if err != nil {
+		if errors.Is(err, state.ErrBlockNotFound) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+
+		return err
+	}
+
+	var levels [][]string
+	for _, level := range blk.MerkleTree.Levels() {
+		hashes := make([]string, len(level))
+		for i, hash := range level {
+			hashes[i] = hexutil.Encode(hash)
+		}
+		levels = append(levels, hashes)
+	}
+
+	resp := merkleTree{
+		Number:     blk.Header.Number,
+		MerkleRoot: blk.MerkleTree.RootHex(),
+		Levels:     levels,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// BlocksByAccount returns all the blocks and their details. When the trim
+// query parameter is set, each block only lists the transactions involving
+// the account, with the proofs still against the full block.
 func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	var accountID database.AccountID
 	accountStr := web.Param(r, "account")
@@ -191,7 +502,30 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 		}
 	}
 
-	dbBlocks, err := h.State.QueryBlocksByAccount(accountID)
+	// The blocks can be narrowed down to the ones holding a transaction of
+	// the specified category.
+	query := h.State.QueryBlocksByAccount
+	if categoryStr := r.URL.Query().Get("category"); categoryStr != "" {
+		category, err := database.ParseCategory(categoryStr)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+
+		query = func(accountID database.AccountID) ([]database.Block, error) {
+			return h.State.QueryBlocksByCategory(accountID, category)
+		}
+	}
+
+	var trim bool
+	if v := r.URL.Query().Get("trim"); v != "" {
+		var err error
+		trim, err = strconv.ParseBool(v)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid trim %q, must be true or false", v), http.StatusBadRequest)
+		}
+	}
+
+	dbBlocks, err := query(accountID)
 	if err != nil {
 		return err
 	}
@@ -199,12 +533,18 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 		return web.Respond(ctx, w, nil, http.StatusNoContent)
 	}
 
+	latest := h.State.LatestBlock().Header.Number
+
 	blocks := make([]block, len(dbBlocks))
 	for j, blk := range dbBlocks {
 		values := blk.MerkleTree.Values()
 
-		txs := make([]tx, len(values))
-		for i, tran := range values {
+		txs := make([]tx, 0, len(values))
+		for _, tran := range values {
+			if trim && accountID != "" && tran.FromID != accountID && tran.ToID != accountID {
+				continue
+			}
+
 			rawProof, order, err := blk.MerkleTree.Proof(tran)
 			if err != nil {
 				return err
@@ -214,7 +554,7 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 				proof[i] = hexutil.Encode(rp)
 			}
 
-			txs[i] = tx{
+			txs = append(txs, tx{
 				FromAccount: tran.FromID,
 				FromName:    h.NS.Lookup(tran.FromID),
 				To:          tran.ToID,
@@ -224,13 +564,15 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 				Value:       tran.Value,
 				Tip:         tran.Tip,
 				Data:        tran.Data,
+				DataText:    dataText(tran.Data),
+				Category:    tran.Category.String(),
 				TimeStamp:   tran.TimeStamp,
 				GasPrice:    tran.GasPrice,
 				GasUnits:    tran.GasUnits,
 				Sig:         tran.SignatureString(),
 				Proof:       proof,
 				ProofOrder:  order,
-			}
+			})
 		}
 
 		b := block{
@@ -243,11 +585,48 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 			Nonce:         blk.Header.Nonce,
 			StateRoot:     blk.Header.StateRoot,
 			TransRoot:     blk.Header.TransRoot,
+			TxCount:       len(values),
 			Transactions:  txs,
 		}
+		b.Confirmations, b.Finalized = confirmations(latest, blk.Header.Number, h.FinalityDepth)
 
 		blocks[j] = b
 	}
 
 	return web.Respond(ctx, w, blocks, http.StatusOK)
 }
+
+// /////////////////////////////////////////////////////////////////
+
+// pageParams validates and returns the page, size and sort query parameters
+// used to paginate a list, applying the defaults when they aren't provided.
+func pageParams(r *http.Request) (page int, size int, sortBy string, err error) {
+	q := r.URL.Query()
+
+	page = 1
+	if v := q.Get("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, "", fmt.Errorf("invalid page %q, must be 1 or greater", v)
+		}
+	}
+
+	size = defaultPageSize
+	if v := q.Get("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 1 || size > maxPageSize {
+			return 0, 0, "", fmt.Errorf("invalid size %q, must be between 1 and %d", v, maxPageSize)
+		}
+	}
+
+	sortBy = q.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = sortByAccount
+	case sortByAccount, sortByBalance:
+	default:
+		return 0, 0, "", fmt.Errorf("invalid sort %q, must be %s or %s", sortBy, sortByAccount, sortByBalance)
+	}
+
+	return page, size, sortBy, nil
+}
@@ -0,0 +1,283 @@
+package public
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dimfeld/httptreemux/v5"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+	"github.com/adamwoolhether/blockchain/foundation/nameservice"
+)
+
+func Test_NextBlock(t *testing.T) {
+	kennedy, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %v", err)
+	}
+
+	kennedyID := database.PublicKeyToAccountID(kennedy.PublicKey)
+	otherID := database.PublicKeyToAccountID(other.PublicKey)
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	// Only two of the three transactions fit in a block.
+	st, err := state.New(state.Config{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Host:          "localhost:9080",
+		Storage:       storage,
+		Genesis: genesis.Genesis{
+			Date:          time.Now().Add(-24 * time.Hour),
+			ChainID:       1,
+			TransPerBlock: 2,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances: map[string]uint64{
+				string(kennedyID): 1000000,
+				string(otherID):   1000000,
+			},
+		},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewSet(),
+		EvHandler:      func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+
+	txs := []database.Tx{
+		{ChainID: 1, Nonce: 1, FromID: kennedyID, ToID: otherID, Value: 1},
+		{ChainID: 1, Nonce: 2, FromID: kennedyID, ToID: otherID, Value: 1},
+		{ChainID: 1, Nonce: 1, FromID: otherID, ToID: kennedyID, Value: 1, Tip: 50},
+	}
+
+	for _, tx := range txs {
+		pk := kennedy
+		if tx.FromID == otherID {
+			pk = other
+		}
+
+		signedTx, err := tx.Sign(pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign the transaction: %v", err)
+		}
+
+		if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+			t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+		}
+	}
+
+	ns, err := nameservice.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Should be able to construct the name service: %v", err)
+	}
+
+	h := Handlers{State: st, NS: ns}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/tx/next", nil)
+	w := httptest.NewRecorder()
+
+	if err := h.NextBlock(context.Background(), w, r); err != nil {
+		t.Fatalf("Should be able to get the next block transactions: %v", err)
+	}
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Should receive a status code of %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var next []nextTx
+	if err := json.NewDecoder(w.Body).Decode(&next); err != nil {
+		t.Fatalf("Should be able to decode the next block transactions: %v", err)
+	}
+
+	var got []string
+	for i, tx := range next {
+		if tx.Position != i {
+			t.Fatalf("Should report the position of the transaction, got %d, exp %d", tx.Position, i)
+		}
+		got = append(got, tx.Sig)
+	}
+
+	// The endpoint leaves the mempool alone, so mining now picks the same
+	// transactions.
+	if n := st.MempoolLength(); n != len(txs) {
+		t.Fatalf("Should not change the mempool, got %d transactions, exp %d", n, len(txs))
+	}
+
+	block, err := st.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	var exp []string
+	for _, tx := range block.MerkleTree.Values() {
+		exp = append(exp, tx.SignatureString())
+	}
+
+	sort.Strings(got)
+	sort.Strings(exp)
+
+	if len(got) != 2 || !reflect.DeepEqual(got, exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatal("Should return the transactions the miner selects for the next block.")
+	}
+}
+
+func Test_BlocksByAccountTrim(t *testing.T) {
+	kennedy, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %v", err)
+	}
+
+	third, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %v", err)
+	}
+
+	kennedyID := database.PublicKeyToAccountID(kennedy.PublicKey)
+	otherID := database.PublicKeyToAccountID(other.PublicKey)
+	thirdID := database.PublicKeyToAccountID(third.PublicKey)
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Host:          "localhost:9080",
+		Storage:       storage,
+		Genesis: genesis.Genesis{
+			Date:          time.Now().Add(-24 * time.Hour),
+			ChainID:       1,
+			TransPerBlock: 10,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances: map[string]uint64{
+				string(kennedyID): 1000000,
+				string(otherID):   1000000,
+				string(thirdID):   1000000,
+			},
+		},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewSet(),
+		EvHandler:      func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+
+	// Only the first transaction involves kennedy.
+	txs := []struct {
+		tx database.Tx
+		pk *ecdsa.PrivateKey
+	}{
+		{tx: database.Tx{ChainID: 1, Nonce: 1, FromID: kennedyID, ToID: otherID, Value: 1}, pk: kennedy},
+		{tx: database.Tx{ChainID: 1, Nonce: 1, FromID: otherID, ToID: thirdID, Value: 1}, pk: other},
+		{tx: database.Tx{ChainID: 1, Nonce: 1, FromID: thirdID, ToID: otherID, Value: 1}, pk: third},
+	}
+
+	for _, tx := range txs {
+		signedTx, err := tx.tx.Sign(tx.pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign the transaction: %v", err)
+		}
+
+		if err := st.UpsertMempool(database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())); err != nil {
+			t.Fatalf("Should be able to add the transaction to the mempool: %v", err)
+		}
+	}
+
+	if _, err := st.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	ns, err := nameservice.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Should be able to construct the name service: %v", err)
+	}
+
+	h := Handlers{State: st, NS: ns}
+
+	type table struct {
+		name    string
+		query   string
+		trimmed bool
+	}
+
+	tt := []table{
+		{name: "full", query: "", trimmed: false},
+		{name: "untrimmed", query: "?trim=false", trimmed: false},
+		{name: "trimmed", query: "?trim=true", trimmed: true},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/blocks/list/"+string(kennedyID)+tst.query, nil)
+			r = r.WithContext(httptreemux.AddParamsToContext(r.Context(), map[string]string{"account": string(kennedyID)}))
+			w := httptest.NewRecorder()
+
+			if err := h.BlocksByAccount(context.Background(), w, r); err != nil {
+				t.Fatalf("Test %s:\tShould be able to get the blocks: %v", tst.name, err)
+			}
+
+			var blocks []block
+			if err := json.NewDecoder(w.Body).Decode(&blocks); err != nil {
+				t.Fatalf("Test %s:\tShould be able to decode the blocks: %v", tst.name, err)
+			}
+
+			if len(blocks) != 1 {
+				t.Fatalf("Test %s:\tShould receive 1 block, got %d", tst.name, len(blocks))
+			}
+
+			if blocks[0].TxCount != len(txs) {
+				t.Fatalf("Test %s:\tShould report the full transaction count %d, got %d", tst.name, len(txs), blocks[0].TxCount)
+			}
+
+			if !tst.trimmed {
+				if len(blocks[0].Transactions) != len(txs) {
+					t.Fatalf("Test %s:\tShould receive all %d transactions, got %d", tst.name, len(txs), len(blocks[0].Transactions))
+				}
+				return
+			}
+
+			if len(blocks[0].Transactions) != 1 {
+				t.Fatalf("Test %s:\tShould receive 1 transaction, got %d", tst.name, len(blocks[0].Transactions))
+			}
+
+			if tx := blocks[0].Transactions[0]; tx.FromAccount != kennedyID || tx.To != otherID {
+				t.Fatalf("Test %s:\tShould only receive the transaction involving the account, got %s to %s", tst.name, tx.FromAccount, tx.To)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
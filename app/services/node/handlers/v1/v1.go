@@ -25,27 +25,40 @@ type Config struct {
 	WS    websocket.Upgrader
 	NS    *nameservice.NameService
 	Evts  *events.Events
+
+	FinalityDepth uint64
 }
 
 // PublicRoutes binds all the version 1 public routes.
 func PublicRoutes(app *web.App, cfg Config) {
 	pbl := public.Handlers{
-		Log:   cfg.Log,
-		State: cfg.State,
-		WS:    websocket.Upgrader{},
-		NS:    cfg.NS,
-		Evts:  cfg.Evts,
+		Log:           cfg.Log,
+		State:         cfg.State,
+		WS:            websocket.Upgrader{},
+		NS:            cfg.NS,
+		Evts:          cfg.Evts,
+		FinalityDepth: cfg.FinalityDepth,
 	}
 
 	app.Handle(http.MethodGet, version, "/events", pbl.Events)
 	app.Handle(http.MethodGet, version, "/genesis/list", pbl.Genesis)
+	app.Handle(http.MethodGet, version, "/chain/feemarket", pbl.FeeMarket)
 	app.Handle(http.MethodGet, version, "/accounts/list", pbl.Accounts)
 	app.Handle(http.MethodGet, version, "/accounts/list/:account", pbl.Accounts)
+	app.Handle(http.MethodGet, version, "/accounts/:account/at/:block", pbl.AccountAt)
+	app.Handle(http.MethodGet, version, "/accounts/stateroot/:block", pbl.StateRoot)
+	app.Handle(http.MethodGet, version, "/accounts/pending/:account/gaps", pbl.PendingNonces)
+	app.Handle(http.MethodGet, version, "/accounts/earnings", pbl.Earnings)
+	app.Handle(http.MethodGet, version, "/names/:name", pbl.LookupName)
 	app.Handle(http.MethodGet, version, "/blocks/list", pbl.BlocksByAccount)
 	app.Handle(http.MethodGet, version, "/blocks/list/:account", pbl.BlocksByAccount)
+	app.Handle(http.MethodGet, version, "/blocks/:num/merkle", pbl.MerkleTree)
 	app.Handle(http.MethodGet, version, "/tx/uncommitted/list", pbl.Mempool)
 	app.Handle(http.MethodGet, version, "/tx/uncommitted/list/:account", pbl.Mempool)
+	app.Handle(http.MethodGet, version, "/tx/uncommitted/stats", pbl.MempoolStats)
+	app.Handle(http.MethodGet, version, "/tx/next", pbl.NextBlock)
 	app.Handle(http.MethodPost, version, "/tx/submit", pbl.SubmitWalletTransaction)
+	app.Handle(http.MethodGet, version, "/tx/raw/:sig", pbl.RawTransaction)
 	app.Handle(http.MethodPost, version, "/tx/proof/:block/", pbl.SubmitWalletTransaction)
 }
 
@@ -58,9 +71,21 @@ func PrivateRoutes(app *web.App, cfg Config) {
 	}
 
 	app.Handle(http.MethodPost, version, "/node/peers", prv.SubmitPeer)
+	app.Handle(http.MethodPost, version, "/node/tip", prv.SubmitTip)
 	app.Handle(http.MethodGet, version, "/node/status", prv.Status)
+	app.Handle(http.MethodGet, version, "/node/version", prv.Version)
+	app.Handle(http.MethodGet, version, "/node/genesis", prv.Genesis)
+	app.Handle(http.MethodGet, version, "/node/genesis/export", prv.ExportGenesis)
 	app.Handle(http.MethodGet, version, "/node/block/list/:from/:to", prv.BlocksByNumber)
+	app.Handle(http.MethodGet, version, "/node/block/:num/txs", prv.BlockTxs)
+	app.Handle(http.MethodGet, version, "/node/headers/list/:from/:to", prv.HeadersByNumber)
 	app.Handle(http.MethodPost, version, "/node/block/propose", prv.ProposeBlock)
 	app.Handle(http.MethodPost, version, "/node/tx/submit", prv.SubmitNodeTransaction)
 	app.Handle(http.MethodGet, version, "/node/tx/list", prv.Mempool)
+	app.Handle(http.MethodPost, version, "/node/tx/rebroadcast", prv.Rebroadcast)
+	app.Handle(http.MethodGet, version, "/node/rejected", prv.RejectedBlocks)
+	app.Handle(http.MethodPost, version, "/node/mining/cancel", prv.CancelMining)
+	app.Handle(http.MethodGet, version, "/node/mining/timings", prv.MiningTimings)
+	app.Handle(http.MethodPost, version, "/node/resync", prv.Resync)
+	app.Handle(http.MethodPost, version, "/node/resync/:host", prv.Resync)
 }
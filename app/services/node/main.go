@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -20,7 +21,7 @@ import (
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
-	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/worker"
 	"github.com/adamwoolhether/blockchain/foundation/events"
 	"github.com/adamwoolhether/blockchain/foundation/logger"
@@ -59,13 +60,57 @@ func run(log *zap.SugaredLogger) error {
 			ShutdownTimeout time.Duration `conf:"default:20s"`
 			PublicHost      string        `conf:"default:0.0.0.0:8080"`
 			PrivateHost     string        `conf:"default:0.0.0.0:9080"`
+			ExternalHost    string        // Address peers reach this node at when it differs from the private host
+			FinalityDepth   uint64        `conf:"default:6"`
+			MaxRequestBytes int64         `conf:"default:8388608"`
+			MaxEventSubs    int           `conf:"default:100"` // Number of concurrent event subscribers, 0 is unlimited
 		}
 		State struct {
-			Beneficiary    string   `conf:"default:miner1"`
-			DBPath         string   `conf:"default:zblock/miner1/"`
-			SelectStrategy string   `conf:"default:Tip"`
-			OriginPeers    []string `conf:"default:0.0.0.0:9080"`
-			Consensus      string   `conf:"default:POW"` // Change to POA to run Proof of Authority
+			Beneficiary         string        `conf:"default:miner1"`
+			DBPath              string        `conf:"default:zblock/miner1/"`
+			StorageBackend      string        `conf:"default:disk"`  // Change to memory to keep the blocks in memory only
+			CompactBlocks       bool          `conf:"default:false"` // Write blocks as compact json and compact the existing blocks on startup
+			SelectStrategy      string        `conf:"default:Tip"`
+			OriginPeers         []string      `conf:"default:0.0.0.0:9080"`
+			Consensus           string        `conf:"default:POW"` // Change to POA to run Proof of Authority
+			POACycle            time.Duration `conf:"default:12s"`
+			SyncConcurrency     int           `conf:"default:4"`
+			PeerUpdateInterval  time.Duration `conf:"default:1m"`  // How often to ask peers for new peers
+			SyncInterval        time.Duration `conf:"default:10s"` // How often to sync the mempool and blocks with peers
+			OriginRetryInterval time.Duration `conf:"default:15s"` // About how often to retry lost origin peers, jittered by half either way
+			InitialSyncAttempts int           `conf:"default:5"`
+			InitialSyncBackoff  time.Duration `conf:"default:1s"`    // Doubles after every failed attempt
+			RequireInitialSync  bool          `conf:"default:false"` // Fail to start when the initial sync reaches no peers
+			PeerMaxConnsPerHost int           `conf:"default:10"`
+			PeerIdleTimeout     time.Duration `conf:"default:90s"`
+			PeerMaxResponse     int64         `conf:"default:33554432"`
+			MaxBlockRange       int           `conf:"default:500"`    // Largest number of blocks served or requested at once
+			ForkChoice          string        `conf:"default:none"`   // Change to timestamp to resolve competing blocks
+			ValidationMode      string        `conf:"default:strict"` // Change to lenient to skip the softer checks when testing
+			MinTxToMine         int           `conf:"default:1"`
+			MaxMineWait         time.Duration `conf:"default:10s"`
+			MinPeersToMine      int           `conf:"default:0"` // Number of peers needed before mining, the origin node is exempt
+			TxTimeTolerance     time.Duration `conf:"default:1h"`
+			RebroadcastInterval time.Duration `conf:"default:30s"`
+			ReplaceGracePeriod  time.Duration `conf:"default:0"` // How long a pending transaction can be replaced, 0 is no limit
+			LocalTxBoost        uint64        `conf:"default:0"` // Tip added to transactions submitted to this node when picking a block's transactions
+			AccountPruneBlocks  int           `conf:"default:0"` // Number of blocks between pruning empty accounts, 0 disables pruning, requires prune_empty in the genesis
+			SnapshotBlocks      int           `conf:"default:0"` // Number of blocks between snapshots of the accounts, 0 disables snapshots
+			TxFanout            int           `conf:"default:0"` // Number of peers to share a transaction with, 0 shares with all peers
+			MaxClockSkew        time.Duration `conf:"default:30s"`
+			StopMiningOnSkew    bool          `conf:"default:false"`   // Stop mining while the clock is skewed from the peers
+			ReadOnly            bool          `conf:"default:false"`   // Serve queries and relay transactions, but never mine
+			CheckBalance        bool          `conf:"default:false"`   // Reject transactions the sender can't afford along with its pending transactions
+			TipGossip           bool          `conf:"default:false"`   // Notify the peers of every new latest block right away
+			IntegrityInterval   time.Duration `conf:"default:0"`       // How often to check the recent blocks on disk still match, 0 disables the check
+			IntegrityWindow     int           `conf:"default:100"`     // Number of the most recent blocks checked each time
+			IntegrityResync     bool          `conf:"default:false"`   // Resync the chain when the check finds a block that doesn't match
+			ReshareAge          time.Duration `conf:"default:0"`       // How long a pending transaction goes without being shared before it's shared again, 0 disables resharing
+			ReportAttempts      int           `conf:"default:1000000"` // Hashes attempted between mining progress events, 0 is the default
+			HistoryDepth        int           `conf:"default:1000"`    // How many blocks back from the latest block an account can be queried at
+			MempoolShards       int           `conf:"default:1"`       // Number of independently locked maps the mempool is split into by account
+			ShareDedupWindow    time.Duration `conf:"default:10s"`     // How long a shared transaction isn't shared again, 0 shares every time
+			RewardSplits        []string      // List of account:basis-points pairs summing to 10000 to split the mining rewards
 		}
 		NameService struct {
 			Folder string `conf:"default:zblock/accounts/"`
@@ -136,21 +181,47 @@ func run(log *zap.SugaredLogger) error {
 	}
 	peerSet.Add(peer.New(cfg.Web.PrivateHost))
 
-	evts := events.New()
+	// Merge in the peers this node knew about the last time it ran. A node
+	// that can't load its peers can still rediscover them from the origin.
+	peersFile := filepath.Join(cfg.State.DBPath, "peers.json")
+	if err := peerSet.Load(peersFile); err != nil {
+		log.Errorw("startup", "status", "unable to load known peers", "file", peersFile, "ERROR", err)
+	}
+
+	// Remember the known peers for the next time the node starts.
+	defer func() {
+		if err := peerSet.Save(peersFile); err != nil {
+			log.Errorw("shutdown", "status", "unable to save known peers", "file", peersFile, "ERROR", err)
+		}
+	}()
+
+	evts := events.NewWithMax(cfg.Web.MaxEventSubs)
 	ev := func(v string, args ...any) {
 		const websocketPrefix = "viewer:"
 
 		s := fmt.Sprintf(v, args...)
 		log.Infow(s, "traceid", "00000000-0000-0000-0000-000000000000")
-		if strings.HasPrefix(s, websocketPrefix) {
+		if strings.HasPrefix(s, websocketPrefix) || strings.HasPrefix(s, state.EventTxConfirmed) {
 			evts.Send(s)
 		}
 	}
 
-	// Construct disk storage.
-	storage, err := disk.New(cfg.State.DBPath)
+	// Construct the configured storage backend.
+	store, err := storage.New(cfg.State.StorageBackend, storage.Config{
+		DBPath:  cfg.State.DBPath,
+		Compact: cfg.State.CompactBlocks,
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("constructing storage: %w", err)
+	}
+
+	// Rewrite the blocks written before compaction was turned on.
+	if compacter, ok := store.(storage.Compacter); ok && cfg.State.CompactBlocks {
+		reclaimed, err := compacter.Compact()
+		if err != nil {
+			return fmt.Errorf("compacting blocks: %w", err)
+		}
+		log.Infow("startup", "status", "compacted blocks", "reclaimed", reclaimed)
 	}
 
 	// Load genesis file for initial blockchain settings and origin balances.
@@ -159,22 +230,80 @@ func run(log *zap.SugaredLogger) error {
 		return err
 	}
 
+	// Split the rewards for the blocks this node mines, if configured.
+	rewardSplits, err := database.ToRewardSplits(cfg.State.RewardSplits)
+	if err != nil {
+		return fmt.Errorf("parsing reward splits: %w", err)
+	}
+
+	// The origin node is exempt from the minimum number of peers to mine
+	// since the other nodes start by syncing its chain.
+	minPeersToMine := cfg.State.MinPeersToMine
+	for _, host := range cfg.State.OriginPeers {
+		if host == cfg.Web.PrivateHost {
+			minPeersToMine = 0
+		}
+	}
+
 	st, err := state.New(state.Config{
-		BeneficiaryID:  database.PublicKeyToAccountID(privateKey.PublicKey),
-		Host:           cfg.Web.PrivateHost,
-		Storage:        storage,
-		Genesis:        genesis,
-		SelectStrategy: cfg.State.SelectStrategy,
-		KnownPeers:     peerSet,
-		Consensus:      cfg.State.Consensus,
-		EvHandler:      ev,
+		BeneficiaryID:       database.PublicKeyToAccountID(privateKey.PublicKey),
+		Host:                cfg.Web.PrivateHost,
+		Addresses:           []string{cfg.Web.PublicHost, cfg.Web.ExternalHost},
+		Storage:             store,
+		Genesis:             genesis,
+		SelectStrategy:      cfg.State.SelectStrategy,
+		KnownPeers:          peerSet,
+		Consensus:           cfg.State.Consensus,
+		POACycle:            cfg.State.POACycle,
+		SyncConcurrency:     cfg.State.SyncConcurrency,
+		PeerUpdateInterval:  cfg.State.PeerUpdateInterval,
+		SyncInterval:        cfg.State.SyncInterval,
+		OriginPeers:         cfg.State.OriginPeers,
+		OriginRetryInterval: cfg.State.OriginRetryInterval,
+		InitialSyncAttempts: cfg.State.InitialSyncAttempts,
+		InitialSyncBackoff:  cfg.State.InitialSyncBackoff,
+		RequireInitialSync:  cfg.State.RequireInitialSync,
+		PeerMaxConnsPerHost: cfg.State.PeerMaxConnsPerHost,
+		PeerIdleTimeout:     cfg.State.PeerIdleTimeout,
+		PeerMaxResponse:     cfg.State.PeerMaxResponse,
+		MaxBlockRange:       cfg.State.MaxBlockRange,
+		ForkChoice:          cfg.State.ForkChoice,
+		ValidationMode:      cfg.State.ValidationMode,
+		MinTxToMine:         cfg.State.MinTxToMine,
+		MaxMineWait:         cfg.State.MaxMineWait,
+		MinPeersToMine:      minPeersToMine,
+		TxTimeTolerance:     cfg.State.TxTimeTolerance,
+		RebroadcastInterval: cfg.State.RebroadcastInterval,
+		ReplaceGracePeriod:  cfg.State.ReplaceGracePeriod,
+		LocalTxBoost:        cfg.State.LocalTxBoost,
+		AccountPruneBlocks:  cfg.State.AccountPruneBlocks,
+		SnapshotBlocks:      cfg.State.SnapshotBlocks,
+		TxFanout:            cfg.State.TxFanout,
+		RewardSplits:        rewardSplits,
+		MaxClockSkew:        cfg.State.MaxClockSkew,
+		StopMiningOnSkew:    cfg.State.StopMiningOnSkew,
+		ReadOnly:            cfg.State.ReadOnly,
+		CheckBalance:        cfg.State.CheckBalance,
+		TipGossip:           cfg.State.TipGossip,
+		IntegrityInterval:   cfg.State.IntegrityInterval,
+		IntegrityWindow:     cfg.State.IntegrityWindow,
+		IntegrityResync:     cfg.State.IntegrityResync,
+		ReshareAge:          cfg.State.ReshareAge,
+		ReportAttempts:      cfg.State.ReportAttempts,
+		HistoryDepth:        cfg.State.HistoryDepth,
+		MempoolShards:       cfg.State.MempoolShards,
+		Build:               build,
+		ShareDedupWindow:    cfg.State.ShareDedupWindow,
+		EvHandler:           ev,
 	})
 	if err != nil {
 		return err
 	}
 	defer st.Shutdown()
 
-	worker.Run(st, ev)
+	if err := worker.Run(st, ev); err != nil {
+		return fmt.Errorf("starting worker: %w", err)
+	}
 
 	// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 	// Service Start/Stop Support
@@ -199,6 +328,8 @@ func run(log *zap.SugaredLogger) error {
 		State:    st,
 		NS:       ns,
 		Evts:     evts,
+
+		FinalityDepth: cfg.Web.FinalityDepth,
 	})
 
 	// Construct a server to service the requests against the Mux.
@@ -226,6 +357,8 @@ func run(log *zap.SugaredLogger) error {
 		Shutdown: shutdown,
 		Log:      log,
 		State:    st,
+
+		MaxRequestBytes: cfg.Web.MaxRequestBytes,
 	})
 
 	// Construct a server to service the requests against the Mux.
@@ -74,6 +74,30 @@ function connect(wsUrl, httpUrl, nodeID, accountID) {
     };
 }
 
+function connectMining(nodeID) {
+    let socket = new WebSocket(`ws://${window.location.host}/mining/${nodeID}`);
+
+    socket.onmessage = function(event) {
+        let mining = JSON.parse(event.data);
+        let msg = document.getElementById(`first-msg${nodeID}`);
+        let seconds = (mining.elapsed_ms / 1000).toFixed(1);
+        switch (mining.status) {
+            case "started":
+            case "running":
+                msg.innerHTML = `Node ${nodeID}: Mining block ${mining.block_number}<br>Difficulty: ${mining.difficulty}<br>Attempts: ${mining.attempts}<br>Elapsed: ${seconds}s`;
+                break;
+            default:
+                msg.innerHTML = `Node ${nodeID}: Connected`;
+        }
+    };
+
+    socket.onclose = function(event) {
+        setTimeout(function() {
+            connectMining(nodeID);
+        }, 1000);
+    };
+}
+
 function getBlockTable(block) {
     if (block.hash) {
         return `
@@ -309,4 +333,8 @@ function getMempoolTable(t) {
 
 connect('ws://localhost:8080/v1/events', 'http://localhost:9080/v1/node/block/list/1/latest', 1, '0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8');
 connect('ws://localhost:8280/v1/events', 'http://localhost:9280/v1/node/block/list/1/latest', 2, '0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61');
-connect('ws://localhost:8380/v1/events', 'http://localhost:9380/v1/node/block/list/1/latest', 3, '0x616c90073c78ac073D89E750836401a92B16dE7e');
\ No newline at end of file
+connect('ws://localhost:8380/v1/events', 'http://localhost:9380/v1/node/block/list/1/latest', 3, '0x616c90073c78ac073D89E750836401a92B16dE7e');
+
+connectMining(1);
+connectMining(2);
+connectMining(3);
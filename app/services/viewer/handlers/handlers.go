@@ -13,12 +13,19 @@ import (
 	"github.com/adamwoolhether/blockchain/foundation/web"
 )
 
-func UIMux(build string, shutdown chan os.Signal, log *zap.SugaredLogger) (*web.App, error) {
+func UIMux(build string, shutdown chan os.Signal, log *zap.SugaredLogger, nodes []string) (*web.App, error) {
 	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Panics(), mid.Cors("*"))
 
 	// Register the index page for the website.
 	app.Handle(http.MethodGet, "", "/", handler)
 
+	// Register the mining progress of the nodes.
+	mng := mining{
+		log:   log,
+		nodes: nodes,
+	}
+	app.Handle(http.MethodGet, "", "/mining/:node", mng.events)
+
 	// Register the assets.
 	fs := http.FileServer(http.Dir("app/services/viewer/assets"))
 	fs = http.StripPrefix("/assets/", fs)
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	v1 "github.com/adamwoolhether/blockchain/business/web/v1"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/web"
+)
+
+// mining forwards the mining progress of the nodes to the browser.
+type mining struct {
+	log   *zap.SugaredLogger
+	nodes []string
+	ws    websocket.Upgrader
+}
+
+// events subscribes to the events websocket of the specified node and
+// forwards the mining events to the browser. The node is identified by its
+// position in the list of nodes, starting at 1.
+func (m mining) events(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	n, err := strconv.Atoi(web.Param(r, "node"))
+	if err != nil || n < 1 || n > len(m.nodes) {
+		return v1.NewRequestError(fmt.Errorf("unknown node %q", web.Param(r, "node")), http.StatusNotFound)
+	}
+	nodeURL := m.nodes[n-1]
+
+	// Subscribe to the node before the upgrade so a node that can't be
+	// reached can still be reported with an http error.
+	node, _, err := websocket.DefaultDialer.DialContext(ctx, nodeURL, nil)
+	if err != nil {
+		return v1.NewRequestError(fmt.Errorf("subscribing to node %s: %w", nodeURL, err), http.StatusBadGateway)
+	}
+	defer node.Close()
+
+	m.ws.CheckOrigin = func(r *http.Request) bool { return true } // required to bypass CORS issues, this is a security issue!.
+
+	c, err := m.ws.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// The browser doesn't send anything, reading only notices when it goes
+	// away so the subscription to the node can be closed.
+	go func() {
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				node.Close()
+				return
+			}
+		}
+	}()
+
+	// Forward the mining events until the node or the browser goes away.
+	for {
+		_, msg, err := node.ReadMessage()
+		if err != nil {
+			m.log.Infow("mining events", "status", "node subscription closed", "node", nodeURL, "reason", err)
+			return nil
+		}
+
+		if !strings.HasPrefix(string(msg), state.EventMining) {
+			continue
+		}
+
+		event := strings.TrimPrefix(string(msg), state.EventMining)
+		if err := c.WriteMessage(websocket.TextMessage, []byte(event)); err != nil {
+			return nil
+		}
+	}
+}
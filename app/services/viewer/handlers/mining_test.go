@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+)
+
+func Test_MiningEvents(t *testing.T) {
+	const mined = `{"block_number":1,"difficulty":6,"attempts":12000,"elapsed_ms":1500,"status":"running"}`
+
+	// The node sends a mix of events, only the mining event is forwarded.
+	var upgrader websocket.Upgrader
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		for _, msg := range []string{
+			`viewer: block: {"number":1}`,
+			"viewer: PerformPOW: MINING: running",
+			state.EventMining + mined,
+		} {
+			if err := c.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+
+		// Hold the subscription open until the viewer goes away.
+		c.ReadMessage()
+	}))
+	defer node.Close()
+
+	nodeEvents := "ws" + strings.TrimPrefix(node.URL, "http")
+
+	app, err := UIMux("test", make(chan os.Signal, 1), zap.NewNop().Sugar(), []string{nodeEvents})
+	if err != nil {
+		t.Fatalf("Should be able to construct the viewer: %v", err)
+	}
+
+	viewer := httptest.NewServer(app)
+	defer viewer.Close()
+
+	viewerURL := "ws" + strings.TrimPrefix(viewer.URL, "http")
+
+	c, _, err := websocket.DefaultDialer.Dial(viewerURL+"/mining/1", nil)
+	if err != nil {
+		t.Fatalf("Should be able to subscribe to the mining events: %v", err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("Should be able to read the mining event: %v", err)
+	}
+
+	if string(msg) != mined {
+		t.Fatalf("Should forward the mining event, got %s, exp %s", msg, mined)
+	}
+
+	// An unknown node can't be subscribed to.
+	_, resp, err := websocket.DefaultDialer.Dial(viewerURL+"/mining/2", nil)
+	if err == nil {
+		t.Fatal("Should not be able to subscribe to an unknown node.")
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Should get a not found for an unknown node, got %v", resp)
+	}
+}
@@ -47,6 +47,9 @@ func run(log *zap.SugaredLogger) error {
 			IdleTimeout     time.Duration `conf:"default:120s"`
 			ShutdownTimeout time.Duration `conf:"default:20s"`
 		}
+		Node struct {
+			Events []string `conf:"default:ws://localhost:8080/v1/events;ws://localhost:8280/v1/events;ws://localhost:8380/v1/events"`
+		}
 	}{
 		Version: conf.Version{
 			Build: build,
@@ -85,7 +88,7 @@ func run(log *zap.SugaredLogger) error {
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
 	// Load template and bind handlers.
-	uiMux, err := handlers.UIMux(build, shutdown, log)
+	uiMux, err := handlers.UIMux(build, shutdown, log, cfg.Node.Events)
 	if err != nil {
 		return fmt.Errorf("unable to bind handlers: %w", err)
 	}
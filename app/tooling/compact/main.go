@@ -0,0 +1,34 @@
+// This program rewrites the blocks stored in a node's data directory as
+// compact json to reclaim disk space. The contents of the blocks are unchanged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+)
+
+var dbPath string
+
+func init() {
+	flag.StringVar(&dbPath, "db-path", "zblock/miner1/", "path to the node's blocks")
+}
+
+func main() {
+	flag.Parse()
+
+	storage, err := disk.NewWithCompact(dbPath, true)
+	if err != nil {
+		log.Fatalf("opening storage: %s", err)
+	}
+	defer storage.Close()
+
+	reclaimed, err := storage.Compact()
+	if err != nil {
+		log.Fatalf("compacting blocks: %s", err)
+	}
+
+	fmt.Printf("Reclaimed: %d bytes\n", reclaimed)
+}
@@ -0,0 +1,51 @@
+// This program replays the blockchain stored in a node's data directory and
+// verifies the computed state root against the latest block header.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+)
+
+var dbPath string
+
+func init() {
+	flag.StringVar(&dbPath, "db-path", "zblock/miner1/", "path to the node's blocks")
+}
+
+func main() {
+	flag.Parse()
+
+	genesis, err := genesis.Load()
+	if err != nil {
+		log.Fatalf("loading genesis: %s", err)
+	}
+
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		log.Fatalf("opening storage: %s", err)
+	}
+	defer storage.Close()
+
+	report, err := database.VerifyStateRoot(genesis, storage)
+	if err != nil {
+		log.Fatalf("verifying state root: %s", err)
+	}
+
+	fmt.Printf("Latest Block: %d\n", report.Number)
+	fmt.Printf("Computed    : %s\n", report.Computed)
+	fmt.Printf("Header      : %s\n", report.StateRoot)
+
+	if !report.Match {
+		fmt.Println("Result      : MISMATCH")
+		os.Exit(1)
+	}
+
+	fmt.Println("Result      : MATCH")
+}
@@ -480,17 +480,57 @@ function createTransaction() {
         data: null,
     };
 
-    // Convert the transaction to a JSON string and sign that as the data.
-    // The underlying code will apply the Ardan stamp and ID to the signature
-    // thanks to changes made to the ether.js api.
+    // Sign the canonical encoding of the transaction, the same bytes the
+    // node recovers the signer from. The underlying code will apply the
+    // Ardan stamp and ID to the signature thanks to changes made to the
+    // ether.js api. The stamp has no signing domain, so the wallet only works
+    // with networks that don't configure one.
     const wallet = new ethers.Wallet(document.getElementById("from").value);
-    signature = wallet.signMessage(JSON.stringify(tx));
+    signature = wallet.signMessage(signingBytes(tx));
 
     // Since everything is built on promises, wait for the signature to
     // be calculated and then send the transaction to the node.
     signature.then((sig) => sendTran(tx, sig));
 }
 
+// signingBytes returns the canonical encoding of the transaction used as the
+// signing preimage. It must match Tx.SigningBytes in the node. The fields are
+// concatenated in a fixed order, integers in big endian and variable length
+// values prefixed by their length. The wallet doesn't set a deadline or a
+// category, so they are never encoded.
+function signingBytes(tx) {
+    const utf8 = new TextEncoder();
+
+    const uint16 = function(n) {
+        const b = new Uint8Array(2);
+        new DataView(b.buffer).setUint16(0, n);
+        return b;
+    }
+
+    const uint64 = function(n) {
+        const b = new Uint8Array(8);
+        new DataView(b.buffer).setBigUint64(0, BigInt(n));
+        return b;
+    }
+
+    const lengthPrefixed = function(data) {
+        const b = new Uint8Array(4 + data.length);
+        new DataView(b.buffer).setUint32(0, data.length);
+        b.set(data, 4);
+        return b;
+    }
+
+    return ethers.utils.concat([
+        uint16(tx.chain_id),
+        uint64(tx.nonce),
+        lengthPrefixed(utf8.encode(tx.from)),
+        lengthPrefixed(utf8.encode(tx.to)),
+        uint64(tx.value),
+        uint64(tx.tip),
+        lengthPrefixed(tx.data ? ethers.utils.arrayify(tx.data) : new Uint8Array(0)),
+    ]);
+}
+
 // sendTran submits the signed transaction to the node for inclusion.
 function sendTran(tx, sig) {
 
@@ -3,9 +3,11 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
@@ -14,15 +16,35 @@ import (
 )
 
 var (
-	url   string
-	nonce uint64
-	from  string
-	to    string
-	value uint64
-	tip   uint64
-	data  []byte
+	url    string
+	nonce  uint64
+	from   string
+	to     string
+	value  uint64
+	tip    uint64
+	data   []byte
+	domain string
+	wait   bool
+	until  time.Duration
 )
 
+// pollInterval is how often the node is asked if a sent transaction has
+// been confirmed.
+const pollInterval = time.Second
+
+// sentTx represents the part of a transaction in a block that's needed to
+// find a sent transaction.
+type sentTx struct {
+	Sig string `json:"sig"`
+}
+
+// sentBlock represents the part of a block that's needed to find a sent
+// transaction.
+type sentBlock struct {
+	Number       uint64   `json:"number"`
+	Transactions []sentTx `json:"txs"`
+}
+
 var sendCmd = &cobra.Command{
 	Use:   "send",
 	Short: "Send transaction",
@@ -53,6 +75,9 @@ func init() {
 	sendCmd.Flags().Uint64VarP(&value, "value", "v", 0, "Value to send.")
 	sendCmd.Flags().Uint64VarP(&tip, "tip", "c", 0, "Tip to send.")
 	sendCmd.Flags().BytesHexVarP(&data, "data", "d", nil, "Data to send.")
+	sendCmd.Flags().StringVar(&domain, "domain", "", "Signing domain of the network, from the genesis file.")
+	sendCmd.Flags().BoolVarP(&wait, "wait", "w", false, "Wait for the transaction to be confirmed.")
+	sendCmd.Flags().DurationVar(&until, "timeout", time.Minute, "How long to wait for the transaction to be confirmed.")
 }
 
 func runSend(user string) error {
@@ -77,7 +102,7 @@ func runSend(user string) error {
 		return err
 	}
 
-	signedTx, err := tx.Sign(privateKey)
+	signedTx, err := tx.SignWithDomain(domain, privateKey)
 	if err != nil {
 		return err
 	}
@@ -93,5 +118,77 @@ func runSend(user string) error {
 	}
 	defer resp.Body.Close()
 
+	if !wait {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("submitting transaction: status %d", resp.StatusCode)
+	}
+
+	number, err := waitForTx(url, fromAccount, signedTx.SignatureString(), until, pollInterval)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Confirmed in block:", number)
+
 	return nil
 }
+
+// waitForTx polls the node for the blocks of the sending account until the
+// transaction with the specified signature is found in one of them, and
+// returns the number of that block.
+func waitForTx(url string, from database.AccountID, sig string, timeout time.Duration, interval time.Duration) (uint64, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		number, found, err := findTx(url, from, sig)
+		if err != nil {
+			return 0, err
+		}
+
+		if found {
+			return number, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return 0, errors.New("timed out waiting for the transaction to be confirmed")
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// findTx looks for the transaction with the specified signature in the
+// blocks of the sending account.
+func findTx(url string, from database.AccountID, sig string) (uint64, bool, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/v1/blocks/list/%s", url, from))
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return 0, false, nil
+	case http.StatusOK:
+	default:
+		return 0, false, fmt.Errorf("querying blocks: status %d", resp.StatusCode)
+	}
+
+	var blocks []sentBlock
+	if err := json.NewDecoder(resp.Body).Decode(&blocks); err != nil {
+		return 0, false, err
+	}
+
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			if tx.Sig == sig {
+				return block.Number, true, nil
+			}
+		}
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+func Test_WaitForTx(t *testing.T) {
+	const (
+		from = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+		sig  = "0x1f2e3d4c"
+	)
+
+	var polls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/blocks/list/"+string(from) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// The transaction is confirmed on the third poll.
+		switch polls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusNoContent)
+		case 2:
+			json.NewEncoder(w).Encode([]sentBlock{{Number: 1, Transactions: []sentTx{{Sig: "0xaaaa"}}}})
+		default:
+			json.NewEncoder(w).Encode([]sentBlock{
+				{Number: 1, Transactions: []sentTx{{Sig: "0xaaaa"}}},
+				{Number: 2, Transactions: []sentTx{{Sig: "0xbbbb"}, {Sig: sig}}},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	number, err := waitForTx(srv.URL, from, sig, 5*time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Should be able to wait for the transaction: %v", err)
+	}
+
+	if number != 2 {
+		t.Fatalf("Should find the transaction in block 2, got %d", number)
+	}
+
+	if n := polls.Load(); n != 3 {
+		t.Fatalf("Should poll the node 3 times, got %d", n)
+	}
+
+	if _, err := waitForTx(srv.URL, from, "0xcccc", 50*time.Millisecond, 10*time.Millisecond); err == nil {
+		t.Fatal("Should time out waiting for a transaction that is never confirmed.")
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+)
+
+var message string
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a message to prove ownership of the account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		acctName, err := rootCmd.Flags().GetString("account")
+		if err != nil {
+			return err
+		}
+
+		path, err := rootCmd.Flags().GetString("account-path")
+		if err != nil {
+			return err
+		}
+
+		user := keyPath(acctName, path)
+
+		return runSign(user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+	signCmd.Flags().StringVarP(&message, "message", "m", "", "Message to sign.")
+}
+
+func runSign(user string) error {
+	privateKey, err := crypto.LoadECDSA(user)
+	if err != nil {
+		return err
+	}
+
+	sig, err := signature.SignMessage([]byte(message), privateKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(sig)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+)
+
+var (
+	msgSig string
+	signer string
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify a message was signed by the account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerify()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVarP(&message, "message", "m", "", "Message that was signed.")
+	verifyCmd.Flags().StringVarP(&msgSig, "signature", "s", "", "Signature of the message.")
+	verifyCmd.Flags().StringVarP(&signer, "signer", "f", "", "Account that signed the message.")
+}
+
+func runVerify() error {
+	account, err := database.ToAccountID(signer)
+	if err != nil {
+		return err
+	}
+
+	if err := signature.VerifyMessage([]byte(message), msgSig, string(account)); err != nil {
+		return err
+	}
+
+	fmt.Println("signature verified")
+
+	return nil
+}
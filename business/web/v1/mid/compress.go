@@ -0,0 +1,85 @@
+package mid
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/adamwoolhether/blockchain/foundation/web"
+)
+
+// Compress gzip encodes the response body when the client accepts it. Peers
+// poll the status and mempool frequently, so this saves a lot of bandwidth
+// on an active network.
+func Compress() web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			if !acceptsGzip(r) {
+				return handler(ctx, w, r)
+			}
+
+			gw := gzipWriter{ResponseWriter: w}
+			defer gw.close()
+
+			// Call the next handler with the compressing writer.
+			return handler(ctx, &gw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// acceptsGzip reports whether the request lists gzip as an accepted encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, _, _ = strings.Cut(enc, ";")
+		if strings.TrimSpace(enc) == "gzip" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gzipWriter compresses the body written to the response. The gzip stream is
+// only started when there is a body, so responses like a 204 are untouched.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+// WriteHeader marks the response as gzip encoded before sending the headers.
+func (gw *gzipWriter) WriteHeader(statusCode int) {
+	if statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write compresses the data into the response body.
+func (gw *gzipWriter) Write(data []byte) (int, error) {
+	if gw.gz == nil {
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	return gw.gz.Write(data)
+}
+
+// close flushes the remainder of the gzip stream to the response.
+func (gw *gzipWriter) close() {
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
@@ -0,0 +1,43 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	v1Web "github.com/adamwoolhether/blockchain/business/web/v1"
+	"github.com/adamwoolhether/blockchain/foundation/web"
+)
+
+// MaxBytes limits the size of the request body that can be read by the
+// handlers. Requests with a larger body are rejected with a 413 status.
+// A limit of zero or less disables the check.
+func MaxBytes(limit int64) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+		if limit <= 0 {
+			return handler
+		}
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+			// Call the next handler and report a body that was too large.
+			err := handler(ctx, w, r)
+
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return v1Web.NewRequestError(fmt.Errorf("request body too large, limit %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,51 @@
+// Package bloom provides a bloom filter for quickly ruling out that a value
+// is part of a set, like the accounts touched by a block.
+package bloom
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Size is the number of bytes in a filter.
+const Size = 256
+
+// hashes is the number of bits set in the filter for each value.
+const hashes = 3
+
+// Filter represents a bloom filter of 2048 bits. A filter never reports a
+// value it holds is missing, but can report a value it doesn't hold is
+// present. The zero value is an empty filter.
+type Filter [Size]byte
+
+// Add adds the value to the filter.
+func (f *Filter) Add(value []byte) {
+	for _, bit := range positions(value) {
+		f[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Contains reports whether the value may have been added to the filter. A
+// false result means the value was never added.
+func (f *Filter) Contains(value []byte) bool {
+	for _, bit := range positions(value) {
+		if f[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// positions returns the bits in the filter for the value. Each position is
+// taken from a pair of bytes of the hash of the value.
+func positions(value []byte) [hashes]uint {
+	hash := sha256.Sum256(value)
+
+	var bits [hashes]uint
+	for i := range bits {
+		bits[i] = uint(binary.BigEndian.Uint16(hash[i*2:])) % (Size * 8)
+	}
+
+	return bits
+}
@@ -0,0 +1,53 @@
+package bloom_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/bloom"
+)
+
+func Test_NoFalseNegatives(t *testing.T) {
+	const values = 100
+
+	var f bloom.Filter
+	for i := 0; i < values; i++ {
+		f.Add([]byte(fmt.Sprintf("account-%d", i)))
+	}
+
+	for i := 0; i < values; i++ {
+		if v := fmt.Sprintf("account-%d", i); !f.Contains([]byte(v)) {
+			t.Fatalf("Should contain the added value %s", v)
+		}
+	}
+}
+
+func Test_FalsePositives(t *testing.T) {
+	const (
+		values = 20
+		checks = 10000
+	)
+
+	// A block holds a handful of accounts, so most accounts that aren't in
+	// the block should be ruled out.
+	var f bloom.Filter
+	for i := 0; i < values; i++ {
+		f.Add([]byte(fmt.Sprintf("account-%d", i)))
+	}
+
+	var positives int
+	for i := 0; i < checks; i++ {
+		if f.Contains([]byte(fmt.Sprintf("other-%d", i))) {
+			positives++
+		}
+	}
+
+	if rate := float64(positives) / checks; rate > 0.01 {
+		t.Fatalf("Should have a false positive rate under 1%%, got %.2f%%", rate*100)
+	}
+
+	var empty bloom.Filter
+	if empty.Contains([]byte("account-0")) {
+		t.Fatal("Should not contain a value in an empty filter.")
+	}
+}
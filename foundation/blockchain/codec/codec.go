@@ -0,0 +1,125 @@
+// Package codec provides the set of codecs used to validate the structure
+// of the data carried by a transaction.
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Set of codecs that are registered by default.
+const (
+	Opaque = "opaque"
+	JSON   = "json"
+	TLV    = "tlv"
+)
+
+// ErrUnknownCodec is returned when a codec isn't registered.
+var ErrUnknownCodec = errors.New("unknown data codec")
+
+// ErrInvalidData is returned when the data isn't valid for the codec.
+var ErrInvalidData = errors.New("invalid transaction data")
+
+// Validator represents a function that checks the data is properly encoded.
+type Validator func(data []byte) error
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Validator{
+		Opaque: validateOpaque,
+		JSON:   validateJSON,
+		TLV:    validateTLV,
+	}
+)
+
+// Register adds a codec that can be named in the genesis file. Registering
+// an existing codec replaces it.
+func Register(name string, validator Validator) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	codecs[name] = validator
+}
+
+// IsRegistered reports whether the codec can be used to validate data. An
+// empty name is the opaque codec.
+func IsRegistered(name string) bool {
+	if name == "" {
+		return true
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, exists := codecs[name]
+	return exists
+}
+
+// Validate checks the data is properly encoded for the specified codec. An
+// empty name is the opaque codec. Empty data is always valid, since most
+// transactions don't carry any.
+func Validate(name string, data []byte) error {
+	if name == "" {
+		name = Opaque
+	}
+
+	mu.RLock()
+	validator, exists := codecs[name]
+	mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := validator(data); err != nil {
+		return fmt.Errorf("%w for codec %s: %s", ErrInvalidData, name, err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// validateOpaque accepts any data.
+func validateOpaque(data []byte) error {
+	return nil
+}
+
+// validateJSON requires the data to be a single valid JSON value.
+func validateJSON(data []byte) error {
+	if !json.Valid(data) {
+		return errors.New("data is not valid json")
+	}
+
+	return nil
+}
+
+// validateTLV requires the data to be a sequence of tag-length-value
+// records. Each record is a 1 byte tag, a 2 byte big endian length, and
+// then length bytes of value.
+func validateTLV(data []byte) error {
+	const header = 3
+
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < header {
+			return fmt.Errorf("truncated record header at offset %d", offset)
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+1 : offset+header]))
+		offset += header
+
+		if len(data)-offset < length {
+			return fmt.Errorf("record value at offset %d is %d bytes, exp %d", offset, len(data)-offset, length)
+		}
+		offset += length
+	}
+
+	return nil
+}
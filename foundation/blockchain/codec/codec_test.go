@@ -0,0 +1,78 @@
+package codec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/codec"
+)
+
+func Test_Validate(t *testing.T) {
+	type table struct {
+		name    string
+		codec   string
+		data    []byte
+		success bool
+	}
+
+	tt := []table{
+		{name: "opaque binary", codec: codec.Opaque, data: []byte{0xff, 0x00, 0x01}, success: true},
+		{name: "default binary", codec: "", data: []byte{0xff, 0x00, 0x01}, success: true},
+		{name: "json object", codec: codec.JSON, data: []byte(`{"order":12,"item":"apple"}`), success: true},
+		{name: "json array", codec: codec.JSON, data: []byte(`[1,2,3]`), success: true},
+		{name: "json empty", codec: codec.JSON, data: nil, success: true},
+		{name: "json truncated", codec: codec.JSON, data: []byte(`{"order":12`), success: false},
+		{name: "json trailing", codec: codec.JSON, data: []byte(`{"order":12}}`), success: false},
+		{name: "json binary", codec: codec.JSON, data: []byte{0xff, 0x00, 0x01}, success: false},
+		{name: "tlv records", codec: codec.TLV, data: []byte{0x01, 0x00, 0x02, 'h', 'i', 0x02, 0x00, 0x00}, success: true},
+		{name: "tlv truncated header", codec: codec.TLV, data: []byte{0x01, 0x00}, success: false},
+		{name: "tlv truncated value", codec: codec.TLV, data: []byte{0x01, 0x00, 0x05, 'h', 'i'}, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := codec.Validate(tst.codec, tst.data)
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept the data: %v", tst.name, err)
+			}
+			if !tst.success {
+				if !errors.Is(err, codec.ErrInvalidData) {
+					t.Fatalf("Test %s:\tShould reject the data with ErrInvalidData, got %v", tst.name, err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Register(t *testing.T) {
+	if codec.IsRegistered("upper") {
+		t.Fatal("Should not have the codec registered yet.")
+	}
+
+	if err := codec.Validate("upper", []byte("ABC")); !errors.Is(err, codec.ErrUnknownCodec) {
+		t.Fatalf("Should reject an unknown codec, got %v", err)
+	}
+
+	codec.Register("upper", func(data []byte) error {
+		for _, b := range data {
+			if b < 'A' || b > 'Z' {
+				return errors.New("data is not upper case")
+			}
+		}
+		return nil
+	})
+
+	if !codec.IsRegistered("upper") {
+		t.Fatal("Should have the codec registered.")
+	}
+
+	if err := codec.Validate("upper", []byte("ABC")); err != nil {
+		t.Fatalf("Should accept valid data for a registered codec: %v", err)
+	}
+
+	if err := codec.Validate("upper", []byte("abc")); !errors.Is(err, codec.ErrInvalidData) {
+		t.Fatalf("Should reject invalid data for a registered codec, got %v", err)
+	}
+}
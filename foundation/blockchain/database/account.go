@@ -22,6 +22,12 @@ func newAccount(accountID AccountID, balance uint64) Account {
 	}
 }
 
+// isEmpty checks if the account has no balance and has never sent a
+// transaction. An empty account is the same as an account that doesn't exist.
+func (a Account) isEmpty() bool {
+	return a.Balance == 0 && a.Nonce == 0
+}
+
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // AccountID represents an account id that is used to sign transactions and is
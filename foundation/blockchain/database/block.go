@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/merkle"
@@ -17,6 +19,22 @@ import (
 // is two or more blocks ahead of ours.
 var ErrChainForked = errors.New("blockchain forked, start resync")
 
+// ErrStateRootMismatch is returned when a block's state root doesn't match
+// the state of the accounts after applying the block.
+var ErrStateRootMismatch = errors.New("state of the accounts are wrong")
+
+// ErrHashAlgorithmMismatch is returned when a block's header is hashed with
+// a different algorithm than the chain's hash algorithm.
+var ErrHashAlgorithmMismatch = errors.New("block hash algorithm is not the chain's hash algorithm")
+
+// ErrDifficultyMismatch is returned when a block's difficulty doesn't match
+// the difficulty expected for its height.
+var ErrDifficultyMismatch = errors.New("block difficulty is not the expected difficulty")
+
+// DefaultReportAttempts is the number of attempts between the progress events
+// of a POW mining operation when one isn't specified.
+const DefaultReportAttempts = 1_000_000
+
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // BlockData represents what can be serialized to disk and over the network.
@@ -65,6 +83,10 @@ type BlockHeader struct {
 	StateRoot     string    `json:"state_root"`      // Ethereum: Represents a hash of the accounts and their balances.
 	TransRoot     string    `json:"trans_root"`      // Both: Represents the merkle tree root hash for the transactions in this block.
 	Nonce         uint64    `json:"nonce"`           // Both: Value identified to solve the hash solution.
+
+	RewardSplits  []RewardSplit `json:"reward_splits,omitempty"`  // Accounts sharing the credit to the beneficiary, empty gives the beneficiary everything.
+	HashAlgorithm string        `json:"hash_algorithm,omitempty"` // Algorithm used to hash this header, empty is sha256.
+	GenesisHash   string        `json:"genesis_hash,omitempty"`   // Hash of the genesis the chain was started with, only set in block 1.
 }
 
 // Block represents a group of transactions batched together.
@@ -78,12 +100,25 @@ type POWArgs struct {
 	BeneficiaryID AccountID
 	Difficulty    uint16
 	MiningReward  uint64
+	RewardSplits  []RewardSplit
 	PrevBlock     Block
 	StateRoot     string
+	HashAlgorithm string
+	GenesisHash   string // Recorded in the block when it's the first block of the chain.
 	Tx            []BlockTx
+	Attempts      *atomic.Uint64 // Optional, updated with the number of hashes attempted.
+	Timings       *POWTimings    // Optional, updated with the time spent in each phase.
+	ReportEvery   uint64         // Attempts between progress events, 0 is the default.
 	EvHandler     func(v string, args ...any)
 }
 
+// POWTimings represents the time spent in each phase of constructing and
+// mining a block.
+type POWTimings struct {
+	Merkle time.Duration // Constructing the merkle tree of the transactions.
+	POW    time.Duration // Finding a nonce that solves the POW puzzle.
+}
+
 // POW constructs a new Block and performs the work to find a nonce that
 // solves the cryptographic POW puzzel.
 func POW(ctx context.Context, args POWArgs) (Block, error) {
@@ -96,11 +131,16 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 
 	// Construct a merkle tree from the transaction for this block. The root
 	// of this tree will be part of the block to be mined.
+	start := time.Now()
 	tree, err := merkle.NewTree(args.Tx)
 	if err != nil {
 		return Block{}, err
 	}
 
+	if args.Timings != nil {
+		args.Timings.Merkle = time.Since(start)
+	}
+
 	// Construct the block to be mined.
 	block := Block{
 		Header: BlockHeader{
@@ -113,21 +153,42 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 			StateRoot:     args.StateRoot,
 			TransRoot:     tree.RootHex(), //
 			Nonce:         0,              // Will be identified by the POW algorithm.
+			RewardSplits:  args.RewardSplits,
+			HashAlgorithm: args.HashAlgorithm,
 		},
 		MerkleTree: tree,
 	}
 
+	// The first block ties the chain to the genesis it was started with.
+	if block.Header.Number == 1 {
+		block.Header.GenesisHash = args.GenesisHash
+	}
+
+	// Report the progress of mining every so many attempts.
+	reportEvery := args.ReportEvery
+	if reportEvery == 0 {
+		reportEvery = DefaultReportAttempts
+	}
+
 	// Peform the proof of work mining operation.
-	if err := block.performPOW(ctx, args.EvHandler); err != nil {
+	start = time.Now()
+	if err := block.performPOW(ctx, args.Attempts, reportEvery, args.EvHandler); err != nil {
 		return Block{}, err
 	}
 
+	if args.Timings != nil {
+		args.Timings.POW = time.Since(start)
+	}
+
 	return block, nil
 }
 
 // performPOW does the work of mining to find a valid hash for a specified
 // block. Pointer semantics are being used since a nonce is being discovered.
-func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any)) error {
+// The number of attempts made is stored in the counter, if one is provided,
+// so it can be read while mining is running. A progress event is sent every
+// reportEvery attempts.
+func (b *Block) performPOW(ctx context.Context, counter *atomic.Uint64, reportEvery uint64, ev func(v string, args ...any)) error {
 	ev("database: PerformPOW: MINING: started")
 	defer ev("database: PerformPOW: MINING: completed")
 
@@ -150,7 +211,10 @@ func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any))
 	var attempts uint64
 	for {
 		attempts++
-		if attempts%1_000_000 == 0 {
+		if counter != nil {
+			counter.Store(attempts)
+		}
+		if attempts%reportEvery == 0 {
 			ev("viewer: PerformPOW: MINING: running: attempts[%d]", attempts)
 		}
 
@@ -191,11 +255,24 @@ func (b Block) Hash() string {
 	//   to follow the latest set of blocks being produced. The do not validate
 	//   blocks, but can prove a transaction is in a block.
 
-	return signature.Hash(b.Header)
+	// The header is hashed with the algorithm of the chain it was mined for.
+	// An unknown algorithm has no hash, which never solves the work problem.
+	hash, err := signature.HashWith(b.Header.HashAlgorithm, b.Header)
+	if err != nil {
+		return ""
+	}
+
+	return hash
 }
 
 // ValidateBlock takes a block and validates it to be included into the blockchain.
-func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler func(v string, args ...any)) error {
+// The difficulty is what the protocol expects the block to be mined with, and
+// a difficulty of 0 only checks the block against its parent. The hash algorithm
+// is the chain's algorithm for hashing block headers. The state root is the hash
+// of the accounts after applying the block, which the node computes from its
+// own accounts. The softer checks, like the transaction timestamps, only run
+// when strict is set.
+func (b Block) ValidateBlock(previousBlock Block, difficulty uint16, hashAlgorithm string, stateRoot string, accountTxCap uint16, strict bool, evHandler func(v string, args ...any)) error {
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: chain is not forked", b.Header.Number)
 
 	// The node who sent this block has a chain that is two or more blocks ahead
@@ -211,6 +288,20 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 		return fmt.Errorf("block difficulty is less than previous block difficulty, parent %d, block %d", previousBlock.Header.Difficulty, b.Header.Difficulty)
 	}
 
+	if difficulty != 0 {
+		evHandler("database: ValidateBlock: validate: blk[%d]: check: block difficulty is the expected difficulty", b.Header.Number)
+
+		if b.Header.Difficulty != difficulty {
+			return fmt.Errorf("%w, got %d, exp %d", ErrDifficultyMismatch, b.Header.Difficulty, difficulty)
+		}
+	}
+
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: block hash algorithm is the chain's hash algorithm", b.Header.Number)
+
+	if b.Header.HashAlgorithm != hashAlgorithm {
+		return fmt.Errorf("%w, got %q, exp %q", ErrHashAlgorithmMismatch, b.Header.HashAlgorithm, hashAlgorithm)
+	}
+
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: block hash has been solved", b.Header.Number)
 
 	hash := b.Hash()
@@ -249,10 +340,16 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 		// }
 	}
 
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: state root hash does match current database", b.Header.Number)
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: reward splits are valid", b.Header.Number)
+
+	if err := ValidateRewardSplits(b.Header.RewardSplits); err != nil {
+		return err
+	}
+
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: state root hash does match the database after applying the block", b.Header.Number)
 
 	if b.Header.StateRoot != stateRoot {
-		return fmt.Errorf("state of the accounts are wrong, current %s, expected %s", stateRoot, b.Header.StateRoot)
+		return fmt.Errorf("%w, got %s, exp %s", ErrStateRootMismatch, b.Header.StateRoot, stateRoot)
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: merkle root does match transactions", b.Header.Number)
@@ -261,18 +358,69 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 		return fmt.Errorf("merkle root does not match transactions, got %s, exp %s", b.MerkleTree.RootHex(), b.Header.TransRoot)
 	}
 
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: transactions are unique", b.Header.Number)
+
+	sigs := make(map[string]struct{})
+	for _, tx := range b.MerkleTree.Values() {
+		sig := tx.SignatureString()
+		if _, exists := sigs[sig]; exists {
+			return fmt.Errorf("tx[%s]: transaction is in the block more than once", tx)
+		}
+		sigs[sig] = struct{}{}
+	}
+
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: transactions declare the minimum gas units", b.Header.Number)
+
+	for _, tx := range b.MerkleTree.Values() {
+		if err := tx.ValidateGas(); err != nil {
+			return fmt.Errorf("tx[%s]: %w", tx, err)
+		}
+	}
+
+	evHandler("database: ValidateBlock: validate: blk[%d]: check: transactions are not past their deadline", b.Header.Number)
+
+	for _, tx := range b.MerkleTree.Values() {
+		if tx.Expired(b.Header.Number) {
+			return fmt.Errorf("tx[%s]: %w, valid until block %d", tx, ErrTxExpired, tx.ValidUntilBlock)
+		}
+	}
+
+	if strict {
+		evHandler("database: ValidateBlock: validate: blk[%d]: check: transactions are not newer than the block", b.Header.Number)
+
+		for _, tx := range b.MerkleTree.Values() {
+			if tx.TimeStamp > b.Header.TimeStamp {
+				return fmt.Errorf("tx[%s]: %w, tx %d is after block %d", tx, ErrInvalidTimeStamp, tx.TimeStamp, b.Header.TimeStamp)
+			}
+		}
+	}
+
+	if accountTxCap > 0 {
+		evHandler("database: ValidateBlock: validate: blk[%d]: check: accounts don't exceed the transactions per block cap", b.Header.Number)
+
+		counts := make(map[AccountID]int)
+		for _, tx := range b.MerkleTree.Values() {
+			counts[tx.FromID]++
+			if counts[tx.FromID] > int(accountTxCap) {
+				return fmt.Errorf("account %s has more than %d transactions in the block", tx.FromID, accountTxCap)
+			}
+		}
+	}
+
 	return nil
 }
 
 // isHashSolved checks the hash to make sure it complies with
 // the POW rules. We need to match a difficulty number of 0's.
 func isHashSolved(difficulty uint16, hash string) bool {
-	const match = "0x00000000000000000"
+	if len(hash) != 66 || hash[:2] != "0x" {
+		return false
+	}
 
-	if len(hash) != 66 {
+	// A difficulty greater than the length of the hash can never be solved.
+	if int(difficulty) > len(hash)-2 {
 		return false
 	}
 
-	difficulty += 2
-	return hash[:difficulty] == match[:difficulty]
+	return strings.Count(hash[2:2+difficulty], "0") == int(difficulty)
 }
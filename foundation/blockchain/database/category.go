@@ -0,0 +1,59 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Category represents the kind of transaction, so applications can tell
+// transactions apart without parsing the data. The named categories are
+// the ones known to the node, any other value can be used by applications.
+type Category uint8
+
+// Set of named transaction categories.
+const (
+	CategoryNone     Category = 0
+	CategoryPayment  Category = 1
+	CategoryContract Category = 2
+	CategoryMemo     Category = 3
+)
+
+// categoryNames maps the named categories to their names.
+var categoryNames = map[Category]string{
+	CategoryNone:     "none",
+	CategoryPayment:  "payment",
+	CategoryContract: "contract",
+	CategoryMemo:     "memo",
+}
+
+// ParseCategory converts the name or number of a category to a category.
+func ParseCategory(s string) (Category, error) {
+	for category, name := range categoryNames {
+		if s == name {
+			return category, nil
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown category %q", s)
+	}
+
+	return Category(n), nil
+}
+
+// String returns the name of the category, or its number for a category
+// that isn't named.
+func (c Category) String() string {
+	if name, exists := categoryNames[c]; exists {
+		return name
+	}
+
+	return strconv.Itoa(int(c))
+}
+
+// BloomKey returns the value added to the bloom filter of a block holding a
+// transaction of the category. Transactions without a category aren't added.
+func (c Category) BloomKey() []byte {
+	return []byte("category:" + strconv.Itoa(int(c)))
+}
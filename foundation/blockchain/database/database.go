@@ -5,21 +5,33 @@ package database
 import (
 	"errors"
 	"fmt"
+	"math/big"
+	"math/bits"
 	"sort"
 	"sync"
 
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/bloom"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
 )
 
+// ErrBalanceOverflow is returned when crediting an account would overflow
+// the account balance.
+var ErrBalanceOverflow = errors.New("account balance overflow")
+
+// ErrAccountNotFound is returned when an account doesn't exist.
+var ErrAccountNotFound = errors.New("account does not exist")
+
 // Storage interface represents the behavior required to be implemented by any
 // package providing support for reading and writing the blockchain.
 type Storage interface {
 	Write(blockData BlockData) error
 	GetBlock(num uint64) (BlockData, error)
 	ForEach() Iterator
+	ForEachReverse() Iterator
 	Close() error
 	Reset() error
+	Truncate(num uint64) error
 }
 
 // Iterator interface represents the behavior required to be implemented by any
@@ -36,17 +48,61 @@ type Database struct {
 	mu          sync.RWMutex
 	genesis     genesis.Genesis
 	latestBlock Block
+	txCount     uint64
+	totalWork   *big.Int
+	blooms      map[uint64]bloom.Filter
 	accounts    map[AccountID]Account
+	names       map[string]AccountID
 	storage     Storage
+	historyMu   sync.Mutex
+	history     *historyCheckpoint
 }
 
 // New constructs a new database and applies account genesis information and
 // reads/writes the blockchain database on disk if a dbPath is provided.
 func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args ...any)) (*Database, error) {
+	db, err := open(genesis, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to load a chain that was started with a different genesis,
+	// since replaying its blocks on top of this genesis would produce a
+	// ledger that matches neither.
+	if err := db.checkStoredGenesis(); err != nil {
+		return nil, err
+	}
+
+	// Start from the latest snapshot of the accounts when there is one
+	// that can be trusted, so only the blocks after it are replayed.
+	iter := db.loadSnapshot(evHandler)
+
+	// Read the blocks from storage, validating the block values and
+	// cryptographic audit trail. The expected difficulty depends on the
+	// consensus protocol, which the database doesn't know, so it was
+	// checked when the block was first added. So were the softer checks,
+	// which depend on how strict the node was when it accepted the block.
+	validate := func(block Block) error {
+		stateRoot := db.HashStateAfter(block.Header, block.MerkleTree.Values())
+		return block.ValidateBlock(db.latestBlock, 0, genesis.HashAlgorithm, stateRoot, genesis.AccountTxCap, false, evHandler)
+	}
+
+	if err := db.replay(iter, validate); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// open constructs a database holding only the genesis account information.
+func open(genesis genesis.Genesis, storage Storage) (*Database, error) {
 	db := Database{
-		genesis:  genesis,
-		accounts: make(map[AccountID]Account),
-		storage:  storage,
+		genesis:   genesis,
+		totalWork: new(big.Int),
+		blooms:    make(map[uint64]bloom.Filter),
+		accounts:  make(map[AccountID]Account),
+		names:     make(map[string]AccountID),
+		storage:   storage,
 	}
 
 	// Update the database with account balance information from genesis.
@@ -58,19 +114,27 @@ func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args
 		db.accounts[accountID] = newAccount(accountID, balance)
 	}
 
-	// Read all the blocks from storage.
-	iter := db.ForEach()
+	return &db, nil
+}
+
+// replay reads the blocks from the iterator and applies them to the accounts.
+// The check function is called for each block before it is applied, and a
+// nil check applies the blocks without any validation.
+func (db *Database) replay(iter DatabaseIterator, check func(block Block) error) error {
 	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		// Validate the block values and cryptographic audit trail.
-		if err := block.ValidateBlock(db.latestBlock, db.HashState(), evHandler); err != nil {
-			return nil, err
+		if check != nil {
+			if err := check(block); err != nil {
+				return err
+			}
 		}
 
-		// Update the database with the transaction information.
+		// Update the database with the transaction information. Failed
+		// transactions and rewards are skipped the same way they were when
+		// the block was first processed, keeping the replayed state identical.
 		for _, tx := range block.MerkleTree.Values() {
 			db.ApplyTx(block, tx)
 		}
@@ -78,9 +142,12 @@ func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args
 
 		// Update the current latest block.
 		db.latestBlock = block
+		db.txCount += uint64(len(block.MerkleTree.Values()))
+		db.totalWork.Add(db.totalWork, BlockWork(block.Header.Difficulty))
+		db.indexBlock(block)
 	}
 
-	return &db, nil
+	return nil
 }
 
 // Close closes the open blocks database.
@@ -97,7 +164,11 @@ func (db *Database) Reset() error {
 
 	// Initalizes the database back to the genesis information.
 	db.latestBlock = Block{}
+	db.txCount = 0
+	db.totalWork = new(big.Int)
+	db.blooms = make(map[uint64]bloom.Filter)
 	db.accounts = make(map[AccountID]Account)
+	db.names = make(map[string]AccountID)
 	for accountStr, balance := range db.genesis.Balances {
 		accountID, err := ToAccountID(accountStr)
 		if err != nil {
@@ -110,6 +181,29 @@ func (db *Database) Reset() error {
 	return nil
 }
 
+// PruneEmptyAccounts removes the accounts that have no balance and have never
+// sent a transaction, returning the number of accounts removed. Nothing is
+// removed unless the genesis leaves empty accounts out of the state root,
+// since pruning them would otherwise change it.
+func (db *Database) PruneEmptyAccounts() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.genesis.PruneEmpty {
+		return 0
+	}
+
+	var pruned int
+	for accountID, account := range db.accounts {
+		if account.isEmpty() {
+			delete(db.accounts, accountID)
+			pruned++
+		}
+	}
+
+	return pruned
+}
+
 // Remove deletes an account from the database.
 func (db *Database) Remove(accountID AccountID) {
 	db.mu.Lock()
@@ -125,7 +219,7 @@ func (db *Database) Query(accountID AccountID) (Account, error) {
 
 	account, exists := db.accounts[accountID]
 	if !exists {
-		return Account{}, errors.New("account does not exist")
+		return Account{}, ErrAccountNotFound
 	}
 
 	return account, nil
@@ -147,28 +241,74 @@ func (db *Database) Copy() map[AccountID]Account {
 // HashState returns a hash based on the contents of the accounts and
 // their balances. This is added to each block and checked by peers.
 func (db *Database) HashState() string {
-	accounts := make([]Account, 0, len(db.accounts))
+	return signature.Hash(db.SortedAccounts())
+}
+
+// HashStateAfter returns the hash of the accounts as they would be after
+// applying the specified transactions and the mining reward for a block with
+// the specified header, without changing the database. This is the state root
+// for a block with these values.
+func (db *Database) HashStateAfter(header BlockHeader, txs []BlockTx) string {
 	db.mu.RLock()
-	{
-		for _, account := range db.accounts {
-			accounts = append(accounts, account)
-		}
+	defer db.mu.RUnlock()
+
+	accounts := make(map[AccountID]Account, len(db.accounts))
+	for accountID, account := range db.accounts {
+		accounts[accountID] = account
 	}
-	db.mu.RUnlock()
+	names := copyNames(db.names)
+
+	// Failed transactions and rewards are skipped the same way they are
+	// when the block is applied to the database.
+	block := Block{Header: header}
+	for _, tx := range txs {
+		db.applyTx(accounts, names, block, tx)
+	}
+	applyMiningReward(accounts, block)
+
+	return signature.Hash(sortAccounts(accounts, db.genesis.PruneEmpty))
+}
 
-	sort.Sort(byAccount(accounts))
-	return signature.Hash(accounts)
+// SortedAccounts returns a copy of the accounts in the order they are hashed
+// to produce the state root.
+func (db *Database) SortedAccounts() []Account {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.sortedAccounts()
+}
+
+// StateAccounts returns the latest block along with the sorted set of accounts
+// the state root for that block was calculated from. Hashing these accounts
+// reproduces the state root stored in the block header.
+func (db *Database) StateAccounts() (Block, []Account) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.latestBlock, db.sortedAccounts()
 }
 
 // ApplyMiningReward gives the specififed account the mining reward.
-func (db *Database) ApplyMiningReward(block Block) {
+func (db *Database) ApplyMiningReward(block Block) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	account := db.accounts[block.Header.BeneficiaryID]
-	account.Balance += block.Header.MiningReward
+	return applyMiningReward(db.accounts, block)
+}
 
-	db.accounts[block.Header.BeneficiaryID] = account
+// applyMiningReward gives the beneficiary in the specified accounts the
+// mining reward, split across the reward splits in the block header.
+func applyMiningReward(accounts map[AccountID]Account, block Block) error {
+	credits, err := beneficiaryCredits(accounts, block.Header, block.Header.MiningReward)
+	if err != nil {
+		return fmt.Errorf("mining reward invalid, beneficiary %s: %w", block.Header.BeneficiaryID, err)
+	}
+
+	for _, account := range credits {
+		accounts[account.AccountID] = account
+	}
+
+	return nil
 }
 
 // ApplyTx performs the business logic for applying a transaction
@@ -177,72 +317,233 @@ func (db *Database) ApplyTx(block Block, tx BlockTx) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	return db.applyTx(db.accounts, db.names, block, tx)
+}
+
+// applyTx applies the transaction to the specified accounts and name
+// registry. The caller is expected to hold the lock.
+func (db *Database) applyTx(accounts map[AccountID]Account, names map[string]AccountID, block Block, tx BlockTx) error {
+	_, _, err := db.applyTxCredits(accounts, names, block, tx)
+	return err
+}
+
+// applyTxCredits applies the transaction to the specified accounts and name
+// registry, and returns the gas fee and tip credited on behalf of the
+// beneficiary. The tip is only credited when the transaction succeeds. The
+// gas fee is credited even when the transaction fails, unless the genesis
+// policy is to refund the fee of a failed transaction.
+func (db *Database) applyTxCredits(accounts map[AccountID]Account, names map[string]AccountID, block Block, tx BlockTx) (fee uint64, tip uint64, err error) {
+	if !db.genesis.RefundsFailedTx() {
+		return db.chargeTxCredits(accounts, names, block, tx)
+	}
+
+	// Apply the transaction against a copy of the accounts it can touch, and
+	// only keep the changes when it succeeds. A failed transaction is dropped
+	// as if it was never in the block.
+	ids := []AccountID{tx.FromID, tx.ToID, block.Header.BeneficiaryID}
+	for _, split := range block.Header.RewardSplits {
+		ids = append(ids, split.AccountID)
+	}
+
+	touched := make(map[AccountID]Account, len(ids))
+	for _, accountID := range ids {
+		if account, exists := accounts[accountID]; exists {
+			touched[accountID] = account
+		}
+	}
+
+	fee, tip, err = db.chargeTxCredits(touched, names, block, tx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for accountID, account := range touched {
+		accounts[accountID] = account
+	}
+
+	return fee, tip, nil
+}
+
+// chargeTxCredits applies the transaction to the specified accounts and name
+// registry, taking the gas fee even when the transaction fails.
+func (db *Database) chargeTxCredits(accounts map[AccountID]Account, names map[string]AccountID, block Block, tx BlockTx) (fee uint64, tip uint64, err error) {
+	// Transactions are validated for the chain id when they are submitted,
+	// but a block from a peer could still contain one from another chain.
+	if tx.ChainID != db.genesis.ChainID {
+		return 0, 0, fmt.Errorf("transaction invalid, %w, got[%d] exp[%d]", ErrInvalidChainID, tx.ChainID, db.genesis.ChainID)
+	}
+
 	// Capture these accounts from the database.
-	from, exists := db.accounts[tx.FromID]
+	from, exists := accounts[tx.FromID]
 	if !exists {
 		from = newAccount(tx.FromID, 0)
 	}
 
-	to, exists := db.accounts[tx.ToID]
+	to, exists := accounts[tx.ToID]
 	if !exists {
 		to = newAccount(tx.ToID, 0)
 	}
 
-	bnfc, exists := db.accounts[block.Header.BeneficiaryID]
-	if !exists {
-		bnfc = newAccount(block.Header.BeneficiaryID, 0)
-	}
-
 	// The account needs to pay the gas fee regardless. Take the
 	// remaining balance if the account doesn't hold enough for the
-	// full amount of gas. This is the only way to stop bad actors.
-	gasFee := tx.GasPrice * tx.GasUnits
-	if gasFee > from.Balance {
+	// full amount of gas. This is the only way to stop bad actors,
+	// unless the genesis policy refunds the fee of a failed transaction.
+	hi, gasFee := bits.Mul64(tx.GasPrice, tx.GasUnits)
+	if hi != 0 || gasFee > from.Balance {
 		gasFee = from.Balance
 	}
+
+	// CORE NOTE: Balances are uint64 values and crediting an account could
+	// silently wrap the balance back around to zero. Every credit is checked
+	// and the transaction fails before any balances are changed. The fees and
+	// tips for the beneficiary are split across the block's reward splits.
+	credits, err := beneficiaryCredits(accounts, block.Header, gasFee)
+	if err != nil {
+		return 0, 0, fmt.Errorf("transaction invalid, beneficiary gas fee: %w", err)
+	}
+
 	from.Balance -= gasFee
-	bnfc.Balance += gasFee
 
 	// Make sure these changes get applied.
-	db.accounts[tx.FromID] = from
-	db.accounts[block.Header.BeneficiaryID] = bnfc
+	accounts[tx.FromID] = from
+	for _, account := range credits {
+		accounts[account.AccountID] = account
+	}
 
 	// Perform basic accounting checks.
 	{
 		if tx.Nonce != (from.Nonce + 1) {
-			return fmt.Errorf("transaction invalid, wrong nonce, got %d, exp %d", tx.Nonce, from.Nonce+1)
+			return gasFee, 0, fmt.Errorf("transaction invalid, wrong nonce, got %d, exp %d", tx.Nonce, from.Nonce+1)
 		}
 
-		if from.Balance == 0 || from.Balance < (tx.Value+tx.Tip) {
-			return fmt.Errorf("transaction invalid, insufficient funds, bal %d, needed %d", from.Balance, (tx.Value + tx.Tip))
+		needed, err := addBalance(tx.Value, tx.Tip)
+		if err != nil {
+			return gasFee, 0, fmt.Errorf("transaction invalid, value plus tip: %w", err)
+		}
+
+		if from.Balance == 0 || from.Balance < needed {
+			return gasFee, 0, fmt.Errorf("transaction invalid, insufficient funds, bal %d, needed %d", from.Balance, needed)
 		}
 	}
 
+	// A name registration fails when the name can't be registered by the
+	// sending account.
+	name, isNameReg := ParseNameRegistration(tx.Data)
+	if isNameReg {
+		if err := checkNameRegistration(names, name, tx.FromID); err != nil {
+			return gasFee, 0, fmt.Errorf("transaction invalid, %w", err)
+		}
+	}
+
+	// Make sure the credits to the receiving parties don't overflow.
+	toBalance, err := addBalance(to.Balance, tx.Value)
+	if err != nil {
+		return gasFee, 0, fmt.Errorf("transaction invalid, to account %s: %w", tx.ToID, err)
+	}
+
+	credits, err = beneficiaryCredits(accounts, block.Header, tx.Tip)
+	if err != nil {
+		return gasFee, 0, fmt.Errorf("transaction invalid, beneficiary tip: %w", err)
+	}
+
 	// Update the balances between the two parties.
 	from.Balance -= tx.Value
-	to.Balance += tx.Value
+	to.Balance = toBalance
 
 	// Give the beneficiary the tip.
 	from.Balance -= tx.Tip
-	bnfc.Balance += tx.Tip
 
 	// Update the nonce for the next transaction check.
 	from.Nonce = tx.Nonce
 
 	// Update the final changes to these accounts.
-	db.accounts[tx.FromID] = from
-	db.accounts[tx.ToID] = to
-	db.accounts[block.Header.BeneficiaryID] = bnfc
+	accounts[tx.FromID] = from
+	accounts[tx.ToID] = to
+	for _, account := range credits {
+		accounts[account.AccountID] = account
+	}
 
-	return nil
+	if isNameReg {
+		names[name] = tx.FromID
+	}
+
+	return gasFee, tx.Tip, nil
 }
 
-// UpdateLatestBlock provides safe access to update the latest block.
+// UpdateLatestBlock provides safe access to update the latest block. The
+// block is expected to be the next block in the chain, its transactions are
+// added to the transaction count.
 func (db *Database) UpdateLatestBlock(block Block) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	db.latestBlock = block
+	db.txCount += uint64(len(block.MerkleTree.Values()))
+	db.totalWork.Add(db.totalWork, BlockWork(block.Header.Difficulty))
+	db.indexBlock(block)
+}
+
+// AccountBloom returns the bloom filter of the accounts sending or receiving
+// a transaction in the specified block, along with the categories of those
+// transactions. There is no filter for the blocks
+// before a snapshot the database was started from, since those blocks were
+// never read.
+func (db *Database) AccountBloom(num uint64) (bloom.Filter, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	filter, exists := db.blooms[num]
+	return filter, exists
+}
+
+// indexBlock adds a bloom filter of the accounts sending or receiving a
+// transaction in the block, and the categories of those transactions. A
+// block replacing one at the same height replaces its filter. The caller is
+// expected to hold the lock.
+func (db *Database) indexBlock(block Block) {
+	var filter bloom.Filter
+	for _, tx := range block.MerkleTree.Values() {
+		filter.Add([]byte(tx.FromID))
+		filter.Add([]byte(tx.ToID))
+
+		if tx.Category != CategoryNone {
+			filter.Add(tx.Category.BloomKey())
+		}
+	}
+
+	db.blooms[block.Header.Number] = filter
+}
+
+// TxCount returns the number of transactions in the blocks up to and
+// including the latest block.
+func (db *Database) TxCount() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.txCount
+}
+
+// CORE NOTE: The total work is the expected number of hashes it took to mine
+// the chain. The difficulty is the number of leading zeros in the hex hash,
+// so each step of difficulty takes 16 times the hashes. Summing the raw
+// difficulty would undercount a chain mined at a retargeted difficulty, so
+// the work of every block is 16^difficulty, kept in a big integer since it
+// overflows a uint64 at the higher difficulties. That makes the total work
+// usable for comparing chains in a fork choice rule.
+
+// BlockWork returns the expected number of hashes to mine a block at the
+// specified difficulty.
+func BlockWork(difficulty uint16) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), 4*uint(difficulty))
+}
+
+// TotalWork returns the expected number of hashes to mine the blocks up to
+// and including the latest block.
+func (db *Database) TotalWork() *big.Int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return new(big.Int).Set(db.totalWork)
 }
 
 // LatestBlock returns the latest block.
@@ -264,6 +565,12 @@ func (db *Database) ForEach() DatabaseIterator {
 	return DatabaseIterator{iterator: db.storage.ForEach()}
 }
 
+// ForEachReverse returns an iterator to walk through all the blocks
+// starting with the latest block and ending with block number 1.
+func (db *Database) ForEachReverse() DatabaseIterator {
+	return DatabaseIterator{iterator: db.storage.ForEachReverse()}
+}
+
 // GetBlock searches the blockchain on disk to locate and return the
 // contents of the specified block by number.
 func (db *Database) GetBlock(num uint64) (Block, error) {
@@ -275,6 +582,46 @@ func (db *Database) GetBlock(num uint64) (Block, error) {
 	return ToBlock(blockData)
 }
 
+// sortedAccounts returns a copy of the accounts sorted by account id. The
+// caller is expected to hold the lock.
+//
+// CORE NOTE: When the genesis enables pruning, empty accounts are left out
+// so the state root is the same whether an empty account is in the database
+// or not. This allows nodes to prune empty accounts without breaking
+// consensus. The switch lives in the genesis because it changes the state
+// root of every block, so chains started without it keep hashing the empty
+// accounts and their existing blocks still verify.
+func (db *Database) sortedAccounts() []Account {
+	return sortAccounts(db.accounts, db.genesis.PruneEmpty)
+}
+
+// sortAccounts returns the accounts sorted by account id, leaving out the
+// empty accounts when skipEmpty is set.
+func sortAccounts(accounts map[AccountID]Account, skipEmpty bool) []Account {
+	sorted := make([]Account, 0, len(accounts))
+	for _, account := range accounts {
+		if skipEmpty && account.isEmpty() {
+			continue
+		}
+		sorted = append(sorted, account)
+	}
+
+	sort.Sort(byAccount(sorted))
+
+	return sorted
+}
+
+// addBalance adds the amount to the balance and returns an error
+// if the result would overflow a uint64.
+func addBalance(balance uint64, amount uint64) (uint64, error) {
+	sum, carry := bits.Add64(balance, amount, 0)
+	if carry != 0 {
+		return 0, ErrBalanceOverflow
+	}
+
+	return sum, nil
+}
+
 // /////////////////////////////////////////////////////////////////
 
 // DatabaseIterator provides support for iterating over the blocks in the
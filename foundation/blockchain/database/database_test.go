@@ -1,13 +1,26 @@
 package database_test
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
 )
 
 func Test_Transactions(t *testing.T) {
@@ -158,8 +171,2087 @@ func TestNonceValidation(t *testing.T) {
 	}
 }
 
+func Test_BalanceOverflow(t *testing.T) {
+	const (
+		fromID  = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		toID    = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+		minerID = database.AccountID("0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8")
+	)
+
+	balances := map[string]uint64{
+		string(fromID):  1000,
+		string(toID):    math.MaxUint64 - 10,
+		string(minerID): math.MaxUint64 - 10,
+	}
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: balances}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  fromID,
+		ToID:    toID,
+		Value:   100,
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: minerID, MiningReward: 100}}
+
+	if err := db.ApplyTx(block, blockTx); !errors.Is(err, database.ErrBalanceOverflow) {
+		t.Fatalf("Should fail the transaction with a balance overflow, got: %v", err)
+	}
+
+	if err := db.ApplyMiningReward(block); !errors.Is(err, database.ErrBalanceOverflow) {
+		t.Fatalf("Should fail the mining reward with a balance overflow, got: %v", err)
+	}
+
+	for account, info := range db.Copy() {
+		if info.Balance != balances[string(account)] {
+			t.Errorf("Should not change the balance for %s.", account)
+			t.Logf("got: %d", info.Balance)
+			t.Logf("exp: %d", balances[string(account)])
+		}
+	}
+}
+
+func Test_FailedTxFee(t *testing.T) {
+	const (
+		fromID  = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		toID    = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+		minerID = database.AccountID("0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8")
+		gas     = 15
+	)
+
+	type table struct {
+		name     string
+		policy   string
+		fromBal  uint64
+		minerBal uint64
+	}
+
+	tt := []table{
+		{name: "default", policy: "", fromBal: 1000 - gas, minerBal: gas},
+		{name: "charge", policy: genesis.FailedTxCharge, fromBal: 1000 - gas, minerBal: gas},
+		{name: "refund", policy: genesis.FailedTxRefund, fromBal: 1000, minerBal: 0},
+	}
+
+	for _, tst := range tt {
+		ev := func(v string, args ...any) {}
+
+		gen := genesis.Genesis{
+			ChainID:     1,
+			Difficulty:  1,
+			FailedTxFee: tst.policy,
+			Balances:    map[string]uint64{string(fromID): 1000},
+		}
+
+		storage, err := memory.New()
+		if err != nil {
+			t.Fatalf("Test %s:\tShould be able to construct memory storage: %v", tst.name, err)
+		}
+
+		db, err := database.New(gen, storage, ev)
+		if err != nil {
+			t.Fatalf("Test %s:\tShould be able to open database: %v", tst.name, err)
+		}
+
+		// The transaction pays its gas fee, but fails for insufficient funds.
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   1,
+			FromID:  fromID,
+			ToID:    toID,
+			Value:   5000,
+		}
+
+		blockTx, err := sign(tx, gas)
+		if err != nil {
+			t.Fatalf("Test %s:\tShould be able to sign transaction: %v", tst.name, err)
+		}
+
+		header := database.BlockHeader{BeneficiaryID: minerID}
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: minerID,
+			Difficulty:    gen.Difficulty,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashStateAfter(header, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Test %s:\tShould be able to mine the block: %v", tst.name, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Test %s:\tShould be able to write the block: %v", tst.name, err)
+		}
+		db.UpdateLatestBlock(block)
+
+		if err := db.ApplyTx(block, blockTx); err == nil {
+			t.Fatalf("Test %s:\tShould fail the transaction for insufficient funds.", tst.name)
+		}
+		db.ApplyMiningReward(block)
+
+		accounts := db.Copy()
+		if bal := accounts[fromID].Balance; bal != tst.fromBal {
+			t.Logf("Test %s:\tgot: %d", tst.name, bal)
+			t.Logf("Test %s:\texp: %d", tst.name, tst.fromBal)
+			t.Fatalf("Test %s:\tShould have the expected balance for the from account.", tst.name)
+		}
+
+		if bal := accounts[minerID].Balance; bal != tst.minerBal {
+			t.Logf("Test %s:\tgot: %d", tst.name, bal)
+			t.Logf("Test %s:\texp: %d", tst.name, tst.minerBal)
+			t.Fatalf("Test %s:\tShould have the expected balance for the miner.", tst.name)
+		}
+
+		if _, exists := accounts[toID]; exists {
+			t.Fatalf("Test %s:\tShould not create the to account.", tst.name)
+		}
+
+		// Replaying the chain must apply the same policy.
+		report, err := database.VerifyStateRoot(gen, storage)
+		if err != nil {
+			t.Fatalf("Test %s:\tShould be able to verify the state root: %v", tst.name, err)
+		}
+
+		if !report.Match || report.Computed != db.HashState() {
+			t.Logf("Test %s:\tgot: %s", tst.name, report.Computed)
+			t.Logf("Test %s:\texp: %s", tst.name, db.HashState())
+			t.Fatalf("Test %s:\tShould compute the same state root on replay.", tst.name)
+		}
+	}
+}
+
+func Test_SigningBytes(t *testing.T) {
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   5,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   100,
+		Tip:     10,
+		Data:    []byte("hello"),
+	}
+
+	// This is the golden signing preimage for the transaction above. If this
+	// test fails, every existing transaction signature has been invalidated.
+	const golden = "000100000000000000050000002a3078646436423937326666636336333161363243414531424239643830623766663432396338656241340000002a3078463031383133453442383565313738413833653239423845376246323642443833306132356633320000000000000064000000000000000a0000000568656c6c6f"
+
+	got := hex.EncodeToString(tx.SigningBytes())
+	if got != golden {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", golden)
+		t.Fatalf("Should get back the golden signing preimage.")
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := blockTx.SignedTx.Validate(1, ""); err != nil {
+		t.Fatalf("Should be able to validate the signature over the signing preimage: %v", err)
+	}
+}
+
+func Test_Category(t *testing.T) {
+	type table struct {
+		name     string
+		value    string
+		category database.Category
+		fail     bool
+	}
+
+	tt := []table{
+		{name: "named", value: "payment", category: database.CategoryPayment},
+		{name: "none", value: "none", category: database.CategoryNone},
+		{name: "number", value: "3", category: database.CategoryMemo},
+		{name: "unnamed number", value: "200", category: database.Category(200)},
+		{name: "unknown name", value: "refund", fail: true},
+		{name: "out of range", value: "256", fail: true},
+	}
+
+	for _, tst := range tt {
+		category, err := database.ParseCategory(tst.value)
+		if (err != nil) != tst.fail {
+			t.Fatalf("Test %s:\tShould get an error only for an invalid category, got %v", tst.name, err)
+		}
+
+		if category != tst.category {
+			t.Fatalf("Test %s:\tShould parse the category, got %d, exp %d", tst.name, category, tst.category)
+		}
+	}
+
+	// The category is signed, so it can't be changed without invalidating
+	// the signature.
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 10, Category: database.CategoryPayment}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := blockTx.SignedTx.Validate(1, ""); err != nil {
+		t.Fatalf("Should be able to validate the signature with the category: %v", err)
+	}
+
+	blockTx.Category = database.CategoryMemo
+	if err := blockTx.SignedTx.Validate(1, ""); err == nil {
+		t.Fatal("Should not be able to validate the signature with a changed category.")
+	}
+}
+
+func Test_SigningDomain(t *testing.T) {
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   100,
+	}
+
+	signedTx, err := tx.SignWithDomain("A", pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := signedTx.Validate(1, "A"); err != nil {
+		t.Fatalf("Should be able to validate the transaction under the same domain: %v", err)
+	}
+
+	// The same chain id on a network with another domain must not accept
+	// the transaction.
+	for _, domain := range []string{"B", ""} {
+		if err := signedTx.Validate(1, domain); err == nil {
+			t.Fatalf("Should not be able to validate the transaction under domain %q.", domain)
+		}
+	}
+}
+
+func Test_HighDifficulty(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	for _, difficulty := range []uint16{17, 18, 63, 64, 1000} {
+		block := database.Block{
+			Header: database.BlockHeader{
+				Number:     1,
+				Difficulty: difficulty,
+			},
+		}
+
+		// This should return an error and not panic for difficulties larger
+		// than the original 17 character match string.
+		if err := block.ValidateBlock(database.Block{}, difficulty, "", "", 0, true, ev); err == nil {
+			t.Fatalf("Should not be able to validate an unsolved block with difficulty %d.", difficulty)
+		}
+	}
+}
+
+func Test_ReportAttempts(t *testing.T) {
+	const reportEvery = 10
+
+	var reports []uint64
+	var attempts uint64
+	ev := func(v string, args ...any) {
+		switch {
+		case strings.HasPrefix(v, "viewer: PerformPOW: MINING: running: attempts"):
+			reports = append(reports, args[0].(uint64))
+		case strings.HasPrefix(v, "database: PerformPOW: MINING: attempts"):
+			attempts = args[0].(uint64)
+		}
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	_, err = database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    3,
+		Tx:            []database.BlockTx{blockTx},
+		ReportEvery:   reportEvery,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	if exp := int(attempts / reportEvery); len(reports) != exp {
+		t.Logf("got: %d", len(reports))
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should report the progress every %d of the %d attempts.", reportEvery, attempts)
+	}
+
+	for i, report := range reports {
+		if exp := uint64(i+1) * reportEvery; report != exp {
+			t.Fatalf("Should report the progress at attempt %d, got %d", exp, report)
+		}
+	}
+}
+
+func Test_DifficultyMismatch(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   1,
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	blocks := make(map[uint16]database.Block)
+	for _, difficulty := range []uint16{1, 2} {
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Difficulty:    difficulty,
+			StateRoot:     "stateroot",
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block with difficulty %d: %v", difficulty, err)
+		}
+		blocks[difficulty] = block
+	}
+
+	type table struct {
+		name     string
+		mined    uint16
+		expected uint16
+		success  bool
+	}
+
+	tt := []table{
+		{name: "match", mined: 2, expected: 2, success: true},
+		{name: "above expected", mined: 2, expected: 1, success: false},
+		{name: "below expected", mined: 1, expected: 2, success: false},
+		{name: "parent only", mined: 1, expected: 0, success: true},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := blocks[tst.mined].ValidateBlock(database.Block{}, tst.expected, "", "stateroot", 0, true, ev)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Should be able to validate block with difficulty %d: %v", tst.mined, err)
+				}
+			default:
+				if !errors.Is(err, database.ErrDifficultyMismatch) {
+					t.Fatalf("Should not be able to validate block with difficulty %d, exp %d: got %v", tst.mined, tst.expected, err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_HashAlgorithm(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   1,
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	algorithms := []string{"", signature.HashSHA256, signature.HashKeccak256}
+
+	for _, algorithm := range algorithms {
+		f := func(t *testing.T) {
+			block, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+				Difficulty:    2,
+				StateRoot:     "stateroot",
+				HashAlgorithm: algorithm,
+				Tx:            []database.BlockTx{blockTx},
+				EvHandler:     ev,
+			})
+			if err != nil {
+				t.Fatalf("Should be able to mine block with hash algorithm %q: %v", algorithm, err)
+			}
+
+			hash, err := signature.HashWith(algorithm, block.Header)
+			if err != nil {
+				t.Fatalf("Should be able to hash the block header: %v", err)
+			}
+
+			if block.Hash() != hash {
+				t.Logf("got: %s", block.Hash())
+				t.Logf("exp: %s", hash)
+				t.Fatalf("Should hash the block with hash algorithm %q.", algorithm)
+			}
+
+			if err := block.ValidateBlock(database.Block{}, 2, algorithm, "stateroot", 0, true, ev); err != nil {
+				t.Fatalf("Should be able to validate block with hash algorithm %q: %v", algorithm, err)
+			}
+
+			for _, other := range algorithms {
+				if other == algorithm {
+					continue
+				}
+
+				err := block.ValidateBlock(database.Block{}, 2, other, "stateroot", 0, true, ev)
+				if !errors.Is(err, database.ErrHashAlgorithmMismatch) {
+					t.Fatalf("Should not be able to validate block with hash algorithm %q on a %q chain, got %v", algorithm, other, err)
+				}
+			}
+		}
+
+		name := algorithm
+		if name == "" {
+			name = "default"
+		}
+		t.Run(name, f)
+	}
+}
+
+func Test_AccountTxCap(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	var txs []database.BlockTx
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   1,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		txs = append(txs, blockTx)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Difficulty:    1,
+		StateRoot:     "stateroot",
+		Tx:            txs,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	type table struct {
+		name    string
+		cap     uint16
+		success bool
+	}
+
+	tt := []table{
+		{name: "no cap", cap: 0, success: true},
+		{name: "under cap", cap: 2, success: false},
+		{name: "at cap", cap: 3, success: true},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := block.ValidateBlock(database.Block{}, 1, "", "stateroot", tst.cap, true, ev)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Should be able to validate block with cap %d: %v", tst.cap, err)
+				}
+			default:
+				if err == nil {
+					t.Fatalf("Should not be able to validate block with cap %d.", tst.cap)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_ApplyTxChainID(t *testing.T) {
+	db, err := database.New(genesis.Genesis{ChainID: 1}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 2,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   1,
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"}}
+	if err := db.ApplyTx(block, blockTx); !errors.Is(err, database.ErrInvalidChainID) {
+		t.Fatalf("Should not be able to apply a transaction for another chain, got %v", err)
+	}
+}
+
+func Test_PruneEmptyAccounts(t *testing.T) {
+	balances := map[string]uint64{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 100,
+	}
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, PruneEmpty: true, Balances: balances}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Sending no value with no gas to new accounts leaves both the
+	// receiving account and the beneficiary empty.
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"}}
+	if err := db.ApplyTx(block, blockTx); err != nil {
+		t.Fatalf("Should be able to apply transaction: %v", err)
+	}
+
+	if n := len(db.Copy()); n != 3 {
+		t.Fatalf("Should have the sender, receiver and beneficiary accounts, got %d", n)
+	}
+
+	stateRoot := db.HashState()
+
+	if pruned := db.PruneEmptyAccounts(); pruned != 2 {
+		t.Fatalf("Should prune the 2 empty accounts, got %d", pruned)
+	}
+
+	if _, err := db.Query("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"); err != nil {
+		t.Fatalf("Should keep the sender account: %v", err)
+	}
+
+	if got := db.HashState(); got != stateRoot {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", stateRoot)
+		t.Fatal("Should have the same state root after pruning empty accounts.")
+	}
+}
+
+func Test_KeepEmptyAccounts(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Sending no value with no gas to a new account leaves the receiving
+	// account empty, which a chain without pruning hashes into the root.
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	header := database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: header.BeneficiaryID,
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		PrevBlock:     db.LatestBlock(),
+		GenesisHash:   gen.NetworkID(),
+		StateRoot:     db.HashStateAfter(header, []database.BlockTx{blockTx}),
+		Tx:            []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	if err := db.Write(block); err != nil {
+		t.Fatalf("Should be able to write block: %v", err)
+	}
+
+	if pruned := db.PruneEmptyAccounts(); pruned != 0 {
+		t.Fatalf("Should not prune accounts without the genesis switch, got %d", pruned)
+	}
+
+	// The chain loads and verifies with the state root it was mined with.
+	db, err = database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to reload the chain: %v", err)
+	}
+
+	if got := db.LatestBlock().Header.StateRoot; got != db.HashState() {
+		t.Logf("got: %s", db.HashState())
+		t.Logf("exp: %s", got)
+		t.Fatal("Should hash the empty accounts into the state root.")
+	}
+
+	report, err := database.VerifyStateRoot(gen, storage)
+	if err != nil {
+		t.Fatalf("Should be able to verify the state root: %v", err)
+	}
+
+	if !report.Match {
+		t.Fatal("Should match the state root of a chain without pruning.")
+	}
+
+	// Turning the switch on for the same chain changes the state root.
+	gen.PruneEmpty = true
+	report, err = database.VerifyStateRoot(gen, storage)
+	if err != nil {
+		t.Fatalf("Should be able to verify the state root: %v", err)
+	}
+
+	if report.Match {
+		t.Fatal("Should not match the state root once empty accounts are left out.")
+	}
+}
+
+func Test_VerifyStateRoot(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Mine a known-good chain of three blocks.
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashStateAfter(database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", nonce, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", nonce, err)
+		}
+		db.UpdateLatestBlock(block)
+
+		if err := db.ApplyTx(block, blockTx); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+		db.ApplyMiningReward(block)
+	}
+
+	report, err := database.VerifyStateRoot(gen, storage)
+	if err != nil {
+		t.Fatalf("Should be able to verify the state root: %v", err)
+	}
+
+	if !report.Match {
+		t.Logf("got: %s", report.Computed)
+		t.Logf("exp: %s", report.StateRoot)
+		t.Fatal("Should match the state root of the known-good chain.")
+	}
+
+	if report.Number != 3 {
+		t.Fatalf("Should verify up to block 3, got %d", report.Number)
+	}
+
+	if report.Computed != db.HashState() {
+		t.Fatal("Should compute the same state root as the database.")
+	}
+
+	// Tamper with the mining reward of the first block in storage.
+	var blocks []database.BlockData
+	for num := uint64(1); num <= 3; num++ {
+		blockData, err := storage.GetBlock(num)
+		if err != nil {
+			t.Fatalf("Should be able to get block %d: %v", num, err)
+		}
+		blocks = append(blocks, blockData)
+	}
+	blocks[0].Header.MiningReward++
+
+	storage.Reset()
+	for _, blockData := range blocks {
+		if err := storage.Write(blockData); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", blockData.Header.Number, err)
+		}
+	}
+
+	report, err = database.VerifyStateRoot(gen, storage)
+	if err != nil {
+		t.Fatalf("Should be able to verify the state root: %v", err)
+	}
+
+	if report.Match {
+		t.Fatal("Should not match the state root of the tampered chain.")
+	}
+}
+
+func Test_AccountAt(t *testing.T) {
+	const depth = 3
+
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	memStorage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+	storage := &countingStorage{Storage: memStorage}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Mine a chain of ten blocks, recording the receiving account after
+	// each one.
+	const toID = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	known := []database.Account{{}}
+	for nonce := uint64(1); nonce <= 10; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    toID,
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		header := database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: header.BeneficiaryID,
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			GenesisHash:   gen.NetworkID(),
+			StateRoot:     db.HashStateAfter(header, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", nonce, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", nonce, err)
+		}
+		db.UpdateLatestBlock(block)
+
+		if err := db.ApplyTx(block, blockTx); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+		db.ApplyMiningReward(block)
+
+		account, err := db.Query(toID)
+		if err != nil {
+			t.Fatalf("Should be able to query account: %v", err)
+		}
+		known = append(known, account)
+	}
+
+	// The first query replays the chain and sets the checkpoint at the
+	// oldest block within the depth.
+	for number := uint64(7); number <= 10; number++ {
+		account, err := db.AccountAt(toID, number, depth)
+		if err != nil {
+			t.Fatalf("Should be able to query the account at block %d: %v", number, err)
+		}
+
+		if account != known[number] {
+			t.Logf("got: %+v", account)
+			t.Logf("exp: %+v", known[number])
+			t.Fatalf("Should match the known account at block %d.", number)
+		}
+	}
+
+	// A query at the latest block only reads the checkpoint's block and the
+	// blocks after it.
+	storage.gets, storage.walks = 0, 0
+	if _, err := db.AccountAt(toID, 10, depth); err != nil {
+		t.Fatalf("Should be able to query the account at block 10: %v", err)
+	}
+
+	if storage.walks != 0 {
+		t.Fatal("Should not replay the chain from genesis.")
+	}
+
+	if storage.gets > depth+1 {
+		t.Fatalf("Should only read the blocks within the depth, read %d", storage.gets)
+	}
+}
+
+func Test_TotalWork(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	if work := db.TotalWork(); work.Sign() != 0 {
+		t.Fatalf("Should have no total work without blocks, got %s", work)
+	}
+
+	// Each block takes 16 times the work of a block one difficulty lower.
+	sum := new(big.Int)
+	for i, difficulty := range []uint16{1, 1, 2} {
+		nonce := uint64(i + 1)
+
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+			Difficulty:    difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashStateAfter(database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", nonce, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", nonce, err)
+		}
+
+		before := db.TotalWork()
+
+		db.UpdateLatestBlock(block)
+
+		if err := db.ApplyTx(block, blockTx); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+		db.ApplyMiningReward(block)
+
+		sum.Add(sum, big.NewInt(1<<(4*difficulty)))
+
+		if work := db.TotalWork(); work.Cmp(before) <= 0 || work.Cmp(sum) != 0 {
+			t.Logf("got: %s", work)
+			t.Logf("exp: %s", sum)
+			t.Fatalf("Should increase the total work by the work of block %d.", nonce)
+		}
+	}
+
+	// Replaying the chain from storage reaches the same total work.
+	replay, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to reopen database: %v", err)
+	}
+
+	if work := replay.TotalWork(); work.Cmp(sum) != 0 {
+		t.Logf("got: %s", work)
+		t.Logf("exp: %s", sum)
+		t.Fatal("Should replay the total work across the chain.")
+	}
+}
+
+func Test_GenesisChanged(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 10}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashStateAfter(database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}, []database.BlockTx{blockTx}),
+		GenesisHash:   gen.NetworkID(),
+		Tx:            []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	if block.Header.GenesisHash != gen.NetworkID() {
+		t.Fatalf("Should record the genesis hash in the first block, got %q", block.Header.GenesisHash)
+	}
+
+	if err := db.CheckGenesis(block.Header); err != nil {
+		t.Fatalf("Should accept a proposed first block with the genesis hash: %v", err)
+	}
+
+	// A peer can't skip the check by leaving the hash out.
+	stripped := block.Header
+	stripped.GenesisHash = ""
+
+	if err := db.CheckGenesis(stripped); !errors.Is(err, database.ErrGenesisChanged) {
+		t.Fatalf("Should receive ErrGenesisChanged for a proposed first block without the genesis hash, got %v", err)
+	}
+
+	if err := db.Write(block); err != nil {
+		t.Fatalf("Should be able to write block: %v", err)
+	}
+
+	if _, err := database.New(gen, storage, ev); err != nil {
+		t.Fatalf("Should be able to reopen the database with the same genesis: %v", err)
+	}
+
+	// The operator edits the balances after the chain has blocks.
+	changed := gen
+	changed.Balances = map[string]uint64{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 5000,
+	}
+
+	if _, err := database.New(changed, storage, ev); !errors.Is(err, database.ErrGenesisChanged) {
+		t.Fatalf("Should receive ErrGenesisChanged opening the chain with a changed genesis, got %v", err)
+	}
+}
+
+func Test_CheckIntegrity(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	if checked, mismatches := db.CheckIntegrity(10); checked != 0 || len(mismatches) != 0 {
+		t.Fatalf("Should have nothing to check on an empty chain, got %d checked, %v", checked, mismatches)
+	}
+
+	// Mine a known-good chain of three blocks.
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{ChainID: 1, Nonce: nonce, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 10}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashStateAfter(database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", nonce, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", nonce, err)
+		}
+		db.UpdateLatestBlock(block)
+	}
+
+	if checked, mismatches := db.CheckIntegrity(10); checked != 3 || len(mismatches) != 0 {
+		t.Fatalf("Should find the known-good chain intact, got %d checked, %v", checked, mismatches)
+	}
+
+	if checked, _ := db.CheckIntegrity(2); checked != 2 {
+		t.Fatalf("Should only check the blocks in the window, got %d", checked)
+	}
+
+	type table struct {
+		name    string
+		corrupt func(blocks []database.BlockData)
+		number  uint64
+	}
+
+	tt := []table{
+		{name: "transaction", corrupt: func(blocks []database.BlockData) { blocks[1].Trans[0].Value++ }, number: 2},
+		{name: "header", corrupt: func(blocks []database.BlockData) { blocks[2].Header.MiningReward++ }, number: 3},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			var blocks []database.BlockData
+			for num := uint64(1); num <= 3; num++ {
+				blockData, err := storage.GetBlock(num)
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to get block %d: %v", tst.name, num, err)
+				}
+				blocks = append(blocks, blockData)
+			}
+
+			// Keep a copy of the blocks to put the chain back afterwards.
+			var good []database.BlockData
+			for _, blockData := range blocks {
+				blockData.Trans = append([]database.BlockTx(nil), blockData.Trans...)
+				good = append(good, blockData)
+			}
+
+			write := func(blocks []database.BlockData) {
+				storage.Reset()
+				for _, blockData := range blocks {
+					if err := storage.Write(blockData); err != nil {
+						t.Fatalf("Test %s:\tShould be able to write block %d: %v", tst.name, blockData.Header.Number, err)
+					}
+				}
+			}
+
+			tst.corrupt(blocks)
+			write(blocks)
+			defer write(good)
+
+			_, mismatches := db.CheckIntegrity(10)
+			if len(mismatches) != 1 || mismatches[0].Number != tst.number {
+				t.Fatalf("Test %s:\tShould detect the corrupted block %d, got %v", tst.name, tst.number, mismatches)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_TxTimeStamp(t *testing.T) {
+	const tolerance = time.Hour
+	now := time.Now()
+
+	type table struct {
+		name      string
+		timeStamp time.Time
+		success   bool
+	}
+
+	tt := []table{
+		{name: "valid", timeStamp: now.Add(-time.Minute), success: true},
+		{name: "future within tolerance", timeStamp: now.Add(time.Minute), success: true},
+		{name: "future", timeStamp: now.Add(2 * tolerance), success: false},
+		{name: "stale", timeStamp: now.Add(-2 * tolerance), success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			tx := database.BlockTx{TimeStamp: uint64(tst.timeStamp.UnixMilli())}
+			err := tx.ValidateTimeStamp(now, tolerance)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tShould accept the transaction timestamp: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, database.ErrInvalidTimeStamp) {
+					t.Fatalf("Test %s:\tShould reject the transaction timestamp, got %v", tst.name, err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_BlockTxTimeStamp(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	type table struct {
+		name    string
+		offset  time.Duration
+		success bool
+	}
+
+	tt := []table{
+		{name: "before block", offset: -time.Minute, success: true},
+		{name: "after block", offset: time.Hour, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			tx := database.Tx{
+				ChainID: 1,
+				Nonce:   1,
+				FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+				ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+				Value:   1,
+			}
+
+			blockTx, err := sign(tx, 0)
+			if err != nil {
+				t.Fatalf("Should be able to sign transaction: %v", err)
+			}
+			blockTx.TimeStamp = uint64(time.Now().Add(tst.offset).UnixMilli())
+
+			block, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+				Difficulty:    1,
+				StateRoot:     "stateroot",
+				Tx:            []database.BlockTx{blockTx},
+				EvHandler:     ev,
+			})
+			if err != nil {
+				t.Fatalf("Should be able to mine block: %v", err)
+			}
+
+			err = block.ValidateBlock(database.Block{}, 1, "", "stateroot", 0, true, ev)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to validate block: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, database.ErrInvalidTimeStamp) {
+					t.Fatalf("Test %s:\tShould reject a transaction newer than the block, got %v", tst.name, err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_OddTransactionBlock(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID: 1,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	var txs []database.BlockTx
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		txs = append(txs, blockTx)
+	}
+
+	genDB, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Difficulty:    1,
+		StateRoot:     genDB.HashStateAfter(database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"}, txs),
+		Tx:            txs,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	if n := len(block.MerkleTree.Values()); n != 3 {
+		t.Fatalf("Should have 3 transactions in the block, got %d", n)
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	if err := storage.Write(database.NewBlockData(block)); err != nil {
+		t.Fatalf("Should be able to write block: %v", err)
+	}
+
+	// Replaying the block from storage applies its transactions.
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to replay the block: %v", err)
+	}
+
+	to, err := db.Query("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	if err != nil {
+		t.Fatalf("Should be able to query the receiving account: %v", err)
+	}
+
+	if to.Balance != 30 {
+		t.Fatalf("Should apply each transaction exactly once, got balance %d, exp 30", to.Balance)
+	}
+
+	// A block holding the same transaction twice must be rejected.
+	dupBlock, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0",
+		Difficulty:    1,
+		StateRoot:     genDB.HashState(),
+		Tx:            []database.BlockTx{txs[0], txs[0]},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	if err := dupBlock.ValidateBlock(database.Block{}, 1, "", genDB.HashState(), 0, true, ev); err == nil {
+		t.Fatal("Should not be able to validate a block with a duplicate transaction.")
+	}
+}
+
+func Test_StateRootValidation(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	const beneficiary = "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	db, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   10,
+	}
+
+	blockTx, err := sign(tx, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+	txs := []database.BlockTx{blockTx}
+
+	stateRoot := db.HashStateAfter(database.BlockHeader{BeneficiaryID: beneficiary, MiningReward: gen.MiningReward}, txs)
+	if stateRoot == db.HashState() {
+		t.Fatal("Should change the state root by applying the block.")
+	}
+
+	type table struct {
+		name      string
+		stateRoot string
+		success   bool
+	}
+
+	tt := []table{
+		{name: "after block", stateRoot: stateRoot, success: true},
+		{name: "before block", stateRoot: db.HashState(), success: false},
+		{name: "wrong reward", stateRoot: db.HashStateAfter(database.BlockHeader{BeneficiaryID: beneficiary, MiningReward: gen.MiningReward + 1}, txs), success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			block, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: beneficiary,
+				Difficulty:    1,
+				MiningReward:  gen.MiningReward,
+				StateRoot:     tst.stateRoot,
+				Tx:            txs,
+				EvHandler:     ev,
+			})
+			if err != nil {
+				t.Fatalf("Should be able to mine block: %v", err)
+			}
+
+			err = block.ValidateBlock(database.Block{}, 1, "", stateRoot, 0, true, ev)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to validate block: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, database.ErrStateRootMismatch) {
+					t.Fatalf("Test %s:\tShould reject a block with the wrong state root, got %v", tst.name, err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	// Computing the state root must not change the database.
+	if _, err := db.Query("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"); err == nil {
+		t.Fatal("Should not apply the block to the database when computing the state root.")
+	}
+}
+
+func Test_RewardSplitValidation(t *testing.T) {
+	type table struct {
+		name    string
+		values  []string
+		success bool
+	}
+
+	tt := []table{
+		{name: "none", values: nil, success: true},
+		{name: "single", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:10000"}, success: true},
+		{name: "three", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:5000", "0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61:3333", "0xbEE6ACE826eC3DE1B6349888B9151B92522F7F76:1667"}, success: true},
+		{name: "under total", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:5000", "0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61:4999"}, success: false},
+		{name: "over total", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:5000", "0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61:5001"}, success: false},
+		{name: "zero share", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:10000", "0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61:0"}, success: false},
+		{name: "duplicate", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:5000", "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8:5000"}, success: false},
+		{name: "bad account", values: []string{"miner1:10000"}, success: false},
+		{name: "missing basis points", values: []string{"0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"}, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			_, err := database.ToRewardSplits(tst.values)
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept the reward splits: %v", tst.name, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject the reward splits.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_RewardSplit(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	const (
+		fromID  = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		toID    = database.AccountID("0x6Fe6CF3c8fF57c58d24BfC869668F48BCbDb3BD9")
+		minerID = database.AccountID("0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0")
+		poolA   = database.AccountID("0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8")
+		poolB   = database.AccountID("0xb8Ee4c7ac4ca3269fEc242780D7D960bd6272a61")
+		poolC   = database.AccountID("0xbEE6ACE826eC3DE1B6349888B9151B92522F7F76")
+	)
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			string(fromID): 10000,
+		},
+	}
+
+	splits := []database.RewardSplit{
+		{AccountID: poolA, BasisPoints: 5000},
+		{AccountID: poolB, BasisPoints: 3333},
+		{AccountID: poolC, BasisPoints: 1667},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	var txs []database.BlockTx
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  fromID,
+			ToID:    toID,
+			Value:   100,
+			Tip:     33,
+		}
+
+		blockTx, err := sign(tx, 17)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		txs = append(txs, blockTx)
+	}
+	txs, badTxs := txs[:2], txs[2:]
+
+	header := database.BlockHeader{BeneficiaryID: minerID, MiningReward: gen.MiningReward, RewardSplits: splits}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: minerID,
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		RewardSplits:  splits,
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashStateAfter(header, txs),
+		Tx:            txs,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	if err := db.Write(block); err != nil {
+		t.Fatalf("Should be able to write block: %v", err)
+	}
+	db.UpdateLatestBlock(block)
+
+	for _, tx := range txs {
+		if err := db.ApplyTx(block, tx); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+	}
+	if err := db.ApplyMiningReward(block); err != nil {
+		t.Fatalf("Should be able to apply mining reward: %v", err)
+	}
+
+	// Each transaction pays 17 in gas and 33 in tips, which are split along
+	// with the 700 mining reward. The rounding remainders go to the miner.
+	final := map[database.AccountID]uint64{
+		fromID:  10000 - 2*(17+100+33),
+		toID:    200,
+		poolA:   2*(8+16) + 350,
+		poolB:   2*(5+10) + 233,
+		poolC:   2*(2+5) + 116,
+		minerID: 2*(2+2) + 1,
+	}
+
+	var supply uint64
+	for _, account := range db.SortedAccounts() {
+		supply += account.Balance
+	}
+
+	if exp := 10000 + gen.MiningReward; supply != exp {
+		t.Fatalf("Should reconcile with the total supply, got %d, exp %d", supply, exp)
+	}
+
+	for accountID, exp := range final {
+		account, err := db.Query(accountID)
+		if err != nil {
+			t.Fatalf("Should be able to query account %s: %v", accountID, err)
+		}
+
+		if account.Balance != exp {
+			t.Fatalf("Should have the right balance for account %s, got %d, exp %d", accountID, account.Balance, exp)
+		}
+	}
+
+	// The splits are carried in the block, so replaying it must produce the
+	// same accounts.
+	replayed, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to replay the block: %v", err)
+	}
+
+	if got, exp := replayed.HashState(), db.HashState(); got != exp || exp != block.Header.StateRoot {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", exp)
+		t.Fatal("Should get the same accounts when replaying the block.")
+	}
+
+	// A block with splits that don't sum to the total is rejected.
+	bad := []database.RewardSplit{
+		{AccountID: poolA, BasisPoints: 10000},
+		{AccountID: poolB, BasisPoints: 10000},
+	}
+
+	badBlock, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: minerID,
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		RewardSplits:  bad,
+		PrevBlock:     block,
+		StateRoot:     db.HashStateAfter(database.BlockHeader{BeneficiaryID: minerID, MiningReward: gen.MiningReward, RewardSplits: bad}, badTxs),
+		Tx:            badTxs,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	stateRoot := db.HashStateAfter(badBlock.Header, badTxs)
+	if err := badBlock.ValidateBlock(block, gen.Difficulty, "", stateRoot, 0, true, ev); err == nil {
+		t.Fatal("Should reject a block with reward splits that don't sum to the total.")
+	}
+}
+
+func Test_GasUnits(t *testing.T) {
+	type table struct {
+		name     string
+		data     []byte
+		gasUnits uint64
+		success  bool
+	}
+
+	tt := []table{
+		{name: "no data, base gas", data: nil, gasUnits: database.GasUnitsBase, success: true},
+		{name: "no data, zero gas", data: nil, gasUnits: 0, success: false},
+		{name: "data, correct gas", data: []byte("hello"), gasUnits: database.GasUnitsBase + 5*database.GasUnitsDataByte, success: true},
+		{name: "data, extra gas", data: []byte("hello"), gasUnits: 100, success: true},
+		{name: "data, under-declared gas", data: []byte("hello"), gasUnits: database.GasUnitsBase, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			tx := database.Tx{
+				ChainID: 1,
+				Nonce:   1,
+				FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+				ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+				Data:    tst.data,
+			}
+
+			blockTx, err := sign(tx, 15)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to sign transaction: %v", tst.name, err)
+			}
+			blockTx.GasUnits = tst.gasUnits
+
+			err = blockTx.ValidateGas()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept the declared gas units: %v", tst.name, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject the under-declared gas units.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Snapshot(t *testing.T) {
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	dbPath := t.TempDir()
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	var events []string
+	ev := func(v string, args ...any) {
+		events = append(events, fmt.Sprintf(v, args...))
+	}
+
+	loaded := func(num uint64) bool {
+		exp := fmt.Sprintf("database: loadSnapshot: loaded snapshot: blk[%d]", num)
+		for _, event := range events {
+			if event == exp {
+				return true
+			}
+		}
+		return false
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	if _, err := db.WriteSnapshot(); !errors.Is(err, database.ErrNoBlocks) {
+		t.Fatalf("Should not be able to snapshot a chain with no blocks: %v", err)
+	}
+
+	// Mine a chain of five blocks, taking a snapshot after the third.
+	for nonce := uint64(1); nonce <= 5; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		header := database.BlockHeader{BeneficiaryID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", MiningReward: gen.MiningReward}
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: header.BeneficiaryID,
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashStateAfter(header, []database.BlockTx{blockTx}),
+			Tx:            []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", nonce, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", nonce, err)
+		}
+		db.UpdateLatestBlock(block)
+
+		if err := db.ApplyTx(block, blockTx); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+		db.ApplyMiningReward(block)
+
+		if nonce == 3 {
+			snapshot, err := db.WriteSnapshot()
+			if err != nil {
+				t.Fatalf("Should be able to write a snapshot: %v", err)
+			}
+
+			if snapshot.Number != 3 || snapshot.StateRoot != block.Header.StateRoot {
+				t.Fatalf("Should snapshot the state after block 3, got blk[%d] root[%s]", snapshot.Number, snapshot.StateRoot)
+			}
+		}
+	}
+
+	// Load the database from the snapshot.
+	events = nil
+	fromSnapshot, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open the database from the snapshot: %v", err)
+	}
+
+	if !loaded(3) {
+		t.Fatalf("Should load the database from the snapshot after block 3: %v", events)
+	}
+
+	// Load the database by replaying the full chain.
+	if err := os.Rename(filepath.Join(dbPath, "snapshot.json"), filepath.Join(dbPath, "snapshot.bak")); err != nil {
+		t.Fatalf("Should be able to move the snapshot: %v", err)
+	}
+
+	events = nil
+	fromReplay, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open the database from the chain: %v", err)
+	}
+
+	if loaded(3) {
+		t.Fatal("Should replay the full chain without a snapshot.")
+	}
+
+	if err := os.Rename(filepath.Join(dbPath, "snapshot.bak"), filepath.Join(dbPath, "snapshot.json")); err != nil {
+		t.Fatalf("Should be able to restore the snapshot: %v", err)
+	}
+
+	for _, got := range []*database.Database{fromSnapshot, fromReplay} {
+		if !reflect.DeepEqual(got.Copy(), db.Copy()) {
+			t.Logf("got: %v", got.Copy())
+			t.Logf("exp: %v", db.Copy())
+			t.Fatal("Should have the same accounts as the original database.")
+		}
+
+		if got.HashState() != db.HashState() {
+			t.Fatal("Should have the same state root as the original database.")
+		}
+
+		if got.LatestBlock().Hash() != db.LatestBlock().Hash() {
+			t.Fatal("Should have the same latest block as the original database.")
+		}
+
+		if got.TxCount() != 5 {
+			t.Fatalf("Should count the transactions in all 5 blocks, got %d", got.TxCount())
+		}
+	}
+
+	// A snapshot that doesn't match the chain must be ignored.
+	good, err := storage.ReadSnapshot()
+	if err != nil {
+		t.Fatalf("Should be able to read the snapshot: %v", err)
+	}
+
+	tampered := []func(snapshot *database.Snapshot){
+		func(snapshot *database.Snapshot) { snapshot.Accounts[0].Balance++ },
+		func(snapshot *database.Snapshot) { snapshot.Accounts = snapshot.Accounts[1:] },
+		func(snapshot *database.Snapshot) { snapshot.BlockHash = signature.ZeroHash },
+		func(snapshot *database.Snapshot) { snapshot.Number = 9 },
+	}
+
+	for i, tamper := range tampered {
+		snapshot := good
+		snapshot.Accounts = append([]database.Account(nil), good.Accounts...)
+		tamper(&snapshot)
+
+		if err := storage.WriteSnapshot(snapshot); err != nil {
+			t.Fatalf("Should be able to write tampered snapshot %d: %v", i, err)
+		}
+
+		events = nil
+		got, err := database.New(gen, storage, ev)
+		if err != nil {
+			t.Fatalf("Should be able to open the database with tampered snapshot %d: %v", i, err)
+		}
+
+		if loaded(snapshot.Number) {
+			t.Fatalf("Should not load tampered snapshot %d.", i)
+		}
+
+		if !reflect.DeepEqual(got.Copy(), db.Copy()) {
+			t.Fatalf("Should replay the full chain with tampered snapshot %d.", i)
+		}
+	}
+}
+
+func Test_NameRegistry(t *testing.T) {
+	const (
+		pavel   = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		kennedy = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	)
+
+	balances := map[string]uint64{
+		string(pavel):   1000,
+		string(kennedy): 1000,
+	}
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: balances}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"}}
+
+	if _, err := db.LookupName("pavel"); !errors.Is(err, database.ErrNameNotFound) {
+		t.Fatalf("Should not find a name that isn't registered, got %v", err)
+	}
+
+	// Pavel registers the name.
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: pavel, ToID: kennedy, Data: database.NameRegistration("pavel")}
+	blockTx, err := sign(tx, 1)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := db.ApplyTx(block, blockTx); err != nil {
+		t.Fatalf("Should be able to register the name: %v", err)
+	}
+
+	if owner, err := db.LookupName("pavel"); err != nil || owner != pavel {
+		t.Fatalf("Should find the name registered to %s, got %s: %v", pavel, owner, err)
+	}
+
+	// Kennedy can't take the name.
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	tx = database.Tx{ChainID: 1, Nonce: 1, FromID: kennedy, ToID: pavel, Data: database.NameRegistration("pavel")}
+	signedTx, err := tx.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := db.ApplyTx(block, database.NewBlockTx(signedTx, 1, 1)); !errors.Is(err, database.ErrNameTaken) {
+		t.Fatalf("Should not be able to register a name owned by another account, got %v", err)
+	}
+
+	if owner, _ := db.LookupName("pavel"); owner != pavel {
+		t.Fatalf("Should keep the name registered to %s, got %s", pavel, owner)
+	}
+
+	if account, _ := db.Query(kennedy); account.Nonce != 0 {
+		t.Fatalf("Should fail the duplicate registration without updating the nonce, got %d", account.Nonce)
+	}
+
+	// The owner can register the name again.
+	tx = database.Tx{ChainID: 1, Nonce: 2, FromID: pavel, ToID: kennedy, Data: database.NameRegistration("pavel")}
+	if blockTx, err = sign(tx, 1); err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := db.ApplyTx(block, blockTx); err != nil {
+		t.Fatalf("Should be able to register an owned name again: %v", err)
+	}
+
+	// A name has to follow the rules.
+	for _, name := range []string{"pv", "Pavel", "-pavel", "pavel-", "pavel!", "a-very-long-name-that-goes-over-the-limit"} {
+		if err := database.ValidateName(name); !errors.Is(err, database.ErrInvalidName) {
+			t.Fatalf("Should reject the name %q, got %v", name, err)
+		}
+	}
+
+	tx = database.Tx{ChainID: 1, Nonce: 3, FromID: pavel, ToID: kennedy, Data: database.NameRegistration("Pavel")}
+	if blockTx, err = sign(tx, 1); err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := db.ApplyTx(block, blockTx); !errors.Is(err, database.ErrInvalidName) {
+		t.Fatalf("Should not be able to register an invalid name, got %v", err)
+	}
+
+	// Data that isn't a registration leaves the registry alone.
+	if _, ok := database.ParseNameRegistration([]byte("hello")); ok {
+		t.Fatal("Should not parse regular data as a name registration.")
+	}
+}
+
+func Test_FromAccountCache(t *testing.T) {
+	const domain = "testnet"
+
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %s", err)
+	}
+
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 10}
+
+	signedTx, err := tx.SignWithDomain(domain, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %s", err)
+	}
+
+	// The same signature over different data or for another domain
+	// recovers a different account, so none of them can share a cache entry.
+	forged := signedTx
+	forged.Value = 1000
+
+	type table struct {
+		name   string
+		tx     database.SignedTx
+		domain string
+	}
+
+	tt := []table{
+		{name: "signed", tx: signedTx, domain: domain},
+		{name: "forged value", tx: forged, domain: domain},
+		{name: "other domain", tx: signedTx, domain: "mainnet"},
+	}
+
+	for _, tst := range tt {
+		uncached, uncachedErr := signature.FromAddressWithDomain(tst.domain, tst.tx.Tx, tst.tx.V, tst.tx.R, tst.tx.S)
+
+		// The first call recovers the account and the second is served
+		// from the cache.
+		for i := 0; i < 2; i++ {
+			accountID, err := tst.tx.FromAccount(tst.domain)
+			if (err != nil) != (uncachedErr != nil) {
+				t.Fatalf("Test %s:\tShould get the same error as the uncached recovery, got %v, exp %v", tst.name, err, uncachedErr)
+			}
+
+			if string(accountID) != uncached {
+				t.Fatalf("Test %s:\tShould recover the same account as the uncached recovery, got %s, exp %s", tst.name, accountID, uncached)
+			}
+		}
+
+		if match := uncached == string(tx.FromID); match != (tst.name == "signed") {
+			t.Fatalf("Test %s:\tShould only recover the from account for the signed transaction, got %s", tst.name, uncached)
+		}
+	}
+}
+
+func BenchmarkFromAccount(b *testing.B) {
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		b.Fatalf("Should be able to construct the private key: %s", err)
+	}
+
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 10}
+
+	signedTx, err := tx.Sign(pk)
+	if err != nil {
+		b.Fatalf("Should be able to sign the transaction: %s", err)
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := signature.FromAddress(signedTx.Tx, signedTx.V, signedTx.R, signedTx.S); err != nil {
+				b.Fatalf("Should be able to recover the account: %s", err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := signedTx.FromAccount(""); err != nil {
+				b.Fatalf("Should be able to recover the account: %s", err)
+			}
+		}
+	})
+}
+
 // =============================================================================
 
+// countingStorage counts the blocks read from the storage by number and
+// the walks through the whole chain.
+type countingStorage struct {
+	database.Storage
+	gets  int
+	walks int
+}
+
+func (cs *countingStorage) GetBlock(num uint64) (database.BlockData, error) {
+	cs.gets++
+	return cs.Storage.GetBlock(num)
+}
+
+func (cs *countingStorage) ForEach() database.Iterator {
+	cs.walks++
+	return cs.Storage.ForEach()
+}
+
 func sign(tx database.Tx, gas uint64) (database.BlockTx, error) {
 	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
 	if err != nil {
@@ -200,6 +2292,10 @@ func (ms MockStorage) ForEach() database.Iterator {
 	return &MockIterator{}
 }
 
+func (ms MockStorage) ForEachReverse() database.Iterator {
+	return &MockIterator{}
+}
+
 func (ms MockStorage) Close() error {
 	return nil
 }
@@ -207,3 +2303,7 @@ func (ms MockStorage) Close() error {
 func (ms MockStorage) Reset() error {
 	return nil
 }
+
+func (ms MockStorage) Truncate(num uint64) error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrGenesisChanged is returned when a chain was started with a different
+// genesis than the one the node is running with.
+var ErrGenesisChanged = errors.New("genesis does not match the genesis the chain was started with")
+
+// CORE NOTE: The first block records the hash of the genesis the chain was
+// started with. Editing the genesis after the chain has blocks, like changing
+// the balances, would otherwise mix the old and new genesis into a ledger that
+// matches neither. Blocks mined before the hash was recorded don't carry it,
+// so a chain already in storage without it can't be checked and is accepted.
+// A proposed block 1 must carry the hash, or a peer could skip the check by
+// leaving it out.
+
+// CheckGenesis checks the block header was mined for the genesis of this
+// database. Only the header of block 1 carries the hash of the genesis.
+func (db *Database) CheckGenesis(header BlockHeader) error {
+	if header.Number != 1 {
+		return nil
+	}
+
+	if header.GenesisHash == "" {
+		return fmt.Errorf("%w, block 1 doesn't record the chain genesis", ErrGenesisChanged)
+	}
+
+	return db.matchGenesis(header)
+}
+
+// checkStoredGenesis checks the chain in storage was started with the genesis
+// of this database. There is nothing to check before the first block is
+// written, or when the first block predates recording the genesis hash.
+func (db *Database) checkStoredGenesis() error {
+	blockData, err := db.storage.GetBlock(1)
+	if err != nil || blockData.Header.GenesisHash == "" {
+		return nil
+	}
+
+	return db.matchGenesis(blockData.Header)
+}
+
+// matchGenesis checks the genesis hash recorded in the header matches the
+// genesis of this database.
+func (db *Database) matchGenesis(header BlockHeader) error {
+	if id := db.genesis.NetworkID(); header.GenesisHash != id {
+		return fmt.Errorf("%w, chain genesis %s, loaded genesis %s", ErrGenesisChanged, header.GenesisHash, id)
+	}
+
+	return nil
+}
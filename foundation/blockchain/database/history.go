@@ -0,0 +1,242 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CORE NOTE: Rebuilding the accounts at a past block means replaying the
+// chain, which is too much work to do from genesis on every request. The
+// accounts after the oldest block that can be queried, depth blocks before
+// the latest block, are kept as a checkpoint. A query replays from the
+// checkpoint, so only the blocks within the depth and the blocks added since
+// the checkpoint last moved are replayed, and the checkpoint moves forward as
+// the chain grows. Only the first query, or one after the checkpoint's block
+// left the chain, replays from the latest snapshot or genesis.
+
+// historyCheckpoint holds the accounts as they were after a block was
+// applied, for the historical queries to replay from.
+type historyCheckpoint struct {
+	number   uint64
+	hash     string
+	accounts map[AccountID]Account
+	names    map[string]AccountID
+}
+
+// AccountAt returns the account as it was after the specified block was
+// applied, for a block at most depth blocks before the latest block. The
+// accounts are rebuilt by replaying the blocks from the history checkpoint
+// without changing the database.
+func (db *Database) AccountAt(accountID AccountID, number uint64, depth uint64) (Account, error) {
+	latest := db.LatestBlock().Header.Number
+	if number > latest {
+		return Account{}, fmt.Errorf("block %d is after the latest block %d", number, latest)
+	}
+
+	// Keep the checkpoint at the oldest block that can be queried.
+	floor := number
+	if latest > depth && latest-depth < floor {
+		floor = latest - depth
+	}
+
+	db.historyMu.Lock()
+	defer db.historyMu.Unlock()
+
+	replay, err := db.replayHistory(number, floor)
+	if err != nil {
+		return Account{}, err
+	}
+
+	account, exists := replay.accounts[accountID]
+	if !exists {
+		return Account{}, fmt.Errorf("%w at block %d", ErrAccountNotFound, number)
+	}
+
+	return account, nil
+}
+
+// RollbackLatestBlock removes the latest block from the chain. Only the
+// latest block is removed from storage, and the accounts are rebuilt as of
+// its parent by replaying the chain in memory.
+func (db *Database) RollbackLatestBlock() error {
+	latest := db.LatestBlock()
+	if latest.Header.Number == 0 {
+		return errors.New("no block to roll back")
+	}
+	number := latest.Header.Number - 1
+
+	replay, err := db.replayTo(number)
+	if err != nil {
+		return err
+	}
+
+	var parent Block
+	if number > 0 {
+		if parent, err = db.GetBlock(number); err != nil {
+			return fmt.Errorf("get block %d: %w", number, err)
+		}
+	}
+
+	if err := db.storage.Truncate(number); err != nil {
+		return fmt.Errorf("truncate block %d: %w", latest.Header.Number, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.accounts = replay.accounts
+	db.names = replay.names
+	db.latestBlock = parent
+	db.txCount -= uint64(len(latest.MerkleTree.Values()))
+	db.totalWork.Sub(db.totalWork, BlockWork(latest.Header.Difficulty))
+	delete(db.blooms, latest.Header.Number)
+
+	return nil
+}
+
+// replayTo replays the chain into a new database up to and including the
+// specified block, without changing this database. Failed transactions and
+// rewards are skipped the same way they were when the block was first
+// processed.
+func (db *Database) replayTo(number uint64) (*Database, error) {
+	replay, iter, err := db.replayFrom(number)
+	if err != nil {
+		return nil, err
+	}
+
+	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		if block.Header.Number > number {
+			break
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			replay.applyTx(replay.accounts, replay.names, block, tx)
+		}
+		applyMiningReward(replay.accounts, block)
+	}
+
+	return replay, nil
+}
+
+// replayHistory replays the chain into a new database up to and including
+// the specified block, starting from the history checkpoint when it can be
+// used, and moves the checkpoint to the floor block along the way. The caller
+// is expected to hold the history lock.
+func (db *Database) replayHistory(number uint64, floor uint64) (*Database, error) {
+	replay, err := open(db.genesis, db.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	apply := func(block Block) {
+		for _, tx := range block.MerkleTree.Values() {
+			replay.applyTx(replay.accounts, replay.names, block, tx)
+		}
+		applyMiningReward(replay.accounts, block)
+
+		if block.Header.Number == floor {
+			db.history = &historyCheckpoint{
+				number:   floor,
+				hash:     block.Hash(),
+				accounts: copyAccounts(replay.accounts),
+				names:    copyNames(replay.names),
+			}
+		}
+	}
+
+	// Replay only the blocks after the checkpoint when it's at or before
+	// the block and still on the chain.
+	if cp := db.history; cp != nil && cp.number <= number && db.onChain(cp) {
+		replay.accounts = copyAccounts(cp.accounts)
+		replay.names = copyNames(cp.names)
+
+		for num := cp.number + 1; num <= number; num++ {
+			block, err := db.GetBlock(num)
+			if err != nil {
+				return nil, fmt.Errorf("get block %d: %w", num, err)
+			}
+			apply(block)
+		}
+
+		return replay, nil
+	}
+
+	replay, iter, err := db.replayFrom(number)
+	if err != nil {
+		return nil, err
+	}
+
+	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		if block.Header.Number > number {
+			break
+		}
+		apply(block)
+	}
+
+	return replay, nil
+}
+
+// onChain reports whether the block the checkpoint was taken after is still
+// on the chain.
+func (db *Database) onChain(cp *historyCheckpoint) bool {
+	if cp.number == 0 {
+		return true
+	}
+
+	block, err := db.GetBlock(cp.number)
+	if err != nil {
+		return false
+	}
+
+	return block.Hash() == cp.hash
+}
+
+// copyAccounts returns a copy of the accounts.
+func copyAccounts(accounts map[AccountID]Account) map[AccountID]Account {
+	cpy := make(map[AccountID]Account, len(accounts))
+	for accountID, account := range accounts {
+		cpy[accountID] = account
+	}
+
+	return cpy
+}
+
+// replayFrom opens a database to replay the chain up to the specified block,
+// starting from the latest snapshot taken at or before it when it can be
+// trusted. It returns an iterator over the blocks still to be replayed.
+func (db *Database) replayFrom(number uint64) (*Database, DatabaseIterator, error) {
+	replay, err := open(db.genesis, db.storage)
+	if err != nil {
+		return nil, DatabaseIterator{}, err
+	}
+
+	snapshotter, ok := db.storage.(Snapshotter)
+	if !ok {
+		return replay, db.ForEach(), nil
+	}
+
+	snapshot, err := snapshotter.ReadSnapshot()
+	if err != nil || snapshot.Number > number {
+		return replay, db.ForEach(), nil
+	}
+
+	if _, err := verifySnapshot(db, snapshot); err != nil {
+		return replay, db.ForEach(), nil
+	}
+
+	replay.accounts = make(map[AccountID]Account, len(snapshot.Accounts))
+	for _, account := range snapshot.Accounts {
+		replay.accounts[account.AccountID] = account
+	}
+	replay.names = copyNames(snapshot.Names)
+
+	return replay, DatabaseIterator{iterator: snapshotter.ForEachFrom(snapshot.Number)}, nil
+}
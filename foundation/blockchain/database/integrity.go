@@ -0,0 +1,81 @@
+package database
+
+import (
+	"fmt"
+)
+
+// BlockMismatch represents a block in storage that failed the integrity
+// check, along with the reason it failed.
+type BlockMismatch struct {
+	Number uint64 `json:"number"`
+	Reason string `json:"reason"`
+}
+
+// CORE NOTE: Unlike VerifyStateRoot, which replays the whole chain once, the
+// integrity check is cheap enough to run periodically on a running node. It
+// only reads the most recent blocks back from storage and checks them on their
+// own: the stored hash matches the header, the transactions hash to the merkle
+// root in the header, and each block is the parent of the block after it. The
+// accounts are left alone, so nothing is locked while the blocks are read.
+
+// CheckIntegrity reads up to window of the most recent blocks back from
+// storage, starting with the latest block, and returns the number of blocks
+// checked along with the blocks that don't match what was written.
+func (db *Database) CheckIntegrity(window int) (int, []BlockMismatch) {
+	latest := db.LatestBlock()
+
+	var mismatches []BlockMismatch
+	mismatch := func(number uint64, format string, args ...any) {
+		mismatches = append(mismatches, BlockMismatch{Number: number, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	// The hash the next block read is expected to have, starting with the
+	// latest block held in memory.
+	expHash := latest.Hash()
+	expNumber := latest.Header.Number
+
+	var checked int
+	iter := db.storage.ForEachReverse()
+	for !iter.Done() && checked < window {
+		blockData, err := iter.Next()
+		checked++
+
+		if err != nil {
+			mismatch(expNumber, "unreadable block: %s", err)
+			break
+		}
+
+		number := blockData.Header.Number
+
+		// A block written after the latest block was read is left to the
+		// next check.
+		if number > latest.Header.Number {
+			checked--
+			continue
+		}
+
+		block, err := ToBlock(blockData)
+		if err != nil {
+			mismatch(number, "invalid transactions: %s", err)
+			expHash, expNumber = blockData.Header.PrevBlockHash, number-1
+			continue
+		}
+
+		hash := block.Hash()
+
+		switch {
+		case number != expNumber:
+			mismatch(number, "block number, got %d, exp %d", number, expNumber)
+		case hash != blockData.Hash:
+			mismatch(number, "block hash doesn't match the header, got %s, stored %s", hash, blockData.Hash)
+		case hash != expHash:
+			mismatch(number, "block hash doesn't match the chain, got %s, exp %s", hash, expHash)
+		case block.MerkleTree.RootHex() != block.Header.TransRoot:
+			mismatch(number, "merkle root doesn't match the header, got %s, exp %s", block.MerkleTree.RootHex(), block.Header.TransRoot)
+		}
+
+		expHash, expNumber = block.Header.PrevBlockHash, number-1
+	}
+
+	return checked, mismatches
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// NameRegistrationPrefix is the prefix of the data of a transaction that
+// registers a name for the account sending it. The name follows the prefix.
+const NameRegistrationPrefix = "name:register:"
+
+// Set of limits on the length of a registered name.
+const (
+	MinNameLength = 3
+	MaxNameLength = 32
+)
+
+// ErrInvalidName is returned when a name doesn't meet the rules for a
+// registered name.
+var ErrInvalidName = errors.New("invalid name")
+
+// ErrNameTaken is returned when a name is already registered to another
+// account.
+var ErrNameTaken = errors.New("name is registered to another account")
+
+// ErrNameNotFound is returned when a name isn't registered.
+var ErrNameNotFound = errors.New("name is not registered")
+
+// CORE NOTE: The name registry is an application built on top of regular
+// transactions. A transaction carrying a name registration in its data binds
+// the name to the account sending it, once the transaction is applied. The
+// first account to register a name owns it, and a registration of the name by
+// any other account fails like a transaction with the wrong nonce. The
+// registry is rebuilt by replaying the blocks and is not part of the state
+// root, which only covers the accounts.
+
+// NameRegistration returns the transaction data that registers the name for
+// the account sending the transaction.
+func NameRegistration(name string) []byte {
+	return []byte(NameRegistrationPrefix + name)
+}
+
+// ParseNameRegistration returns the name registered by the transaction data,
+// and reports whether the data is a name registration at all.
+func ParseNameRegistration(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(NameRegistrationPrefix)) {
+		return "", false
+	}
+
+	return string(data[len(NameRegistrationPrefix):]), true
+}
+
+// ValidateName checks the name can be registered. A name is made of lower
+// case letters, digits and hyphens, and can't start or end with a hyphen.
+func ValidateName(name string) error {
+	if len(name) < MinNameLength || len(name) > MaxNameLength {
+		return fmt.Errorf("%w: %q must be %d to %d characters", ErrInvalidName, name, MinNameLength, MaxNameLength)
+	}
+
+	if name[0] == '-' || name[len(name)-1] == '-' {
+		return fmt.Errorf("%w: %q can't start or end with a hyphen", ErrInvalidName, name)
+	}
+
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+		default:
+			return fmt.Errorf("%w: %q can only hold lower case letters, digits and hyphens", ErrInvalidName, name)
+		}
+	}
+
+	return nil
+}
+
+// LookupName returns the account the name is registered to.
+func (db *Database) LookupName(name string) (AccountID, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	accountID, exists := db.names[name]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrNameNotFound, name)
+	}
+
+	return accountID, nil
+}
+
+// =============================================================================
+
+// checkNameRegistration checks the account can register the name in the
+// specified registry. Registering a name the account already owns is allowed.
+func checkNameRegistration(names map[string]AccountID, name string, accountID AccountID) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	if owner, exists := names[name]; exists && owner != accountID {
+		return fmt.Errorf("%w: %s", ErrNameTaken, name)
+	}
+
+	return nil
+}
+
+// copyNames makes a copy of the specified registry.
+func copyNames(names map[string]AccountID) map[string]AccountID {
+	cpy := make(map[string]AccountID, len(names))
+	for name, accountID := range names {
+		cpy[name] = accountID
+	}
+
+	return cpy
+}
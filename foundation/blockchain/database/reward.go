@@ -0,0 +1,196 @@
+package database
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// TotalBasisPoints is the sum the basis points of a reward split must add up
+// to, representing 100% of the credit.
+const TotalBasisPoints = 10000
+
+// RewardSplit represents an account receiving a share of the mining reward,
+// gas fees and tips credited to the beneficiary of a block.
+type RewardSplit struct {
+	AccountID   AccountID `json:"account"`      // Account receiving the share.
+	BasisPoints uint64    `json:"basis_points"` // Share of the credit in 1/100th of a percent.
+}
+
+// ValidateRewardSplits checks the set of reward splits is valid. An empty
+// set is valid and means the beneficiary receives the full credit.
+func ValidateRewardSplits(splits []RewardSplit) error {
+	if len(splits) == 0 {
+		return nil
+	}
+
+	var total uint64
+	seen := make(map[AccountID]bool, len(splits))
+
+	for _, split := range splits {
+		if !split.AccountID.IsAccountID() {
+			return fmt.Errorf("reward split invalid, account %q is not properly formatted", split.AccountID)
+		}
+
+		if seen[split.AccountID] {
+			return fmt.Errorf("reward split invalid, account %s is listed more than once", split.AccountID)
+		}
+		seen[split.AccountID] = true
+
+		if split.BasisPoints == 0 || split.BasisPoints > TotalBasisPoints {
+			return fmt.Errorf("reward split invalid, account %s basis points %d, must be between 1 and %d", split.AccountID, split.BasisPoints, TotalBasisPoints)
+		}
+		total += split.BasisPoints
+	}
+
+	if total != TotalBasisPoints {
+		return fmt.Errorf("reward split invalid, basis points sum to %d, exp %d", total, TotalBasisPoints)
+	}
+
+	return nil
+}
+
+// ToRewardSplits converts a set of account:basis-points strings into a set
+// of validated reward splits.
+func ToRewardSplits(values []string) ([]RewardSplit, error) {
+	var splits []RewardSplit
+	for _, value := range values {
+		account, bps, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("reward split %q invalid, must be account:basis-points", value)
+		}
+
+		accountID, err := ToAccountID(account)
+		if err != nil {
+			return nil, fmt.Errorf("reward split %q invalid: %w", value, err)
+		}
+
+		basisPoints, err := strconv.ParseUint(bps, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reward split %q invalid: %w", value, err)
+		}
+
+		splits = append(splits, RewardSplit{AccountID: accountID, BasisPoints: basisPoints})
+	}
+
+	if err := ValidateRewardSplits(splits); err != nil {
+		return nil, err
+	}
+
+	return splits, nil
+}
+
+// Earnings returns the amounts credited to accounts on behalf of the
+// beneficiaries of the blocks in the from/to range: the mining reward along
+// with the gas fees and tips paid by the transactions. The amounts credited
+// depend on the balances at the time, so the chain is replayed from genesis
+// without changing the database.
+func (db *Database) Earnings(from uint64, to uint64) (map[AccountID]uint64, error) {
+	replay, err := open(db.genesis, db.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	earnings := make(map[AccountID]uint64)
+	earn := func(header BlockHeader, amount uint64) {
+		credits, err := beneficiaryCredits(map[AccountID]Account{}, header, amount)
+		if err != nil || amount == 0 {
+			return
+		}
+
+		for _, account := range credits {
+			earnings[account.AccountID] += account.Balance
+		}
+	}
+
+	iter := db.ForEach()
+	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		if block.Header.Number > to {
+			break
+		}
+		inRange := block.Header.Number >= from
+
+		// Failed transactions and rewards are skipped the same way they
+		// were when the block was first processed.
+		for _, tx := range block.MerkleTree.Values() {
+			fee, tip, _ := replay.applyTxCredits(replay.accounts, replay.names, block, tx)
+			if inRange {
+				earn(block.Header, fee)
+				earn(block.Header, tip)
+			}
+		}
+
+		if err := applyMiningReward(replay.accounts, block); err == nil && inRange {
+			earn(block.Header, block.Header.MiningReward)
+		}
+	}
+
+	return earnings, nil
+}
+
+// =============================================================================
+
+// CORE NOTE: The reward splits are carried in the block header, so every node
+// replaying the block credits the same accounts no matter how it's configured.
+// Each account receives its share rounded down, and what's left over from the
+// rounding goes to the beneficiary so the full amount is always credited and
+// no value is created or lost.
+
+// beneficiaryCredits returns the accounts credited with the specified amount
+// on behalf of the beneficiary of the block, with their new balances. Nothing
+// is changed in the accounts, so the caller can apply the credits once every
+// other check has passed.
+func beneficiaryCredits(accounts map[AccountID]Account, header BlockHeader, amount uint64) ([]Account, error) {
+	shares := make(map[AccountID]uint64, len(header.RewardSplits)+1)
+	order := make([]AccountID, 0, len(header.RewardSplits)+1)
+
+	addShare := func(accountID AccountID, share uint64) {
+		if _, exists := shares[accountID]; !exists {
+			order = append(order, accountID)
+		}
+		shares[accountID] += share
+	}
+
+	remaining := amount
+	for _, split := range header.RewardSplits {
+		// The splits are validated with the block, but the credits can be
+		// calculated before that, so never credit more than the amount.
+		bps := split.BasisPoints
+		if bps > TotalBasisPoints {
+			bps = TotalBasisPoints
+		}
+
+		hi, lo := bits.Mul64(amount, bps)
+		share, _ := bits.Div64(hi, lo, TotalBasisPoints)
+		if share > remaining {
+			share = remaining
+		}
+		remaining -= share
+
+		addShare(split.AccountID, share)
+	}
+	addShare(header.BeneficiaryID, remaining)
+
+	credits := make([]Account, 0, len(order))
+	for _, accountID := range order {
+		account, exists := accounts[accountID]
+		if !exists {
+			account = newAccount(accountID, 0)
+		}
+
+		balance, err := addBalance(account.Balance, shares[accountID])
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", accountID, err)
+		}
+		account.Balance = balance
+
+		credits = append(credits, account)
+	}
+
+	return credits, nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+)
+
+// sigCacheSize is the number of recovered accounts kept in the cache.
+const sigCacheSize = 10000
+
+// CORE NOTE: Recovering the account that signed a transaction is an ECDSA
+// public key recovery, the most expensive step in validating a transaction.
+// The same transaction is validated when it enters the mempool, when a peer
+// shares it again and when it arrives in a block. The recovered accounts are
+// cached so the recovery only happens once. The key is a hash of the signed
+// data along with the signature, since the account recovered from a signature
+// depends on the data it signs. Nothing is ever invalidated, the same data and
+// signature always recover the same account.
+
+// recovered is the cache of the accounts recovered from transactions.
+var recovered = newSigCache(sigCacheSize)
+
+// FromAccount returns the account that signed the transaction for the
+// specified signing domain. Transactions seen before are served from a cache.
+func (tx SignedTx) FromAccount(domain string) (AccountID, error) {
+	key := sigCacheKey(domain, tx)
+	if accountID, exists := recovered.get(key); exists {
+		return accountID, nil
+	}
+
+	address, err := signature.FromAddressWithDomain(domain, tx.Tx, tx.V, tx.R, tx.S)
+	if err != nil {
+		return "", err
+	}
+
+	accountID := AccountID(address)
+	recovered.add(key, accountID)
+
+	return accountID, nil
+}
+
+// sigCacheKey returns the cache key for the transaction signed for the
+// specified signing domain.
+func sigCacheKey(domain string, tx SignedTx) [sha256.Size]byte {
+	h := sha256.New()
+
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(domain)))
+	h.Write(size[:])
+	h.Write([]byte(domain))
+
+	h.Write(tx.SigningBytes())
+	h.Write(signature.ToSignatureBytes(tx.V, tx.R, tx.S))
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	return key
+}
+
+// =============================================================================
+
+// sigCache is a bounded cache of recovered accounts that evicts the least
+// recently used account when it's full.
+type sigCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+// sigCacheEntry is the value held by each element of the cache order.
+type sigCacheEntry struct {
+	key       [sha256.Size]byte
+	accountID AccountID
+}
+
+// newSigCache constructs a cache holding up to size accounts.
+func newSigCache(size int) *sigCache {
+	return &sigCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// get returns the account for the key, marking it as recently used.
+func (c *sigCache) get(key [sha256.Size]byte) (AccountID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(sigCacheEntry).accountID, true
+}
+
+// add stores the account for the key, evicting the least recently used
+// account if the cache is full.
+func (c *sigCache) add(key [sha256.Size]byte, accountID AccountID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(sigCacheEntry{key: key, accountID: accountID})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(sigCacheEntry).key)
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+)
+
+// ErrNoSnapshot is returned when there is no snapshot in storage.
+var ErrNoSnapshot = errors.New("no snapshot in storage")
+
+// ErrSnapshotNotSupported is returned when the storage doesn't support
+// writing snapshots.
+var ErrSnapshotNotSupported = errors.New("storage does not support snapshots")
+
+// Snapshotter interface represents the behavior a storage package can
+// implement to support writing and reading snapshots of the accounts.
+type Snapshotter interface {
+	WriteSnapshot(snapshot Snapshot) error
+	ReadSnapshot() (Snapshot, error)
+	ForEachFrom(num uint64) Iterator
+}
+
+// Snapshot represents the state of the accounts after the specified block
+// was applied.
+type Snapshot struct {
+	Number    uint64               `json:"number"`          // Number of the block the snapshot was taken after.
+	BlockHash string               `json:"block_hash"`      // Hash of the block the snapshot was taken after.
+	StateRoot string               `json:"state_root"`      // State root of the accounts in the snapshot.
+	TxCount   uint64               `json:"tx_count"`        // Number of transactions in the blocks up to the snapshot.
+	TotalWork *big.Int             `json:"total_work"`      // Expected number of hashes to mine the blocks up to the snapshot.
+	Accounts  []Account            `json:"accounts"`        // Accounts sorted by account id.
+	Names     map[string]AccountID `json:"names,omitempty"` // Registered names and the accounts they belong to.
+}
+
+// CORE NOTE: A snapshot lets a node skip replaying the blocks it already
+// applied when it starts up. The snapshot is only trusted when the block it
+// was taken after is still in storage with the same hash, and the state root
+// of the snapshot's accounts matches the state root in that block's header.
+// Otherwise the snapshot is ignored and the full chain is replayed. When
+// the genesis leaves empty accounts out of the state root, they are left out
+// of the snapshot as well.
+
+// Snapshot returns a snapshot of the accounts after the latest block.
+func (db *Database) Snapshot() Snapshot {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	accounts := db.sortedAccounts()
+
+	return Snapshot{
+		Number:    db.latestBlock.Header.Number,
+		BlockHash: db.latestBlock.Hash(),
+		StateRoot: signature.Hash(accounts),
+		TxCount:   db.txCount,
+		TotalWork: new(big.Int).Set(db.totalWork),
+		Accounts:  accounts,
+		Names:     copyNames(db.names),
+	}
+}
+
+// WriteSnapshot writes a snapshot of the accounts after the latest block to
+// storage, replacing any previous snapshot.
+func (db *Database) WriteSnapshot() (Snapshot, error) {
+	snapshotter, ok := db.storage.(Snapshotter)
+	if !ok {
+		return Snapshot{}, ErrSnapshotNotSupported
+	}
+
+	snapshot := db.Snapshot()
+	if snapshot.Number == 0 {
+		return Snapshot{}, ErrNoBlocks
+	}
+
+	if err := snapshotter.WriteSnapshot(snapshot); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// =============================================================================
+
+// loadSnapshot replaces the genesis accounts with the accounts in the latest
+// snapshot in storage, and returns an iterator over the blocks after it. When
+// there is no snapshot or it can't be trusted, the accounts are left alone
+// and an iterator over every block is returned.
+func (db *Database) loadSnapshot(evHandler func(v string, args ...any)) DatabaseIterator {
+	ev := func(v string, args ...any) {
+		if evHandler != nil {
+			evHandler(v, args...)
+		}
+	}
+
+	snapshotter, ok := db.storage.(Snapshotter)
+	if !ok {
+		return db.ForEach()
+	}
+
+	snapshot, err := snapshotter.ReadSnapshot()
+	if err != nil {
+		if !errors.Is(err, ErrNoSnapshot) {
+			ev("database: loadSnapshot: WARNING: %s", err)
+		}
+		return db.ForEach()
+	}
+
+	block, err := verifySnapshot(db, snapshot)
+	if err != nil {
+		ev("database: loadSnapshot: WARNING: ignoring snapshot blk[%d]: %s", snapshot.Number, err)
+		return db.ForEach()
+	}
+
+	accounts := make(map[AccountID]Account, len(snapshot.Accounts))
+	for _, account := range snapshot.Accounts {
+		accounts[account.AccountID] = account
+	}
+
+	db.accounts = accounts
+	db.names = copyNames(snapshot.Names)
+	db.latestBlock = block
+	db.txCount = snapshot.TxCount
+	db.totalWork = new(big.Int)
+	if snapshot.TotalWork != nil {
+		db.totalWork.Set(snapshot.TotalWork)
+	}
+	db.indexBlock(block)
+
+	ev("database: loadSnapshot: loaded snapshot: blk[%d]", snapshot.Number)
+
+	return DatabaseIterator{iterator: snapshotter.ForEachFrom(snapshot.Number)}
+}
+
+// verifySnapshot checks the snapshot matches the block it was taken after,
+// and returns that block.
+func verifySnapshot(db *Database, snapshot Snapshot) (Block, error) {
+	if snapshot.Number == 0 {
+		return Block{}, errors.New("snapshot has no block number")
+	}
+
+	block, err := db.GetBlock(snapshot.Number)
+	if err != nil {
+		return Block{}, err
+	}
+
+	if hash := block.Hash(); hash != snapshot.BlockHash {
+		return Block{}, fmt.Errorf("block hash mismatch, got %s, exp %s", snapshot.BlockHash, hash)
+	}
+
+	accounts := make(map[AccountID]Account, len(snapshot.Accounts))
+	for _, account := range snapshot.Accounts {
+		if _, exists := accounts[account.AccountID]; exists {
+			return Block{}, fmt.Errorf("account %s is listed more than once", account.AccountID)
+		}
+		accounts[account.AccountID] = account
+	}
+
+	if stateRoot := signature.Hash(sortAccounts(accounts, db.genesis.PruneEmpty)); stateRoot != block.Header.StateRoot {
+		return Block{}, fmt.Errorf("%w, got %s, exp %s", ErrStateRootMismatch, stateRoot, block.Header.StateRoot)
+	}
+
+	return block, nil
+}
@@ -3,24 +3,47 @@ package database
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
+	"math/bits"
 	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
 )
 
+// Set of gas unit costs used to calculate the minimum number of gas units a
+// transaction must declare to be accepted.
+const (
+	GasUnitsBase     = 1 // Ethereum: 21000 units charged for every transaction.
+	GasUnitsDataByte = 1 // Ethereum: 16 units charged for each byte of data.
+)
+
+// ErrInvalidChainID is returned when a transaction was signed for a
+// different chain than the one this node is running.
+var ErrInvalidChainID = errors.New("invalid chain id")
+
+// ErrTxExpired is returned when a transaction is past the last block it
+// can be mined in.
+var ErrTxExpired = errors.New("transaction is past its deadline")
+
+// ErrInvalidTimeStamp is returned when a transaction's timestamp is too far
+// from the node's clock or is after the timestamp of its block.
+var ErrInvalidTimeStamp = errors.New("invalid transaction timestamp")
+
 // Tx is the transactional information between two parties.
 type Tx struct {
-	ChainID uint16    `json:"chain_id"` // Ethereum: The chain id that is listed in the genesis file.
-	Nonce   uint64    `json:"nonce"`    // Ethereum: Unique id for the transaction supplied by the user.
-	FromID  AccountID `json:"from"`     // Ethereum: Account sending the transaction. Will be checked against signature.
-	ToID    AccountID `json:"to"`       // Ethereum: Account receiving the benefit of the transaction.
-	Value   uint64    `json:"value"`    // Ethereum: Monetary value received from this transaction.
-	Tip     uint64    `json:"tip"`      // Ethereum: Tip offered by the sender as an incentive to mine this transaction.
-	Data    []byte    `json:"data"`     // Ethereum: Extra data related to the transaction.
+	ChainID         uint16    `json:"chain_id"`                    // Ethereum: The chain id that is listed in the genesis file.
+	Nonce           uint64    `json:"nonce"`                       // Ethereum: Unique id for the transaction supplied by the user.
+	FromID          AccountID `json:"from"`                        // Ethereum: Account sending the transaction. Will be checked against signature.
+	ToID            AccountID `json:"to"`                          // Ethereum: Account receiving the benefit of the transaction.
+	Value           uint64    `json:"value"`                       // Ethereum: Monetary value received from this transaction.
+	Tip             uint64    `json:"tip"`                         // Ethereum: Tip offered by the sender as an incentive to mine this transaction.
+	Data            []byte    `json:"data"`                        // Ethereum: Extra data related to the transaction.
+	ValidUntilBlock uint64    `json:"valid_until_block,omitempty"` // Last block the transaction can be mined in, 0 is no deadline.
+	Category        Category  `json:"category,omitempty"`          // Kind of transaction, 0 is no category.
 }
 
 // NewTx constructs a new transaction.
@@ -46,11 +69,18 @@ func NewTx(chainID uint16, nonce uint64, fromID, toID AccountID, value uint64, t
 	return tx, nil
 }
 
-// Sign uses the specified private key to sign the transaction.
+// Sign uses the specified private key to sign the transaction for a network
+// without a signing domain.
 func (tx Tx) Sign(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
+	return tx.SignWithDomain("", privateKey)
+}
+
+// SignWithDomain uses the specified private key to sign the transaction for
+// the network with the specified signing domain.
+func (tx Tx) SignWithDomain(domain string, privateKey *ecdsa.PrivateKey) (SignedTx, error) {
 
 	// Sign the transaction with the private key to produce a signature.
-	v, r, s, err := signature.Sign(tx, privateKey)
+	v, r, s, err := signature.SignWithDomain(domain, tx, privateKey)
 	if err != nil {
 		return SignedTx{}, err
 	}
@@ -67,6 +97,48 @@ func (tx Tx) Sign(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
 	return signedTx, nil
 }
 
+// SigningBytes implements the signature Signable interface and returns the
+// canonical encoding of the transaction used as the signing preimage. The
+// fields are concatenated in a fixed order, integers in big endian and
+// variable length values prefixed by their length, so changes to the struct
+// layout or JSON tags don't invalidate existing signatures.
+func (tx Tx) SigningBytes() []byte {
+	b := make([]byte, 0, 2+8+8+8+3*4+len(tx.FromID)+len(tx.ToID)+len(tx.Data))
+
+	b = binary.BigEndian.AppendUint16(b, tx.ChainID)
+	b = binary.BigEndian.AppendUint64(b, tx.Nonce)
+	b = appendLengthPrefixed(b, []byte(tx.FromID))
+	b = appendLengthPrefixed(b, []byte(tx.ToID))
+	b = binary.BigEndian.AppendUint64(b, tx.Value)
+	b = binary.BigEndian.AppendUint64(b, tx.Tip)
+	b = appendLengthPrefixed(b, tx.Data)
+
+	// The deadline and category are optional and only encoded when set, so
+	// the signatures of transactions without them are unchanged. They have
+	// different sizes, so the encoding stays unambiguous.
+	if tx.ValidUntilBlock != 0 {
+		b = binary.BigEndian.AppendUint64(b, tx.ValidUntilBlock)
+	}
+
+	if tx.Category != CategoryNone {
+		b = append(b, byte(tx.Category))
+	}
+
+	return b
+}
+
+// Expired reports whether the transaction is past its deadline for a block
+// with the specified number.
+func (tx Tx) Expired(blockNumber uint64) bool {
+	return tx.ValidUntilBlock != 0 && blockNumber > tx.ValidUntilBlock
+}
+
+// MinGasUnits calculates the minimum number of gas units required to process
+// this transaction based on a base cost and a cost per byte of data.
+func (tx Tx) MinGasUnits() uint64 {
+	return GasUnitsBase + uint64(len(tx.Data))*GasUnitsDataByte
+}
+
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // SignedTx is a signed version of the transaction. This is how clients like
@@ -80,10 +152,11 @@ type SignedTx struct {
 
 // Validate verifies the transaction has a proper signature that conforms to our
 // standards. Also checks that the from field matches the account that signed the
-// transaction. Lastly, checks the format of the from and to fields.
-func (tx SignedTx) Validate(chainID uint16) error {
+// transaction for the signing domain. Lastly, checks the format of the from and
+// to fields.
+func (tx SignedTx) Validate(chainID uint16, domain string) error {
 	if tx.ChainID != chainID {
-		return fmt.Errorf("invalid chain id, got[%d] exp[%d]", tx.ChainID, chainID)
+		return fmt.Errorf("%w, got[%d] exp[%d]", ErrInvalidChainID, tx.ChainID, chainID)
 	}
 
 	if !tx.FromID.IsAccountID() {
@@ -102,25 +175,18 @@ func (tx SignedTx) Validate(chainID uint16) error {
 		return err
 	}
 
-	address, err := signature.FromAddress(tx.Tx, tx.V, tx.R, tx.S)
+	accountID, err := tx.FromAccount(domain)
 	if err != nil {
 		return err
 	}
 
-	if address != string(tx.FromID) {
+	if accountID != tx.FromID {
 		return errors.New("signature address doesn't match the from address")
 	}
 
 	return nil
 }
 
-// FromAccount extracts the account id that signed the transaction.
-// DEPRECATED: You can directly use the tx.FromID.
-func (tx SignedTx) FromAccount() (AccountID, error) {
-	address, err := signature.FromAddress(tx.Tx, tx.V, tx.R, tx.S)
-	return AccountID(address), err
-}
-
 // SignatureString returns the signature as a string.
 func (tx SignedTx) SignatureString() string {
 	return signature.SignatureString(tx.V, tx.R, tx.S)
@@ -152,6 +218,63 @@ func NewBlockTx(signedTx SignedTx, gasPrice uint64, unitsOfGas uint64) BlockTx {
 	}
 }
 
+// Validate performs the signed transaction validation and then verifies the
+// declared gas units are enough to cover the minimum gas for this transaction.
+func (tx BlockTx) Validate(chainID uint16, domain string) error {
+	if err := tx.SignedTx.Validate(chainID, domain); err != nil {
+		return err
+	}
+
+	if err := tx.ValidateGas(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateGas verifies the declared gas units are not below the minimum number
+// of gas units required to process this transaction.
+func (tx BlockTx) ValidateGas() error {
+	if minGas := tx.MinGasUnits(); tx.GasUnits < minGas {
+		return fmt.Errorf("transaction invalid, insufficient gas units, got %d, exp at least %d", tx.GasUnits, minGas)
+	}
+
+	return nil
+}
+
+// Cost returns the most the transaction can take from the sending account,
+// which is the value, the tip and the full gas fee. An error is returned if
+// the cost overflows a uint64.
+func (tx BlockTx) Cost() (uint64, error) {
+	hi, gasFee := bits.Mul64(tx.GasPrice, tx.GasUnits)
+	if hi != 0 {
+		return 0, ErrBalanceOverflow
+	}
+
+	cost, err := addBalance(tx.Value, tx.Tip)
+	if err != nil {
+		return 0, err
+	}
+
+	return addBalance(cost, gasFee)
+}
+
+// ValidateTimeStamp verifies the transaction's timestamp is within the
+// tolerance of the specified time, rejecting transactions that claim to be
+// from the far future or are too old.
+func (tx BlockTx) ValidateTimeStamp(now time.Time, tolerance time.Duration) error {
+	txTime := time.UnixMilli(int64(tx.TimeStamp))
+
+	switch {
+	case txTime.After(now.Add(tolerance)):
+		return fmt.Errorf("transaction invalid, %w, %s is in the future, tolerance %v", ErrInvalidTimeStamp, txTime.UTC(), tolerance)
+	case txTime.Before(now.Add(-tolerance)):
+		return fmt.Errorf("transaction invalid, %w, %s is stale, tolerance %v", ErrInvalidTimeStamp, txTime.UTC(), tolerance)
+	}
+
+	return nil
+}
+
 // Hash implements the merkle Hashable interface for providing a hash
 // of a block transaction.
 func (tx BlockTx) Hash() ([]byte, error) {
@@ -170,3 +293,12 @@ func (tx BlockTx) Equals(otherTx BlockTx) bool {
 
 	return tx.Nonce == otherTx.Nonce && bytes.Equal(txSig, otherTxSig)
 }
+
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// appendLengthPrefixed appends the length of the data as a big endian uint32
+// followed by the data itself.
+func appendLengthPrefixed(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+)
+
+// ErrNoBlocks is returned when there are no blocks in storage to verify.
+var ErrNoBlocks = errors.New("no blocks in storage")
+
+// StateRootReport represents the result of replaying the chain in storage
+// and comparing the computed state root with the latest block header.
+type StateRootReport struct {
+	Number    uint64 `json:"number"`     // Number of the latest block in storage.
+	StateRoot string `json:"state_root"` // State root stored in the latest block header.
+	Computed  string `json:"computed"`   // State root computed after replaying the chain.
+	Match     bool   `json:"match"`      // Computed state root matches the header.
+}
+
+// CORE NOTE: A block's state root is the hash of the accounts after the
+// block is applied, so the state root of the latest block must match the
+// final state of the replayed chain. The replay doesn't validate any block,
+// so a change made to any block in storage ends up in the final state and
+// is reported as a mismatch.
+
+// VerifyStateRoot replays every block in storage on top of the genesis
+// accounts and compares the computed state root with the state root stored
+// in the latest block header.
+func VerifyStateRoot(genesis genesis.Genesis, storage Storage) (StateRootReport, error) {
+	db, err := open(genesis, storage)
+	if err != nil {
+		return StateRootReport{}, err
+	}
+
+	if err := db.replay(db.ForEach(), nil); err != nil {
+		return StateRootReport{}, err
+	}
+
+	latest := db.LatestBlock()
+	if latest.Header.Number == 0 {
+		return StateRootReport{}, ErrNoBlocks
+	}
+
+	report := StateRootReport{
+		Number:    latest.Header.Number,
+		StateRoot: latest.Header.StateRoot,
+		Computed:  db.HashState(),
+	}
+	report.Match = report.Computed == report.StateRoot
+
+	return report, nil
+}
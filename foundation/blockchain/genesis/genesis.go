@@ -3,18 +3,47 @@ package genesis
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/codec"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
+)
+
+// Set of bounds for the difficulty of the work problem. A block hash is 64
+// hex characters, so a difficulty above the max would be impossible to solve.
+const (
+	MinDifficulty = 1
+	MaxDifficulty = 63
+)
+
+// Set of policies for the gas fee of a transaction that fails to apply.
+const (
+	FailedTxCharge = "charge"
+	FailedTxRefund = "refund"
 )
 
 // Genesis represents the genesis file.
 type Genesis struct {
 	Date          time.Time         `json:"date"`
-	ChainID       uint16            `json:"chain_id"`        // The chain id represents a unique id for this running instance.
-	TransPerBlock uint16            `json:"trans_per_block"` // The maximum number of transaction that can be in a block.
-	Difficulty    uint16            `json:"difficulty"`      // Difficulty level to solve the work problem.
-	MiningReward  uint64            `json:"mining_reward"`   // Reward for mining the block.
-	GasPrice      uint64            `json:"gas_price"`       // Fee paid for each transaction mined into a block.
+	ChainID       uint16            `json:"chain_id"`                     // The chain id represents a unique id for this running instance.
+	TransPerBlock uint16            `json:"trans_per_block"`              // The maximum number of transaction that can be in a block.
+	AccountTxCap  uint16            `json:"account_tx_cap,omitempty"`     // The maximum number of transactions from one account in a block, 0 is no limit.
+	Difficulty    uint16            `json:"difficulty"`                   // Difficulty level to solve the work problem.
+	DiffFloor     uint16            `json:"difficulty_floor,omitempty"`   // The lowest difficulty a retarget can produce, 0 is the min difficulty.
+	DiffCeiling   uint16            `json:"difficulty_ceiling,omitempty"` // The highest difficulty a retarget can produce, 0 is the max difficulty.
+	MiningReward  uint64            `json:"mining_reward"`                // Reward for mining the block.
+	GasPrice      uint64            `json:"gas_price"`                    // Fee paid for each transaction mined into a block.
+	HashAlgorithm string            `json:"hash_algorithm,omitempty"`     // Algorithm used to hash the block headers, empty is sha256.
+	DataCodec     string            `json:"data_codec,omitempty"`         // Codec the transaction data must be valid for, empty is opaque.
+	SigningDomain string            `json:"signing_domain,omitempty"`     // Domain mixed into transaction signatures for replay protection, empty is none.
+	MinTxValue    uint64            `json:"min_tx_value,omitempty"`       // The smallest value a transaction can transfer, 0 is no minimum.
+	ZeroValueTx   bool              `json:"zero_value_tx,omitempty"`      // Exempts transactions transferring no value from the minimum, like data only transactions.
+	FailedTxFee   string            `json:"failed_tx_fee,omitempty"`      // Policy for the gas fee of a failed transaction, charge or refund, empty is charge.
+	PruneEmpty    bool              `json:"prune_empty,omitempty"`        // Leaves empty accounts out of the state root so nodes can prune them, only set for a new chain.
+	Allowlist     []string          `json:"allowlist,omitempty"`          // Accounts permitted to send transactions, empty lets any account transact.
 	Balances      map[string]uint64 `json:"balances"`
 }
 
@@ -32,5 +61,128 @@ func Load() (Genesis, error) {
 		return Genesis{}, err
 	}
 
+	if err := genesis.Validate(); err != nil {
+		return Genesis{}, err
+	}
+
 	return genesis, nil
 }
+
+// NetworkID returns an id derived from hashing the full genesis information.
+// Two networks can share a chain id by accident, but only nodes with the
+// same network id started from the same genesis and are running the same chain.
+func (g Genesis) NetworkID() string {
+	return signature.Hash(g)
+}
+
+// Validate checks the genesis values are within sane bounds.
+func (g Genesis) Validate() error {
+	if g.Difficulty < MinDifficulty || g.Difficulty > MaxDifficulty {
+		return fmt.Errorf("invalid difficulty %d, must be between %d and %d", g.Difficulty, MinDifficulty, MaxDifficulty)
+	}
+
+	if g.DiffFloor > MaxDifficulty {
+		return fmt.Errorf("invalid difficulty floor %d, must be between %d and %d", g.DiffFloor, MinDifficulty, MaxDifficulty)
+	}
+
+	if g.DiffCeiling > MaxDifficulty {
+		return fmt.Errorf("invalid difficulty ceiling %d, must be between %d and %d", g.DiffCeiling, MinDifficulty, MaxDifficulty)
+	}
+
+	floor, ceiling := g.DifficultyBounds()
+	if floor > ceiling {
+		return fmt.Errorf("invalid difficulty bounds, floor %d is above ceiling %d", floor, ceiling)
+	}
+
+	if g.Difficulty < floor || g.Difficulty > ceiling {
+		return fmt.Errorf("invalid difficulty %d, must be between floor %d and ceiling %d", g.Difficulty, floor, ceiling)
+	}
+
+	if !signature.IsHashAlgorithm(g.HashAlgorithm) {
+		return fmt.Errorf("invalid hash algorithm %q, must be %s or %s", g.HashAlgorithm, signature.HashSHA256, signature.HashKeccak256)
+	}
+
+	if !codec.IsRegistered(g.DataCodec) {
+		return fmt.Errorf("invalid data codec %q, codec is not registered", g.DataCodec)
+	}
+
+	switch g.FailedTxFee {
+	case "", FailedTxCharge, FailedTxRefund:
+	default:
+		return fmt.Errorf("invalid failed tx fee policy %q, must be %s or %s", g.FailedTxFee, FailedTxCharge, FailedTxRefund)
+	}
+
+	return nil
+}
+
+// RefundsFailedTx reports whether a transaction that fails to apply is
+// dropped without taking the gas fee, instead of charging it as anti-spam.
+func (g Genesis) RefundsFailedTx() bool {
+	return g.FailedTxFee == FailedTxRefund
+}
+
+// Permissioned reports whether only the accounts on the allowlist are
+// permitted to send transactions.
+func (g Genesis) Permissioned() bool {
+	return len(g.Allowlist) > 0
+}
+
+// Allowed reports whether the account is permitted to send transactions. Any
+// account is allowed when the allowlist is empty. Account ids are compared
+// without regard to the case of their checksum.
+func (g Genesis) Allowed(accountID string) bool {
+	if !g.Permissioned() {
+		return true
+	}
+
+	for _, allowed := range g.Allowlist {
+		if strings.EqualFold(allowed, accountID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DifficultyBounds returns the floor and ceiling for the difficulty of the
+// work problem. Bounds that are not set default to the min and max difficulty.
+func (g Genesis) DifficultyBounds() (floor uint16, ceiling uint16) {
+	floor, ceiling = MinDifficulty, MaxDifficulty
+
+	if g.DiffFloor != 0 {
+		floor = g.DiffFloor
+	}
+	if g.DiffCeiling != 0 {
+		ceiling = g.DiffCeiling
+	}
+
+	return floor, ceiling
+}
+
+// CORE NOTE: Difficulty retargeting isn't implemented yet, every block is
+// mined at the genesis difficulty. Any retarget calculation belongs in
+// ExpectedDifficulty so miners and validators agree on it, and must pass its
+// result through ClampDifficulty so a sudden drop in hashrate can't drive the
+// difficulty to a trivial value, and a spike can't stall the chain with a
+// difficulty that is impossible to solve.
+
+// ExpectedDifficulty returns the difficulty a POW block at the specified
+// height must be mined with.
+func (g Genesis) ExpectedDifficulty(number uint64) uint16 {
+	return g.ClampDifficulty(g.Difficulty)
+}
+
+// ClampDifficulty returns the difficulty limited to the genesis floor and
+// ceiling. The result is always a difficulty isHashSolved can check.
+func (g Genesis) ClampDifficulty(difficulty uint16) uint16 {
+	floor, ceiling := g.DifficultyBounds()
+
+	switch {
+	case difficulty < floor:
+		return floor
+	case difficulty > ceiling:
+		return ceiling
+	}
+
+	return difficulty
+}
@@ -0,0 +1,236 @@
+package genesis_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Difficulty(t *testing.T) {
+	type table struct {
+		name       string
+		difficulty uint16
+		success    bool
+	}
+
+	tt := []table{
+		{name: "zero", difficulty: 0, success: false},
+		{name: "min", difficulty: genesis.MinDifficulty, success: true},
+		{name: "typical", difficulty: 6, success: true},
+		{name: "above match string", difficulty: 18, success: true},
+		{name: "max", difficulty: genesis.MaxDifficulty, success: true},
+		{name: "hash length", difficulty: 64, success: false},
+		{name: "huge", difficulty: 1000, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			g := genesis.Genesis{ChainID: 1, Difficulty: tst.difficulty}
+
+			err := g.Validate()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept difficulty %d: %v", tst.name, tst.difficulty, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject difficulty %d.", tst.name, tst.difficulty)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_NetworkID(t *testing.T) {
+	base := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   6,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 1000000},
+	}
+
+	type table struct {
+		name string
+		gen  genesis.Genesis
+		same bool
+	}
+
+	tt := []table{
+		{name: "same genesis", gen: base, same: true},
+		{name: "chain id", gen: genesis.Genesis{ChainID: 2, Difficulty: 6, MiningReward: 700, Balances: base.Balances}},
+		{name: "difficulty", gen: genesis.Genesis{ChainID: 1, Difficulty: 7, MiningReward: 700, Balances: base.Balances}},
+		{name: "mining reward", gen: genesis.Genesis{ChainID: 1, Difficulty: 6, MiningReward: 800, Balances: base.Balances}},
+		{name: "balances", gen: genesis.Genesis{ChainID: 1, Difficulty: 6, MiningReward: 700, Balances: map[string]uint64{"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 1}}},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			same := tst.gen.NetworkID() == base.NetworkID()
+			if same != tst.same {
+				t.Fatalf("Test %s:\tShould get back the same network id: %t, got %t", tst.name, tst.same, same)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_DifficultyBounds(t *testing.T) {
+	type table struct {
+		name    string
+		gen     genesis.Genesis
+		success bool
+	}
+
+	tt := []table{
+		{name: "no bounds", gen: genesis.Genesis{Difficulty: 6}, success: true},
+		{name: "within bounds", gen: genesis.Genesis{Difficulty: 6, DiffFloor: 4, DiffCeiling: 8}, success: true},
+		{name: "at bounds", gen: genesis.Genesis{Difficulty: 4, DiffFloor: 4, DiffCeiling: 4}, success: true},
+		{name: "below floor", gen: genesis.Genesis{Difficulty: 3, DiffFloor: 4}, success: false},
+		{name: "above ceiling", gen: genesis.Genesis{Difficulty: 9, DiffCeiling: 8}, success: false},
+		{name: "floor above ceiling", gen: genesis.Genesis{Difficulty: 6, DiffFloor: 8, DiffCeiling: 4}, success: false},
+		{name: "ceiling unsolvable", gen: genesis.Genesis{Difficulty: 6, DiffCeiling: 64}, success: false},
+		{name: "floor unsolvable", gen: genesis.Genesis{Difficulty: 6, DiffFloor: 64}, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := tst.gen.Validate()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept the difficulty bounds: %v", tst.name, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject the difficulty bounds.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_HashAlgorithm(t *testing.T) {
+	type table struct {
+		name      string
+		algorithm string
+		success   bool
+	}
+
+	tt := []table{
+		{name: "default", algorithm: "", success: true},
+		{name: "sha256", algorithm: "sha256", success: true},
+		{name: "keccak256", algorithm: "keccak256", success: true},
+		{name: "unknown", algorithm: "md5", success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			g := genesis.Genesis{ChainID: 1, Difficulty: 6, HashAlgorithm: tst.algorithm}
+
+			err := g.Validate()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept hash algorithm %q: %v", tst.name, tst.algorithm, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject hash algorithm %q.", tst.name, tst.algorithm)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_DataCodec(t *testing.T) {
+	type table struct {
+		name    string
+		codec   string
+		success bool
+	}
+
+	tt := []table{
+		{name: "default", codec: "", success: true},
+		{name: "opaque", codec: "opaque", success: true},
+		{name: "json", codec: "json", success: true},
+		{name: "tlv", codec: "tlv", success: true},
+		{name: "unknown", codec: "protobuf", success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			g := genesis.Genesis{ChainID: 1, Difficulty: 6, DataCodec: tst.codec}
+
+			err := g.Validate()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept data codec %q: %v", tst.name, tst.codec, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject data codec %q.", tst.name, tst.codec)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_FailedTxFee(t *testing.T) {
+	type table struct {
+		name    string
+		policy  string
+		refunds bool
+		success bool
+	}
+
+	tt := []table{
+		{name: "default", policy: "", refunds: false, success: true},
+		{name: "charge", policy: genesis.FailedTxCharge, refunds: false, success: true},
+		{name: "refund", policy: genesis.FailedTxRefund, refunds: true, success: true},
+		{name: "unknown", policy: "waive", success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			g := genesis.Genesis{ChainID: 1, Difficulty: 6, FailedTxFee: tst.policy}
+
+			err := g.Validate()
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould accept failed tx fee policy %q: %v", tst.name, tst.policy, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould reject failed tx fee policy %q.", tst.name, tst.policy)
+			}
+
+			if g.RefundsFailedTx() != tst.refunds {
+				t.Fatalf("Test %s:\tShould refund the fee of a failed tx: %t", tst.name, tst.refunds)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_ClampDifficulty(t *testing.T) {
+	type table struct {
+		name       string
+		gen        genesis.Genesis
+		difficulty uint16
+		exp        uint16
+	}
+
+	tt := []table{
+		{name: "within bounds", gen: genesis.Genesis{DiffFloor: 4, DiffCeiling: 8}, difficulty: 6, exp: 6},
+		{name: "hashrate drop", gen: genesis.Genesis{DiffFloor: 4, DiffCeiling: 8}, difficulty: 0, exp: 4},
+		{name: "hashrate spike", gen: genesis.Genesis{DiffFloor: 4, DiffCeiling: 8}, difficulty: math.MaxUint16, exp: 8},
+		{name: "default floor", gen: genesis.Genesis{}, difficulty: 0, exp: genesis.MinDifficulty},
+		{name: "default ceiling", gen: genesis.Genesis{}, difficulty: math.MaxUint16, exp: genesis.MaxDifficulty},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			got := tst.gen.ClampDifficulty(tst.difficulty)
+			if got != tst.exp {
+				t.Fatalf("Test %s:\tShould clamp difficulty %d to %d, got %d", tst.name, tst.difficulty, tst.exp, got)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
@@ -2,38 +2,108 @@
 package mempool
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"math"
+	"math/bits"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/mempool/selector"
 )
 
+// ErrReplaceGracePeriod is returned when a transaction is replaced after the
+// grace period since the original was first seen.
+var ErrReplaceGracePeriod = errors.New("replacement grace period has elapsed")
+
+// ErrReplaceMining is returned when a transaction is replaced while a block
+// including the original is being mined.
+var ErrReplaceMining = errors.New("transaction is being mined")
+
+// Stats represents a summary of the transactions in the mempool.
+type Stats struct {
+	Count     int    `json:"count"`
+	Bytes     int    `json:"bytes"`
+	Accounts  int    `json:"accounts"`
+	MinTip    uint64 `json:"min_tip"`
+	MaxTip    uint64 `json:"max_tip"`
+	MedianTip uint64 `json:"median_tip"`
+}
+
+// Config represents the settings for a mempool.
+type Config struct {
+	Strategy     string        // Sort strategy used to select transactions.
+	ReplaceGrace time.Duration // How long a transaction can be replaced, 0 is no limit.
+	LocalBoost   uint64        // Added to the tip of local transactions when selecting.
+	Shards       int           // Number of independently locked maps, 0 is one.
+}
+
+// CORE NOTE: Under heavy load a single lock over the whole mempool is a point
+// of contention between taking in new transactions, selecting transactions
+// for a block and removing mined ones. The transactions are sharded by the
+// hash of their from account into independent maps, each with its own lock.
+// Every transaction from an account lives in the same shard, so the nonce
+// ordering per account is kept, and selecting gathers across all shards.
+
 // Mempool represents a cache of transactions organized by account:nonce.
 type Mempool struct {
-	mu       sync.RWMutex
-	pool     map[string]database.BlockTx
-	selectFn selector.Func
+	shards       []*shard
+	replaceGrace time.Duration
+	localBoost   uint64
+	selectFn     selector.Func
 }
 
-// New constructs a new mempool with the specified sort strategy.
-func New() (*Mempool, error) {
-	return NewWithStrategy(selector.StrategyTip)
+// shard represents a subset of the transactions in the mempool, for the
+// accounts hashing to it.
+type shard struct {
+	mu     sync.RWMutex
+	pool   map[string]database.BlockTx
+	seen   map[string]time.Time
+	shared map[string]time.Time
+	mining map[string]struct{}
+	local  map[string]struct{}
 }
 
-// NewWithStrategy  constructs a new mempool with the specified sort strategy.
-func NewWithStrategy(strategy string) (*Mempool, error) {
-	selectFn, err := selector.Retrieve(strategy)
+// newShard constructs an empty shard.
+func newShard() *shard {
+	return &shard{
+		pool:   make(map[string]database.BlockTx),
+		seen:   make(map[string]time.Time),
+		shared: make(map[string]time.Time),
+		mining: make(map[string]struct{}),
+		local:  make(map[string]struct{}),
+	}
+}
+
+// NewWithConfig constructs a new mempool with the specified settings.
+func NewWithConfig(cfg Config) (*Mempool, error) {
+	selectFn, err := selector.Retrieve(cfg.Strategy)
 	if err != nil {
 		return nil, err
 	}
 
+	shards := cfg.Shards
+	switch {
+	case shards < 0:
+		return nil, errors.New("shards must be positive")
+	case shards == 0:
+		shards = 1
+	}
+
 	mp := Mempool{
-		pool:     make(map[string]database.BlockTx),
-		selectFn: selectFn,
+		shards:       make([]*shard, shards),
+		replaceGrace: cfg.ReplaceGrace,
+		localBoost:   cfg.LocalBoost,
+		selectFn:     selectFn,
+	}
+
+	for i := range mp.shards {
+		mp.shards[i] = newShard()
 	}
 
 	return &mp, nil
@@ -41,16 +111,35 @@ func NewWithStrategy(strategy string) (*Mempool, error) {
 
 // Count return the current number of transaction in the pool.
 func (mp *Mempool) Count() int {
-	mp.mu.RLock()
-	defer mp.mu.RUnlock()
+	var count int
+	for _, sh := range mp.shards {
+		sh.mu.RLock()
+		count += len(sh.pool)
+		sh.mu.RUnlock()
+	}
 
-	return len(mp.pool)
+	return count
 }
 
-// Upsert adds or replaces a transaction from the mempool.
+// Upsert adds or replaces a transaction shared by a peer in the mempool.
 func (mp *Mempool) Upsert(tx database.BlockTx) error {
-	mp.mu.Lock()
-	defer mp.mu.Unlock()
+	return mp.upsert(tx, false)
+}
+
+// UpsertLocal adds or replaces a transaction submitted directly to this
+// node in the mempool. Local transactions get the configured boost to their
+// priority when selecting transactions.
+func (mp *Mempool) UpsertLocal(tx database.BlockTx) error {
+	return mp.upsert(tx, true)
+}
+
+// upsert performs the work of Upsert and UpsertLocal, tagging the
+// transaction with its origin.
+func (mp *Mempool) upsert(tx database.BlockTx, local bool) error {
+	sh := mp.shardFor(tx.FromID)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
 	// CORE NOTE: Different blockchains have different algorithms to limit
 	// the size of the mempool. Some limit based on the amount of
@@ -67,38 +156,261 @@ func (mp *Mempool) Upsert(tx database.BlockTx) error {
 
 	// Ethereum requires a 10% bump in the tip to replace an existing
 	// transaction in the mempool and so do we. We want to limit users
-	// from this sort of behavior.
-	if etx, exists := mp.pool[key]; exists {
+	// from this sort of behavior. Replacement is also bounded in time so
+	// a transaction can't be swapped out from under a miner.
+	if etx, exists := sh.pool[key]; exists {
+		if _, mining := sh.mining[key]; mining {
+			return ErrReplaceMining
+		}
+
+		if mp.replaceGrace > 0 {
+			if elapsed := time.Since(sh.seen[key]); elapsed > mp.replaceGrace {
+				return fmt.Errorf("%w, first seen %v ago, grace %v", ErrReplaceGracePeriod, elapsed.Round(time.Millisecond), mp.replaceGrace)
+			}
+		}
+
 		if tx.Tip < uint64(math.Round(float64(etx.Tip)*1.10)) {
 			return errors.New("replacing a transaction requires a 10% increase of the tip")
 		}
 	}
 
-	mp.pool[key] = tx
+	// The grace period runs from when the original was first seen, so a
+	// replacement doesn't extend it.
+	if _, exists := sh.seen[key]; !exists {
+		sh.seen[key] = time.Now()
+	}
+
+	sh.pool[key] = tx
+
+	// A new transaction is shared when it's received, by the node it came
+	// from or by this node for a local transaction.
+	sh.shared[key] = time.Now()
+
+	// The origin is the origin of the latest version of the transaction.
+	if local {
+		sh.local[key] = struct{}{}
+	} else {
+		delete(sh.local, key)
+	}
 
 	return nil
 }
 
+// Contains checks if the exact transaction is already in the mempool.
+func (mp *Mempool) Contains(tx database.BlockTx) bool {
+	sh := mp.shardFor(tx.FromID)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	key, err := mapKey(tx)
+	if err != nil {
+		return false
+	}
+
+	etx, exists := sh.pool[key]
+	if !exists {
+		return false
+	}
+
+	return etx.SignatureString() == tx.SignatureString()
+}
+
 // Delete removes a transaction from the mempool.
 func (mp *Mempool) Delete(tx database.BlockTx) error {
-	mp.mu.RLock()
-	defer mp.mu.RUnlock()
+	sh := mp.shardFor(tx.FromID)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
 	key, err := mapKey(tx)
 	if err != nil {
 		return err
 	}
 
-	delete(mp.pool, key)
+	delete(sh.pool, key)
+	delete(sh.seen, key)
+	delete(sh.shared, key)
+	delete(sh.mining, key)
+	delete(sh.local, key)
 
 	return nil
 }
 
-func (mp *Mempool) Truncate() {
-	mp.mu.Lock()
-	defer mp.mu.Unlock()
+// MarkShared records the transaction was shared with the peers just now.
+func (mp *Mempool) MarkShared(tx database.BlockTx) {
+	sh := mp.shardFor(tx.FromID)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	key, err := mapKey(tx)
+	if err != nil {
+		return
+	}
+
+	if _, exists := sh.pool[key]; exists {
+		sh.shared[key] = time.Now()
+	}
+}
+
+// Unshared returns the transactions in the mempool that haven't been shared
+// with the peers for at least the specified age, oldest first.
+func (mp *Mempool) Unshared(age time.Duration) []database.BlockTx {
+	type unshared struct {
+		tx     database.BlockTx
+		shared time.Time
+	}
+
+	aged := make([]unshared, 0)
+	for _, sh := range mp.shards {
+		sh.mu.RLock()
+		for key, shared := range sh.shared {
+			if time.Since(shared) >= age {
+				aged = append(aged, unshared{tx: sh.pool[key], shared: shared})
+			}
+		}
+		sh.mu.RUnlock()
+	}
+
+	sort.Slice(aged, func(i, j int) bool { return aged[i].shared.Before(aged[j].shared) })
+
+	txs := make([]database.BlockTx, len(aged))
+	for i, u := range aged {
+		txs[i] = u.tx
+	}
+
+	return txs
+}
+
+// MarkMining records the transactions being mined into a block, so they
+// can't be replaced until mining is done. Marking replaces the transactions
+// marked by a previous mining operation.
+func (mp *Mempool) MarkMining(txs []database.BlockTx) {
+	mining := make(map[*shard]map[string]struct{}, len(mp.shards))
+	for _, tx := range txs {
+		if key, err := mapKey(tx); err == nil {
+			sh := mp.shardFor(tx.FromID)
+			if mining[sh] == nil {
+				mining[sh] = make(map[string]struct{})
+			}
+			mining[sh][key] = struct{}{}
+		}
+	}
+
+	for _, sh := range mp.shards {
+		sh.mu.Lock()
+		sh.mining = mining[sh]
+		if sh.mining == nil {
+			sh.mining = make(map[string]struct{})
+		}
+		sh.mu.Unlock()
+	}
+}
 
-	mp.pool = make(map[string]database.BlockTx)
+// ClearMining allows the transactions marked as being mined to be replaced
+// again, once mining is done.
+func (mp *Mempool) ClearMining() {
+	for _, sh := range mp.shards {
+		sh.mu.Lock()
+		sh.mining = make(map[string]struct{})
+		sh.mu.Unlock()
+	}
+}
+
+// Stats returns a summary of the transactions currently in the mempool. The
+// size in bytes is the size of the transactions serialized as JSON.
+func (mp *Mempool) Stats() Stats {
+	var stats Stats
+	tips := make([]uint64, 0, mp.Count())
+	accounts := make(map[database.AccountID]struct{})
+
+	for _, sh := range mp.shards {
+		sh.mu.RLock()
+		for _, tx := range sh.pool {
+			if data, err := json.Marshal(tx); err == nil {
+				stats.Bytes += len(data)
+			}
+
+			accounts[tx.FromID] = struct{}{}
+			tips = append(tips, tx.Tip)
+		}
+		sh.mu.RUnlock()
+	}
+
+	stats.Count = len(tips)
+	stats.Accounts = len(accounts)
+
+	if len(tips) == 0 {
+		return stats
+	}
+
+	sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+
+	stats.MinTip = tips[0]
+	stats.MaxTip = tips[len(tips)-1]
+
+	mid := len(tips) / 2
+	switch {
+	case len(tips)%2 == 1:
+		stats.MedianTip = tips[mid]
+	default:
+		stats.MedianTip = tips[mid-1] + (tips[mid]-tips[mid-1])/2
+	}
+
+	return stats
+}
+
+// PendingNonces returns the sorted nonces of the transactions in the mempool
+// sent from the specified account.
+func (mp *Mempool) PendingNonces(account database.AccountID) []uint64 {
+	sh := mp.shardFor(account)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	nonces := make([]uint64, 0)
+	for _, tx := range sh.pool {
+		if tx.FromID == account {
+			nonces = append(nonces, tx.Nonce)
+		}
+	}
+
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+
+	return nonces
+}
+
+// PendingTxs returns the transactions in the mempool sent from the specified
+// account, sorted by nonce.
+func (mp *Mempool) PendingTxs(account database.AccountID) []database.BlockTx {
+	sh := mp.shardFor(account)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	txs := make([]database.BlockTx, 0)
+	for _, tx := range sh.pool {
+		if tx.FromID == account {
+			txs = append(txs, tx)
+		}
+	}
+
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+
+	return txs
+}
+
+func (mp *Mempool) Truncate() {
+	for _, sh := range mp.shards {
+		sh.mu.Lock()
+		sh.pool = make(map[string]database.BlockTx)
+		sh.seen = make(map[string]time.Time)
+		sh.shared = make(map[string]time.Time)
+		sh.mining = make(map[string]struct{})
+		sh.local = make(map[string]struct{})
+		sh.mu.Unlock()
+	}
 }
 
 // PickBest uses the configured sort strategy to return the next
@@ -110,6 +422,31 @@ func (mp *Mempool) PickBest(howMany ...uint16) []database.BlockTx {
 		number = int(howMany[0])
 	}
 
+	return mp.pickBest(number, 0, 0)
+}
+
+// PickBestPerAccount works like PickBest, but no more than perAccount
+// transactions from any single account are returned. This leaves the
+// remaining slots for transactions from other accounts. If 0 is passed
+// for perAccount, there is no limit per account.
+func (mp *Mempool) PickBestPerAccount(howMany uint16, perAccount uint16) []database.BlockTx {
+	return mp.pickBest(int(howMany), int(perAccount), 0)
+}
+
+// PickBestForBlock works like PickBestPerAccount, but skips the transactions
+// that are past their deadline for the block with the specified number.
+// Since the nonce ordering has to stay intact, the transactions from the
+// same account with a higher nonce than an expired one are skipped as well.
+func (mp *Mempool) PickBestForBlock(blockNumber uint64, howMany uint16, perAccount uint16) []database.BlockTx {
+	return mp.pickBest(int(howMany), int(perAccount), blockNumber)
+}
+
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// pickBest performs the selection for PickBest, PickBestPerAccount and
+// PickBestForBlock. A block number of 0 skips the deadline check.
+func (mp *Mempool) pickBest(number int, perAccount int, blockNumber uint64) []database.BlockTx {
+
 	// CORE NOTE: Most blockchains do set a max block size limit and this size
 	// will determine which transactions are selected. When picking the best
 	// transactions for the next block, the Ardan blockchain is currently not
@@ -122,27 +459,90 @@ func (mp *Mempool) PickBest(howMany ...uint16) []database.BlockTx {
 	// selected as the only form of revenue. This will change how transactions
 	// need to be selected.
 
-	// Copy all the transactions for each account into separate slices.
+	// Copy all the transactions for each account into separate slices. The
+	// local transactions are copied with their tip boosted, so the selector
+	// ranks them ahead of peer transactions while keeping nonce ordering.
 	m := make(map[database.AccountID][]database.BlockTx)
-	mp.mu.RLock()
-	{
-		if number == 0 {
-			number = len(mp.pool)
-		}
+	boosted := make(map[string]database.BlockTx)
+	var count int
+	for _, sh := range mp.shards {
+		sh.mu.RLock()
+		count += len(sh.pool)
+
+		for key, tx := range sh.pool {
+			if _, local := sh.local[key]; local && mp.localBoost > 0 {
+				boosted[key] = tx
+
+				tip, carry := bits.Add64(tx.Tip, mp.localBoost, 0)
+				if carry != 0 {
+					tip = math.MaxUint64
+				}
+				tx.Tip = tip
+			}
 
-		for key, tx := range mp.pool {
 			account := accountFromMapKey(key)
 			m[account] = append(m[account], tx)
 		}
+		sh.mu.RUnlock()
+	}
+
+	if number == 0 {
+		number = count
+	}
+
+	// Drop the expired transactions, along with the ones after them from
+	// the same account, since those can't be applied without a gap.
+	if blockNumber > 0 {
+		for account, txs := range m {
+			sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+			for i, tx := range txs {
+				if tx.Expired(blockNumber) {
+					m[account] = txs[:i]
+					break
+				}
+			}
+		}
+	}
+
+	// Only the transactions with the lowest nonces for each account can be
+	// selected to keep the nonce ordering intact.
+	if perAccount > 0 {
+		for account, txs := range m {
+			if len(txs) > perAccount {
+				sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+				m[account] = txs[:perAccount]
+			}
+		}
 	}
-	mp.mu.RUnlock()
 
 	// The selection algorithm is expecting this slice
 	// of transactions to be organized by account.
-	return mp.selectFn(m, number)
+	txs := mp.selectFn(m, number)
+
+	// The boost only affects the selection, so hand back the transactions
+	// with the tip they were signed with.
+	for i, tx := range txs {
+		if key, err := mapKey(tx); err == nil {
+			if orig, exists := boosted[key]; exists {
+				txs[i] = orig
+			}
+		}
+	}
+
+	return txs
 }
 
-// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// shardFor returns the shard holding the transactions from the account.
+func (mp *Mempool) shardFor(account database.AccountID) *shard {
+	if len(mp.shards) == 1 {
+		return mp.shards[0]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(account))
+
+	return mp.shards[h.Sum32()%uint32(len(mp.shards))]
+}
 
 // mapKey is used to generate the map key.
 func mapKey(tx database.BlockTx) (string, error) {
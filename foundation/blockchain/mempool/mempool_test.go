@@ -1,7 +1,13 @@
 package mempool_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 
@@ -60,7 +66,7 @@ func Test_CRUD(t *testing.T) {
 
 	for _, tst := range tt {
 		f := func(t *testing.T) {
-			mp, err := mempool.New()
+			mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
 			if err != nil {
 				t.Fatalf("Test %s:\tShould be able to construct a mempool: %s", tst.name, err)
 			}
@@ -104,6 +110,552 @@ func Test_CRUD(t *testing.T) {
 	}
 }
 
+func Test_PickBestPerAccount(t *testing.T) {
+	const (
+		kennedyKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		pavelKey   = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+		edKey      = "aed31b6b5a341af8f27e66fb0b7633cf20fc27049e3eb7f6f623a4655b719ebb"
+	)
+
+	txs := []struct {
+		Tx     database.Tx
+		hexKey string
+	}{
+		{Tx: database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Tip: 300}, hexKey: kennedyKey},
+		{Tx: database.Tx{Nonce: 2, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Tip: 300}, hexKey: kennedyKey},
+		{Tx: database.Tx{Nonce: 3, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Tip: 300}, hexKey: kennedyKey},
+		{Tx: database.Tx{Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", Tip: 10}, hexKey: pavelKey},
+		{Tx: database.Tx{Nonce: 1, FromID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", Tip: 10}, hexKey: edKey},
+	}
+
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	for _, user := range txs {
+		tx, err := sign(user.hexKey, user.Tx)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		mp.Upsert(tx)
+	}
+
+	type table struct {
+		name       string
+		perAccount uint16
+		kennedy    int
+		others     int
+	}
+
+	tt := []table{
+		{name: "no cap", perAccount: 0, kennedy: 3, others: 2},
+		{name: "cap one", perAccount: 1, kennedy: 1, others: 2},
+		{name: "cap two", perAccount: 2, kennedy: 2, others: 2},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			best := mp.PickBestPerAccount(uint16(len(txs)), tst.perAccount)
+
+			var kennedy, others int
+			for _, tx := range best {
+				switch tx.FromID {
+				case "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32":
+					kennedy++
+					if tx.Nonce > uint64(kennedy) {
+						t.Fatalf("Test %s:\tShould get back the lowest nonces first, got nonce %d.", tst.name, tx.Nonce)
+					}
+				default:
+					others++
+				}
+			}
+
+			if kennedy != tst.kennedy || others != tst.others {
+				t.Logf("Test %s:\tgot: kennedy %d, others %d", tst.name, kennedy, others)
+				t.Logf("Test %s:\texp: kennedy %d, others %d", tst.name, tst.kennedy, tst.others)
+				t.Fatalf("Test %s:\tShould only pick up to the cap from one account and leave the rest to others.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Stats(t *testing.T) {
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	if stats := mp.Stats(); stats != (mempool.Stats{}) {
+		t.Fatalf("Should get back empty stats for an empty mempool: %+v", stats)
+	}
+
+	txs := []struct {
+		Tx     database.Tx
+		hexKey string
+	}{
+		{Tx: database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Tip: 40}, hexKey: "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"},
+		{Tx: database.Tx{Nonce: 2, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Tip: 10}, hexKey: "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"},
+		{Tx: database.Tx{Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", Tip: 25}, hexKey: "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"},
+		{Tx: database.Tx{Nonce: 1, FromID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0", Tip: 100}, hexKey: "aed31b6b5a341af8f27e66fb0b7633cf20fc27049e3eb7f6f623a4655b719ebb"},
+	}
+
+	var bytes int
+	for _, user := range txs {
+		tx, err := sign(user.hexKey, user.Tx)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		data, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("Should be able to marshal transaction: %s", err)
+		}
+		bytes += len(data)
+
+		mp.Upsert(tx)
+	}
+
+	exp := mempool.Stats{
+		Count:     4,
+		Bytes:     bytes,
+		Accounts:  3,
+		MinTip:    10,
+		MaxTip:    100,
+		MedianTip: 32,
+	}
+
+	if stats := mp.Stats(); stats != exp {
+		t.Logf("got: %+v", stats)
+		t.Logf("exp: %+v", exp)
+		t.Fatal("Should get back the right stats for the mempool.")
+	}
+}
+
+func Test_PendingNonces(t *testing.T) {
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	const kennedy = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+
+	txs := []struct {
+		Tx     database.Tx
+		hexKey string
+	}{
+		{Tx: database.Tx{Nonce: 5, FromID: kennedy}, hexKey: "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"},
+		{Tx: database.Tx{Nonce: 2, FromID: kennedy}, hexKey: "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"},
+		{Tx: database.Tx{Nonce: 3, FromID: kennedy}, hexKey: "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"},
+		{Tx: database.Tx{Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"}, hexKey: "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"},
+	}
+
+	for _, user := range txs {
+		tx, err := sign(user.hexKey, user.Tx)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		mp.Upsert(tx)
+	}
+
+	exp := []uint64{2, 3, 5}
+	got := mp.PendingNonces(kennedy)
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatal("Should get back the sorted pending nonces for the account.")
+	}
+
+	if got := mp.PendingNonces("0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"); len(got) != 0 {
+		t.Fatalf("Should get back no pending nonces for an account without transactions: %v", got)
+	}
+}
+
+func Test_ReplaceGracePeriod(t *testing.T) {
+	const (
+		kennedy = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		hexKey  = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		grace   = 50 * time.Millisecond
+	)
+
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip", ReplaceGrace: grace})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	tip := uint64(100)
+	replace := func() error {
+		tx, err := sign(hexKey, database.Tx{Nonce: 1, FromID: kennedy, Tip: tip})
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+		tip *= 2
+
+		return mp.Upsert(tx)
+	}
+
+	if err := replace(); err != nil {
+		t.Fatalf("Should be able to add the transaction: %s", err)
+	}
+
+	if err := replace(); err != nil {
+		t.Fatalf("Should be able to replace the transaction within the grace period: %s", err)
+	}
+
+	time.Sleep(2 * grace)
+
+	if err := replace(); !errors.Is(err, mempool.ErrReplaceGracePeriod) {
+		t.Fatalf("Should not be able to replace the transaction after the grace period: %v", err)
+	}
+}
+
+func Test_ReplaceMining(t *testing.T) {
+	const (
+		kennedy = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		hexKey  = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+	)
+
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	tip := uint64(100)
+	replace := func() (database.BlockTx, error) {
+		tx, err := sign(hexKey, database.Tx{Nonce: 1, FromID: kennedy, Tip: tip})
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+		tip *= 2
+
+		return tx, mp.Upsert(tx)
+	}
+
+	tx, err := replace()
+	if err != nil {
+		t.Fatalf("Should be able to add the transaction: %s", err)
+	}
+
+	mp.MarkMining([]database.BlockTx{tx})
+
+	if _, err := replace(); !errors.Is(err, mempool.ErrReplaceMining) {
+		t.Fatalf("Should not be able to replace the transaction while it's being mined: %v", err)
+	}
+
+	mp.ClearMining()
+
+	if _, err := replace(); err != nil {
+		t.Fatalf("Should be able to replace the transaction once mining is done: %s", err)
+	}
+}
+
+func Test_PickBestForBlock(t *testing.T) {
+	const (
+		kennedy    = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		kennedyKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		pavel      = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		pavelKey   = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+	)
+
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	// Kennedy's first transaction expires after block 5, which leaves a gap
+	// before the second. Pavel's transactions have no deadline or a later one.
+	txs := []struct {
+		hexKey string
+		tx     database.Tx
+	}{
+		{kennedyKey, database.Tx{Nonce: 1, FromID: kennedy, Tip: 10, ValidUntilBlock: 5}},
+		{kennedyKey, database.Tx{Nonce: 2, FromID: kennedy, Tip: 10}},
+		{pavelKey, database.Tx{Nonce: 1, FromID: pavel, Tip: 5}},
+		{pavelKey, database.Tx{Nonce: 2, FromID: pavel, Tip: 5, ValidUntilBlock: 10}},
+	}
+
+	for _, tst := range txs {
+		tx, err := sign(tst.hexKey, tst.tx)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		if err := mp.Upsert(tx); err != nil {
+			t.Fatalf("Should be able to add the transaction: %s", err)
+		}
+	}
+
+	if n := len(mp.PickBestForBlock(5, 0, 0)); n != 4 {
+		t.Fatalf("Should pick every transaction on the deadline, got %d", n)
+	}
+
+	picked := mp.PickBestForBlock(6, 0, 0)
+	if len(picked) != 2 {
+		t.Fatalf("Should skip the expired transaction and the one after it, got %d", len(picked))
+	}
+
+	for _, tx := range picked {
+		if tx.FromID != pavel {
+			t.Fatalf("Should only pick pavel's transactions, got %s", tx)
+		}
+	}
+
+	if n := len(mp.PickBestForBlock(11, 0, 0)); n != 1 {
+		t.Fatalf("Should skip every expired transaction, got %d", n)
+	}
+
+	if n := len(mp.PickBest()); n != 4 {
+		t.Fatalf("Should pick every transaction without a block number, got %d", n)
+	}
+}
+
+func Test_LocalBoost(t *testing.T) {
+	const (
+		kennedy    = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		kennedyKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		pavel      = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		pavelKey   = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+		localTip   = 10
+	)
+
+	type table struct {
+		name      string
+		boost     uint64
+		peerTip   uint64
+		expFirst  database.AccountID
+		expLocals int
+	}
+
+	tt := []table{
+		{name: "no boost", boost: 0, peerTip: localTip + 1, expFirst: pavel, expLocals: 1},
+		{name: "boost equal tip", boost: 10, peerTip: localTip, expFirst: kennedy, expLocals: 2},
+		{name: "boost higher tip", boost: 10, peerTip: localTip + 5, expFirst: kennedy, expLocals: 2},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip", LocalBoost: tst.boost})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct a mempool: %s", tst.name, err)
+			}
+
+			for nonce := uint64(1); nonce <= 2; nonce++ {
+				local, err := sign(kennedyKey, database.Tx{Nonce: nonce, FromID: kennedy, Tip: localTip})
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to sign transaction: %s", tst.name, err)
+				}
+				if err := mp.UpsertLocal(local); err != nil {
+					t.Fatalf("Test %s:\tShould be able to add the local transaction: %s", tst.name, err)
+				}
+
+				peer, err := sign(pavelKey, database.Tx{Nonce: nonce, FromID: pavel, Tip: tst.peerTip})
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to sign transaction: %s", tst.name, err)
+				}
+				if err := mp.Upsert(peer); err != nil {
+					t.Fatalf("Test %s:\tShould be able to add the peer transaction: %s", tst.name, err)
+				}
+			}
+
+			if txs := mp.PickBest(1); len(txs) != 1 || txs[0].FromID != tst.expFirst {
+				t.Fatalf("Test %s:\tShould select a transaction from %s first, got %v", tst.name, tst.expFirst, txs)
+			}
+
+			var locals int
+			nonces := make(map[database.AccountID]uint64)
+			for _, tx := range mp.PickBest(3) {
+				if tx.Nonce != nonces[tx.FromID]+1 {
+					t.Fatalf("Test %s:\tShould select the transactions in nonce order, got nonce %d for %s", tst.name, tx.Nonce, tx.FromID)
+				}
+				nonces[tx.FromID] = tx.Nonce
+
+				if tx.FromID == kennedy {
+					locals++
+
+					if tx.Tip != localTip {
+						t.Fatalf("Test %s:\tShould return the local transaction with its original tip, got %d", tst.name, tx.Tip)
+					}
+				}
+			}
+
+			if locals != tst.expLocals {
+				t.Fatalf("Test %s:\tShould select %d local transactions, got %d", tst.name, tst.expLocals, locals)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Unshared(t *testing.T) {
+	const (
+		kennedy = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		hexKey  = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		age     = 50 * time.Millisecond
+	)
+
+	mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip"})
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	tx, err := sign(hexKey, database.Tx{Nonce: 1, FromID: kennedy})
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %s", err)
+	}
+
+	if err := mp.Upsert(tx); err != nil {
+		t.Fatalf("Should be able to add the transaction: %s", err)
+	}
+
+	if txs := mp.Unshared(age); len(txs) != 0 {
+		t.Fatalf("Should not get back a transaction shared within the age: %d", len(txs))
+	}
+
+	time.Sleep(age)
+
+	if txs := mp.Unshared(age); len(txs) != 1 {
+		t.Fatalf("Should get back the transaction not shared for the age: %d", len(txs))
+	}
+
+	mp.MarkShared(tx)
+
+	if txs := mp.Unshared(age); len(txs) != 0 {
+		t.Fatalf("Should not get back a transaction that was just shared: %d", len(txs))
+	}
+
+	mp.Delete(tx)
+	time.Sleep(age)
+
+	if txs := mp.Unshared(age); len(txs) != 0 {
+		t.Fatalf("Should not get back a deleted transaction: %d", len(txs))
+	}
+}
+
+func Test_ShardedNonceOrdering(t *testing.T) {
+	const hexKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+
+	type table struct {
+		strategy string
+		accounts int
+		nonces   int
+	}
+
+	// The advanced tip selection searches the combinations of transactions,
+	// so it gets a fixture small enough to finish.
+	tt := []table{
+		{strategy: "Tip", accounts: 20, nonces: 5},
+		{strategy: "Tip_Advanced", accounts: 4, nonces: 3},
+	}
+
+	tmpl, err := sign(hexKey, database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"})
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %s", err)
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			strategy, accounts, nonces := tst.strategy, tst.accounts, tst.nonces
+
+			mp, err := mempool.NewWithConfig(mempool.Config{Strategy: strategy, Shards: 8})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct a mempool: %s", strategy, err)
+			}
+
+			// The later nonces pay a higher tip, so a selection ignoring the
+			// nonce ordering would pick them first.
+			for nonce := uint64(nonces); nonce > 0; nonce-- {
+				for i := 0; i < accounts; i++ {
+					tx := tmpl
+					tx.FromID = database.AccountID(fmt.Sprintf("0x%040X", i))
+					tx.Nonce = nonce
+					tx.Tip = nonce * uint64(i+1)
+
+					if err := mp.Upsert(tx); err != nil {
+						t.Fatalf("Test %s:\tShould be able to add the transaction: %s", strategy, err)
+					}
+				}
+			}
+
+			if count := mp.Count(); count != accounts*nonces {
+				t.Fatalf("Test %s:\tShould count the transactions across the shards, got %d, exp %d", strategy, count, accounts*nonces)
+			}
+
+			best := mp.PickBest()
+			if len(best) != accounts*nonces {
+				t.Fatalf("Test %s:\tShould pick the transactions across the shards, got %d, exp %d", strategy, len(best), accounts*nonces)
+			}
+
+			next := make(map[database.AccountID]uint64)
+			for _, tx := range best {
+				if exp := next[tx.FromID] + 1; tx.Nonce != exp {
+					t.Fatalf("Test %s:\tShould pick the transactions for %s in nonce order, got nonce %d, exp %d", strategy, tx.FromID, tx.Nonce, exp)
+				}
+				next[tx.FromID] = tx.Nonce
+			}
+
+			for i := 0; i < accounts; i++ {
+				account := database.AccountID(fmt.Sprintf("0x%040X", i))
+				if got := mp.PendingNonces(account); len(got) != nonces {
+					t.Fatalf("Test %s:\tShould get back the pending nonces for %s from its shard, got %v", strategy, account, got)
+				}
+			}
+		}
+
+		t.Run(tst.strategy, f)
+	}
+}
+
+func BenchmarkConcurrentUpsert(b *testing.B) {
+	const (
+		hexKey   = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+		accounts = 256
+	)
+
+	tmpl, err := sign(hexKey, database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"})
+	if err != nil {
+		b.Fatalf("Should be able to sign transaction: %s", err)
+	}
+
+	for _, shards := range []int{1, 16} {
+		name := "single lock"
+		if shards > 1 {
+			name = fmt.Sprintf("%d shards", shards)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			mp, err := mempool.NewWithConfig(mempool.Config{Strategy: "Tip", Shards: shards})
+			if err != nil {
+				b.Fatalf("Should be able to construct a mempool: %s", err)
+			}
+
+			// Each transaction is taken in and then removed, like it was
+			// mined, so the mempool doesn't grow through the run.
+			var counter atomic.Uint64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := counter.Add(1)
+
+					tx := tmpl
+					tx.FromID = database.AccountID(fmt.Sprintf("0x%040X", n%accounts))
+					tx.Nonce = n
+
+					if err := mp.Upsert(tx); err != nil {
+						b.Errorf("Should be able to add the transaction: %s", err)
+						return
+					}
+					mp.Delete(tx)
+				}
+			})
+		})
+	}
+}
+
 // =============================================================================
 
 func sign(hexKey string, tx database.Tx) (database.BlockTx, error) {
@@ -111,12 +111,7 @@ func (t *Tree[T]) Generate(values []T) error {
 // Rebuild is a helper function that will rebuild the tree
 // reusing only the data that it currently holds in the leaves.
 func (t *Tree[T]) Rebuild() error {
-	var data []T
-	for _, node := range t.Leaves {
-		data = append(data, node.Value)
-	}
-
-	if err := t.Generate(data); err != nil {
+	if err := t.Generate(t.Values()); err != nil {
 		return err
 	}
 
@@ -239,18 +234,49 @@ func (t *Tree[T]) VerifyData(data T) error {
 }
 
 // Values returns a slice of unique values stored in the tree.
+//
+// CORE NOTE: When there is an odd number of values, the last leaf is
+// duplicated to balance the tree. The duplicate only exists for hashing,
+// so anything processing the values, like applying the transactions in a
+// block, must use Values and never range over the Leaves directly.
 func (t *Tree[T]) Values() []T {
-	var values []T
-	for _, tx := range t.Leaves {
-		values = append(values, tx.Value)
+	values := make([]T, 0, len(t.Leaves))
+	for _, node := range t.Leaves {
+		if node.dup {
+			continue
+		}
+		values = append(values, node.Value)
 	}
 
-	l := len(t.Leaves)
-	if bytes.Equal(t.Leaves[l-1].Hash, t.Leaves[l-2].Hash) {
-		return values[:l-1]
+	return values
+}
+
+// Levels returns the hashes of the nodes in the tree level by level, starting
+// with the leaves and ending with the root. When there is an odd number of
+// values, the leaves include the duplicate of the last value. This exposes
+// the structure of the tree without marshaling it.
+func (t *Tree[T]) Levels() [][][]byte {
+	var levels [][][]byte
+
+	for nodes := t.Leaves; len(nodes) > 0; {
+		level := make([][]byte, len(nodes))
+		var parents []*Node[T]
+
+		for i, node := range nodes {
+			level[i] = node.Hash
+
+			// Both children of a node are on the same level next to each
+			// other, so a parent only needs to be checked against the last.
+			if node.Parent != nil && (len(parents) == 0 || parents[len(parents)-1] != node.Parent) {
+				parents = append(parents, node.Parent)
+			}
+		}
+
+		levels = append(levels, level)
+		nodes = parents
 	}
 
-	return values
+	return levels
 }
 
 // RootHex converts the merkle root byte hash to a hex encoded string.
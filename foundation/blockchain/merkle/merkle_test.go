@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"hash"
+	"reflect"
 	"testing"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/merkle"
@@ -204,6 +205,68 @@ func Test_MerklePath(t *testing.T) {
 	}
 }
 
+func Test_Values(t *testing.T) {
+	for i := 0; i < len(table); i++ {
+		tree, err := merkle.NewTree(table[i].data, merkle.WithHashStrategy[Data](table[i].hashStrategy))
+		if err != nil {
+			t.Errorf("[case:%d] error: unexpected error: %v", table[i].testCaseID, err)
+		}
+		if values := tree.Values(); !reflect.DeepEqual(values, table[i].data) {
+			t.Errorf("[case:%d] error: expected values %v got %v", table[i].testCaseID, table[i].data, values)
+		}
+		if err := tree.Rebuild(); err != nil {
+			t.Errorf("[case:%d] error: unexpected error: %v", table[i].testCaseID, err)
+		}
+		if values := tree.Values(); !reflect.DeepEqual(values, table[i].data) {
+			t.Errorf("[case:%d] error: expected values after rebuild %v got %v", table[i].testCaseID, table[i].data, values)
+		}
+	}
+}
+
+func Test_Levels(t *testing.T) {
+	for i := 0; i < len(table); i++ {
+		tree, err := merkle.NewTree(table[i].data, merkle.WithHashStrategy[Data](table[i].hashStrategy))
+		if err != nil {
+			t.Fatalf("[case:%d] error: unexpected error: %v", table[i].testCaseID, err)
+		}
+
+		levels := tree.Levels()
+
+		root := levels[len(levels)-1]
+		if len(root) != 1 || !bytes.Equal(root[0], tree.MerkleRoot) {
+			t.Fatalf("[case:%d] error: expected the last level to be the merkle root %v got %v", table[i].testCaseID, tree.MerkleRoot, root)
+		}
+
+		if len(levels[0]) != len(tree.Leaves) {
+			t.Fatalf("[case:%d] error: expected %d leaves got %d", table[i].testCaseID, len(tree.Leaves), len(levels[0]))
+		}
+
+		// Every hash is the hash of the pair of hashes below it. An odd
+		// hash out is paired with itself.
+		for l := 1; l < len(levels); l++ {
+			below := levels[l-1]
+			if exp := (len(below) + 1) / 2; len(levels[l]) != exp {
+				t.Fatalf("[case:%d] error: expected %d hashes on level %d got %d", table[i].testCaseID, exp, l, len(levels[l]))
+			}
+
+			for n, hash := range levels[l] {
+				left, right := below[2*n], below[2*n]
+				if 2*n+1 < len(below) {
+					right = below[2*n+1]
+				}
+
+				exp, err := calHash(append(append([]byte{}, left...), right...), table[i].hashStrategy)
+				if err != nil {
+					t.Fatalf("[case:%d] error: unexpected error: %v", table[i].testCaseID, err)
+				}
+				if !bytes.Equal(hash, exp) {
+					t.Fatalf("[case:%d] error: expected hash %d on level %d to be %v got %v", table[i].testCaseID, n, l, exp, hash)
+				}
+			}
+		}
+	}
+}
+
 // =============================================================================
 
 func calHash(hash []byte, hashStrategy func() hash.Hash) ([]byte, error) {
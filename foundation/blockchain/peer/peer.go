@@ -2,7 +2,16 @@
 // set of known peers and their state.
 package peer
 
-import "sync"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
 
 // Peer represents information about a State in the network.
 type Peer struct {
@@ -23,12 +32,37 @@ func (p Peer) Match(host string) bool {
 
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
+// ProtocolVersion is the version of the protocol nodes use to talk to each
+// other. It changes when a node running the new version can't be understood
+// by a node running an older version.
+const ProtocolVersion = 1
+
+// Version represents the software and protocol version a node runs.
+type Version struct {
+	Build    string `json:"build"`    // Version of the node software.
+	Protocol int    `json:"protocol"` // Version of the protocol between nodes.
+}
+
 // Status represents information about
 // the status of any given peer.
 type Status struct {
-	LatestBlockHash   string `json:"latest_block_hash"`
-	LatestBlockNumber uint64 `json:"latest_block_number"`
-	KnownPeers        []Peer `json:"known_peers"`
+	NetworkID         string  `json:"network_id"`
+	LatestBlockHash   string  `json:"latest_block_hash"`
+	LatestBlockNumber uint64  `json:"latest_block_number"`
+	TxCount           uint64  `json:"tx_count"`      // Number of transactions in the peer's blocks.
+	TotalWork         string  `json:"total_work"`    // Expected number of hashes to mine the peer's blocks, in decimal.
+	MempoolCount      int     `json:"mempool_count"` // Number of transactions in the peer's mempool.
+	KnownPeers        []Peer  `json:"known_peers"`
+	Time              uint64  `json:"time,omitempty"` // Time on the peer's clock in unix milliseconds.
+	Version           Version `json:"version"`        // Software and protocol version the peer runs.
+}
+
+// Tip represents the notification a peer sends when its latest block
+// changes, so nodes that are behind can request the block right away.
+type Tip struct {
+	Host   string `json:"host"`
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
 }
 
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -82,3 +116,58 @@ func (s *Set) Copy(host string) []Peer {
 
 	return peers
 }
+
+// Save writes the set of known peers to the specified file so they can be
+// loaded again when the node restarts. The file is replaced atomically so
+// a crash while saving can't leave a partially written file behind.
+func (s *Set) Save(path string) error {
+	peers := s.Copy("")
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Host < peers[j].Host })
+
+	data, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load adds the peers stored in the specified file to the set. A missing
+// file is not an error since the node may have never saved its peers.
+func (s *Set) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var peers []Peer
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return fmt.Errorf("corrupt peers file %s: %w", path, err)
+	}
+
+	for _, peer := range peers {
+		if peer.Host != "" {
+			s.Add(peer)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package peer_test
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
@@ -45,3 +49,45 @@ func Test_CRUD(t *testing.T) {
 		t.Run(tst.name, f)
 	}
 }
+
+func Test_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+
+	ps := peer.NewSet()
+	ps.Add(peer.New("host1"))
+	ps.Add(peer.New("host2"))
+
+	if err := ps.Save(path); err != nil {
+		t.Fatalf("Should be able to save the peers: %v", err)
+	}
+
+	// Loading merges the saved peers with the peers already in the set.
+	loaded := peer.NewSet()
+	loaded.Add(peer.New("seed"))
+
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Should be able to load the peers: %v", err)
+	}
+
+	peers := loaded.Copy("")
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Host < peers[j].Host })
+
+	exp := []peer.Peer{{Host: "host1"}, {Host: "host2"}, {Host: "seed"}}
+	if !reflect.DeepEqual(peers, exp) {
+		t.Logf("got: %v", peers)
+		t.Logf("exp: %v", exp)
+		t.Fatal("Should get back the saved peers merged with the seed.")
+	}
+
+	if err := peer.NewSet().Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("Should be able to load a missing peers file: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Should be able to write the peers file: %v", err)
+	}
+
+	if err := peer.NewSet().Load(path); err == nil {
+		t.Fatal("Should not be able to load a corrupt peers file.")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -23,52 +24,141 @@ const ZeroHash string = "0x00000000000000000000000000000000000000000000000000000
 // Ethereum and Bitcoind do this, but they both use a value of 27.
 const ardanID = 29
 
+// ErrMessageSignature is returned when a message signature was not produced
+// by the specified account.
+var ErrMessageSignature = errors.New("message not signed by account")
+
+// Set of hash algorithms that can be used to hash a value.
+const (
+	HashSHA256    = "sha256"
+	HashKeccak256 = "keccak256"
+)
+
+// ErrUnknownHashAlgorithm is returned when a hash algorithm isn't supported.
+var ErrUnknownHashAlgorithm = errors.New("unknown hash algorithm")
+
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Signable represents the behavior a value can implement to provide its own
+// canonical encoding for signing. This decouples the signing preimage from
+// the JSON layout of the value so the wire format can change without
+// invalidating existing signatures.
+type Signable interface {
+	SigningBytes() []byte
+}
+
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // Hash returns a unique string for the value.
 func Hash(value any) string {
+	hash, _ := HashWith(HashSHA256, value)
+	return hash
+}
+
+// HashWith returns a unique string for the value using the specified hash
+// algorithm. An empty algorithm is the same as sha256.
+func HashWith(algorithm string, value any) (string, error) {
+	if !IsHashAlgorithm(algorithm) {
+		return "", fmt.Errorf("%w: %q", ErrUnknownHashAlgorithm, algorithm)
+	}
+
 	data, err := json.Marshal(value)
 	if err != nil {
-		return ZeroHash
+		return ZeroHash, nil
+	}
+
+	if algorithm == HashKeccak256 {
+		return hexutil.Encode(crypto.Keccak256(data)), nil
 	}
 
 	hash := sha256.Sum256(data)
 
-	return hexutil.Encode(hash[:])
+	return hexutil.Encode(hash[:]), nil
+}
+
+// IsHashAlgorithm reports whether the hash algorithm is supported. An empty
+// algorithm is supported and is the same as sha256.
+func IsHashAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "", HashSHA256, HashKeccak256:
+		return true
+	}
+
+	return false
 }
 
 // Sign uses the specified private kry to sign the data.
 func Sign(value any, privateKey *ecdsa.PrivateKey) (v, r, s *big.Int, err error) {
+	return SignWithDomain("", value, privateKey)
+}
+
+// CORE NOTE: Two networks can end up with the same chain id, for example
+// when a network is forked. A signing domain from the genesis file is mixed
+// into the stamp so a value signed for one network doesn't recover to the
+// same address on another network with a different domain. An empty domain
+// produces the original stamp, so signatures made before domains existed
+// remain valid.
+
+// SignWithDomain uses the specified private key to sign the data for the
+// specified signing domain.
+func SignWithDomain(domain string, value any, privateKey *ecdsa.PrivateKey) (v, r, s *big.Int, err error) {
 	// Prepare the data for signing.
-	data, err := stamp(value)
+	data, err := stamp(domain, value)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	// Sign the hash with the private kry to produce a signature.
-	sig, err := crypto.Sign(data, privateKey)
+	return sign(data, privateKey)
+}
+
+// CORE NOTE: Signing an arbitrary message lets a wallet prove it owns an
+// account, for a login for example, without submitting a transaction. The
+// message is stamped with a different prefix than the one used for values
+// like transactions, so the hash signed for a message never matches the hash
+// of a value and a message signature can't be replayed as a transaction.
+
+// SignMessage uses the specified private key to sign an arbitrary message,
+// returning the signature as a hex string.
+func SignMessage(msg []byte, privateKey *ecdsa.PrivateKey) (string, error) {
+	v, r, s, err := sign(messageStamp(msg), privateKey)
 	if err != nil {
-		return nil, nil, nil, err
+		return "", err
 	}
 
-	// Extract the bytes for the original public key.
-	publicKeyOrg := privateKey.Public()
-	publicKeyECDSA, ok := publicKeyOrg.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, nil, nil, errors.New("error casting public key to ECDSA")
+	return SignatureString(v, r, s), nil
+}
+
+// VerifyMessage checks the hex signature was produced by the specified
+// account signing the message with SignMessage.
+func VerifyMessage(msg []byte, sig string, account string) error {
+	sigBytes, err := hexutil.Decode(sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
 	}
-	publicKeyBytes := crypto.FromECDSAPub(publicKeyECDSA)
 
-	// Check the public key validates the data and the signature.
-	rs := sig[:crypto.RecoveryIDOffset]
-	if !crypto.VerifySignature(publicKeyBytes, data, rs) {
-		return nil, nil, nil, errors.New("invalid signature produced")
+	if len(sigBytes) != crypto.SignatureLength {
+		return fmt.Errorf("invalid signature length %d, exp %d", len(sigBytes), crypto.SignatureLength)
 	}
 
-	// Convert the 65 byte signature into the [R|S|V] format.
-	v, r, s = toSignatureValues(sig)
+	v, r, s, err := ToVRSFromHexSignature(sig)
+	if err != nil {
+		return err
+	}
 
-	return v, r, s, nil
+	if err := VerifySignature(v, r, s); err != nil {
+		return err
+	}
+
+	addr, err := fromAddress(messageStamp(msg), v, r, s)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(addr, account) {
+		return fmt.Errorf("%w: signed by %s, exp %s", ErrMessageSignature, addr, account)
+	}
+
+	return nil
 }
 
 // VerifySignature verifies the signature conforms to our standards.
@@ -90,23 +180,19 @@ func VerifySignature(v, r, s *big.Int) error {
 
 // FromAddress extracts the address for the account that signed the data.
 func FromAddress(value any, v, r, s *big.Int) (string, error) {
-	// Prepare the data for public key extraction.
-	data, err := stamp(value)
-	if err != nil {
-		return "", err
-	}
-
-	// Convert the [R|S|V] format into the original 65 bytes.
-	sig := ToSignatureBytes(v, r, s)
+	return FromAddressWithDomain("", value, v, r, s)
+}
 
-	// Capture the public key associated with this data and signature.
-	publicKey, err := crypto.SigToPub(data, sig)
+// FromAddressWithDomain extracts the address for the account that signed
+// the data for the specified signing domain.
+func FromAddressWithDomain(domain string, value any, v, r, s *big.Int) (string, error) {
+	// Prepare the data for public key extraction.
+	data, err := stamp(domain, value)
 	if err != nil {
 		return "", err
 	}
 
-	// Extract the account address from the public key.
-	return crypto.PubkeyToAddress(*publicKey).String(), nil
+	return fromAddress(data, v, r, s)
 }
 
 // SignatureString returns the signature as a string.
@@ -159,18 +245,30 @@ func ToSignatureBytesWithArdanID(v, r, s *big.Int) []byte {
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // stamp returns a hash of 32 bytes that represents this data
-// with the Ardan stamp embedded into the final hash.
-func stamp(value any) ([]byte, error) {
-	// Marshal the v.
-	v, err := json.Marshal(value)
-	if err != nil {
-		return nil, err
+// with the Ardan stamp, and the signing domain if there is one,
+// embedded into the final hash.
+func stamp(domain string, value any) ([]byte, error) {
+	// Use the canonical encoding if the value provides one, else marshal the v.
+	var v []byte
+	switch value := value.(type) {
+	case Signable:
+		v = value.SigningBytes()
+	default:
+		var err error
+		if v, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
 	}
 
 	// This stamp is used so signatures produced when signing data
 	// are always unique to the Ardan blockchain.
 	stamp := []byte(fmt.Sprintf("\x19Ardan Signed Message:\n%d", len(v)))
 
+	// The domain is length prefixed so no two domains produce the same stamp.
+	if domain != "" {
+		stamp = []byte(fmt.Sprintf("\x19Ardan Signed Message:\n%d:%s\n%d", len(domain), domain, len(v)))
+	}
+
 	// Hash the stamp and txHash together in a final 32 byte
 	// array that represents the transaction v.
 	data := crypto.Keccak256(stamp, v)
@@ -178,6 +276,60 @@ func stamp(value any) ([]byte, error) {
 	return data, nil
 }
 
+// sign produces the signature of the stamped data with the private key.
+func sign(data []byte, privateKey *ecdsa.PrivateKey) (v, r, s *big.Int, err error) {
+
+	// Sign the hash with the private kry to produce a signature.
+	sig, err := crypto.Sign(data, privateKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Extract the bytes for the original public key.
+	publicKeyOrg := privateKey.Public()
+	publicKeyECDSA, ok := publicKeyOrg.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, nil, nil, errors.New("error casting public key to ECDSA")
+	}
+	publicKeyBytes := crypto.FromECDSAPub(publicKeyECDSA)
+
+	// Check the public key validates the data and the signature.
+	rs := sig[:crypto.RecoveryIDOffset]
+	if !crypto.VerifySignature(publicKeyBytes, data, rs) {
+		return nil, nil, nil, errors.New("invalid signature produced")
+	}
+
+	// Convert the 65 byte signature into the [R|S|V] format.
+	v, r, s = toSignatureValues(sig)
+
+	return v, r, s, nil
+}
+
+// fromAddress extracts the address for the account that signed the stamped data.
+func fromAddress(data []byte, v, r, s *big.Int) (string, error) {
+
+	// Convert the [R|S|V] format into the original 65 bytes.
+	sig := ToSignatureBytes(v, r, s)
+
+	// Capture the public key associated with this data and signature.
+	publicKey, err := crypto.SigToPub(data, sig)
+	if err != nil {
+		return "", err
+	}
+
+	// Extract the account address from the public key.
+	return crypto.PubkeyToAddress(*publicKey).String(), nil
+}
+
+// messageStamp returns a hash of 32 bytes that represents the message with
+// the Ardan message stamp embedded into the final hash. The stamp is not the
+// same as the one used for values, so a message can't be signed as a value.
+func messageStamp(msg []byte) []byte {
+	stamp := []byte(fmt.Sprintf("\x19Ardan Signed Off-Chain Message:\n%d", len(msg)))
+
+	return crypto.Keccak256(stamp, msg)
+}
+
 // toSignatureValues converts the signature into the r, s, v values.
 func toSignatureValues(sig []byte) (v, r, s *big.Int) {
 	r = big.NewInt(0).SetBytes(sig[:32])
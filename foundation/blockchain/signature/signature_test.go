@@ -1,6 +1,8 @@
 package signature_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/crypto"
@@ -79,6 +81,47 @@ func Test_Hash(t *testing.T) {
 	}
 }
 
+func Test_HashWith(t *testing.T) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	type table struct {
+		name      string
+		algorithm string
+		hash      string
+	}
+
+	tt := []table{
+		{name: "default", algorithm: "", hash: "0x0f6887ac85101d6d6425a617edf35bd721b5f619fb92c36c3d2224e3bdb0ee5a"},
+		{name: "sha256", algorithm: signature.HashSHA256, hash: "0x0f6887ac85101d6d6425a617edf35bd721b5f619fb92c36c3d2224e3bdb0ee5a"},
+		{name: "keccak256", algorithm: signature.HashKeccak256, hash: "0xc1d172e644eb2c6e3da7cb23c14168fe68d8730b3045042c3ccab646e11fd734"},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			h, err := signature.HashWith(tst.algorithm, value)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to hash the value: %v", tst.name, err)
+			}
+
+			if h != tst.hash {
+				t.Logf("got: %s", h)
+				t.Logf("exp: %s", tst.hash)
+				t.Fatalf("Test %s:\tShould get back the right hash.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	if _, err := signature.HashWith("md5", value); !errors.Is(err, signature.ErrUnknownHashAlgorithm) {
+		t.Fatalf("Should not be able to hash with an unknown algorithm, got %v", err)
+	}
+}
+
 func Test_SignConsistency(t *testing.T) {
 	value1 := struct {
 		Name string
@@ -122,3 +165,156 @@ func Test_SignConsistency(t *testing.T) {
 		t.Fatalf("Should have the same address.")
 	}
 }
+
+func Test_SignMessage(t *testing.T) {
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	msg := []byte("login to the ardan blockchain at 2022-01-01T00:00:00Z")
+
+	sig, err := signature.SignMessage(msg, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the message: %s", err)
+	}
+
+	type table struct {
+		name    string
+		msg     []byte
+		sig     string
+		account string
+		success bool
+	}
+
+	tt := []table{
+		{name: "valid", msg: msg, sig: sig, account: from, success: true},
+		{name: "account case", msg: msg, sig: sig, account: strings.ToLower(from), success: true},
+		{name: "wrong account", msg: msg, sig: sig, account: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", success: false},
+		{name: "wrong message", msg: []byte("login somewhere else"), sig: sig, account: from, success: false},
+		{name: "short signature", msg: msg, sig: sig[:20], account: from, success: false},
+		{name: "not hex", msg: msg, sig: "signature", account: from, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := signature.VerifyMessage(tst.msg, tst.sig, tst.account)
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould be able to verify the message: %s", tst.name, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould not be able to verify the message.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// signable provides the message as the signing bytes of a value, the same
+// way a transaction provides its canonical encoding.
+type signable []byte
+
+func (s signable) SigningBytes() []byte {
+	return s
+}
+
+func Test_MessageReplay(t *testing.T) {
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	msg := []byte("transfer everything")
+
+	// A message signature can't be used as the signature of a value.
+	sig, err := signature.SignMessage(msg, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the message: %s", err)
+	}
+
+	v, r, s, err := signature.ToVRSFromHexSignature(sig)
+	if err != nil {
+		t.Fatalf("Should be able to decode the signature: %s", err)
+	}
+
+	addr, err := signature.FromAddress(signable(msg), v, r, s)
+	if err == nil && addr == from {
+		t.Fatal("Should not be able to use a message signature as a value signature.")
+	}
+
+	// The signature of a value can't be used as a message signature.
+	v, r, s, err = signature.Sign(signable(msg), pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the value: %s", err)
+	}
+
+	if err := signature.VerifyMessage(msg, signature.SignatureString(v, r, s), from); !errors.Is(err, signature.ErrMessageSignature) {
+		t.Fatalf("Should not be able to use a value signature as a message signature: %v", err)
+	}
+}
+
+func Test_SigningDomain(t *testing.T) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	v, r, s, err := signature.SignWithDomain("A", value, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	type table struct {
+		name    string
+		domain  string
+		success bool
+	}
+
+	tt := []table{
+		{name: "same domain", domain: "A", success: true},
+		{name: "other domain", domain: "B", success: false},
+		{name: "no domain", domain: "", success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			addr, err := signature.FromAddressWithDomain(tst.domain, value, v, r, s)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to recover an address: %s", tst.name, err)
+			}
+
+			if tst.success && addr != from {
+				t.Logf("Test %s:\tgot: %s", tst.name, addr)
+				t.Logf("Test %s:\texp: %s", tst.name, from)
+				t.Fatalf("Test %s:\tShould recover the signing address under the same domain.", tst.name)
+			}
+			if !tst.success && addr == from {
+				t.Fatalf("Test %s:\tShould not recover the signing address under a different domain.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	// Without a domain, the signature is the same as before domains existed.
+	v1, r1, s1, err := signature.SignWithDomain("", value, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	v2, r2, s2, err := signature.Sign(value, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	if signature.SignatureString(v1, r1, s1) != signature.SignatureString(v2, r2, s2) {
+		t.Fatal("Should produce the same signature with an empty domain.")
+	}
+}
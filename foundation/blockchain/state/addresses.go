@@ -0,0 +1,54 @@
+package state
+
+import (
+	"net"
+)
+
+// IsSelf reports whether the host is one of the addresses this node can be
+// reached at, so the node never treats itself as a peer.
+func (s *State) IsSelf(host string) bool {
+	_, exists := s.addresses[host]
+	return exists
+}
+
+// selfAddresses constructs the set of addresses this node can be reached
+// at. A host bound to all interfaces is also reachable through the loopback
+// and interface addresses on the same port.
+func selfAddresses(hosts ...string) map[string]struct{} {
+	addrs := make(map[string]struct{})
+
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		addrs[host] = struct{}{}
+
+		ip, port, err := net.SplitHostPort(host)
+		if err != nil {
+			continue
+		}
+
+		if ip != "" && !net.ParseIP(ip).IsUnspecified() {
+			continue
+		}
+
+		for _, loopback := range []string{"localhost", "127.0.0.1", "::1"} {
+			addrs[net.JoinHostPort(loopback, port)] = struct{}{}
+		}
+
+		// The interface addresses are a best effort, the node can still
+		// be reached through the loopback addresses without them.
+		ifaceAddrs, err := net.InterfaceAddrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range ifaceAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				addrs[net.JoinHostPort(ipNet.IP.String(), port)] = struct{}{}
+			}
+		}
+	}
+
+	return addrs
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 )
@@ -13,6 +14,15 @@ import (
 // to be created and there aren't enough transactions.
 var ErrNoTransactions = errors.New("not enough transactions in mempool")
 
+// ErrReadOnly is returned when a read-only node is asked to mine a block or
+// to replace one of its blocks to resolve a fork.
+var ErrReadOnly = errors.New("node is read-only")
+
+// EventTxConfirmed is the prefix for the event sent when a transaction is
+// mined into a block. The signature of the transaction follows the prefix
+// so subscribers can filter for a specific transaction.
+const EventTxConfirmed = "tx:confirmed:"
+
 // /////////////////////////////////////////////////////////////////
 
 // MineNewBlock attempts to create a new block with a proper hash
@@ -20,6 +30,10 @@ var ErrNoTransactions = errors.New("not enough transactions in mempool")
 func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 	defer s.evHandler("viewer: MineNewBlock: MINING: completed")
 
+	if s.readOnly {
+		return database.Block{}, ErrReadOnly
+	}
+
 	s.evHandler("state: MineNewBlock: MINING: check mempool count")
 
 	// Are there enough transactions in the pool.
@@ -40,27 +54,62 @@ func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 	//   to follow the latest set of blocks being produced. The do not validate
 	//   blocks, but can prove a transaction is in a block.
 
-	// Pick the best transaction from the mempool
-	tx := s.mempool.PickBest(s.genesis.TransPerBlock)
+	// Pick the best transactions from the mempool for the next block.
+	start := time.Now()
+	number := s.LatestBlock().Header.Number + 1
+	tx := s.pickBlockTxs(number)
+	selection := time.Since(start)
 
-	difficulty := s.genesis.Difficulty
-	if s.Consensus() == ConsensusPOA {
-		difficulty = 1
+	// Every transaction in the mempool could be past its deadline.
+	if len(tx) == 0 {
+		return database.Block{}, ErrNoTransactions
 	}
 
+	// The transactions can't be replaced while they are being mined.
+	s.mempool.MarkMining(tx)
+	defer s.mempool.ClearMining()
+
+	difficulty := s.expectedDifficulty(number)
+
+	// The state root depends on who receives the reward, fees and tips.
+	header := database.BlockHeader{
+		BeneficiaryID: s.beneficiaryID,
+		MiningReward:  s.genesis.MiningReward,
+		RewardSplits:  s.rewardSplits,
+	}
+
+	phase := time.Now()
+	stateRoot := s.db.HashStateAfter(header, tx)
+	stateRootTime := time.Since(phase)
+
+	// Track the attempts made by this mining operation for diagnostics.
+	s.mineAttempts.Store(0)
+
+	// Report the progress of the mining operation to the viewer.
+	stopProgress := s.startMiningProgress(number, difficulty)
+
 	// Attempt to create a new BlockFS by solving the POW puzzle. This can be cancelled.
+	var powTimings database.POWTimings
 	block, err := database.POW(ctx, database.POWArgs{
 		BeneficiaryID: s.beneficiaryID,
 		Difficulty:    difficulty,
 		MiningReward:  s.genesis.MiningReward,
+		RewardSplits:  s.rewardSplits,
 		PrevBlock:     s.LatestBlock(),
-		StateRoot:     s.db.HashState(),
+		StateRoot:     stateRoot,
+		HashAlgorithm: s.genesis.HashAlgorithm,
+		GenesisHash:   s.genesis.NetworkID(),
 		Tx:            tx,
+		Attempts:      &s.mineAttempts,
+		Timings:       &powTimings,
+		ReportEvery:   s.reportEvery,
 		EvHandler:     s.evHandler,
 	})
 	if err != nil {
+		stopProgress(MiningCancelled)
 		return database.Block{}, err
 	}
+	stopProgress(MiningSolved)
 
 	// Just check one more time we were not cancelled.
 	if ctx.Err() != nil {
@@ -70,9 +119,21 @@ func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 	s.evHandler("state: MineNewBlock: MINING: validate and update database")
 
 	// Validate the block and update the blockchain database
+	phase = time.Now()
 	if err := s.validateUpdateDatabase(block); err != nil {
 		return database.Block{}, err
 	}
+	s.signalTipChanged()
+
+	s.recordMiningTimings(MiningTimings{
+		Number:    block.Header.Number,
+		Selection: selection,
+		StateRoot: stateRootTime,
+		Merkle:    powTimings.Merkle,
+		POW:       powTimings.POW,
+		Validate:  time.Since(phase),
+		Total:     time.Since(start),
+	})
 
 	return block, nil
 }
@@ -80,13 +141,22 @@ func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 // ProcessProposedBlock takes a block received from  a peer, validates
 // it, and if it passes, writes the block the local blockchain
 func (s *State) ProcessProposedBlock(block database.Block) error {
+	return s.ProcessProposedBlockFrom(block, "")
+}
+
+// ProcessProposedBlockFrom performs the work of ProcessProposedBlock for a
+// block received from the specified source. A rejected block is recorded
+// with its source so it can be looked at later.
+func (s *State) ProcessProposedBlockFrom(block database.Block, source string) error {
 	s.evHandler("state: ValidateProposedBlock: started: prevBlk[%s]: newBlk[%s]: numTrans[%d]", block.Header.PrevBlockHash, block.Hash(), len(block.MerkleTree.Values()))
 	defer s.evHandler("state: ValidateProposedBlock: completed: newBlk[%s]", block.Hash())
 
 	// Validate the block and then update the blockchain database.
 	if err := s.validateUpdateDatabase(block); err != nil {
+		s.recordRejected(block, source, err)
 		return err
 	}
+	s.signalTipChanged()
 
 	// If the runMiningOperation function is being executed it needs to stop
 	// immediately.
@@ -104,6 +174,26 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkEquivocation(block); err != nil {
+		return err
+	}
+
+	// If the block competes with our latest block for the same height, the
+	// fork choice rule decides which one is kept. A read-only node keeps the
+	// block it has.
+	if s.isCompetingBlock(block) {
+		if s.readOnly {
+			return fmt.Errorf("%w: competing block %d, keeping %s", ErrReadOnly, block.Header.Number, s.db.LatestBlock().Hash())
+		}
+		return s.resolveFork(block)
+	}
+
+	return s.updateDatabase(block)
+}
+
+// updateDatabase performs the work of validateUpdateDatabase. The caller
+// must hold the state lock.
+func (s *State) updateDatabase(block database.Block) error {
 	s.evHandler("state: validateUpdateDatabase: validate block")
 
 	// CORE NOTE: We could add logic to determine if this block was mined by this
@@ -111,17 +201,40 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	// us to this function for the same block number, we could replace the peer
 	// block with my own and attempt to have other peers accept our block instead.
 
-	if err := block.ValidateBlock(s.db.LatestBlock(), s.db.HashState(), s.evHandler); err != nil {
+	// The state root is checked against our accounts as they would be after
+	// applying the block, so nodes that disagree on the ledger reject it.
+	stateRoot := s.db.HashStateAfter(block.Header, block.MerkleTree.Values())
+
+	// The difficulty is bound to the protocol, not just to the parent block.
+	difficulty := s.expectedDifficulty(block.Header.Number)
+
+	if err := block.ValidateBlock(s.db.LatestBlock(), difficulty, s.genesis.HashAlgorithm, stateRoot, s.genesis.AccountTxCap, s.strict(), s.evHandler); err != nil {
+		return err
+	}
+
+	if err := s.db.CheckGenesis(block.Header); err != nil {
+		return err
+	}
+
+	s.evHandler("state: validateUpdateDatabase: validate block transactions")
+
+	// Only the rules that don't depend on the accounts are checked. A bad
+	// nonce or balance fails the transaction when the block is applied.
+	if err := s.checkBlockTxs(block); err != nil {
 		return err
 	}
 
 	s.evHandler("state: validateUpdateDatabase: write to disk")
 
-	// Write the new block to the chain on disk.
+	// Write the new block to the chain on disk. Nothing in memory is changed
+	// until the write succeeds, so a failed write (like a full disk) leaves
+	// the latest block, accounts and mempool exactly as they were.
 	if err := s.db.Write(block); err != nil {
+		s.evHandler("state: validateUpdateDatabase: ERROR: write blk[%d]: %s", block.Header.Number, err)
 		return err
 	}
 	s.db.UpdateLatestBlock(block)
+	s.recordMined(block)
 
 	s.evHandler("state: validateUpdateDatabase: update accounts and remove from mempool")
 
@@ -132,17 +245,41 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 		// Remove this transaction from the mempool.
 		s.mempool.Delete(tx)
 
-		// Apply the balance changes based on this transaction.
-		if err := s.db.ApplyTx(block, tx); err != nil {
+		// Apply the balance changes based on this transaction and send the
+		// outcome to the viewer.
+		err := s.db.ApplyTx(block, tx)
+		s.txEvent(block, tx, err)
+		if err != nil {
 			s.evHandler("state: validateUpdateDatabase: WARNING : %s", err)
 			continue
 		}
+
+		// Send an event that this transaction has been confirmed.
+		s.evHandler("%s%s", EventTxConfirmed, tx.SignatureString())
 	}
 
 	s.evHandler("state: updateLocalState: apply mining reward")
 
 	// Apply the mining reward for this block.
-	s.db.ApplyMiningReward(block)
+	if err := s.db.ApplyMiningReward(block); err != nil {
+		s.evHandler("state: validateUpdateDatabase: WARNING : %s", err)
+	}
+
+	// Periodically prune the empty accounts to bound the size of the database.
+	if s.pruneBlocks > 0 && block.Header.Number%s.pruneBlocks == 0 {
+		pruned := s.db.PruneEmptyAccounts()
+		s.evHandler("state: validateUpdateDatabase: pruned empty accounts[%d]", pruned)
+	}
+
+	// Periodically snapshot the accounts so a restart only replays the
+	// blocks after the snapshot.
+	if s.snapBlocks > 0 && block.Header.Number%s.snapBlocks == 0 {
+		if _, err := s.db.WriteSnapshot(); err != nil {
+			s.evHandler("state: validateUpdateDatabase: WARNING : snapshot: %s", err)
+		} else {
+			s.evHandler("state: validateUpdateDatabase: wrote snapshot: blk[%d]", block.Header.Number)
+		}
+	}
 
 	// Send an event about this new block
 	s.blockEvent(block)
@@ -150,13 +287,80 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	return nil
 }
 
+// pickBlockTxs picks the best transactions from the mempool that haven't
+// expired for the block at the specified height, spreading the block across
+// accounts when there is a cap on transactions per account.
+func (s *State) pickBlockTxs(number uint64) []database.BlockTx {
+	return s.mempool.PickBestForBlock(number, s.genesis.TransPerBlock, s.genesis.AccountTxCap)
+}
+
+// expectedDifficulty returns the difficulty a block at the specified height
+// must be mined with under the node's consensus protocol. POA blocks are
+// mined at the lowest difficulty since the selected node is the only one
+// allowed to mine the block.
+func (s *State) expectedDifficulty(number uint64) uint16 {
+	if s.Consensus() == ConsensusPOA {
+		return 1
+	}
+
+	return s.genesis.ExpectedDifficulty(number)
+}
+
+// TxEvent represents the outcome of applying a transaction in a block. It's
+// sent to the viewer for every transaction in a new block.
+type TxEvent struct {
+	BlockNumber uint64             `json:"block_number"`
+	Sig         string             `json:"sig"`
+	FromID      database.AccountID `json:"from"`
+	ToID        database.AccountID `json:"to"`
+	Value       uint64             `json:"value"`
+	Tip         uint64             `json:"tip"`
+	GasPrice    uint64             `json:"gas_price"`
+	GasUnits    uint64             `json:"gas_units"`
+	Success     bool               `json:"success"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// txEvent provides a specific event about the outcome of applying a
+// transaction in a new block for application specific support.
+func (s *State) txEvent(block database.Block, tx database.BlockTx, applyErr error) {
+	ev := TxEvent{
+		BlockNumber: block.Header.Number,
+		Sig:         tx.SignatureString(),
+		FromID:      tx.FromID,
+		ToID:        tx.ToID,
+		Value:       tx.Value,
+		Tip:         tx.Tip,
+		GasPrice:    tx.GasPrice,
+		GasUnits:    tx.GasUnits,
+		Success:     applyErr == nil,
+	}
+	if applyErr != nil {
+		ev.Error = applyErr.Error()
+	}
+
+	s.evHandler("viewer: tx: %s", eventJSON(ev))
+}
+
 // blockEvent provides a specific event about a new block in the
-// chain for application specific support.
+// chain for application specific support. The block is sent in the
+// same form the viewer reads from the node's block list.
 func (s *State) blockEvent(block database.Block) {
-	data, err := json.Marshal(block.Header)
+	s.evHandler("viewer: block: %s", eventJSON(database.NewBlockData(block)))
+}
+
+// eventJSON marshals the value for an event. If the value can't be
+// marshaled, the error is marshaled in its place so the viewer always
+// receives valid JSON.
+func eventJSON(v any) string {
+	data, err := json.Marshal(v)
 	if err != nil {
-		data = []byte(fmt.Sprintf("{error: %q}", err.Error()))
+		data, _ = json.Marshal(struct {
+			Error string `json:"error"`
+		}{
+			Error: err.Error(),
+		})
 	}
 
-	s.evHandler("viewer: block: %s", string(data))
+	return string(data)
 }
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+)
+
+// CORE NOTE: Block and transaction timestamps are validated against the
+// node's clock, so a node with a badly skewed clock will reject valid blocks
+// or accept bad ones. Each peer reports the time on its clock in its status,
+// and the node compares it with its own clock at the midpoint of the request
+// to cancel out most of the network latency. The median across peers is used
+// so a single peer with a bad clock can't make this node look skewed.
+
+// PeerClockSkew returns the median difference between the clocks of the known
+// peers and this node's clock. A positive value means the peers are ahead of
+// this node. Zero is returned when no peer has reported its time.
+func (s *State) PeerClockSkew() time.Duration {
+	known := s.KnownExternalPeers()
+
+	s.skewMu.Lock()
+	skews := make([]time.Duration, 0, len(known))
+	for _, pr := range known {
+		if skew, exists := s.peerSkew[pr.Host]; exists {
+			skews = append(skews, skew)
+		}
+	}
+	s.skewMu.Unlock()
+
+	if len(skews) == 0 {
+		return 0
+	}
+
+	sort.Slice(skews, func(i, j int) bool { return skews[i] < skews[j] })
+
+	mid := len(skews) / 2
+	if len(skews)%2 == 1 {
+		return skews[mid]
+	}
+
+	return skews[mid-1] + (skews[mid]-skews[mid-1])/2
+}
+
+// ClockSkewed reports whether the median peer clock skew is more than the
+// max clock skew allowed.
+func (s *State) ClockSkewed() bool {
+	skew := s.PeerClockSkew()
+	if skew < 0 {
+		skew = -skew
+	}
+
+	return skew > s.maxSkew
+}
+
+// MaxClockSkew returns how far this node's clock can be from its peers'
+// clocks before it's reported as skewed.
+func (s *State) MaxClockSkew() time.Duration {
+	return s.maxSkew
+}
+
+// StopMiningOnSkew reports whether this node stops mining while its clock
+// is skewed from its peers.
+func (s *State) StopMiningOnSkew() bool {
+	return s.skewStopsMine
+}
+
+// =============================================================================
+
+// recordPeerClock records the skew between the peer's clock and this node's
+// clock, using the time the status request was sent and received. Peers that
+// don't report their time are ignored.
+func (s *State) recordPeerClock(pr peer.Peer, sent time.Time, received time.Time, peerTime uint64) {
+	if peerTime == 0 {
+		return
+	}
+
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := time.UnixMilli(int64(peerTime)).Sub(local)
+
+	s.skewMu.Lock()
+	defer s.skewMu.Unlock()
+
+	s.peerSkew[pr.Host] = skew
+}
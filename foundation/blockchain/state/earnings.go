@@ -0,0 +1,39 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// BeneficiaryEarnings returns the amounts each account earned for mining the
+// blocks in the from/to range: the mining rewards along with the gas fees and
+// tips of the transactions. Accounts sharing a beneficiary's credit through
+// the reward splits are credited with their share. QueryLatest can be used
+// for the latest block.
+func (s *State) BeneficiaryEarnings(from, to uint64) (map[database.AccountID]uint64, error) {
+	latest := s.db.LatestBlock().Header.Number
+
+	if from == 0 {
+		from = 1
+	}
+	if from == QueryLatest {
+		from = latest
+	}
+	if to == QueryLatest || to > latest {
+		to = latest
+	}
+
+	if from > to {
+		return nil, fmt.Errorf("invalid block range, from %d, to %d, latest %d", from, to, latest)
+	}
+
+	earnings, err := s.db.Earnings(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	s.evHandler("state: BeneficiaryEarnings: blks[%d-%d]: accounts[%d]", from, to, len(earnings))
+
+	return earnings, nil
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// ErrEquivocation is returned when a beneficiary proposes a block at a height
+// it has already produced a different block for.
+var ErrEquivocation = errors.New("beneficiary produced a different block at the same height")
+
+// equivocationWindow is the number of recent block heights that are tracked
+// to detect equivocating miners.
+const equivocationWindow = 100
+
+// minedKey identifies a block produced by a beneficiary at a given height.
+type minedKey struct {
+	number        uint64
+	beneficiaryID database.AccountID
+}
+
+// CORE NOTE: In POA, only the selected node is allowed to mine the block for
+// a given height. If that node produces two different blocks at the same
+// height (equivocation), both blocks could propagate through the network.
+// The first block seen is kept and any other block is rejected and logged.
+
+// checkEquivocation validates the beneficiary of the block hasn't already
+// produced a different block at the same height. The caller must hold the
+// state lock.
+func (s *State) checkEquivocation(block database.Block) error {
+	if s.consensus != ConsensusPOA {
+		return nil
+	}
+
+	key := minedKey{number: block.Header.Number, beneficiaryID: block.Header.BeneficiaryID}
+
+	hash, exists := s.mined[key]
+	if !exists || hash == block.Hash() {
+		return nil
+	}
+
+	s.evHandler("state: checkEquivocation: WARNING: EQUIVOCATION: beneficiary[%s]: blk[%d]: kept[%s]: rejected[%s]", key.beneficiaryID, key.number, hash, block.Hash())
+
+	return fmt.Errorf("%w: beneficiary %s, block %d", ErrEquivocation, key.beneficiaryID, key.number)
+}
+
+// recordMined tracks the block produced by the beneficiary at this height and
+// forgets the heights that fall outside of the window. The caller must hold
+// the state lock.
+func (s *State) recordMined(block database.Block) {
+	if s.consensus != ConsensusPOA {
+		return
+	}
+
+	key := minedKey{number: block.Header.Number, beneficiaryID: block.Header.BeneficiaryID}
+	s.mined[key] = block.Hash()
+
+	if block.Header.Number <= equivocationWindow {
+		return
+	}
+
+	oldest := block.Header.Number - equivocationWindow
+	for key := range s.mined {
+		if key.number <= oldest {
+			delete(s.mined, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// Set of limits for the number of recent blocks sampled by the fee market.
+const (
+	DefaultFeeMarketBlocks = 20
+	MaxFeeMarketBlocks     = 1000
+)
+
+// Percentiles represents the 10th, 50th and 90th percentile of a set of values.
+type Percentiles struct {
+	P10 uint64 `json:"p10"`
+	P50 uint64 `json:"p50"`
+	P90 uint64 `json:"p90"`
+}
+
+// FeeMarket represents a summary of the fees paid by the transactions in the
+// most recent blocks and offered by the transactions in the mempool.
+type FeeMarket struct {
+	LatestBlock   uint64      `json:"latest_block"`    // Number of the latest block sampled.
+	Blocks        uint64      `json:"blocks"`          // Number of recent blocks sampled.
+	BlockTxs      int         `json:"block_txs"`       // Number of transactions in the sampled blocks.
+	BlockTip      Percentiles `json:"block_tip"`       // Tips paid by the transactions in the sampled blocks.
+	BlockGasPrice Percentiles `json:"block_gas_price"` // Effective gas price paid by the transactions in the sampled blocks.
+	MempoolTxs    int         `json:"mempool_txs"`     // Number of transactions in the mempool.
+	MempoolTip    Percentiles `json:"mempool_tip"`     // Tips offered by the transactions in the mempool.
+}
+
+// CORE NOTE: The effective gas price is what a transaction paid for each unit
+// of gas, the gas price plus the tip spread across the gas units. On a new
+// chain there may be fewer blocks than requested, or no transactions at all.
+// Whatever blocks exist are sampled, and when there are no transactions the
+// tips are reported as 0 and the gas price as the genesis gas price, which is
+// the least any transaction will pay.
+
+// FeeMarket returns a summary of the fees for the specified number of most
+// recent blocks and the current mempool. A number of 0 samples the default
+// number of blocks.
+func (s *State) FeeMarket(blocks uint64) (FeeMarket, error) {
+	switch {
+	case blocks == 0:
+		blocks = DefaultFeeMarketBlocks
+	case blocks > MaxFeeMarketBlocks:
+		blocks = MaxFeeMarketBlocks
+	}
+
+	latest := s.db.LatestBlock().Header.Number
+
+	from := uint64(1)
+	if latest > blocks {
+		from = latest - blocks + 1
+	}
+
+	var tips, gasPrices []uint64
+	for i := from; i <= latest; i++ {
+		block, err := s.db.GetBlock(i)
+		if err != nil {
+			return FeeMarket{}, err
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			tips = append(tips, tx.Tip)
+			gasPrices = append(gasPrices, effectiveGasPrice(tx))
+		}
+	}
+
+	var mempoolTips []uint64
+	for _, tx := range s.mempool.PickBest() {
+		mempoolTips = append(mempoolTips, tx.Tip)
+	}
+
+	fm := FeeMarket{
+		LatestBlock:   latest,
+		BlockTxs:      len(tips),
+		BlockTip:      percentiles(tips),
+		BlockGasPrice: percentiles(gasPrices),
+		MempoolTxs:    len(mempoolTips),
+		MempoolTip:    percentiles(mempoolTips),
+	}
+
+	if latest > 0 {
+		fm.Blocks = latest - from + 1
+	}
+
+	if len(gasPrices) == 0 {
+		gp := s.genesis.GasPrice
+		fm.BlockGasPrice = Percentiles{P10: gp, P50: gp, P90: gp}
+	}
+
+	return fm, nil
+}
+
+// =============================================================================
+
+// effectiveGasPrice returns the price paid for each unit of gas used by the
+// transaction, including the tip.
+func effectiveGasPrice(tx database.BlockTx) uint64 {
+	if tx.GasUnits == 0 {
+		return tx.GasPrice + tx.Tip
+	}
+
+	return tx.GasPrice + tx.Tip/tx.GasUnits
+}
+
+// percentiles calculates the percentiles of the values using the nearest
+// rank method. An empty set of values returns all zeros.
+func percentiles(values []uint64) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := make([]uint64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(p int) uint64 {
+		return sorted[(p*len(sorted)+99)/100-1]
+	}
+
+	return Percentiles{
+		P10: rank(10),
+		P50: rank(50),
+		P90: rank(90),
+	}
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// Set of fork choice rules that can be used to pick between two
+// competing blocks at the same height.
+const (
+	ForkChoiceTimestamp = "timestamp"
+	ForkChoiceNone      = "none"
+)
+
+// timestampTolerance is how far apart the timestamps of two competing blocks
+// must be before the earlier one is preferred. It's part of the protocol, not
+// the node config, so every node resolves the same fork the same way.
+const timestampTolerance = 30 * time.Second
+
+// ErrForkChoiceLost is returned when a competing block is rejected
+// because the fork choice rule prefers the block we already have.
+var ErrForkChoiceLost = errors.New("competing block lost the fork choice")
+
+// CORE NOTE: Two nodes can mine a valid block at the same height on top of
+// the same parent. Both chains then have the same length and, when the
+// blocks have the same difficulty, the same cumulative difficulty. By default
+// every node keeps the block it saw first, so the network could stay split
+// or flap between the two chains. The timestamp rule is opt-in and makes
+// every node pick the same block: the higher difficulty wins, then the
+// earlier timestamp, and finally the lower hash.
+//
+// A miner picks its own timestamp, so the earlier timestamp alone would let
+// a miner win every tie by backdating its block. A block can't be timestamped
+// before its parent, which both competing blocks share, and timestamps
+// within the tolerance of each other are treated as equal. Backdating only
+// wins against a block mined long after the parent, otherwise the hash
+// decides.
+
+// isCompetingBlock checks if the block is a different block at the same
+// height and with the same parent as our latest block. The caller must hold
+// the state lock.
+func (s *State) isCompetingBlock(block database.Block) bool {
+	if s.forkChoice == ForkChoiceNone {
+		return false
+	}
+
+	latest := s.db.LatestBlock()
+
+	switch {
+	case latest.Header.Number == 0:
+		return false
+	case block.Header.Number != latest.Header.Number:
+		return false
+	case block.Header.PrevBlockHash != latest.Header.PrevBlockHash:
+		return false
+	}
+
+	return block.Hash() != latest.Hash()
+}
+
+// resolveFork applies the fork choice rule between our latest block and the
+// competing block. If the competing block wins, our latest block is rolled
+// back and replaced, and the transactions only in our block are returned to
+// the mempool. The caller must hold the state lock.
+func (s *State) resolveFork(block database.Block) error {
+	latest := s.db.LatestBlock()
+
+	if !preferBlock(block, latest) {
+		s.evHandler("state: resolveFork: keep: blk[%s]: reject: blk[%s]", latest.Hash(), block.Hash())
+		return fmt.Errorf("%w: block %d, keeping %s", ErrForkChoiceLost, block.Header.Number, latest.Hash())
+	}
+
+	s.evHandler("state: resolveFork: replace: blk[%s]: with: blk[%s]", latest.Hash(), block.Hash())
+
+	if err := s.rollbackLatestBlock(); err != nil {
+		return err
+	}
+
+	if err := s.updateDatabase(block); err != nil {
+		s.evHandler("state: resolveFork: ERROR: blk[%s]: %s", block.Hash(), err)
+
+		// Put our block back since the competing block is invalid.
+		if err := s.updateDatabase(latest); err != nil {
+			s.evHandler("state: resolveFork: ERROR: restoring blk[%s]: %s", latest.Hash(), err)
+		}
+
+		return err
+	}
+
+	s.recoverOrphanedTxs(latest, block)
+
+	return nil
+}
+
+// recoverOrphanedTxs returns the transactions that were only in the orphaned
+// block back to the mempool so they can be mined again. Transactions in the
+// winning block, or whose nonce the winning chain already used, are dropped.
+// The caller must hold the state lock.
+func (s *State) recoverOrphanedTxs(orphaned database.Block, winner database.Block) {
+	mined := make(map[string]struct{})
+	for _, tx := range winner.MerkleTree.Values() {
+		mined[tx.SignatureString()] = struct{}{}
+	}
+
+	for _, tx := range orphaned.MerkleTree.Values() {
+		if _, exists := mined[tx.SignatureString()]; exists {
+			continue
+		}
+
+		if account, err := s.db.Query(tx.FromID); err == nil && tx.Nonce <= account.Nonce {
+			continue
+		}
+
+		// The orphaned block came from storage or a peer, so check the
+		// signature again before trusting the transaction.
+		if err := tx.Validate(s.genesis.ChainID, s.genesis.SigningDomain); err != nil {
+			s.evHandler("state: recoverOrphanedTxs: WARNING: tx[%s]: %s", tx, err)
+			continue
+		}
+
+		if err := s.mempool.Upsert(tx); err != nil {
+			s.evHandler("state: recoverOrphanedTxs: WARNING: tx[%s]: %s", tx, err)
+			continue
+		}
+
+		s.evHandler("state: recoverOrphanedTxs: recovered: tx[%s]", tx)
+	}
+}
+
+// rollbackLatestBlock removes the latest block from the chain. Only that
+// block is removed from storage, the blocks before it are left in place. The
+// caller must hold the state lock.
+func (s *State) rollbackLatestBlock() error {
+	return s.db.RollbackLatestBlock()
+}
+
+// preferBlock returns true if block a should be chosen over block b when
+// both are competing for the same height.
+func preferBlock(a database.Block, b database.Block) bool {
+	if a.Header.Difficulty != b.Header.Difficulty {
+		return a.Header.Difficulty > b.Header.Difficulty
+	}
+
+	tolerance := uint64(timestampTolerance.Milliseconds())
+	switch {
+	case a.Header.TimeStamp+tolerance < b.Header.TimeStamp:
+		return true
+	case b.Header.TimeStamp+tolerance < a.Header.TimeStamp:
+		return false
+	}
+
+	return a.Hash() < b.Hash()
+}
@@ -0,0 +1,47 @@
+package state
+
+import (
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// EventIntegrity is the prefix of the event sent to the viewer for every
+// block in storage that fails the integrity check.
+const EventIntegrity = "viewer: integrity: ALERT: "
+
+// IntegrityInterval returns how often the most recent blocks in storage are
+// checked. A value of 0 means they are never checked.
+func (s *State) IntegrityInterval() time.Duration {
+	return s.checkIntvl
+}
+
+// IntegrityResync reports whether the chain is resynced when the integrity
+// check finds a block in storage that doesn't match.
+func (s *State) IntegrityResync() bool {
+	return s.checkResync
+}
+
+// CheckIntegrity reads the most recent blocks back from storage and checks
+// they match what was written. The number of blocks read is bound by the
+// configured window, so the check never reads the whole chain. The blocks
+// are rebuilt during a resync, so there is nothing to check until it's done.
+func (s *State) CheckIntegrity() []database.BlockMismatch {
+	s.mu.RLock()
+	resyncing := s.resyncing
+	s.mu.RUnlock()
+
+	if resyncing {
+		s.evHandler("state: CheckIntegrity: skipped: resync in progress")
+		return nil
+	}
+
+	checked, mismatches := s.db.CheckIntegrity(s.checkWindow)
+
+	s.evHandler("state: CheckIntegrity: checked[%d]: mismatches[%d]", checked, len(mismatches))
+	for _, m := range mismatches {
+		s.evHandler(EventIntegrity+"blk[%d]: %s", m.Number, m.Reason)
+	}
+
+	return mismatches
+}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// EventMining is the prefix for the events sent about the progress of a
+// mining operation. A MiningEvent encoded as json follows the prefix.
+const EventMining = "viewer: mining: "
+
+// Set of statuses a mining operation reports in a MiningEvent.
+const (
+	MiningStarted   = "started"
+	MiningRunning   = "running"
+	MiningSolved    = "solved"
+	MiningCancelled = "cancelled"
+)
+
+// miningProgressInterval is how often the progress of a running mining
+// operation is sent as an event.
+const miningProgressInterval = time.Second
+
+// MiningEvent represents the progress of a mining operation. It's sent to
+// the viewer when mining starts, every second while mining is running and
+// when mining ends.
+type MiningEvent struct {
+	BlockNumber uint64 `json:"block_number"`
+	Difficulty  uint16 `json:"difficulty"`
+	Attempts    uint64 `json:"attempts"`
+	Elapsed     int64  `json:"elapsed_ms"`
+	Status      string `json:"status"`
+}
+
+// startMiningProgress sends the events about the progress of mining the
+// specified block until the returned function is called with the status
+// the mining operation ended with.
+func (s *State) startMiningProgress(number uint64, difficulty uint16) func(status string) {
+	start := time.Now()
+	s.miningEvent(number, difficulty, MiningStarted, start)
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(miningProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.miningEvent(number, difficulty, MiningRunning, start)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	f := func(status string) {
+		close(done)
+		wg.Wait()
+
+		s.miningEvent(number, difficulty, status, start)
+	}
+
+	return f
+}
+
+// miningEvent provides a specific event about the progress of a mining
+// operation for application specific support.
+func (s *State) miningEvent(number uint64, difficulty uint16, status string, start time.Time) {
+	ev := MiningEvent{
+		BlockNumber: number,
+		Difficulty:  difficulty,
+		Attempts:    s.mineAttempts.Load(),
+		Elapsed:     time.Since(start).Milliseconds(),
+		Status:      status,
+	}
+
+	s.evHandler("%s%s", EventMining, eventJSON(ev))
+}
@@ -2,18 +2,51 @@ package state
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
 )
 
 const baseURL = "http://%s/v1/node"
 
+// ErrGenesisMismatch is returned when a peer is running a chain
+// with a different genesis than this node.
+var ErrGenesisMismatch = errors.New("peer genesis does not match")
+
+// ErrPayloadTooLarge is returned when a peer responds with a body larger
+// than the configured limit.
+var ErrPayloadTooLarge = errors.New("peer payload too large")
+
+// peerTimeout is the max amount of time a network call to a peer can take. This
+// makes sure a hung peer can't block operations like a sync indefinitely.
+const peerTimeout = 10 * time.Second
+
+// newPeerClient constructs the HTTP client used for all network calls to
+// peers. The transport keeps idle connections open so calls to the same peer
+// reuse a connection instead of opening a new one each time.
+func newPeerClient(maxConnsPerHost int, idleTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = maxConnsPerHost
+	transport.MaxIdleConnsPerHost = maxConnsPerHost
+	transport.IdleConnTimeout = idleTimeout
+
+	client := http.Client{
+		Transport: transport,
+		Timeout:   peerTimeout,
+	}
+
+	return &client
+}
+
 // NetSendBlockToPeers takes the new mined block and sends it to all know peers.
 func (s *State) NetSendBlockToPeers(block database.Block) error {
 	s.evHandler("state: NetSendBlockToPeers: started")
@@ -27,7 +60,7 @@ func (s *State) NetSendBlockToPeers(block database.Block) error {
 		var status struct {
 			Status string `json:"status"`
 		}
-		if err := send(http.MethodPost, url, database.NewBlockData(block), &status); err != nil {
+		if err := s.send(http.MethodPost, url, database.NewBlockData(block), &status); err != nil {
 			return fmt.Errorf("%s: %s", pr.Host, err)
 		}
 	}
@@ -46,18 +79,54 @@ func (s *State) NetSendTxToPeers(tx database.BlockTx) {
 	// the receiving node doesn't have it, then it will request the transaction
 	// based on the mempool key it received.
 
+	// CORE NOTE: Sending every transaction to every peer doesn't scale. When
+	// a fanout is configured, the transaction is sent to a random subset of
+	// the peers and those peers share it with their own random subset. The
+	// transaction reaches the whole network through this gossip.
+
+	peers := s.KnownExternalPeers()
+	if s.txFanout > 0 && len(peers) > s.txFanout {
+		rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+		peers = peers[:s.txFanout]
+	}
+
 	// For now, the Disk blockchain just sends the full transaction.
-	for _, pr := range s.KnownExternalPeers() {
+	for _, pr := range peers {
 		s.evHandler("state: NetSendTxToPeers: send: tx[%s] to peer[%s]", tx, pr)
 
 		url := fmt.Sprintf("%s/tx/submit", fmt.Sprintf(baseURL, pr.Host))
 
-		if err := send(http.MethodPost, url, tx, nil); err != nil {
+		if err := s.send(http.MethodPost, url, tx, nil); err != nil {
 			s.evHandler("state: NetSendTxToPeers: WARNING: %s", err)
 		}
 	}
 }
 
+// NetSendTipToPeers notifies the known peers of this node's latest block.
+// Only the number and hash are sent, a peer that is behind requests the
+// block itself.
+func (s *State) NetSendTipToPeers() {
+	s.evHandler("state: NetSendTipToPeers: started")
+	defer s.evHandler("state: NetSendTipToPeers: completed")
+
+	latest := s.LatestBlock()
+	tip := peer.Tip{
+		Host:   s.Host(),
+		Number: latest.Header.Number,
+		Hash:   latest.Hash(),
+	}
+
+	for _, pr := range s.KnownExternalPeers() {
+		s.evHandler("state: NetSendTipToPeers: send: blk[%d]: hash[%s] to peer[%s]", tip.Number, tip.Hash, pr)
+
+		url := fmt.Sprintf("%s/tip", fmt.Sprintf(baseURL, pr.Host))
+
+		if err := s.send(http.MethodPost, url, tip, nil); err != nil {
+			s.evHandler("state: NetSendTipToPeers: WARNING: %s", err)
+		}
+	}
+}
+
 // NetSendNodeAvailableToPeers shares this node is available to
 // participate in the network with the known peers.
 func (s *State) NetSendNodeAvailableToPeers() {
@@ -71,7 +140,7 @@ func (s *State) NetSendNodeAvailableToPeers() {
 
 		url := fmt.Sprintf("%s/peers", fmt.Sprintf(baseURL, pr.Host))
 
-		if err := send(http.MethodPost, url, host, nil); err != nil {
+		if err := s.send(http.MethodPost, url, host, nil); err != nil {
 			s.evHandler("state: NetSendNodeAvailableToPeers: WARNING: %s", err)
 		}
 	}
@@ -86,15 +155,37 @@ func (s *State) NetRequestPeerStatus(pr peer.Peer) (peer.Status, error) {
 	url := fmt.Sprintf("%s/status", fmt.Sprintf(baseURL, pr.Host))
 
 	var ps peer.Status
-	if err := send(http.MethodGet, url, nil, &ps); err != nil {
+	sent := time.Now()
+	if err := s.send(http.MethodGet, url, nil, &ps); err != nil {
 		return peer.Status{}, err
 	}
+	s.recordPeerClock(pr, sent, time.Now(), ps.Time)
 
 	s.evHandler("state: NetRequestPeerStatus: peer-node[%s]: latest-blknum[%d]: peer-list[%s]", pr, ps.LatestBlockNumber, ps.KnownPeers)
 
 	return ps, nil
 }
 
+// VerifyPeerGenesis asks the peer for their genesis information and
+// validates it matches ours, so we don't sync with a peer on another chain.
+func (s *State) VerifyPeerGenesis(pr peer.Peer) error {
+	s.evHandler("state: VerifyPeerGenesis: started: %s", pr)
+	defer s.evHandler("state: VerifyPeerGenesis: completed: %s", pr)
+
+	url := fmt.Sprintf("%s/genesis", fmt.Sprintf(baseURL, pr.Host))
+
+	var gen genesis.Genesis
+	if err := s.send(http.MethodGet, url, nil, &gen); err != nil {
+		return err
+	}
+
+	if id, exp := gen.NetworkID(), s.genesis.NetworkID(); id != exp {
+		return fmt.Errorf("%w: peer %s, network id %s, exp %s", ErrGenesisMismatch, pr.Host, id, exp)
+	}
+
+	return nil
+}
+
 // NetRequestPeerMempool asks the peer for the transactions in their mempool.
 func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error) {
 	s.evHandler("state: NetRequestPeerMempool: started: %s", pr)
@@ -103,7 +194,7 @@ func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error)
 	url := fmt.Sprintf("%s/tx/list", fmt.Sprintf(baseURL, pr.Host))
 
 	var mempool []database.BlockTx
-	if err := send(http.MethodGet, url, nil, &mempool); err != nil {
+	if err := s.send(http.MethodGet, url, nil, &mempool); err != nil {
 		return nil, err
 	}
 
@@ -129,34 +220,49 @@ func (s *State) NetRequestPeerBlocks(pr peer.Peer) error {
 	// transactions to have a complete account database. The cryptographic audit
 	// does take place as each full block is downloaded from peers.
 
-	from := s.LatestBlock().Header.Number + 1
-	url := fmt.Sprintf("%s/block/list/%d/latest", fmt.Sprintf(baseURL, pr.Host), from)
+	// CORE NOTE: A node limits the number of blocks it serves at once, so the
+	// blocks are requested in pages that stay within the limit. This node's
+	// limit is used, which works as long as the peers are configured with the
+	// same or a larger limit. A page with fewer blocks than requested means
+	// there are no more blocks.
 
-	var blocksData []database.BlockData
-	if err := send(http.MethodGet, url, nil, &blocksData); err != nil {
-		return err
-	}
+	for {
+		from := s.LatestBlock().Header.Number + 1
+		to := from + s.maxBlkRange - 1
+		url := fmt.Sprintf("%s/block/list/%d/%d", fmt.Sprintf(baseURL, pr.Host), from, to)
 
-	s.evHandler("state: NetRequestPeerBlocks: found blocksData[%d]", len(blocksData))
-
-	for _, blockData := range blocksData {
-		block, err := database.ToBlock(blockData)
-		if err != nil {
+		var blocksData []database.BlockData
+		if err := s.send(http.MethodGet, url, nil, &blocksData); err != nil {
 			return err
 		}
 
-		if err := s.ProcessProposedBlock(block); err != nil {
-			return err
+		s.evHandler("state: NetRequestPeerBlocks: blks[%d-%d]: found blocksData[%d]", from, to, len(blocksData))
+
+		// CORE NOTE: Each block is fully validated and applied before moving on to
+		// the next one. If a block fails, the blocks before it remain applied and
+		// the sync stops. The next sync resumes from the latest block we have.
+		for i, blockData := range blocksData {
+			block, err := database.ToBlock(blockData)
+			if err == nil {
+				err = s.ProcessProposedBlockFrom(block, pr.Host)
+			}
+
+			if err != nil {
+				s.evHandler("state: NetRequestPeerBlocks: ERROR: blk[%d]: applied[%d] of [%d]: %s", blockData.Header.Number, i, len(blocksData), err)
+				return fmt.Errorf("block %d: applied %d of %d blocks: %w", blockData.Header.Number, i, len(blocksData), err)
+			}
 		}
-	}
 
-	return nil
+		if uint64(len(blocksData)) < s.maxBlkRange {
+			return nil
+		}
+	}
 }
 
 // /////////////////////////////////////////////////////////////////
 
 // send is a helper function to send an HTTP request to a node.
-func send(method string, url string, dataSend any, dataRecv any) error {
+func (s *State) send(method string, url string, dataSend any, dataRecv any) error {
 	var req *http.Request
 
 	switch {
@@ -178,30 +284,65 @@ func send(method string, url string, dataSend any, dataRecv any) error {
 		}
 	}
 
-	var client http.Client
-	resp, err := client.Do(req)
+	// Peers compress their responses, which matters for the status and
+	// mempool that are polled frequently. Asking for gzip explicitly leaves
+	// the decompression to us, so the size limit applies to both bodies.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := s.peerClient.Do(req)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+
+	// A peer can't be trusted to send a reasonably sized body, so never
+	// read more than the configured limit.
+	body := http.MaxBytesReader(nil, resp.Body, s.peerMaxResp)
+
+	// The body needs to be fully read for the connection to be reused.
+	defer func() {
+		io.Copy(io.Discard, body)
+		body.Close()
+	}()
 
 	if resp.StatusCode == http.StatusNoContent {
 		return nil
 	}
 
+	var reader io.Reader = body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return payloadError(url, err)
+		}
+		defer gz.Close()
+
+		reader = http.MaxBytesReader(nil, gz, s.peerMaxResp)
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		msg, err := io.ReadAll(resp.Body)
+		msg, err := io.ReadAll(reader)
 		if err != nil {
-			return err
+			return payloadError(url, err)
 		}
 		return errors.New(string(msg))
 	}
 
 	if dataRecv != nil {
-		if err := json.NewDecoder(resp.Body).Decode(dataRecv); err != nil {
-			return err
+		if err := json.NewDecoder(reader).Decode(dataRecv); err != nil {
+			return payloadError(url, err)
 		}
 	}
 
 	return nil
 }
+
+// payloadError converts the error from reading a peer response body into an
+// ErrPayloadTooLarge error if the body exceeded the configured limit.
+func payloadError(url string, err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return fmt.Errorf("%w: %s: limit %d bytes", ErrPayloadTooLarge, url, maxErr.Limit)
+	}
+
+	return err
+}
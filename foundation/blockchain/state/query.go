@@ -1,17 +1,101 @@
 package state
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 )
 
 // QueryLatest represents a query to the latest block in the chain.
 const QueryLatest = ^uint64(0) >> 1
 
+// ErrTxNotFound is returned when a transaction is not pending in the mempool.
+var ErrTxNotFound = errors.New("transaction not found in mempool")
+
+// ErrBlockNotFound is returned when a block is not in the blockchain.
+var ErrBlockNotFound = errors.New("block not found")
+
+// ErrHistoryTooDeep is returned when an account is queried at a block further
+// back from the latest block than the history depth.
+var ErrHistoryTooDeep = errors.New("block is too far back in history")
+
+// TxProof represents a transaction in a block along with the merkle proof
+// that it's part of the block's transaction root.
+type TxProof struct {
+	Tx         database.BlockTx `json:"tx"`
+	Proof      []string         `json:"proof"`
+	ProofOrder []int64          `json:"proof_order"`
+}
+
 // QueryAccount returns a copy of the database record for the specified account.
 func (s *State) QueryAccount(account database.AccountID) (database.Account, error) {
 	return s.db.Query(account)
 }
 
+// QueryAccountAt returns the account as it was after the specified block was
+// applied. QueryLatest can be used for the latest block. The chain is replayed
+// to rebuild the account, so the block can only be as far back from the latest
+// block as the history depth.
+func (s *State) QueryAccountAt(account database.AccountID, block uint64) (database.Account, error) {
+	latest := s.db.LatestBlock().Header.Number
+	if block == QueryLatest {
+		block = latest
+	}
+
+	if block < latest && latest-block > s.historyDepth {
+		return database.Account{}, fmt.Errorf("%w, blk[%d] is more than %d blocks before the latest blk[%d]", ErrHistoryTooDeep, block, s.historyDepth, latest)
+	}
+
+	return s.db.AccountAt(account, block, s.historyDepth)
+}
+
+// LookupName returns the account the name is registered to on the chain.
+func (s *State) LookupName(name string) (database.AccountID, error) {
+	return s.db.LookupName(name)
+}
+
+// QueryMempoolTx returns the transaction pending in the mempool with the
+// specified signature.
+func (s *State) QueryMempoolTx(sig string) (database.BlockTx, error) {
+	for _, tx := range s.mempool.PickBest() {
+		if tx.SignatureString() == sig {
+			return tx, nil
+		}
+	}
+
+	return database.BlockTx{}, ErrTxNotFound
+}
+
+// NextBlockTxs returns the transactions from the mempool that would be mined
+// into the next block right now, in the order they would be in the block.
+// The mempool is left untouched.
+func (s *State) NextBlockTxs() []database.BlockTx {
+	return s.pickBlockTxs(s.LatestBlock().Header.Number + 1)
+}
+
+// QueryStateRoot returns the block along with the sorted set of accounts used
+// to calculate the state root stored in that block's header. Hashing the
+// accounts reproduces the state root so it can be independently verified.
+//
+// CORE NOTE: Reproducing the accounts for an older block requires replaying
+// the blockchain up to that block. For now, only the latest block is supported.
+func (s *State) QueryStateRoot(number uint64) (database.Block, []database.Account, error) {
+	block, accounts := s.db.StateAccounts()
+
+	if block.Header.Number == 0 {
+		return database.Block{}, nil, errors.New("no blocks have been written to the blockchain")
+	}
+
+	if number != QueryLatest && number != block.Header.Number {
+		return database.Block{}, nil, fmt.Errorf("state root accounts are only available for the latest block %d", block.Header.Number)
+	}
+
+	return block, accounts, nil
+}
+
 // QueryBlocksByNumber returns the set of blocks based on block numbers.
 // This function reads the blockchain from the disk first.
 func (s *State) QueryBlocksByNumber(from, to uint64) []database.Block {
@@ -37,19 +121,129 @@ func (s *State) QueryBlocksByNumber(from, to uint64) []database.Block {
 	return out
 }
 
+// QueryRecentBlocks returns up to the last n blocks in the chain, starting
+// with the latest block.
+func (s *State) QueryRecentBlocks(n int) ([]database.Block, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of blocks %d, must be at least 1", n)
+	}
+
+	var out []database.Block
+	iter := s.db.ForEachReverse()
+	for !iter.Done() && len(out) < n {
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block)
+	}
+
+	return out, nil
+}
+
+// QueryHeadersByNumber returns the set of block headers based on block
+// numbers, without the transactions. This function reads the blockchain
+// from the disk first.
+func (s *State) QueryHeadersByNumber(from, to uint64) []database.BlockHeader {
+	blocks := s.QueryBlocksByNumber(from, to)
+
+	headers := make([]database.BlockHeader, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header
+	}
+
+	return headers
+}
+
+// QueryBlock returns the specified block. QueryLatest can be used to get
+// the latest block.
+func (s *State) QueryBlock(number uint64) (database.Block, error) {
+	latest := s.db.LatestBlock().Header.Number
+	if number == QueryLatest {
+		number = latest
+	}
+
+	if number == 0 || number > latest {
+		return database.Block{}, fmt.Errorf("%w: blk[%d]", ErrBlockNotFound, number)
+	}
+
+	return s.db.GetBlock(number)
+}
+
+// QueryBlockTxs returns the transactions in the specified block along with
+// their merkle proofs, without the rest of the block.
+func (s *State) QueryBlockTxs(number uint64) ([]TxProof, error) {
+	block, err := s.QueryBlock(number)
+	if err != nil {
+		return nil, err
+	}
+
+	values := block.MerkleTree.Values()
+
+	txs := make([]TxProof, len(values))
+	for i, tx := range values {
+		rawProof, order, err := block.MerkleTree.Proof(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		proof := make([]string, len(rawProof))
+		for j, rp := range rawProof {
+			proof[j] = hexutil.Encode(rp)
+		}
+
+		txs[i] = TxProof{
+			Tx:         tx,
+			Proof:      proof,
+			ProofOrder: order,
+		}
+	}
+
+	return txs, nil
+}
+
 // QueryBlocksByAccount returns the set of blocks by account. If the account
 // is empty, all blocks are returns. This function reads the blockchain
-// from disk first.
+// from disk first, skipping the blocks whose bloom filter rules out the
+// account.
 func (s *State) QueryBlocksByAccount(accountID database.AccountID) ([]database.Block, error) {
+	return s.queryBlocks(accountID, database.CategoryNone, false)
+}
+
+// QueryBlocksByCategory works like QueryBlocksByAccount, but only returns the
+// blocks holding a transaction of the specified category for the account.
+func (s *State) QueryBlocksByCategory(accountID database.AccountID, category database.Category) ([]database.Block, error) {
+	return s.queryBlocks(accountID, category, true)
+}
+
+// queryBlocks performs the work of QueryBlocksByAccount and
+// QueryBlocksByCategory. The category is only matched when byCategory is set.
+func (s *State) queryBlocks(accountID database.AccountID, category database.Category, byCategory bool) ([]database.Block, error) {
 	var out []database.Block
+	var skipped int
+
+	// Transactions without a category aren't in the bloom filters.
+	bloomCategory := byCategory && category != database.CategoryNone
 
-	iter := s.db.ForEach()
-	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+	latest := s.db.LatestBlock().Header.Number
+	for num := uint64(1); num <= latest; num++ {
+		if filter, exists := s.db.AccountBloom(num); exists {
+			if (accountID != "" && !filter.Contains([]byte(accountID))) || (bloomCategory && !filter.Contains(category.BloomKey())) {
+				skipped++
+				continue
+			}
+		}
+
+		block, err := s.db.GetBlock(num)
 		if err != nil {
 			return nil, err
 		}
 
 		for _, tx := range block.MerkleTree.Values() {
+			if byCategory && tx.Category != category {
+				continue
+			}
+
 			if accountID == "" || tx.FromID == accountID || tx.ToID == accountID {
 				out = append(out, block)
 				break
@@ -57,5 +251,7 @@ func (s *State) QueryBlocksByAccount(accountID database.AccountID) ([]database.B
 		}
 	}
 
+	s.evHandler("state: QueryBlocksByAccount: account[%s]: blocks[%d] skipped[%d] matched[%d]", accountID, latest, skipped, len(out))
+
 	return out, nil
 }
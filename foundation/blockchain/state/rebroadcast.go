@@ -0,0 +1,75 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRebroadcastTooSoon is returned when the mempool is asked to be
+// rebroadcast before the rebroadcast interval has passed.
+var ErrRebroadcastTooSoon = errors.New("mempool was rebroadcast too recently")
+
+// RebroadcastInterval returns the least amount of time between two
+// rebroadcasts of the mempool.
+func (s *State) RebroadcastInterval() time.Duration {
+	return s.rebcastIntvl
+}
+
+// RebroadcastMempool queues every transaction in the mempool to be shared
+// with the peers again, returning the number of transactions queued. This
+// helps transactions propagate after a network partition heals. To keep a
+// node from flooding its peers, a rebroadcast can only run once per interval.
+func (s *State) RebroadcastMempool() (int, error) {
+	s.rebcastMu.Lock()
+	defer s.rebcastMu.Unlock()
+
+	if wait := s.rebcastIntvl - time.Since(s.lastRebcast); wait > 0 {
+		return 0, fmt.Errorf("%w, try again in %v", ErrRebroadcastTooSoon, wait.Round(time.Second))
+	}
+	s.lastRebcast = time.Now()
+
+	// The share queue is bounded, so when the mempool is larger than the
+	// queue the remaining transactions aren't queued or counted.
+	var queued int
+	for _, tx := range s.mempool.PickBest() {
+		if s.Worker.SignalReshareTx(tx) {
+			s.mempool.MarkShared(tx)
+			queued++
+		}
+	}
+
+	s.evHandler("state: RebroadcastMempool: queued[%d] transactions", queued)
+
+	return queued, nil
+}
+
+// ReshareAge returns how long a transaction can sit in the mempool without
+// being shared before it's shared with the peers again, 0 is never.
+func (s *State) ReshareAge() time.Duration {
+	return s.reshareAge
+}
+
+// ReshareAgedTxs queues the transactions in the mempool that haven't been
+// shared for the reshare age to be shared with the peers again, returning
+// the number of transactions queued. A transaction this node never gets to
+// mine, like in POA when it's not selected, then still reaches the miners.
+func (s *State) ReshareAgedTxs() int {
+	if s.reshareAge <= 0 {
+		return 0
+	}
+
+	var queued int
+	for _, tx := range s.mempool.Unshared(s.reshareAge) {
+		if s.Worker.SignalReshareTx(tx) {
+			s.mempool.MarkShared(tx)
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		s.evHandler("state: ReshareAgedTxs: queued[%d] transactions", queued)
+	}
+
+	return queued
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+)
+
+// MaxRejectedBlocks is the number of recently rejected blocks that are
+// kept to help debug disagreements between nodes.
+const MaxRejectedBlocks = 50
+
+// RejectedBlock represents a block proposed to this node that was rejected.
+type RejectedBlock struct {
+	Hash          string             `json:"hash"`            // Hash of the rejected block.
+	Number        uint64             `json:"number"`          // Number of the rejected block.
+	PrevBlockHash string             `json:"prev_block_hash"` // Hash of the parent of the rejected block.
+	BeneficiaryID database.AccountID `json:"beneficiary"`     // Beneficiary of the rejected block.
+	Source        string             `json:"source"`          // Peer the block was received from, when known.
+	Reason        string             `json:"reason"`          // Error the block was rejected with.
+	TimeStamp     uint64             `json:"timestamp"`       // Time the block was rejected in milliseconds.
+}
+
+// RejectedBlocks returns a copy of the recently rejected blocks, starting
+// with the most recent.
+func (s *State) RejectedBlocks() []RejectedBlock {
+	s.rejectedMu.Lock()
+	defer s.rejectedMu.Unlock()
+
+	blocks := make([]RejectedBlock, len(s.rejected))
+	for i, block := range s.rejected {
+		blocks[len(blocks)-1-i] = block
+	}
+
+	return blocks
+}
+
+// =============================================================================
+
+// recordRejected adds the block to the recently rejected blocks, dropping
+// the oldest block when the buffer is full.
+func (s *State) recordRejected(block database.Block, source string, err error) {
+	rejected := RejectedBlock{
+		Hash:          block.Hash(),
+		Number:        block.Header.Number,
+		PrevBlockHash: block.Header.PrevBlockHash,
+		BeneficiaryID: block.Header.BeneficiaryID,
+		Source:        source,
+		Reason:        err.Error(),
+		TimeStamp:     uint64(time.Now().UTC().UnixMilli()),
+	}
+
+	s.rejectedMu.Lock()
+	defer s.rejectedMu.Unlock()
+
+	if len(s.rejected) == MaxRejectedBlocks {
+		copy(s.rejected, s.rejected[1:])
+		s.rejected = s.rejected[:len(s.rejected)-1]
+	}
+	s.rejected = append(s.rejected, rejected)
+}
@@ -1,5 +1,20 @@
 package state
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+)
+
+// ErrResyncInProgress is returned when a resync is requested
+// while another resync is still running.
+var ErrResyncInProgress = errors.New("resync already in progress")
+
+// ErrResyncNoPeer is returned when a resync is requested but none of
+// the peers to resync from can be reached.
+var ErrResyncNoPeer = errors.New("no peer reachable to resync from")
+
 // TurnMiningOn sets the allowMining flag back to true.
 func (s *State) TurnMiningOn() {
 	s.mu.Lock()
@@ -14,18 +29,25 @@ func (s *State) Reorganize() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Only one resync can be running at any given time.
+	if s.resyncing {
+		return ErrResyncInProgress
+	}
+	s.resyncing = true
+
 	// Don't allow mining to continue.
 	s.allowMining = false
 
 	// Reset the state of the blockchain node.
 	s.db.Reset()
+	s.mined = make(map[minedKey]string)
 
 	// Reorganize the state of the blockchain.
 	s.resyncWG.Add(1)
 	go func() {
 		s.evHandler("state: Resync: started: ***********************")
 		defer func() {
-			s.TurnMiningOn()
+			s.finishResync()
 			s.evHandler("state: Resync: completed: ***********************")
 			s.resyncWG.Done()
 		}()
@@ -35,3 +57,81 @@ func (s *State) Reorganize() error {
 
 	return nil
 }
+
+// Resync forces the node to reset its blockchain and synchronize it again
+// from the specified peer. If no peer host is provided, all the known peers
+// are used. Unlike Reorganize, this call blocks until the sync completes and
+// returns the latest block number before and after the resync.
+func (s *State) Resync(host string) (before uint64, after uint64, err error) {
+	s.mu.Lock()
+	{
+		// Only one resync can be running at any given time.
+		if s.resyncing {
+			s.mu.Unlock()
+			return 0, 0, ErrResyncInProgress
+		}
+		s.resyncing = true
+
+		// Don't allow mining to continue.
+		s.allowMining = false
+
+		before = s.db.LatestBlock().Header.Number
+		s.mined = make(map[minedKey]string)
+		s.resyncWG.Add(1)
+	}
+	s.mu.Unlock()
+
+	s.evHandler("state: Resync: started: host[%s]: blknum[%d]", host, before)
+	defer func() {
+		s.finishResync()
+		s.evHandler("state: Resync: completed: host[%s]: blknum[%d]", host, after)
+		s.resyncWG.Done()
+	}()
+
+	// Only reset the blockchain once a peer is known to be reachable, so an
+	// unreachable peer doesn't leave the node with an empty chain.
+	peers := []peer.Peer{peer.New(host)}
+	if host == "" {
+		peers = s.KnownExternalPeers()
+	}
+	if !s.anyPeerReachable(peers) {
+		return before, before, fmt.Errorf("%w: host[%s]", ErrResyncNoPeer, host)
+	}
+
+	// Reset the state of the blockchain node.
+	if err := s.db.Reset(); err != nil {
+		return before, 0, err
+	}
+
+	switch host {
+	case "":
+		s.Worker.Sync()
+	default:
+		s.Worker.SyncPeer(peer.New(host))
+	}
+
+	after = s.db.LatestBlock().Header.Number
+
+	return before, after, nil
+}
+
+// anyPeerReachable returns true if any of the specified peers responds
+// to a status request.
+func (s *State) anyPeerReachable(peers []peer.Peer) bool {
+	for _, pr := range peers {
+		if _, err := s.NetRequestPeerStatus(pr); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finishResync marks the resync as complete and turns mining back on.
+func (s *State) finishResync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resyncing = false
+	s.allowMining = true
+}
@@ -3,7 +3,13 @@
 package state
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
@@ -19,18 +25,97 @@ const (
 	ConsensusPOA = "POA"
 )
 
+// DefaultPOACycle is the duration of a POA mining cycle when one
+// isn't configured.
+const DefaultPOACycle = 12 * time.Second
+
+// DefaultPeerUpdateInterval is how often the node asks its peers for new
+// peers when one is not provided.
+const DefaultPeerUpdateInterval = time.Minute
+
+// DefaultSyncInterval is how often the node syncs its mempool and blocks
+// with its peers when one is not provided.
+const DefaultSyncInterval = 10 * time.Second
+
+// DefaultInitialSyncAttempts is the number of times the node tries to reach
+// its peers on startup when one is not provided.
+const DefaultInitialSyncAttempts = 5
+
+// DefaultInitialSyncBackoff is how long the node first waits before retrying
+// to reach its peers on startup when one is not provided.
+const DefaultInitialSyncBackoff = time.Second
+
+// DefaultOriginRetryInterval is about how often the node retries the origin
+// peers it lost when one is not provided.
+const DefaultOriginRetryInterval = 15 * time.Second
+
+// DefaultSyncConcurrency is the number of peers that can be queried
+// at the same time when one isn't configured.
+const DefaultSyncConcurrency = 4
+
+// DefaultPeerMaxConnsPerHost is the number of connections that can be
+// open to a single peer when one isn't configured.
+const DefaultPeerMaxConnsPerHost = 10
+
+// DefaultPeerIdleTimeout is how long an idle connection to a peer is kept
+// open for reuse when one isn't configured.
+const DefaultPeerIdleTimeout = 90 * time.Second
+
+// DefaultPeerMaxResponseBytes is the largest response body that is read
+// from a peer when one isn't configured.
+const DefaultPeerMaxResponseBytes = 32 << 20
+
+// DefaultMaxBlockRange is the largest number of blocks that can be requested
+// from a node at once when one isn't configured.
+const DefaultMaxBlockRange = 500
+
+// DefaultRebroadcastInterval is the least amount of time between two
+// rebroadcasts of the mempool when one isn't configured.
+const DefaultRebroadcastInterval = 30 * time.Second
+
+// DefaultTxTimeTolerance is how far a transaction's timestamp can be from
+// the node's clock when one isn't configured.
+const DefaultTxTimeTolerance = time.Hour
+
+// DefaultMaxClockSkew is how far the node's clock can be from the median of
+// its peers' clocks before it's reported as skewed when one isn't configured.
+const DefaultMaxClockSkew = 30 * time.Second
+
+// DefaultIntegrityWindow is the number of the most recent blocks read back
+// from storage by each integrity check.
+const DefaultIntegrityWindow = 100
+
+// DefaultHistoryDepth is how many blocks back from the latest block an
+// account can be queried at when one isn't configured.
+const DefaultHistoryDepth = 1000
+
+// DefaultMinTxToMine is the number of transactions that need to be in the
+// mempool before POW mining starts when one isn't configured.
+const DefaultMinTxToMine = 1
+
+// DefaultMaxMineWait is how long POW mining waits for the mempool to reach
+// the minimum number of transactions when one isn't configured.
+const DefaultMaxMineWait = 10 * time.Second
+
 // EventHandler defines a function that is called
 // when events occur in the processing of persisting blocks.
 type EventHandler func(v string, args ...any)
 
+// TxFilter defines a function that is called for each transaction before
+// it's accepted into the mempool. A non-nil error rejects the transaction.
+type TxFilter func(tx database.BlockTx) error
+
 // Worker interface represents the behavior required to be implemented
 // by any package providing support for mining, peer updates, and tx sharing.
 type Worker interface {
 	Shutdown()
 	Sync()
+	SyncPeer(pr peer.Peer)
 	SignalStartMining()
 	SignalCancelMining()
 	SignalShareTx(blockTx database.BlockTx)
+	SignalReshareTx(blockTx database.BlockTx) bool
+	SignalGossipTip()
 }
 
 // /////////////////////////////////////////////////////////////////
@@ -38,32 +123,123 @@ type Worker interface {
 // Config represents the configuration requires
 // to start the blockchain node.
 type Config struct {
-	BeneficiaryID  database.AccountID
-	Host           string
-	Storage        database.Storage
-	Genesis        genesis.Genesis
-	SelectStrategy string
-	KnownPeers     *peer.Set
-	EvHandler      EventHandler
-	Consensus      string
+	BeneficiaryID       database.AccountID
+	Host                string
+	Addresses           []string // Other addresses this node can be reached at, like its public host.
+	Storage             database.Storage
+	Genesis             genesis.Genesis
+	SelectStrategy      string
+	KnownPeers          *peer.Set
+	EvHandler           EventHandler
+	Consensus           string
+	POACycle            time.Duration
+	SyncConcurrency     int
+	PeerUpdateInterval  time.Duration
+	SyncInterval        time.Duration
+	OriginPeers         []string // Seed peers that are retried when they drop out of the known peers.
+	OriginRetryInterval time.Duration
+	InitialSyncAttempts int
+	InitialSyncBackoff  time.Duration
+	RequireInitialSync  bool // Fail to start when no peer is reached by the initial sync.
+	PeerMaxConnsPerHost int
+	PeerIdleTimeout     time.Duration
+	PeerMaxResponse     int64
+	MaxBlockRange       int // Largest number of blocks served or requested at once.
+	ForkChoice          string
+	ValidationMode      string // Strict runs the softer block and transaction checks, lenient skips them.
+	MinTxToMine         int
+	MaxMineWait         time.Duration
+	MinPeersToMine      int
+	TxTimeTolerance     time.Duration
+	RebroadcastInterval time.Duration
+	ReplaceGracePeriod  time.Duration // How long a pending transaction can be replaced, 0 is no limit.
+	LocalTxBoost        uint64        // Added to the tip of transactions submitted to this node when selecting.
+	AccountPruneBlocks  int
+	SnapshotBlocks      int
+	TxFanout            int
+	RewardSplits        []database.RewardSplit
+	MaxClockSkew        time.Duration
+	StopMiningOnSkew    bool
+	TxFilter            TxFilter
+	ReadOnly            bool
+	CheckBalance        bool // Reject transactions the sending account can't afford.
+	TipGossip           bool // Notify the peers of every new latest block right away.
+	IntegrityInterval   time.Duration
+	IntegrityWindow     int
+	IntegrityResync     bool
+	ReshareAge          time.Duration
+	ReportAttempts      int
+	HistoryDepth        int
+	MempoolShards       int
+	Build               string
+	ShareDedupWindow    time.Duration
 }
 
 // State manages the blockchain database.
 type State struct {
 	mu          sync.RWMutex
 	resyncWG    sync.WaitGroup
+	resyncing   bool
 	allowMining bool
 
 	beneficiaryID database.AccountID
 	host          string
+	addresses     map[string]struct{}
 	evHandler     EventHandler
 	consensus     string
+	poaCycle      time.Duration
+	syncConc      int
+	peerInterval  time.Duration
+	syncInterval  time.Duration
+	originPeers   []peer.Peer
+	originRetry   time.Duration
+	syncAttempts  int
+	syncBackoff   time.Duration
+	requireSync   bool
+	forkChoice    string
+	validation    string
+	minTxToMine   int
+	maxMineWait   time.Duration
+	minPeers      int
+	txTimeTol     time.Duration
+	rebcastIntvl  time.Duration
+	pruneBlocks   uint64
+	snapBlocks    uint64
+	txFanout      int
+	peerMaxResp   int64
+	maxBlkRange   uint64
+	rewardSplits  []database.RewardSplit
+	maxSkew       time.Duration
+	skewStopsMine bool
+	txFilter      TxFilter
+	readOnly      bool
+	checkBalance  bool
+	tipGossip     bool
+	tipSyncing    atomic.Bool
+	checkIntvl    time.Duration
+	checkWindow   int
+	checkResync   bool
+	reshareAge    time.Duration
+	reportEvery   uint64
+	historyDepth  uint64
+	build         string
+	dedupWindow   time.Duration
+	rejectedMu    sync.Mutex
+	rejected      []RejectedBlock
+	skewMu        sync.Mutex
+	peerSkew      map[string]time.Duration
+	mineAttempts  atomic.Uint64
+	timingsMu     sync.Mutex
+	timings       MiningTimings
+	rebcastMu     sync.Mutex
+	lastRebcast   time.Time
 
 	knownPeers *peer.Set
-	storage    database.Storage
 	genesis    genesis.Genesis
 	mempool    *mempool.Mempool
 	db         *database.Database
+	mined      map[minedKey]string
+	peerClient *http.Client
 
 	Worker Worker
 }
@@ -77,14 +253,270 @@ func New(cfg Config) (*State, error) {
 		}
 	}
 
+	// Validate the POA cycle duration, using the default if not provided.
+	poaCycle := cfg.POACycle
+	switch {
+	case poaCycle < 0:
+		return nil, errors.New("poa cycle duration must be positive")
+	case poaCycle == 0:
+		poaCycle = DefaultPOACycle
+	}
+
+	// Validate the peer sync concurrency, using the default if not provided.
+	syncConc := cfg.SyncConcurrency
+	switch {
+	case syncConc < 0:
+		return nil, errors.New("sync concurrency must be positive")
+	case syncConc == 0:
+		syncConc = DefaultSyncConcurrency
+	}
+
+	// Validate the peer update and sync intervals, using the defaults if not provided.
+	peerInterval := cfg.PeerUpdateInterval
+	switch {
+	case peerInterval < 0:
+		return nil, errors.New("peer update interval must be positive")
+	case peerInterval == 0:
+		peerInterval = DefaultPeerUpdateInterval
+	}
+
+	syncInterval := cfg.SyncInterval
+	switch {
+	case syncInterval < 0:
+		return nil, errors.New("sync interval must be positive")
+	case syncInterval == 0:
+		syncInterval = DefaultSyncInterval
+	}
+
+	// Validate the origin retry interval, using the default if not provided.
+	originRetry := cfg.OriginRetryInterval
+	switch {
+	case originRetry < 0:
+		return nil, errors.New("origin retry interval must be positive")
+	case originRetry == 0:
+		originRetry = DefaultOriginRetryInterval
+	}
+
+	// Validate the initial sync retries, using the defaults if not provided.
+	syncAttempts := cfg.InitialSyncAttempts
+	switch {
+	case syncAttempts < 0:
+		return nil, errors.New("initial sync attempts must be positive")
+	case syncAttempts == 0:
+		syncAttempts = DefaultInitialSyncAttempts
+	}
+
+	syncBackoff := cfg.InitialSyncBackoff
+	switch {
+	case syncBackoff < 0:
+		return nil, errors.New("initial sync backoff must be positive")
+	case syncBackoff == 0:
+		syncBackoff = DefaultInitialSyncBackoff
+	}
+
+	originPeers := make([]peer.Peer, len(cfg.OriginPeers))
+	for i, host := range cfg.OriginPeers {
+		originPeers[i] = peer.New(host)
+	}
+
+	// Validate the peer connection pool settings, using the defaults if not provided.
+	peerMaxConns := cfg.PeerMaxConnsPerHost
+	switch {
+	case peerMaxConns < 0:
+		return nil, errors.New("peer max connections per host must be positive")
+	case peerMaxConns == 0:
+		peerMaxConns = DefaultPeerMaxConnsPerHost
+	}
+
+	peerIdleTimeout := cfg.PeerIdleTimeout
+	switch {
+	case peerIdleTimeout < 0:
+		return nil, errors.New("peer idle timeout must be positive")
+	case peerIdleTimeout == 0:
+		peerIdleTimeout = DefaultPeerIdleTimeout
+	}
+
+	peerMaxResp := cfg.PeerMaxResponse
+	switch {
+	case peerMaxResp < 0:
+		return nil, errors.New("peer max response size must be positive")
+	case peerMaxResp == 0:
+		peerMaxResp = DefaultPeerMaxResponseBytes
+	}
+
+	// Validate the block range limit, using the default if not provided.
+	maxBlkRange := cfg.MaxBlockRange
+	switch {
+	case maxBlkRange < 0:
+		return nil, errors.New("max block range must be positive")
+	case maxBlkRange == 0:
+		maxBlkRange = DefaultMaxBlockRange
+	}
+
+	// Validate the mining batch settings, using the defaults if not provided.
+	minTxToMine := cfg.MinTxToMine
+	switch {
+	case minTxToMine < 0:
+		return nil, errors.New("min transactions to mine must be positive")
+	case minTxToMine == 0:
+		minTxToMine = DefaultMinTxToMine
+	}
+
+	maxMineWait := cfg.MaxMineWait
+	switch {
+	case maxMineWait < 0:
+		return nil, errors.New("max mine wait must be positive")
+	case maxMineWait == 0:
+		maxMineWait = DefaultMaxMineWait
+	}
+
+	// Validate the transaction timestamp tolerance, using the default if not provided.
+	txTimeTol := cfg.TxTimeTolerance
+	switch {
+	case txTimeTol < 0:
+		return nil, errors.New("transaction time tolerance must be positive")
+	case txTimeTol == 0:
+		txTimeTol = DefaultTxTimeTolerance
+	}
+
+	// Validate the max clock skew, using the default if not provided.
+	maxSkew := cfg.MaxClockSkew
+	switch {
+	case maxSkew < 0:
+		return nil, errors.New("max clock skew must be positive")
+	case maxSkew == 0:
+		maxSkew = DefaultMaxClockSkew
+	}
+
+	// Validate the rebroadcast interval, using the default if not provided.
+	rebcastIntvl := cfg.RebroadcastInterval
+	switch {
+	case rebcastIntvl < 0:
+		return nil, errors.New("rebroadcast interval must be positive")
+	case rebcastIntvl == 0:
+		rebcastIntvl = DefaultRebroadcastInterval
+	}
+
+	// Validate the integrity check, 0 means the recent blocks are never checked.
+	if cfg.IntegrityInterval < 0 {
+		return nil, errors.New("integrity interval must be positive")
+	}
+
+	checkWindow := cfg.IntegrityWindow
+	switch {
+	case checkWindow < 0:
+		return nil, errors.New("integrity window must be positive")
+	case checkWindow == 0:
+		checkWindow = DefaultIntegrityWindow
+	}
+
+	// Validate the mining report interval, using the default if not provided.
+	reportEvery := cfg.ReportAttempts
+	switch {
+	case reportEvery < 0:
+		return nil, errors.New("report attempts must be positive")
+	case reportEvery == 0:
+		reportEvery = database.DefaultReportAttempts
+	}
+
+	// Validate the history depth, using the default if not provided.
+	historyDepth := cfg.HistoryDepth
+	switch {
+	case historyDepth < 0:
+		return nil, errors.New("history depth must be positive")
+	case historyDepth == 0:
+		historyDepth = DefaultHistoryDepth
+	}
+
+	// Validate the share dedup window, 0 means transactions are always shared.
+	if cfg.ShareDedupWindow < 0 {
+		return nil, errors.New("share dedup window must be positive")
+	}
+
+	// Validate the reshare age, 0 means pending transactions are never reshared.
+	// The mempool is checked every half age, which can't be a zero interval.
+	switch {
+	case cfg.ReshareAge < 0:
+		return nil, errors.New("reshare age must be positive")
+	case cfg.ReshareAge > 0 && cfg.ReshareAge < 2*time.Nanosecond:
+		return nil, errors.New("reshare age must be at least 2ns")
+	}
+
+	// Validate the replacement grace period, 0 means replacement isn't limited.
+	if cfg.ReplaceGracePeriod < 0 {
+		return nil, errors.New("replace grace period must be positive")
+	}
+
+	// Validate the minimum peers to mine, 0 means mining doesn't wait for peers.
+	if cfg.MinPeersToMine < 0 {
+		return nil, errors.New("min peers to mine must be positive")
+	}
+
+	// Validate the account prune interval, 0 means empty accounts are never pruned.
+	if cfg.AccountPruneBlocks < 0 {
+		return nil, errors.New("account prune blocks must be positive")
+	}
+
+	// Pruning empty accounts changes the state root unless the genesis
+	// leaves them out of it.
+	if cfg.AccountPruneBlocks > 0 && !cfg.Genesis.PruneEmpty {
+		return nil, errors.New("account pruning requires a genesis with prune_empty set")
+	}
+
+	// Validate the snapshot interval, 0 means snapshots are never written.
+	switch {
+	case cfg.SnapshotBlocks < 0:
+		return nil, errors.New("snapshot blocks must be positive")
+	case cfg.SnapshotBlocks > 0:
+		if _, ok := cfg.Storage.(database.Snapshotter); !ok {
+			return nil, database.ErrSnapshotNotSupported
+		}
+	}
+
+	// Validate the transaction fanout, 0 means transactions are shared with all peers.
+	if cfg.TxFanout < 0 {
+		return nil, errors.New("transaction fanout must be positive")
+	}
+
+	// Validate the reward splits, none means the beneficiary receives everything.
+	if err := database.ValidateRewardSplits(cfg.RewardSplits); err != nil {
+		return nil, err
+	}
+
+	// Validate the fork choice rule, keeping the first block seen if not provided.
+	forkChoice := cfg.ForkChoice
+	switch forkChoice {
+	case "":
+		forkChoice = ForkChoiceNone
+	case ForkChoiceTimestamp, ForkChoiceNone:
+	default:
+		return nil, fmt.Errorf("unknown fork choice rule %q", forkChoice)
+	}
+
+	// Validate the validation mode, using the strict mode if not provided.
+	validationMode := cfg.ValidationMode
+	switch validationMode {
+	case "":
+		validationMode = ValidationStrict
+	case ValidationStrict, ValidationLenient:
+	default:
+		return nil, fmt.Errorf("unknown validation mode %q", validationMode)
+	}
+
 	// Access the storage for the blockchain.
 	db, err := database.New(cfg.Genesis, cfg.Storage, ev)
 	if err != nil {
 		return nil, err
 	}
 
-	// Construct a mempool with the specified sort strategy.
-	mpool, err := mempool.NewWithStrategy(cfg.SelectStrategy)
+	// Construct a mempool with the specified sort strategy, replacement
+	// grace period, boost for local transactions and number of shards.
+	mpool, err := mempool.NewWithConfig(mempool.Config{
+		Strategy:     cfg.SelectStrategy,
+		ReplaceGrace: cfg.ReplaceGracePeriod,
+		LocalBoost:   cfg.LocalTxBoost,
+		Shards:       cfg.MempoolShards,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -93,15 +525,54 @@ func New(cfg Config) (*State, error) {
 	state := State{
 		beneficiaryID: cfg.BeneficiaryID,
 		host:          cfg.Host,
-		storage:       cfg.Storage,
+		addresses:     selfAddresses(append([]string{cfg.Host}, cfg.Addresses...)...),
 		evHandler:     ev,
 		consensus:     cfg.Consensus,
+		poaCycle:      poaCycle,
+		syncConc:      syncConc,
+		peerInterval:  peerInterval,
+		syncInterval:  syncInterval,
+		originPeers:   originPeers,
+		originRetry:   originRetry,
+		syncAttempts:  syncAttempts,
+		syncBackoff:   syncBackoff,
+		requireSync:   cfg.RequireInitialSync,
+		forkChoice:    forkChoice,
+		validation:    validationMode,
+		minTxToMine:   minTxToMine,
+		maxMineWait:   maxMineWait,
+		minPeers:      cfg.MinPeersToMine,
+		txTimeTol:     txTimeTol,
+		rebcastIntvl:  rebcastIntvl,
+		pruneBlocks:   uint64(cfg.AccountPruneBlocks),
+		snapBlocks:    uint64(cfg.SnapshotBlocks),
+		txFanout:      cfg.TxFanout,
+		peerMaxResp:   peerMaxResp,
+		maxBlkRange:   uint64(maxBlkRange),
+		rewardSplits:  cfg.RewardSplits,
+		maxSkew:       maxSkew,
+		skewStopsMine: cfg.StopMiningOnSkew,
+		txFilter:      cfg.TxFilter,
+		readOnly:      cfg.ReadOnly,
+		checkBalance:  cfg.CheckBalance,
+		tipGossip:     cfg.TipGossip,
+		checkIntvl:    cfg.IntegrityInterval,
+		checkWindow:   checkWindow,
+		checkResync:   cfg.IntegrityResync,
+		reshareAge:    cfg.ReshareAge,
+		reportEvery:   uint64(reportEvery),
+		historyDepth:  uint64(historyDepth),
+		build:         cfg.Build,
+		dedupWindow:   cfg.ShareDedupWindow,
+		peerSkew:      make(map[string]time.Duration),
 		allowMining:   true,
 
 		knownPeers: cfg.KnownPeers,
 		genesis:    cfg.Genesis,
 		mempool:    mpool,
 		db:         db,
+		mined:      make(map[minedKey]string),
+		peerClient: newPeerClient(peerMaxConns, peerIdleTimeout),
 	}
 
 	// The Worker is not set here. The call to worker.Run will assign
@@ -145,21 +616,165 @@ func (s *State) Host() string {
 	return s.host
 }
 
+// ReadOnly reports whether the node only serves queries and relays
+// transactions, and never mines.
+func (s *State) ReadOnly() bool {
+	return s.readOnly
+}
+
 // Consensus returns a copy of the consensus algorithm being used.
 func (s *State) Consensus() string {
 	return s.consensus
 }
 
+// POACycle returns the duration of a POA mining cycle.
+func (s *State) POACycle() time.Duration {
+	return s.poaCycle
+}
+
+// SyncConcurrency returns the number of peers that can be queried
+// at the same time.
+func (s *State) SyncConcurrency() int {
+	return s.syncConc
+}
+
+// PeerUpdateInterval returns how often the node asks its peers for new peers.
+func (s *State) PeerUpdateInterval() time.Duration {
+	return s.peerInterval
+}
+
+// SyncInterval returns how often the node syncs its mempool and blocks with
+// its peers.
+func (s *State) SyncInterval() time.Duration {
+	return s.syncInterval
+}
+
+// InitialSyncAttempts returns the number of times the node tries to reach
+// its peers on startup.
+func (s *State) InitialSyncAttempts() int {
+	return s.syncAttempts
+}
+
+// InitialSyncBackoff returns how long the node first waits before retrying
+// to reach its peers on startup. The wait doubles with every attempt.
+func (s *State) InitialSyncBackoff() time.Duration {
+	return s.syncBackoff
+}
+
+// RequireInitialSync reports whether the node fails to start when the
+// initial sync doesn't reach any peers, instead of starting with a stale
+// chain.
+func (s *State) RequireInitialSync() bool {
+	return s.requireSync
+}
+
+// OriginPeers returns a copy of the seed peers the node retries when they
+// drop out of the known peers.
+func (s *State) OriginPeers() []peer.Peer {
+	return append([]peer.Peer(nil), s.originPeers...)
+}
+
+// OriginRetryInterval returns about how often the node retries the origin
+// peers it lost. The worker jitters the interval so the nodes don't all
+// reconnect at the same time.
+func (s *State) OriginRetryInterval() time.Duration {
+	return s.originRetry
+}
+
+// MaxBlockRange returns the largest number of blocks that can be requested
+// from a node at once. Larger ranges need to be requested in pages.
+func (s *State) MaxBlockRange() uint64 {
+	return s.maxBlkRange
+}
+
+// TxFanout returns the number of peers a transaction is shared with. A
+// value of 0 means the transaction is shared with all known peers.
+func (s *State) TxFanout() int {
+	return s.txFanout
+}
+
+// ShareDedupWindow returns how long a shared transaction isn't shared again.
+// A value of 0 means a transaction is shared every time it's signaled.
+func (s *State) ShareDedupWindow() time.Duration {
+	return s.dedupWindow
+}
+
+// RewardSplits returns the accounts sharing the mining reward, fees and tips
+// for the blocks mined by this node.
+func (s *State) RewardSplits() []database.RewardSplit {
+	return s.rewardSplits
+}
+
+// MiningAttempts returns the number of hashes attempted by the current
+// mining operation, or the last one if mining isn't running.
+func (s *State) MiningAttempts() uint64 {
+	return s.mineAttempts.Load()
+}
+
+// MinTxToMine returns the number of transactions that need to be in the
+// mempool before POW mining starts.
+func (s *State) MinTxToMine() int {
+	return s.minTxToMine
+}
+
+// MaxMineWait returns how long POW mining waits for the mempool to reach
+// the minimum number of transactions before mining what it has.
+func (s *State) MaxMineWait() time.Duration {
+	return s.maxMineWait
+}
+
+// MinPeersToMine returns the number of peers that need to be known before
+// POW mining starts. A value of 0 means mining doesn't wait for peers.
+func (s *State) MinPeersToMine() int {
+	return s.minPeers
+}
+
 // Genesis returns a copy of the genesis information.
 func (s *State) Genesis() genesis.Genesis {
 	return s.genesis
 }
 
+// Version returns the software and protocol version this node runs.
+func (s *State) Version() peer.Version {
+	return peer.Version{
+		Build:    s.build,
+		Protocol: peer.ProtocolVersion,
+	}
+}
+
+// ExportGenesis returns genesis information for a new chain that starts with
+// the current account balances. The chain parameters are copied from this
+// chain, so the chain id should be changed before the new chain is started.
+// Accounts without a balance are left out, and nonces start over.
+func (s *State) ExportGenesis() genesis.Genesis {
+	gen := s.genesis
+	gen.Date = time.Now().UTC()
+	gen.Balances = make(map[string]uint64)
+
+	for accountID, account := range s.db.Copy() {
+		if account.Balance > 0 {
+			gen.Balances[string(accountID)] = account.Balance
+		}
+	}
+
+	return gen
+}
+
 // LatestBlock returns a copy the current latest block.
 func (s *State) LatestBlock() database.Block {
 	return s.db.LatestBlock()
 }
 
+// TxCount returns the number of transactions in the blockchain.
+func (s *State) TxCount() uint64 {
+	return s.db.TxCount()
+}
+
+// TotalWork returns the expected number of hashes to mine the blockchain.
+func (s *State) TotalWork() *big.Int {
+	return s.db.TotalWork()
+}
+
 // MempoolLength returns the current length of the mempool.
 func (s *State) MempoolLength() int {
 	return s.mempool.Count()
@@ -170,8 +785,39 @@ func (s *State) Mempool() []database.BlockTx {
 	return s.mempool.PickBest()
 }
 
-// UpsertMempool adds a new transaction to the mempool.
+// MempoolStats returns a summary of the transactions in the mempool.
+func (s *State) MempoolStats() mempool.Stats {
+	return s.mempool.Stats()
+}
+
+// PendingNonces returns the sorted nonces of the transactions in the
+// mempool sent from the specified account.
+func (s *State) PendingNonces(account database.AccountID) []uint64 {
+	return s.mempool.PendingNonces(account)
+}
+
+// UpsertMempool adds a new transaction retrieved from a peer's mempool. The
+// peer isn't trusted, so the transaction goes through the signature, chain
+// and mempool checks first, and an invalid transaction is never inserted.
 func (s *State) UpsertMempool(tx database.BlockTx) error {
+	if err := tx.Validate(s.genesis.ChainID, s.genesis.SigningDomain); err != nil {
+		return err
+	}
+
+	if s.strict() {
+		if err := tx.ValidateTimeStamp(time.Now(), s.txTimeTol); err != nil {
+			return err
+		}
+	}
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if err := s.filterTx(tx); err != nil {
+		return err
+	}
+
 	return s.mempool.Upsert(tx)
 }
 
@@ -196,7 +842,14 @@ func (s *State) RemoveKnownPeer(peer peer.Peer) {
 
 // KnownExternalPeers retrieves a copy of the known peer list without including this node.
 func (s *State) KnownExternalPeers() []peer.Peer {
-	return s.knownPeers.Copy(s.host)
+	var peers []peer.Peer
+	for _, pr := range s.knownPeers.Copy(s.host) {
+		if !s.IsSelf(pr.Host) {
+			peers = append(peers, pr)
+		}
+	}
+
+	return peers
 }
 
 // KnownPeers retrieves a copy of the full known peer list, including this node.
@@ -204,31 +857,3 @@ func (s *State) KnownExternalPeers() []peer.Peer {
 func (s *State) KnownPeers() []peer.Peer {
 	return s.knownPeers.Copy("")
 }
-
-/*// Truncate resets the chain both on disk and in memory. This
-// is used to correct an identified fork.
-// DEPRECATED: No longer used
-func (s *State) Truncate() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Reset the state of the database.
-	// s.mempool.Truncate()
-	// s.database.Reset()
-	// s.latestBlock = storage.Block{}
-	// s.storage.Reset()
-
-	return nil
-}
-
-// addPeerNode adds a peer to the list of peers.
-func (s *State) addPeerNode(peer peer.Peer) error {
-	// Don't add this node to the known peer list.
-	if peer.Match(s.host) {
-		return errors.New("already exists")
-	}
-
-	s.knownPeers.Add(peer)
-
-	return nil
-}*/
@@ -1,16 +1,28 @@
 package state_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/codec"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/signature"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
 )
@@ -170,6 +182,2665 @@ func proposeBlockOneMissingBlock(blocks []database.Block) func(t *testing.T) {
 
 // =============================================================================
 
+// Test_TxConfirmedEvent validates a confirmation event is sent for a
+// transaction once it is mined into a block.
+func Test_TxConfirmedEvent(t *testing.T) {
+	var events []string
+	ev := func(v string, args ...any) {
+		events = append(events, fmt.Sprintf(v, args...))
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	exp := state.EventTxConfirmed + signedTx.SignatureString()
+	for _, event := range events {
+		if event == exp {
+			return
+		}
+	}
+
+	t.Fatalf("Error mining transaction: should have received event %q", exp)
+}
+
+// Test_TxOutcomeEvent validates every transaction in a new block sends an
+// event with the outcome of applying it.
+func Test_TxOutcomeEvent(t *testing.T) {
+	const prefix = "viewer: tx: "
+
+	var outcomes []state.TxEvent
+	ev := func(v string, args ...any) {
+		msg := fmt.Sprintf(v, args...)
+		if !strings.HasPrefix(msg, prefix) {
+			return
+		}
+
+		var txEv state.TxEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(msg, prefix)), &txEv); err != nil {
+			t.Errorf("Error decoding tx event %q: %v", msg, err)
+			return
+		}
+		outcomes = append(outcomes, txEv)
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	// The second transaction spends more than the account holds.
+	txs := []database.Tx{
+		{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100},
+		{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 2000000},
+	}
+
+	sigs := make([]string, len(txs))
+	for i, tx := range txs {
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+		sigs[i] = signedTx.SignatureString()
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if len(outcomes) != len(txs) {
+		t.Fatalf("Error mining new block: should receive %d tx events, got %d", len(txs), len(outcomes))
+	}
+
+	for _, outcome := range outcomes {
+		switch outcome.Sig {
+		case sigs[0]:
+			if !outcome.Success || outcome.Error != "" {
+				t.Fatalf("Error mining new block: should receive a success event, got %+v", outcome)
+			}
+			if outcome.FromID != kennedyAccountID || outcome.ToID != edAccountID || outcome.Value != 100 || outcome.GasUnits == 0 {
+				t.Fatalf("Error mining new block: should receive the transaction details, got %+v", outcome)
+			}
+
+		case sigs[1]:
+			if outcome.Success || !strings.Contains(outcome.Error, "insufficient funds") {
+				t.Fatalf("Error mining new block: should receive a failure event, got %+v", outcome)
+			}
+
+		default:
+			t.Fatalf("Error mining new block: unexpected tx event %+v", outcome)
+		}
+
+		if outcome.BlockNumber != 1 {
+			t.Fatalf("Error mining new block: should receive blk[1], got blk[%d]", outcome.BlockNumber)
+		}
+	}
+}
+
+// Test_BlockEventJSON validates the block event is valid JSON when the
+// transaction data contains bytes that would break hand built JSON.
+func Test_BlockEventJSON(t *testing.T) {
+	const prefix = "viewer: block: "
+
+	var events []string
+	ev := func(v string, args ...any) {
+		if msg := fmt.Sprintf(v, args...); strings.HasPrefix(msg, prefix) {
+			events = append(events, strings.TrimPrefix(msg, prefix))
+		}
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   100,
+		Data:    []byte("\"}, {\"error\": \x00\n\xff"),
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("Error mining new block: should receive 1 block event, got %d", len(events))
+	}
+
+	if !json.Valid([]byte(events[0])) {
+		t.Fatalf("Error mining new block: should receive a valid JSON block event, got %s", events[0])
+	}
+
+	var blockData database.BlockData
+	if err := json.Unmarshal([]byte(events[0]), &blockData); err != nil {
+		t.Fatalf("Error decoding block event: %v", err)
+	}
+
+	if blockData.Hash != block.Hash() || blockData.Header.Number != 1 {
+		t.Fatalf("Error mining new block: should receive blk[1] %s, got blk[%d] %s", block.Hash(), blockData.Header.Number, blockData.Hash)
+	}
+
+	if len(blockData.Trans) != 1 || !bytes.Equal(blockData.Trans[0].Data, tx.Data) {
+		t.Fatalf("Error mining new block: should receive the transaction data, got %+v", blockData.Trans)
+	}
+}
+
+// Test_QueryMempoolTx validates a pending transaction can be retrieved by
+// its signature exactly as it was submitted.
+func Test_QueryMempoolTx(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+		Data:    []byte("rebroadcast"),
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	submitted, err := json.Marshal(signedTx)
+	if err != nil {
+		t.Fatalf("Error marshaling transaction: %v", err)
+	}
+
+	// Decode the transaction the same way the submit handler does.
+	var decoded database.SignedTx
+	if err := json.Unmarshal(submitted, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling transaction: %v", err)
+	}
+
+	if err := node.UpsertWalletTransaction(decoded); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blockTx, err := node.QueryMempoolTx(signedTx.SignatureString())
+	if err != nil {
+		t.Fatalf("Error querying mempool transaction: %v", err)
+	}
+
+	raw, err := json.Marshal(blockTx.SignedTx)
+	if err != nil {
+		t.Fatalf("Error marshaling raw transaction: %v", err)
+	}
+
+	if string(raw) != string(submitted) {
+		t.Logf("got: %s", raw)
+		t.Logf("exp: %s", submitted)
+		t.Fatal("Error querying mempool transaction: should get back the transaction as submitted")
+	}
+
+	if _, err := node.QueryMempoolTx("0x00"); !errors.Is(err, state.ErrTxNotFound) {
+		t.Fatalf("Error querying mempool transaction: should have received ErrTxNotFound, got %v", err)
+	}
+}
+
+// Test_WrongChainID validates a transaction signed for another chain is
+// rejected when it is submitted and never reaches the mempool.
+func Test_WrongChainID(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID + 1,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); !errors.Is(err, database.ErrInvalidChainID) {
+		t.Fatalf("Error submitting wallet transaction: should have received ErrInvalidChainID, got %v", err)
+	}
+
+	blockTx := database.NewBlockTx(signedTx, 1, signedTx.MinGasUnits())
+	if err := node.UpsertMempool(blockTx); !errors.Is(err, database.ErrInvalidChainID) {
+		t.Fatalf("Error adding to mempool: should have received ErrInvalidChainID, got %v", err)
+	}
+
+	if n := node.MempoolLength(); n != 0 {
+		t.Fatalf("Error submitting wallet transaction: mempool should be empty, got %d", n)
+	}
+}
+
+// Test_NodeTransactionSignature validates a transaction shared by a peer is
+// rejected when the signature doesn't match the transaction.
+func Test_NodeTransactionSignature(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+
+	type table struct {
+		name   string
+		forge  func(tx *database.SignedTx)
+		accept bool
+	}
+
+	tt := []table{
+		{name: "valid", forge: func(tx *database.SignedTx) {}, accept: true},
+		{name: "forged from", forge: func(tx *database.SignedTx) { tx.FromID = pavelAccountID }},
+		{name: "forged value", forge: func(tx *database.SignedTx) { tx.Value = 1000 }},
+		{name: "corrupt signature", forge: func(tx *database.SignedTx) { tx.R = new(big.Int).Add(tx.R, big.NewInt(1)) }},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			forged := signedTx
+			tst.forge(&forged)
+
+			blockTx := database.NewBlockTx(forged, 1, forged.MinGasUnits())
+			err := node.UpsertNodeTransaction(blockTx)
+
+			switch tst.accept {
+			case true:
+				if err != nil {
+					t.Fatalf("Error submitting node transaction: %v", err)
+				}
+			default:
+				if err == nil {
+					t.Fatal("Error submitting node transaction: should have been rejected")
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	if n := node.MempoolLength(); n != 1 {
+		t.Fatalf("Error submitting node transactions: only the valid transaction should be in the mempool, got %d", n)
+	}
+}
+
+// Test_StateRoot validates the accounts returned for the latest block
+// hash to the state root stored in that block.
+func Test_StateRoot(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	if _, _, err := node.QueryStateRoot(state.QueryLatest); err == nil {
+		t.Fatal("Error querying state root: should fail when there are no blocks")
+	}
+
+	var blocks []database.Block
+	for i := 1; i <= 2; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+		blocks = append(blocks, blk)
+	}
+
+	blk, accounts, err := node.QueryStateRoot(state.QueryLatest)
+	if err != nil {
+		t.Fatalf("Error querying state root: %v", err)
+	}
+
+	if blk.Header.Number != blocks[1].Header.Number {
+		t.Fatalf("Error querying state root: got block %d, exp %d", blk.Header.Number, blocks[1].Header.Number)
+	}
+
+	if root := signature.Hash(accounts); root != blk.Header.StateRoot {
+		t.Logf("got: %s", root)
+		t.Logf("exp: %s", blk.Header.StateRoot)
+		t.Fatal("Error querying state root: accounts should hash to the stored state root")
+	}
+
+	if _, _, err := node.QueryStateRoot(blocks[0].Header.Number); err == nil {
+		t.Fatal("Error querying state root: should fail for a block that isn't the latest")
+	}
+}
+
+// Test_FeeMarket validates the fee distribution reported for the recent
+// blocks and the mempool, including a chain without any blocks.
+func Test_FeeMarket(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	fm, err := node.FeeMarket(0)
+	if err != nil {
+		t.Fatalf("Error querying fee market: %v", err)
+	}
+
+	gasPrice := newGenesis().GasPrice
+	if fm.Blocks != 0 || fm.BlockTxs != 0 || fm.BlockTip != (state.Percentiles{}) {
+		t.Fatalf("Error querying fee market: should report no fees without blocks, got %+v", fm)
+	}
+	if exp := (state.Percentiles{P10: gasPrice, P50: gasPrice, P90: gasPrice}); fm.BlockGasPrice != exp {
+		t.Logf("got: %+v", fm.BlockGasPrice)
+		t.Logf("exp: %+v", exp)
+		t.Fatal("Error querying fee market: should report the genesis gas price without blocks")
+	}
+
+	// Mine three blocks with increasing tips, then leave two transactions
+	// pending in the mempool.
+	nonce := uint64(1)
+	send := func(tip uint64) {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   nonce,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+			Tip:     tip,
+		}
+		nonce++
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+	}
+
+	for _, tips := range [][]uint64{{10, 20}, {30, 40}, {50}} {
+		for _, tip := range tips {
+			send(tip)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	send(5)
+	send(7)
+
+	type table struct {
+		name     string
+		blocks   uint64
+		sampled  uint64
+		txs      int
+		tip      state.Percentiles
+		gasPrice state.Percentiles
+	}
+
+	tt := []table{
+		{
+			name:     "all blocks",
+			blocks:   0,
+			sampled:  3,
+			txs:      5,
+			tip:      state.Percentiles{P10: 10, P50: 30, P90: 50},
+			gasPrice: state.Percentiles{P10: gasPrice + 10, P50: gasPrice + 30, P90: gasPrice + 50},
+		},
+		{
+			name:     "recent blocks",
+			blocks:   2,
+			sampled:  2,
+			txs:      3,
+			tip:      state.Percentiles{P10: 30, P50: 40, P90: 50},
+			gasPrice: state.Percentiles{P10: gasPrice + 30, P50: gasPrice + 40, P90: gasPrice + 50},
+		},
+		{
+			name:     "more than exist",
+			blocks:   100,
+			sampled:  3,
+			txs:      5,
+			tip:      state.Percentiles{P10: 10, P50: 30, P90: 50},
+			gasPrice: state.Percentiles{P10: gasPrice + 10, P50: gasPrice + 30, P90: gasPrice + 50},
+		},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			fm, err := node.FeeMarket(tst.blocks)
+			if err != nil {
+				t.Fatalf("Test %s:\tError querying fee market: %v", tst.name, err)
+			}
+
+			if fm.LatestBlock != 3 || fm.Blocks != tst.sampled || fm.BlockTxs != tst.txs {
+				t.Fatalf("Test %s:\tShould sample %d blocks with %d transactions, got %+v", tst.name, tst.sampled, tst.txs, fm)
+			}
+
+			if fm.BlockTip != tst.tip || fm.BlockGasPrice != tst.gasPrice {
+				t.Logf("got: tip %+v, gas price %+v", fm.BlockTip, fm.BlockGasPrice)
+				t.Logf("exp: tip %+v, gas price %+v", tst.tip, tst.gasPrice)
+				t.Fatalf("Test %s:\tShould get back the block fee percentiles.", tst.name)
+			}
+
+			if exp := (state.Percentiles{P10: 5, P50: 5, P90: 7}); fm.MempoolTxs != 2 || fm.MempoolTip != exp {
+				t.Fatalf("Test %s:\tShould get back the mempool tips %+v, got %d txs %+v", tst.name, exp, fm.MempoolTxs, fm.MempoolTip)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_MiningAttempts validates the attempts made by a mining operation are
+// available after it's cancelled.
+func Test_MiningAttempts(t *testing.T) {
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.Difficulty = genesis.MaxDifficulty
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := node.MineNewBlock(ctx)
+		errs <- err
+	}()
+
+	// Wait for the mining operation to start attempting hashes.
+	deadline := time.Now().Add(5 * time.Second)
+	for node.MiningAttempts() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Error mining new block: should start attempting hashes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Error mining new block: should be cancelled, got %v", err)
+	}
+
+	attempts := node.MiningAttempts()
+	if attempts == 0 {
+		t.Fatal("Error mining new block: should report the attempts after cancelling")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if got := node.MiningAttempts(); got != attempts {
+		t.Fatalf("Error mining new block: should keep the attempts of the last operation, got %d, exp %d", got, attempts)
+	}
+}
+
+// Test_MiningTimings validates the time spent in each phase of mining a block
+// is recorded and accounts for the time of the whole operation.
+func Test_MiningTimings(t *testing.T) {
+	var events []string
+	ev := func(v string, args ...any) {
+		events = append(events, fmt.Sprintf(v, args...))
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	if timings := node.MiningTimings(); timings.Total != 0 {
+		t.Fatalf("Error getting mining timings: should be empty before mining, got %+v", timings)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	timings := node.MiningTimings()
+	if timings.Number != blk.Header.Number {
+		t.Fatalf("Error getting mining timings: got blk[%d], exp blk[%d]", timings.Number, blk.Header.Number)
+	}
+
+	phases := map[string]time.Duration{
+		"selection": timings.Selection,
+		"stateroot": timings.StateRoot,
+		"merkle":    timings.Merkle,
+		"pow":       timings.POW,
+		"validate":  timings.Validate,
+	}
+
+	var sum time.Duration
+	for name, d := range phases {
+		if d <= 0 {
+			t.Fatalf("Error getting mining timings: should record the %s phase, got %v", name, d)
+		}
+		sum += d
+	}
+
+	// The phases account for the whole operation, apart from the small
+	// amount of bookkeeping between them.
+	if sum > timings.Total {
+		t.Fatalf("Error getting mining timings: phases sum to %v, more than the total %v", sum, timings.Total)
+	}
+
+	if gap := timings.Total - sum; gap > 10*time.Millisecond {
+		t.Fatalf("Error getting mining timings: phases sum to %v, %v less than the total %v", sum, gap, timings.Total)
+	}
+
+	for _, event := range events {
+		if strings.HasPrefix(event, "state: MineNewBlock: MINING: timings: blk[1]") {
+			return
+		}
+	}
+
+	t.Fatal("Error mining new block: should have received the timings event")
+}
+
+// Test_QueryHeadersByNumber validates the headers returned match the headers
+// of the full blocks and can be linked without the transactions.
+func Test_QueryHeadersByNumber(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	for i := 1; i <= 3; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	blocks := node.QueryBlocksByNumber(1, state.QueryLatest)
+	headers := node.QueryHeadersByNumber(1, state.QueryLatest)
+
+	if len(headers) != 3 || len(headers) != len(blocks) {
+		t.Fatalf("Error querying headers: got %d headers, exp %d", len(headers), len(blocks))
+	}
+
+	for i, header := range headers {
+		if !reflect.DeepEqual(header, blocks[i].Header) {
+			t.Logf("got: %+v", header)
+			t.Logf("exp: %+v", blocks[i].Header)
+			t.Fatalf("Error querying headers: header %d should match the full block", i+1)
+		}
+
+		if i > 0 {
+			if prev := (database.Block{Header: headers[i-1]}).Hash(); header.PrevBlockHash != prev {
+				t.Fatalf("Error querying headers: header %d should link to the previous header", i+1)
+			}
+		}
+	}
+
+	if headers := node.QueryHeadersByNumber(2, 2); len(headers) != 1 || headers[0].Number != 2 {
+		t.Fatalf("Error querying headers: should get back only block 2, got %+v", headers)
+	}
+}
+
+// Test_QueryRecentBlocks validates the latest blocks are returned newest
+// first.
+func Test_QueryRecentBlocks(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	if blocks, err := node.QueryRecentBlocks(5); err != nil || len(blocks) != 0 {
+		t.Fatalf("Error querying recent blocks: should get no blocks on an empty chain, got %d: %v", len(blocks), err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		tx := database.Tx{ChainID: chainID, Nonce: uint64(i), FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	type table struct {
+		name   string
+		n      int
+		blocks []uint64
+	}
+
+	tt := []table{
+		{name: "latest", n: 1, blocks: []uint64{4}},
+		{name: "some", n: 3, blocks: []uint64{4, 3, 2}},
+		{name: "all", n: 4, blocks: []uint64{4, 3, 2, 1}},
+		{name: "more than chain", n: 10, blocks: []uint64{4, 3, 2, 1}},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			blocks, err := node.QueryRecentBlocks(tst.n)
+			if err != nil {
+				t.Fatalf("Test %s:\tError querying recent blocks: %v", tst.name, err)
+			}
+
+			var got []uint64
+			for _, block := range blocks {
+				got = append(got, block.Header.Number)
+			}
+
+			if !reflect.DeepEqual(got, tst.blocks) {
+				t.Fatalf("Test %s:\tError querying recent blocks: got blocks %v, exp %v", tst.name, got, tst.blocks)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	if _, err := node.QueryRecentBlocks(0); err == nil {
+		t.Fatal("Error querying recent blocks: should not be able to query 0 blocks.")
+	}
+}
+
+func Test_QueryAccountAt(t *testing.T) {
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.HistoryDepth = 2
+	})
+
+	// Record the known state of the accounts after each block.
+	known := []map[database.AccountID]database.Account{node.Accounts()}
+	for i := 1; i <= 4; i++ {
+		tx := database.Tx{ChainID: chainID, Nonce: uint64(i), FromID: kennedyAccountID, ToID: edAccountID, Value: uint64(i * 10)}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		known = append(known, node.Accounts())
+	}
+
+	for number := uint64(2); number <= 4; number++ {
+		for _, accountID := range []database.AccountID{kennedyAccountID, edAccountID} {
+			account, err := node.QueryAccountAt(accountID, number)
+			if err != nil {
+				t.Fatalf("Error querying account %s at blk[%d]: %v", accountID, number, err)
+			}
+
+			if exp := known[number][accountID]; account != exp {
+				t.Logf("got: %+v", account)
+				t.Logf("exp: %+v", exp)
+				t.Fatalf("Error querying account %s at blk[%d]: should match the known state", accountID, number)
+			}
+		}
+	}
+
+	if _, err := node.QueryAccountAt(kennedyAccountID, 1); !errors.Is(err, state.ErrHistoryTooDeep) {
+		t.Fatalf("Error querying account: should refuse a block past the history depth, got %v", err)
+	}
+
+	if _, err := node.QueryAccountAt(kennedyAccountID, 5); err == nil {
+		t.Fatal("Error querying account: should refuse a block after the latest block.")
+	}
+}
+
+// Test_QueryBlocksByAccount validates the bloom filters of the blocks skip
+// the blocks that don't touch the account without missing any that do.
+func Test_QueryBlocksByAccount(t *testing.T) {
+	var skipped int
+	ev := func(v string, args ...any) {
+		if strings.HasPrefix(v, "state: QueryBlocksByAccount:") {
+			msg := fmt.Sprintf(v, args...)
+			fmt.Sscanf(msg[strings.Index(msg, "skipped["):], "skipped[%d]", &skipped)
+		}
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	// Alternate the blocks between two pairs of accounts.
+	for i := 1; i <= 6; i++ {
+		tx := database.Tx{ChainID: chainID, Nonce: uint64((i + 1) / 2), FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+		hexKey := kennedyPrivateKey
+		if i%2 == 0 {
+			tx = database.Tx{ChainID: chainID, Nonce: uint64(i / 2), FromID: miner2AccountID, ToID: ceasarAccountID, Value: 1}
+			hexKey = miner2PrivateKey
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, hexKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	type table struct {
+		name    string
+		account database.AccountID
+		blocks  []uint64
+		skipped int
+	}
+
+	tt := []table{
+		{name: "sender", account: kennedyAccountID, blocks: []uint64{1, 3, 5}, skipped: 3},
+		{name: "receiver", account: ceasarAccountID, blocks: []uint64{2, 4, 6}, skipped: 3},
+		{name: "unknown", account: babaAccountID, blocks: nil, skipped: 6},
+		{name: "all", account: "", blocks: []uint64{1, 2, 3, 4, 5, 6}, skipped: 0},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			blocks, err := node.QueryBlocksByAccount(tst.account)
+			if err != nil {
+				t.Fatalf("Test %s:\tError querying blocks: %v", tst.name, err)
+			}
+
+			var got []uint64
+			for _, block := range blocks {
+				got = append(got, block.Header.Number)
+			}
+
+			if !reflect.DeepEqual(got, tst.blocks) {
+				t.Fatalf("Test %s:\tError querying blocks: got blocks %v, exp %v", tst.name, got, tst.blocks)
+			}
+
+			if skipped != tst.skipped {
+				t.Fatalf("Test %s:\tError querying blocks: got %d skipped blocks, exp %d", tst.name, skipped, tst.skipped)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_QueryBlocksByCategory validates the blocks can be narrowed down to
+// the ones holding a transaction of a category for the account.
+func Test_QueryBlocksByCategory(t *testing.T) {
+	var skipped int
+	ev := func(v string, args ...any) {
+		if strings.HasPrefix(v, "state: QueryBlocksByAccount:") {
+			msg := fmt.Sprintf(v, args...)
+			fmt.Sscanf(msg[strings.Index(msg, "skipped["):], "skipped[%d]", &skipped)
+		}
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	// Kennedy sends a payment, a memo and a transaction without a category,
+	// and the miner sends another payment.
+	txs := []struct {
+		hexKey string
+		tx     database.Tx
+	}{
+		{kennedyPrivateKey, database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Category: database.CategoryPayment}},
+		{kennedyPrivateKey, database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Category: database.CategoryMemo}},
+		{kennedyPrivateKey, database.Tx{ChainID: chainID, Nonce: 3, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}},
+		{miner2PrivateKey, database.Tx{ChainID: chainID, Nonce: 1, FromID: miner2AccountID, ToID: ceasarAccountID, Value: 1, Category: database.CategoryPayment}},
+	}
+
+	for _, tst := range txs {
+		if err := node.UpsertWalletTransaction(newSignedTx(tst.tx, tst.hexKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	type table struct {
+		name     string
+		account  database.AccountID
+		category database.Category
+		blocks   []uint64
+		skipped  int
+	}
+
+	tt := []table{
+		{name: "account payments", account: kennedyAccountID, category: database.CategoryPayment, blocks: []uint64{1}, skipped: 3},
+		{name: "account memos", account: edAccountID, category: database.CategoryMemo, blocks: []uint64{2}, skipped: 3},
+		{name: "account without category", account: kennedyAccountID, category: database.CategoryNone, blocks: []uint64{3}, skipped: 1},
+		{name: "all payments", account: "", category: database.CategoryPayment, blocks: []uint64{1, 4}, skipped: 2},
+		{name: "unused category", account: "", category: database.CategoryContract, blocks: nil, skipped: 4},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			blocks, err := node.QueryBlocksByCategory(tst.account, tst.category)
+			if err != nil {
+				t.Fatalf("Test %s:\tError querying blocks: %v", tst.name, err)
+			}
+
+			var got []uint64
+			for _, block := range blocks {
+				got = append(got, block.Header.Number)
+			}
+
+			if !reflect.DeepEqual(got, tst.blocks) {
+				t.Fatalf("Test %s:\tError querying blocks: got blocks %v, exp %v", tst.name, got, tst.blocks)
+			}
+
+			if skipped != tst.skipped {
+				t.Fatalf("Test %s:\tError querying blocks: got %d skipped blocks, exp %d", tst.name, skipped, tst.skipped)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_PeerBlocksPartialSync validates that when a block downloaded from a
+// peer is invalid, the blocks before it are kept and the failure is reported.
+func Test_PeerBlocksPartialSync(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+
+	var blocksData []database.BlockData
+	for i := 1; i <= 5; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node1.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		blocksData = append(blocksData, database.NewBlockData(blk))
+	}
+
+	// Corrupt the 3rd block so it fails validation.
+	blocksData[2].Header.TransRoot = signature.ZeroHash
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocksData)
+	}))
+	defer srv.Close()
+
+	node2 := newNode(miner2PrivateKey, t)
+
+	if err := node2.NetRequestPeerBlocks(peer.New(strings.TrimPrefix(srv.URL, "http://"))); err == nil {
+		t.Fatal("Error syncing peer blocks: should have received an error for the invalid block")
+	}
+
+	if num := node2.LatestBlock().Header.Number; num != 2 {
+		t.Fatalf("Error syncing peer blocks: should have kept the first 2 blocks, got %d", num)
+	}
+}
+
+// Test_PeerBlocksChunkedSync validates the blocks are requested from a peer
+// in pages that stay within the block range limit.
+func Test_PeerBlocksChunkedSync(t *testing.T) {
+	const limit = 2
+
+	node1 := newNode(miner1PrivateKey, t)
+
+	var blocksData []database.BlockData
+	for i := 1; i <= 5; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node1.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		blocksData = append(blocksData, database.NewBlockData(blk))
+	}
+
+	// The peer serves the requested range, rejecting ranges over the limit.
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		var from, to uint64
+		if _, err := fmt.Sscanf(r.URL.Path, "/v1/node/block/list/%d/%d", &from, &to); err != nil || to-from+1 > limit {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var page []database.BlockData
+		for _, blockData := range blocksData {
+			if blockData.Header.Number >= from && blockData.Header.Number <= to {
+				page = append(page, blockData)
+			}
+		}
+
+		if len(page) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	node2 := newNode(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.MaxBlockRange = limit
+	})
+
+	if err := node2.NetRequestPeerBlocks(peer.New(strings.TrimPrefix(srv.URL, "http://"))); err != nil {
+		t.Fatalf("Error syncing peer blocks: %v", err)
+	}
+
+	if num := node2.LatestBlock().Header.Number; num != 5 {
+		t.Fatalf("Error syncing peer blocks: should have synced 5 blocks, got %d", num)
+	}
+
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("Error syncing peer blocks: should have requested 3 pages, got %d", n)
+	}
+}
+
+// Test_PeerConnectionReuse validates that multiple calls to the same peer
+// reuse a single connection.
+func Test_PeerConnectionReuse(t *testing.T) {
+	var conns atomic.Int32
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peer.Status{LatestBlockNumber: 1})
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	node := newNode(miner1PrivateKey, t)
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	const calls = 5
+	for i := 0; i < calls; i++ {
+		if _, err := node.NetRequestPeerStatus(pr); err != nil {
+			t.Fatalf("Error requesting peer status: %v", err)
+		}
+	}
+
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("Error requesting peer status: should have reused 1 connection for %d calls, got %d connections", calls, n)
+	}
+}
+
+// Test_PeerResponseLimit validates a peer response larger than the
+// configured limit is rejected.
+func Test_PeerResponseLimit(t *testing.T) {
+	const limit = 1024
+
+	type table struct {
+		name    string
+		peers   int
+		success bool
+	}
+
+	tt := []table{
+		{name: "under limit", peers: 1, success: true},
+		{name: "over limit", peers: 100, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			status := peer.Status{LatestBlockNumber: 1}
+			for i := 0; i < tst.peers; i++ {
+				status.KnownPeers = append(status.KnownPeers, peer.New(fmt.Sprintf("10.0.0.%d:9080", i)))
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(status)
+			}))
+			defer srv.Close()
+
+			node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+				cfg.PeerMaxResponse = limit
+			})
+			pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+			_, err := node.NetRequestPeerStatus(pr)
+
+			switch tst.success {
+			case true:
+				if err != nil {
+					t.Fatalf("Should be able to request peer status under the limit: %v", err)
+				}
+			default:
+				if !errors.Is(err, state.ErrPayloadTooLarge) {
+					t.Fatalf("Should reject a peer status over the limit, got %v", err)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_PeerClockSkew validates the median clock skew is calculated from the
+// times reported by the peers.
+func Test_PeerClockSkew(t *testing.T) {
+	// The last peer doesn't report its time and is ignored.
+	offsets := []time.Duration{2 * time.Minute, 3 * time.Minute, -time.Minute, 0}
+
+	var peers []peer.Peer
+	for i, offset := range offsets {
+		offset := offset
+		report := i < len(offsets)-1
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := peer.Status{LatestBlockNumber: 1}
+			if report {
+				status.Time = uint64(time.Now().Add(offset).UnixMilli())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(status)
+		}))
+		defer srv.Close()
+
+		peers = append(peers, peer.New(strings.TrimPrefix(srv.URL, "http://")))
+	}
+
+	type table struct {
+		name    string
+		maxSkew time.Duration
+		skewed  bool
+	}
+
+	tt := []table{
+		{name: "default max", maxSkew: 0, skewed: true},
+		{name: "tolerant max", maxSkew: 5 * time.Minute, skewed: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+				cfg.MaxClockSkew = tst.maxSkew
+			})
+
+			if skew := node.PeerClockSkew(); skew != 0 || node.ClockSkewed() {
+				t.Fatalf("Test %s:\tShould not report a skew before any peer reports its time, got %v", tst.name, skew)
+			}
+
+			for _, pr := range peers {
+				node.AddKnownPeer(pr)
+				if _, err := node.NetRequestPeerStatus(pr); err != nil {
+					t.Fatalf("Test %s:\tError requesting peer status: %v", tst.name, err)
+				}
+			}
+
+			const exp = 2 * time.Minute
+
+			skew := node.PeerClockSkew()
+			if diff := skew - exp; diff < -time.Second || diff > time.Second {
+				t.Logf("got: %v", skew)
+				t.Logf("exp: %v", exp)
+				t.Fatalf("Test %s:\tShould get back the median peer clock skew.", tst.name)
+			}
+
+			if skewed := node.ClockSkewed(); skewed != tst.skewed {
+				t.Fatalf("Test %s:\tShould report the clock as skewed %t with a max of %v, got %t", tst.name, tst.skewed, node.MaxClockSkew(), skewed)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_TxFanout validates a shared transaction is only sent to the
+// configured number of peers.
+func Test_TxFanout(t *testing.T) {
+	const (
+		peers  = 5
+		fanout = 2
+	)
+
+	var received atomic.Int32
+
+	knownPeers := peer.NewSet()
+	for i := 0; i < peers; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/node/tx/submit" {
+				received.Add(1)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+	}
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.KnownPeers = knownPeers
+		cfg.TxFanout = fanout
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	node.NetSendTxToPeers(database.NewBlockTx(signedTx, 1, signedTx.MinGasUnits()))
+
+	if n := received.Load(); n != fanout {
+		t.Fatalf("Error sharing transaction: should have been sent to %d peers, got %d", fanout, n)
+	}
+}
+
+// Test_ResyncBusy validates a second resync request is rejected while
+// another resync is still running.
+func Test_ResyncBusy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peer.Status{})
+	}))
+	defer srv.Close()
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.KnownPeers = knownPeers
+	})
+
+	worker := blockingWorker{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	node.Worker = worker
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := node.Resync("")
+		errs <- err
+	}()
+
+	<-worker.started
+
+	if _, _, err := node.Resync(""); !errors.Is(err, state.ErrResyncInProgress) {
+		t.Fatalf("Error handling concurrent resync: should have received ErrResyncInProgress, got %v", err)
+	}
+
+	close(worker.release)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("Error running resync: %v", err)
+	}
+
+	if !node.IsMiningAllowed() {
+		t.Fatal("Error completing resync: mining should be turned back on")
+	}
+
+	if _, _, err := node.Resync(""); err != nil {
+		t.Fatalf("Error running resync after the first completed: %v", err)
+	}
+}
+
+// Test_ResyncUnreachablePeer validates a resync from a peer that can't be
+// reached is refused without resetting the blockchain.
+func Test_ResyncUnreachablePeer(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+
+	before, after, err := node.Resync(strings.TrimPrefix(srv.URL, "http://"))
+	if !errors.Is(err, state.ErrResyncNoPeer) {
+		t.Fatalf("Error running resync: should have received ErrResyncNoPeer, got %v", err)
+	}
+
+	if before != 1 || after != 1 {
+		t.Fatalf("Error running resync: the block number should be unchanged, got before %d, after %d", before, after)
+	}
+
+	if num := node.LatestBlock().Header.Number; num != 1 {
+		t.Fatalf("Error running resync: should have kept the blockchain, got block %d", num)
+	}
+
+	if !node.IsMiningAllowed() {
+		t.Fatal("Error completing resync: mining should be turned back on")
+	}
+}
+
+// =============================================================================
+
+// Test_Equivocation validates that in POA, a second block produced by the
+// same beneficiary at the same height is rejected and the first block
+// seen is kept.
+func Test_Equivocation(t *testing.T) {
+	var blocks []database.Block
+	for value := uint64(1); value <= 2; value++ {
+		node := newNode(miner1PrivateKey, t, withConsensus(state.ConsensusPOA))
+
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   1,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   value,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+		blocks = append(blocks, blk)
+	}
+
+	if blocks[0].Hash() == blocks[1].Hash() {
+		t.Fatal("Error mining blocks: the blocks should be different")
+	}
+
+	node := newNode(miner2PrivateKey, t, withConsensus(state.ConsensusPOA))
+
+	if err := node.ProcessProposedBlock(blocks[0]); err != nil {
+		t.Fatalf("Error processing first block: %v", err)
+	}
+
+	if err := node.ProcessProposedBlock(blocks[1]); !errors.Is(err, state.ErrEquivocation) {
+		t.Fatalf("Error processing second block: should have received ErrEquivocation, got %v", err)
+	}
+
+	if hash := node.LatestBlock().Hash(); hash != blocks[0].Hash() {
+		t.Logf("got: %s", hash)
+		t.Logf("exp: %s", blocks[0].Hash())
+		t.Fatal("Error processing second block: the first block seen should be kept")
+	}
+}
+
+// Test_ForkChoice validates that two nodes with competing blocks of equal
+// weight at the same height both converge on the same block.
+func Test_ForkChoice(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t, withForkChoice(state.ForkChoiceTimestamp))
+	node2 := newNode(miner2PrivateKey, t, withForkChoice(state.ForkChoiceTimestamp))
+
+	mine := func(node *state.State, nonce uint64, value uint64) database.Block {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   nonce,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   value,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		return blk
+	}
+
+	// Both nodes share the first block.
+	if err := node2.ProcessProposedBlock(mine(node1, 1, 1)); err != nil {
+		t.Fatalf("Error processing shared block: %v", err)
+	}
+
+	// Each node mines a competing second block.
+	blk1 := mine(node1, 2, 1)
+	blk2 := mine(node2, 2, 2)
+
+	if blk1.Header.Difficulty != blk2.Header.Difficulty {
+		t.Fatal("Error mining competing blocks: the blocks should have equal weight")
+	}
+
+	err1 := node1.ProcessProposedBlock(blk2)
+	err2 := node2.ProcessProposedBlock(blk1)
+
+	if errors.Is(err1, state.ErrForkChoiceLost) == errors.Is(err2, state.ErrForkChoiceLost) {
+		t.Fatalf("Error resolving fork: exactly one node should keep its block: node1 %v, node2 %v", err1, err2)
+	}
+
+	hash1 := node1.LatestBlock().Hash()
+	hash2 := node2.LatestBlock().Hash()
+	if hash1 != hash2 {
+		t.Logf("node1: %s", hash1)
+		t.Logf("node2: %s", hash2)
+		t.Fatal("Error resolving fork: both nodes should pick the same block")
+	}
+
+	var balances []uint64
+	for _, node := range []*state.State{node1, node2} {
+		account, err := node.QueryAccount(edAccountID)
+		if err != nil {
+			t.Fatalf("Error querying account: %v", err)
+		}
+		balances = append(balances, account.Balance)
+	}
+
+	if balances[0] != balances[1] {
+		t.Fatalf("Error resolving fork: both nodes should have the same balances: node1 %d, node2 %d", balances[0], balances[1])
+	}
+}
+
+// Test_ForkChoiceDefault validates that without a fork choice rule each node
+// keeps the competing block it saw first.
+func Test_ForkChoiceDefault(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+
+	mine := func(node *state.State, nonce uint64, value uint64) database.Block {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   nonce,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   value,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		return blk
+	}
+
+	// Both nodes share the first block.
+	if err := node2.ProcessProposedBlock(mine(node1, 1, 1)); err != nil {
+		t.Fatalf("Error processing shared block: %v", err)
+	}
+
+	// Each node mines a competing second block.
+	blk1 := mine(node1, 2, 1)
+	blk2 := mine(node2, 2, 2)
+
+	for _, err := range []error{node1.ProcessProposedBlock(blk2), node2.ProcessProposedBlock(blk1)} {
+		if err == nil || errors.Is(err, state.ErrForkChoiceLost) {
+			t.Fatalf("Error processing competing block: the block should be refused without a fork choice, got %v", err)
+		}
+	}
+
+	if node1.LatestBlock().Hash() != blk1.Hash() || node2.LatestBlock().Hash() != blk2.Hash() {
+		t.Fatal("Error processing competing block: each node should keep the block it saw first")
+	}
+}
+
+// Test_ForkRecoversOrphanedTxs validates the transactions only in the block
+// orphaned by the fork choice return to the mempool, while the transactions
+// in the winning block don't.
+func Test_ForkRecoversOrphanedTxs(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t, withForkChoice(state.ForkChoiceTimestamp))
+	node2 := newNode(miner2PrivateKey, t, withForkChoice(state.ForkChoiceTimestamp))
+
+	submit := func(node *state.State, tx database.Tx, hexKey string) database.SignedTx {
+		signedTx := newSignedTx(tx, hexKey, t)
+		if err := node.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+		return signedTx
+	}
+
+	mine := func(node *state.State) database.Block {
+		blk, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+		return blk
+	}
+
+	// Both nodes share the first block.
+	submit(node1, database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}, kennedyPrivateKey)
+	if err := node2.ProcessProposedBlock(mine(node1)); err != nil {
+		t.Fatalf("Error processing shared block: %v", err)
+	}
+
+	// Both competing blocks contain the shared transaction, and each block
+	// contains a transaction unique to it.
+	shared := database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Value: 1}
+	submit(node1, shared, edPrivateKey)
+	sharedTx := submit(node2, shared, edPrivateKey)
+
+	unique := map[*state.State]database.SignedTx{
+		node1: submit(node1, database.Tx{ChainID: chainID, Nonce: 1, FromID: ceasarAccountID, ToID: edAccountID, Value: 1}, ceasarPrivateKey),
+		node2: submit(node2, database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}, kennedyPrivateKey),
+	}
+
+	blk1 := mine(node1)
+	blk2 := mine(node2)
+
+	err1 := node1.ProcessProposedBlock(blk2)
+	err2 := node2.ProcessProposedBlock(blk1)
+
+	if errors.Is(err1, state.ErrForkChoiceLost) == errors.Is(err2, state.ErrForkChoiceLost) {
+		t.Fatalf("Error resolving fork: exactly one node should keep its block: node1 %v, node2 %v", err1, err2)
+	}
+
+	loser, winner := node1, node2
+	if errors.Is(err1, state.ErrForkChoiceLost) {
+		loser, winner = node2, node1
+	}
+
+	if _, err := loser.QueryMempoolTx(unique[loser].SignatureString()); err != nil {
+		t.Fatalf("Error resolving fork: the transaction unique to the orphaned block should be in the mempool: %v", err)
+	}
+
+	if _, err := loser.QueryMempoolTx(unique[winner].SignatureString()); !errors.Is(err, state.ErrTxNotFound) {
+		t.Fatalf("Error resolving fork: the transaction in the winning block should not be in the mempool, got %v", err)
+	}
+
+	if _, err := loser.QueryMempoolTx(sharedTx.SignatureString()); !errors.Is(err, state.ErrTxNotFound) {
+		t.Fatalf("Error resolving fork: the transaction in both blocks should not be in the mempool, got %v", err)
+	}
+
+	if n := loser.MempoolLength(); n != 1 {
+		t.Fatalf("Error resolving fork: only the orphaned transaction should be in the mempool, got %d", n)
+	}
+}
+
+// Test_TxFilter validates transactions rejected by the configured filter
+// never reach the mempool while other transactions are accepted.
+func Test_TxFilter(t *testing.T) {
+	errBlocked := errors.New("account is blocked")
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.TxFilter = func(tx database.BlockTx) error {
+			if tx.FromID == kennedyAccountID || tx.ToID == kennedyAccountID {
+				return errBlocked
+			}
+			return nil
+		}
+	})
+
+	type table struct {
+		name    string
+		tx      database.Tx
+		hexKey  string
+		blocked bool
+	}
+
+	tt := []table{
+		{name: "from blocked", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}, hexKey: kennedyPrivateKey, blocked: true},
+		{name: "to blocked", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Value: 1}, hexKey: edPrivateKey, blocked: true},
+		{name: "not blocked", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: miner1AccountID, Value: 1}, hexKey: edPrivateKey, blocked: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			signedTx := newSignedTx(tst.tx, tst.hexKey, t)
+			blockTx := database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())
+
+			submits := []struct {
+				name   string
+				submit func() error
+			}{
+				{name: "wallet", submit: func() error { return node.UpsertWalletTransaction(signedTx) }},
+				{name: "node", submit: func() error { return node.UpsertNodeTransaction(blockTx) }},
+				{name: "mempool", submit: func() error { return node.UpsertMempool(blockTx) }},
+			}
+
+			for _, s := range submits {
+				err := s.submit()
+				if tst.blocked && !errors.Is(err, errBlocked) {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been rejected by the filter, got %v", tst.name, s.name, err)
+				}
+				if !tst.blocked && err != nil {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been accepted: %v", tst.name, s.name, err)
+				}
+			}
+
+			pending := node.PendingNonces(tst.tx.FromID)
+			if tst.blocked && len(pending) != 0 {
+				t.Fatalf("Test %s:\tError checking mempool: blocked transaction should not be in the mempool, got nonces %v", tst.name, pending)
+			}
+			if !tst.blocked && len(pending) != 1 {
+				t.Fatalf("Test %s:\tError checking mempool: transaction should be in the mempool, got nonces %v", tst.name, pending)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_DataCodec validates transactions with data that isn't valid for the
+// genesis data codec never reach the mempool.
+func Test_DataCodec(t *testing.T) {
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.DataCodec = codec.JSON
+	})
+
+	type table struct {
+		name    string
+		tx      database.Tx
+		hexKey  string
+		success bool
+	}
+
+	tt := []table{
+		{name: "valid json", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Data: []byte(`{"order":12}`)}, hexKey: kennedyPrivateKey, success: true},
+		{name: "no data", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Value: 1}, hexKey: edPrivateKey, success: true},
+		{name: "malformed json", tx: database.Tx{ChainID: chainID, Nonce: 1, FromID: miner2AccountID, ToID: edAccountID, Value: 1, Data: []byte(`{"order":`)}, hexKey: miner2PrivateKey, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			signedTx := newSignedTx(tst.tx, tst.hexKey, t)
+			blockTx := database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())
+
+			submits := []struct {
+				name   string
+				submit func() error
+			}{
+				{name: "wallet", submit: func() error { return node.UpsertWalletTransaction(signedTx) }},
+				{name: "node", submit: func() error { return node.UpsertNodeTransaction(blockTx) }},
+				{name: "mempool", submit: func() error { return node.UpsertMempool(blockTx) }},
+			}
+
+			for _, s := range submits {
+				err := s.submit()
+				if tst.success && err != nil {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been accepted: %v", tst.name, s.name, err)
+				}
+				if !tst.success && !errors.Is(err, codec.ErrInvalidData) {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been rejected for invalid data, got %v", tst.name, s.name, err)
+				}
+			}
+
+			pending := node.PendingNonces(tst.tx.FromID)
+			if tst.success && len(pending) != 1 {
+				t.Fatalf("Test %s:\tError checking mempool: transaction should be in the mempool, got nonces %v", tst.name, pending)
+			}
+			if !tst.success && len(pending) != 0 {
+				t.Fatalf("Test %s:\tError checking mempool: rejected transaction should not be in the mempool, got nonces %v", tst.name, pending)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_MinTxValue validates transactions transferring less than the minimum
+// value are rejected, unless they transfer no value and that's allowed.
+func Test_MinTxValue(t *testing.T) {
+	const minTxValue = 10
+
+	type table struct {
+		name        string
+		value       uint64
+		zeroValueTx bool
+		success     bool
+	}
+
+	tt := []table{
+		{name: "below minimum", value: minTxValue - 1, success: false},
+		{name: "at minimum", value: minTxValue, success: true},
+		{name: "above minimum", value: minTxValue + 1, success: true},
+		{name: "zero value", value: 0, success: false},
+		{name: "zero value exempt", value: 0, zeroValueTx: true, success: true},
+		{name: "below minimum zero value exempt", value: 1, zeroValueTx: true, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+				cfg.Genesis.MinTxValue = minTxValue
+				cfg.Genesis.ZeroValueTx = tst.zeroValueTx
+			})
+
+			tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: tst.value}
+			signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+			blockTx := database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())
+
+			submits := []struct {
+				name   string
+				submit func() error
+			}{
+				{name: "wallet", submit: func() error { return node.UpsertWalletTransaction(signedTx) }},
+				{name: "node", submit: func() error { return node.UpsertNodeTransaction(blockTx) }},
+				{name: "mempool", submit: func() error { return node.UpsertMempool(blockTx) }},
+			}
+
+			for _, s := range submits {
+				err := s.submit()
+				if tst.success && err != nil {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been accepted: %v", tst.name, s.name, err)
+				}
+				if !tst.success && !errors.Is(err, state.ErrTxValueTooLow) {
+					t.Fatalf("Test %s:\tError submitting %s transaction: should have been rejected for a low value, got %v", tst.name, s.name, err)
+				}
+			}
+
+			if n := node.MempoolLength(); (tst.success && n != 1) || (!tst.success && n != 0) {
+				t.Fatalf("Test %s:\tError checking mempool: got %d transactions", tst.name, n)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_CheckBalance validates transactions are rejected when the sending
+// account can't afford them along with its pending transactions.
+func Test_CheckBalance(t *testing.T) {
+	const balance = 1000000
+
+	submit := func(node *state.State, nonce uint64, value uint64, tip uint64) error {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: value, Tip: tip}
+		return node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t))
+	}
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.CheckBalance = true
+	})
+
+	if err := submit(node, 1, balance, 0); !errors.Is(err, state.ErrInsufficientFunds) {
+		t.Fatalf("Error submitting transaction: should reject a transaction that can't pay for gas, got %v", err)
+	}
+
+	if err := submit(node, 1, 600000, 0); err != nil {
+		t.Fatalf("Error submitting transaction: should accept an affordable transaction: %v", err)
+	}
+
+	// The account can afford this transaction on its own, but not after the
+	// pending transaction is paid for.
+	if err := submit(node, 2, 500000, 0); !errors.Is(err, state.ErrInsufficientFunds) {
+		t.Fatalf("Error submitting transaction: should reject a transaction the pending transactions leave unaffordable, got %v", err)
+	}
+
+	if err := submit(node, 2, 300000, 0); err != nil {
+		t.Fatalf("Error submitting transaction: should accept a transaction affordable with the pending transactions: %v", err)
+	}
+
+	// Replacing a pending transaction only counts the replacement.
+	if err := submit(node, 2, 300000, 10); err != nil {
+		t.Fatalf("Error submitting transaction: should accept replacing a pending transaction: %v", err)
+	}
+
+	if n := node.MempoolLength(); n != 2 {
+		t.Fatalf("Error checking mempool: should have 2 transactions, got %d", n)
+	}
+
+	// Without the check the node accepts transactions that will fail.
+	unchecked := newNode(miner1PrivateKey, t)
+	if err := submit(unchecked, 1, 2*balance, 0); err != nil {
+		t.Fatalf("Error submitting transaction: should accept any transaction without the balance check: %v", err)
+	}
+}
+
+// Test_RejectedBlocks validates blocks rejected by the node are recorded
+// with their source, and only the most recent blocks are kept.
+func Test_RejectedBlocks(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+
+	var blocks []database.Block
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   nonce,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := node1.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+		blocks = append(blocks, blk)
+	}
+
+	// The second block can't be applied before the first one.
+	if err := node2.ProcessProposedBlockFrom(blocks[1], "peer-0"); err == nil {
+		t.Fatal("Error processing block: the block should have been rejected")
+	}
+
+	rejected := node2.RejectedBlocks()
+	if len(rejected) != 1 {
+		t.Fatalf("Error getting rejected blocks: should have 1 block, got %d", len(rejected))
+	}
+
+	got := rejected[0]
+	if got.Hash != blocks[1].Hash() || got.Number != 2 || got.Source != "peer-0" || got.Reason == "" {
+		t.Logf("got: %+v", got)
+		t.Logf("exp: hash[%s] number[2] source[peer-0]", blocks[1].Hash())
+		t.Fatal("Error getting rejected blocks: should record the rejected block")
+	}
+
+	// The first block is accepted and isn't recorded.
+	if err := node2.ProcessProposedBlockFrom(blocks[0], "peer-0"); err != nil {
+		t.Fatalf("Error processing block: %v", err)
+	}
+
+	if n := len(node2.RejectedBlocks()); n != 1 {
+		t.Fatalf("Error getting rejected blocks: accepted block should not be recorded, got %d blocks", n)
+	}
+
+	// Reject more blocks than are kept.
+	last := fmt.Sprintf("peer-%d", state.MaxRejectedBlocks+5)
+	for i := 1; i <= state.MaxRejectedBlocks+5; i++ {
+		node2.ProcessProposedBlockFrom(blocks[0], fmt.Sprintf("peer-%d", i))
+	}
+
+	rejected = node2.RejectedBlocks()
+	if len(rejected) != state.MaxRejectedBlocks {
+		t.Fatalf("Error getting rejected blocks: should keep %d blocks, got %d", state.MaxRejectedBlocks, len(rejected))
+	}
+
+	if rejected[0].Source != last {
+		t.Fatalf("Error getting rejected blocks: most recent block should be first, got source %s, exp %s", rejected[0].Source, last)
+	}
+}
+
+// Test_DifficultyMismatch validates a block mined at a difficulty other than
+// the one expected by the protocol is rejected, even when it's harder.
+func Test_DifficultyMismatch(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.Difficulty = 2
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node2.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk, err := node2.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if blk.Header.Difficulty != 2 {
+		t.Fatalf("Error mining new block: should be mined at difficulty 2, got %d", blk.Header.Difficulty)
+	}
+
+	if err := node1.ProcessProposedBlock(blk); !errors.Is(err, database.ErrDifficultyMismatch) {
+		t.Fatalf("Error processing block: should have received ErrDifficultyMismatch, got %v", err)
+	}
+
+	if n := node1.LatestBlock().Header.Number; n != 0 {
+		t.Fatalf("Error processing block: the block should not be added, latest block %d", n)
+	}
+}
+
+// Test_ValidationMode validates a lenient node accepts a block that a strict
+// node rejects for one of the softer checks.
+func Test_ValidationMode(t *testing.T) {
+	lenient := func(cfg *state.Config) {
+		cfg.ValidationMode = state.ValidationLenient
+	}
+
+	miner := newNode(miner1PrivateKey, t, lenient)
+	strictNode := newNode(miner2PrivateKey, t)
+	lenientNode := newNode(miner2PrivateKey, t, lenient)
+
+	if mode := strictNode.ValidationMode(); mode != state.ValidationStrict {
+		t.Fatalf("Error checking validation mode: should default to %s, got %s", state.ValidationStrict, mode)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	// The transaction claims a timestamp after the block will be mined.
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	blockTx := database.NewBlockTx(signedTx, 15, signedTx.MinGasUnits())
+	blockTx.TimeStamp = uint64(time.Now().Add(time.Minute).UTC().UnixMilli())
+
+	if err := miner.UpsertMempool(blockTx); err != nil {
+		t.Fatalf("Error upserting transaction: %v", err)
+	}
+
+	blk, err := miner.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if err := strictNode.ProcessProposedBlock(blk); !errors.Is(err, database.ErrInvalidTimeStamp) {
+		t.Fatalf("Error processing block: strict node should have received ErrInvalidTimeStamp, got %v", err)
+	}
+
+	if n := strictNode.LatestBlock().Header.Number; n != 0 {
+		t.Fatalf("Error processing block: strict node should not add the block, latest block %d", n)
+	}
+
+	if err := lenientNode.ProcessProposedBlock(blk); err != nil {
+		t.Fatalf("Error processing block: lenient node should accept the block: %v", err)
+	}
+
+	if n := lenientNode.LatestBlock().Header.Number; n != 1 {
+		t.Fatalf("Error processing block: lenient node should add the block, latest block %d", n)
+	}
+
+	// A lenient node also skips the genesis minimum value.
+	minValue := func(cfg *state.Config) {
+		cfg.Genesis.MinTxValue = 10
+	}
+
+	dustTx := database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	signedDust := newSignedTx(dustTx, kennedyPrivateKey, t)
+
+	if err := newNode(miner2PrivateKey, t, minValue).UpsertWalletTransaction(signedDust); !errors.Is(err, state.ErrTxValueTooLow) {
+		t.Fatalf("Error upserting wallet transaction: strict node should have received ErrTxValueTooLow, got %v", err)
+	}
+
+	if err := newNode(miner2PrivateKey, t, minValue, lenient).UpsertWalletTransaction(signedDust); err != nil {
+		t.Fatalf("Error upserting wallet transaction: lenient node should accept the transaction: %v", err)
+	}
+}
+
+// Test_BeneficiaryEarnings validates the rewards, fees and tips credited to
+// the beneficiaries of blocks mined by different nodes.
+func Test_BeneficiaryEarnings(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+
+	mine := func(miner *state.State, other *state.State, nonce uint64, tip uint64) uint64 {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: tip}
+		if err := miner.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		blk, err := miner.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		if err := other.ProcessProposedBlock(blk); err != nil {
+			t.Fatalf("Error processing block: %v", err)
+		}
+
+		var earned uint64
+		for _, tx := range blk.MerkleTree.Values() {
+			earned += tx.GasPrice*tx.GasUnits + tx.Tip
+		}
+
+		return blk.Header.MiningReward + earned
+	}
+
+	miner1Earned := mine(node1, node2, 1, 5)
+	miner2Earned := mine(node2, node1, 2, 3)
+
+	type table struct {
+		name     string
+		from     uint64
+		to       uint64
+		earnings map[database.AccountID]uint64
+	}
+
+	tt := []table{
+		{name: "whole chain", from: 1, to: state.QueryLatest, earnings: map[database.AccountID]uint64{miner1AccountID: miner1Earned, miner2AccountID: miner2Earned}},
+		{name: "first block", from: 1, to: 1, earnings: map[database.AccountID]uint64{miner1AccountID: miner1Earned}},
+		{name: "latest block", from: state.QueryLatest, to: state.QueryLatest, earnings: map[database.AccountID]uint64{miner2AccountID: miner2Earned}},
+	}
+
+	for _, tst := range tt {
+		for _, node := range []*state.State{node1, node2} {
+			earnings, err := node.BeneficiaryEarnings(tst.from, tst.to)
+			if err != nil {
+				t.Fatalf("Test %s:\tError getting earnings: %v", tst.name, err)
+			}
+
+			if !reflect.DeepEqual(earnings, tst.earnings) {
+				t.Logf("Test %s:\tgot: %v", tst.name, earnings)
+				t.Logf("Test %s:\texp: %v", tst.name, tst.earnings)
+				t.Fatalf("Test %s:\tError getting earnings: should match the credits to the beneficiaries.", tst.name)
+			}
+		}
+	}
+
+	if _, err := node1.BeneficiaryEarnings(2, 1); err == nil {
+		t.Fatal("Error getting earnings: should fail for a reversed block range.")
+	}
+}
+
+// Test_InvalidBlockTx validates a block holding a transaction that doesn't
+// recover to its from account is rejected as a whole.
+func Test_InvalidBlockTx(t *testing.T) {
+	type table struct {
+		name   string
+		forge  func(tx *database.SignedTx)
+		accept bool
+	}
+
+	tt := []table{
+		{name: "valid", forge: func(tx *database.SignedTx) {}, accept: true},
+		{name: "forged from", forge: func(tx *database.SignedTx) { tx.FromID = pavelAccountID }},
+		{name: "corrupt signature", forge: func(tx *database.SignedTx) { tx.R = new(big.Int).Add(tx.R, big.NewInt(1)) }},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			node := newNode(miner2PrivateKey, t)
+			gen := newGenesis()
+
+			valid := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+			signedValid := newSignedTx(valid, kennedyPrivateKey, t)
+
+			junk := database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+			signedJunk := newSignedTx(junk, kennedyPrivateKey, t)
+			tst.forge(&signedJunk)
+
+			txs := []database.BlockTx{
+				database.NewBlockTx(signedValid, gen.GasPrice, signedValid.MinGasUnits()),
+				database.NewBlockTx(signedJunk, gen.GasPrice, signedJunk.MinGasUnits()),
+			}
+
+			// The block is mined by hand with the state root the node
+			// expects, so only the transactions can be at fault.
+			storage, err := memory.New()
+			if err != nil {
+				t.Fatalf("Test %s:\tError setting up memory storage: %v", tst.name, err)
+			}
+
+			db, err := database.New(gen, storage, func(v string, args ...any) {})
+			if err != nil {
+				t.Fatalf("Test %s:\tError constructing database: %v", tst.name, err)
+			}
+
+			header := database.BlockHeader{BeneficiaryID: miner1AccountID, MiningReward: gen.MiningReward}
+
+			blk, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: miner1AccountID,
+				Difficulty:    gen.Difficulty,
+				MiningReward:  gen.MiningReward,
+				PrevBlock:     node.LatestBlock(),
+				StateRoot:     db.HashStateAfter(header, txs),
+				Tx:            txs,
+				GenesisHash:   node.Genesis().NetworkID(),
+				EvHandler:     func(v string, args ...any) {},
+			})
+			if err != nil {
+				t.Fatalf("Test %s:\tError mining block: %v", tst.name, err)
+			}
+
+			err = node.ProcessProposedBlock(blk)
+
+			switch tst.accept {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tError processing block: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, state.ErrInvalidBlockTx) {
+					t.Fatalf("Test %s:\tError processing block: should have received ErrInvalidBlockTx, got %v", tst.name, err)
+				}
+
+				if n := node.LatestBlock().Header.Number; n != 0 {
+					t.Fatalf("Test %s:\tError processing block: the block should not be added, latest block %d", tst.name, n)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_Allowlist validates only the accounts on the genesis allowlist can
+// send transactions, both to the mempool and in a block from a peer.
+func Test_Allowlist(t *testing.T) {
+	type table struct {
+		name      string
+		allowlist []string
+		allowed   bool
+	}
+
+	tt := []table{
+		{name: "permissionless", allowlist: nil, allowed: true},
+		{name: "allowed", allowlist: []string{string(edAccountID), strings.ToLower(string(kennedyAccountID))}, allowed: true},
+		{name: "disallowed", allowlist: []string{string(edAccountID)}, allowed: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			node := newNode(miner2PrivateKey, t, func(cfg *state.Config) {
+				cfg.Genesis.Allowlist = tst.allowlist
+			})
+			gen := newGenesis()
+
+			tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+			signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+
+			err := node.UpsertWalletTransaction(signedTx)
+
+			switch tst.allowed {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tError upserting wallet transaction: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, state.ErrTxNotAllowed) {
+					t.Fatalf("Test %s:\tError upserting wallet transaction: should have received ErrTxNotAllowed, got %v", tst.name, err)
+				}
+			}
+
+			// The same transaction arrives in a block mined by hand, like a
+			// block proposed by a peer that doesn't enforce the allowlist.
+			txs := []database.BlockTx{database.NewBlockTx(signedTx, gen.GasPrice, signedTx.MinGasUnits())}
+
+			storage, err := memory.New()
+			if err != nil {
+				t.Fatalf("Test %s:\tError setting up memory storage: %v", tst.name, err)
+			}
+
+			db, err := database.New(gen, storage, func(v string, args ...any) {})
+			if err != nil {
+				t.Fatalf("Test %s:\tError constructing database: %v", tst.name, err)
+			}
+
+			header := database.BlockHeader{BeneficiaryID: miner1AccountID, MiningReward: gen.MiningReward}
+
+			blk, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: miner1AccountID,
+				Difficulty:    gen.Difficulty,
+				MiningReward:  gen.MiningReward,
+				PrevBlock:     node.LatestBlock(),
+				StateRoot:     db.HashStateAfter(header, txs),
+				Tx:            txs,
+				GenesisHash:   node.Genesis().NetworkID(),
+				EvHandler:     func(v string, args ...any) {},
+			})
+			if err != nil {
+				t.Fatalf("Test %s:\tError mining block: %v", tst.name, err)
+			}
+
+			err = node.ProcessProposedBlock(blk)
+
+			switch tst.allowed {
+			case true:
+				if err != nil {
+					t.Fatalf("Test %s:\tError processing block: %v", tst.name, err)
+				}
+			default:
+				if !errors.Is(err, state.ErrInvalidBlockTx) || !strings.Contains(err.Error(), state.ErrTxNotAllowed.Error()) {
+					t.Fatalf("Test %s:\tError processing block: should have received ErrInvalidBlockTx for the sender, got %v", tst.name, err)
+				}
+
+				if n := node.LatestBlock().Header.Number; n != 0 {
+					t.Fatalf("Test %s:\tError processing block: the block should not be added, latest block %d", tst.name, n)
+				}
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_StorageWriteFailure validates a block that fails to be written to
+// storage leaves the latest block, accounts and mempool unchanged.
+func Test_StorageWriteFailure(t *testing.T) {
+	errDiskFull := errors.New("disk full")
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Storage = failingStorage{Storage: cfg.Storage, err: errDiskFull}
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   100,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	accounts := node.Accounts()
+	latest := node.LatestBlock()
+
+	if _, err := node.MineNewBlock(context.Background()); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Error mining new block: should have received the write error, got %v", err)
+	}
+
+	if hash := node.LatestBlock().Hash(); hash != latest.Hash() {
+		t.Fatalf("Error mining new block: latest block should be unchanged, got %s, exp %s", hash, latest.Hash())
+	}
+
+	if got := node.Accounts(); !reflect.DeepEqual(got, accounts) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", accounts)
+		t.Fatal("Error mining new block: accounts should be unchanged")
+	}
+
+	if n := node.MempoolLength(); n != 1 {
+		t.Fatalf("Error mining new block: transaction should still be in the mempool, got %d", n)
+	}
+}
+
+// Test_HashAlgorithm validates blocks mined under each hash algorithm are
+// accepted by nodes on the same chain and rejected by nodes on another.
+func Test_HashAlgorithm(t *testing.T) {
+	algorithms := []string{signature.HashSHA256, signature.HashKeccak256}
+
+	for i, algorithm := range algorithms {
+		f := func(t *testing.T) {
+			withAlgorithm := func(algorithm string) func(cfg *state.Config) {
+				return func(cfg *state.Config) {
+					cfg.Genesis.HashAlgorithm = algorithm
+				}
+			}
+
+			node1 := newNode(miner1PrivateKey, t, withAlgorithm(algorithm))
+			node2 := newNode(miner2PrivateKey, t, withAlgorithm(algorithm))
+			other := newNode(miner2PrivateKey, t, withAlgorithm(algorithms[(i+1)%len(algorithms)]))
+
+			for nonce := uint64(1); nonce <= 2; nonce++ {
+				tx := database.Tx{
+					ChainID: chainID,
+					Nonce:   nonce,
+					FromID:  kennedyAccountID,
+					ToID:    edAccountID,
+					Value:   1,
+				}
+
+				if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+					t.Fatalf("Error upserting wallet transaction: %v", err)
+				}
+
+				blk, err := node1.MineNewBlock(context.Background())
+				if err != nil {
+					t.Fatalf("Error mining new block: %v", err)
+				}
+
+				if blk.Header.HashAlgorithm != algorithm {
+					t.Fatalf("Error mining new block: should be hashed with %s, got %q", algorithm, blk.Header.HashAlgorithm)
+				}
+
+				if err := node2.ProcessProposedBlock(blk); err != nil {
+					t.Fatalf("Error processing block %d: %v", nonce, err)
+				}
+
+				if nonce == 1 {
+					if err := other.ProcessProposedBlock(blk); !errors.Is(err, database.ErrHashAlgorithmMismatch) {
+						t.Fatalf("Error processing block: should have received ErrHashAlgorithmMismatch, got %v", err)
+					}
+				}
+			}
+
+			if hash1, hash2 := node1.LatestBlock().Hash(), node2.LatestBlock().Hash(); hash1 != hash2 {
+				t.Logf("node1: %s", hash1)
+				t.Logf("node2: %s", hash2)
+				t.Fatal("Error processing blocks: both nodes should have the same latest block")
+			}
+		}
+
+		t.Run(algorithm, f)
+	}
+}
+
+// Test_ExportGenesis validates a chain started from an exported genesis has
+// the same balances as the chain it was exported from.
+func Test_ExportGenesis(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 250}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	// Round trip the genesis through json the way it's stored in a file.
+	data, err := json.Marshal(node.ExportGenesis())
+	if err != nil {
+		t.Fatalf("Error marshaling the exported genesis: %v", err)
+	}
+
+	var gen genesis.Genesis
+	if err := json.Unmarshal(data, &gen); err != nil {
+		t.Fatalf("Error unmarshaling the exported genesis: %v", err)
+	}
+
+	if err := gen.Validate(); err != nil {
+		t.Fatalf("Error validating the exported genesis: %v", err)
+	}
+
+	if gen.ChainID != chainID || gen.MiningReward != node.Genesis().MiningReward {
+		t.Fatalf("Error exporting genesis: should keep the chain parameters, got %+v", gen)
+	}
+
+	exported := newNode(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis = gen
+	})
+
+	if exported.LatestBlock().Header.Number != 0 {
+		t.Fatal("Error exporting genesis: the new chain should start without blocks")
+	}
+
+	balances := func(accounts map[database.AccountID]database.Account) map[database.AccountID]uint64 {
+		out := make(map[database.AccountID]uint64)
+		for accountID, account := range accounts {
+			if account.Balance > 0 {
+				out[accountID] = account.Balance
+			}
+		}
+		return out
+	}
+
+	got, exp := balances(exported.Accounts()), balances(node.Accounts())
+	if !reflect.DeepEqual(got, exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatal("Error exporting genesis: the new chain should start with the same balances")
+	}
+
+	if exp[edAccountID] != 250 {
+		t.Fatalf("Error exporting genesis: should include the mined transfer, got %d", exp[edAccountID])
+	}
+
+	for accountID, account := range exported.Accounts() {
+		if account.Nonce != 0 {
+			t.Fatalf("Error exporting genesis: account %s should start with a zero nonce, got %d", accountID, account.Nonce)
+		}
+	}
+}
+
+func Test_NameRegistry(t *testing.T) {
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.DataCodec = codec.JSON
+	})
+
+	// A registration has its own encoding, whatever the data codec.
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Data: database.NameRegistration("kennedy")}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting the name registration: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	owner, err := node.LookupName("kennedy")
+	if err != nil {
+		t.Fatalf("Error looking up the registered name: %v", err)
+	}
+
+	if owner != kennedyAccountID {
+		t.Fatalf("Error looking up the registered name: got %s, exp %s", owner, kennedyAccountID)
+	}
+
+	// Another account can't register the name.
+	tx = database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Data: database.NameRegistration("kennedy")}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, edPrivateKey, t)); !errors.Is(err, database.ErrNameTaken) {
+		t.Fatalf("Error upserting the name registration: should reject a name owned by another account, got %v", err)
+	}
+
+	tx = database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Data: database.NameRegistration("Ed")}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, edPrivateKey, t)); !errors.Is(err, database.ErrInvalidName) {
+		t.Fatalf("Error upserting the name registration: should reject an invalid name, got %v", err)
+	}
+
+	if _, err := node.LookupName("ed"); !errors.Is(err, database.ErrNameNotFound) {
+		t.Fatalf("Error looking up the name: should not find an unregistered name, got %v", err)
+	}
+}
+
+func Test_TxDeadline(t *testing.T) {
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.TransPerBlock = 1
+	})
+
+	// The transaction with the deadline loses the first block to the
+	// transaction with the higher tip.
+	first := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: 10}
+	if err := node.UpsertWalletTransaction(newSignedTx(first, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	deadline := database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: kennedyAccountID, Value: 1, ValidUntilBlock: 1}
+	if err := node.UpsertWalletTransaction(newSignedTx(deadline, edPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction with a deadline: %v", err)
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if txs := block.MerkleTree.Values(); len(txs) != 1 || txs[0].FromID != kennedyAccountID {
+		t.Fatalf("Error mining new block: should only mine the transaction with the higher tip, got %v", txs)
+	}
+
+	// The deadline has passed for the next block.
+	if _, err := node.MineNewBlock(context.Background()); !errors.Is(err, state.ErrNoTransactions) {
+		t.Fatalf("Error mining new block: should not mine the expired transaction, got %v", err)
+	}
+
+	deadline.Nonce = 2
+	if err := node.UpsertWalletTransaction(newSignedTx(deadline, edPrivateKey, t)); !errors.Is(err, database.ErrTxExpired) {
+		t.Fatalf("Error upserting wallet transaction: should reject an expired transaction, got %v", err)
+	}
+}
+
+func Test_ExpiredBlockTx(t *testing.T) {
+	node := newNode(miner2PrivateKey, t)
+	gen := newGenesis()
+
+	// The blocks are mined by hand with the state root the node expects,
+	// so only the transaction deadline can be at fault.
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Error setting up memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, func(v string, args ...any) {})
+	if err != nil {
+		t.Fatalf("Error constructing database: %v", err)
+	}
+
+	mine := func(prevBlock database.Block, tx database.Tx) database.Block {
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		txs := []database.BlockTx{database.NewBlockTx(signedTx, gen.GasPrice, signedTx.MinGasUnits())}
+
+		header := database.BlockHeader{BeneficiaryID: miner1AccountID, MiningReward: gen.MiningReward}
+
+		blk, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: miner1AccountID,
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     prevBlock,
+			StateRoot:     db.HashStateAfter(header, txs),
+			Tx:            txs,
+			GenesisHash:   node.Genesis().NetworkID(),
+			EvHandler:     func(v string, args ...any) {},
+		})
+		if err != nil {
+			t.Fatalf("Error mining block: %v", err)
+		}
+
+		return blk
+	}
+
+	// The first block includes a transaction right on its deadline.
+	blk1 := mine(node.LatestBlock(), database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, ValidUntilBlock: 1})
+	if err := node.ProcessProposedBlock(blk1); err != nil {
+		t.Fatalf("Error processing block: should accept a transaction on its deadline: %v", err)
+	}
+
+	for _, tx := range blk1.MerkleTree.Values() {
+		db.ApplyTx(blk1, tx)
+	}
+	db.ApplyMiningReward(blk1)
+	db.UpdateLatestBlock(blk1)
+
+	// The second block includes a transaction past its deadline.
+	blk2 := mine(blk1, database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, ValidUntilBlock: 1})
+	if err := node.ProcessProposedBlock(blk2); !errors.Is(err, database.ErrTxExpired) {
+		t.Fatalf("Error processing block: should reject an expired transaction, got %v", err)
+	}
+
+	if n := node.LatestBlock().Header.Number; n != 1 {
+		t.Fatalf("Error processing block: the block should not be added, latest block %d", n)
+	}
+}
+
+func Test_MiningEvents(t *testing.T) {
+	var events []state.MiningEvent
+	ev := func(v string, args ...any) {
+		s := fmt.Sprintf(v, args...)
+		if !strings.HasPrefix(s, state.EventMining) {
+			return
+		}
+
+		var event state.MiningEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(s, state.EventMining)), &event); err != nil {
+			t.Fatalf("Error unmarshaling the mining event %q: %v", s, err)
+		}
+		events = append(events, event)
+	}
+
+	node := newNode(miner1PrivateKey, t, withEvHandler(ev))
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if len(events) < 2 {
+		t.Fatalf("Error mining new block: should send a start and an end mining event, got %+v", events)
+	}
+
+	first, last := events[0], events[len(events)-1]
+	if first.Status != state.MiningStarted || last.Status != state.MiningSolved {
+		t.Fatalf("Error mining new block: should start and solve, got %q and %q", first.Status, last.Status)
+	}
+
+	for _, event := range events {
+		if event.BlockNumber != block.Header.Number || event.Difficulty != block.Header.Difficulty {
+			t.Fatalf("Error mining new block: should report block %d at difficulty %d, got %+v", block.Header.Number, block.Header.Difficulty, event)
+		}
+	}
+
+	if last.Attempts == 0 || last.Attempts != node.MiningAttempts() {
+		t.Fatalf("Error mining new block: should report the attempts made, got %d, exp %d", last.Attempts, node.MiningAttempts())
+	}
+
+	// A cancelled mining operation reports it was cancelled.
+	tx = database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	events = nil
+	if _, err := node.MineNewBlock(ctx); err == nil {
+		t.Fatal("Error mining new block: should fail when cancelled")
+	}
+
+	if len(events) == 0 || events[len(events)-1].Status != state.MiningCancelled {
+		t.Fatalf("Error mining new block: should report the mining was cancelled, got %+v", events)
+	}
+}
+
+func Test_RebroadcastMempool(t *testing.T) {
+	const interval = 100 * time.Millisecond
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.RebroadcastInterval = interval
+	})
+
+	sigs := make(map[string]bool)
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+		sigs[signedTx.SignatureString()] = true
+	}
+
+	worker := sharingWorker{shared: make(chan database.BlockTx, len(sigs))}
+	node.Worker = worker
+
+	queued, err := node.RebroadcastMempool()
+	if err != nil {
+		t.Fatalf("Error rebroadcasting the mempool: %v", err)
+	}
+
+	if queued != len(sigs) {
+		t.Fatalf("Error rebroadcasting the mempool: got %d queued, exp %d", queued, len(sigs))
+	}
+
+	n := len(sigs)
+	for i := 0; i < n; i++ {
+		tx := <-worker.shared
+		if !sigs[tx.SignatureString()] {
+			t.Fatalf("Error rebroadcasting the mempool: shared an unknown transaction %s", tx)
+		}
+		delete(sigs, tx.SignatureString())
+	}
+
+	if len(sigs) != 0 {
+		t.Fatalf("Error rebroadcasting the mempool: %d transactions weren't shared", len(sigs))
+	}
+
+	// A second rebroadcast within the interval is refused.
+	if _, err := node.RebroadcastMempool(); !errors.Is(err, state.ErrRebroadcastTooSoon) {
+		t.Fatalf("Error rebroadcasting the mempool: should refuse a rebroadcast within the interval, got %v", err)
+	}
+
+	if len(worker.shared) != 0 {
+		t.Fatal("Error rebroadcasting the mempool: a refused rebroadcast shouldn't share transactions")
+	}
+
+	time.Sleep(interval)
+
+	// The share queue only has room for one transaction, so only one is
+	// reported as queued.
+	node.Worker = sharingWorker{shared: make(chan database.BlockTx, 1)}
+
+	if queued, err := node.RebroadcastMempool(); err != nil || queued != 1 {
+		t.Fatalf("Error rebroadcasting the mempool: should rebroadcast after the interval, got %d queued, exp 1: %v", queued, err)
+	}
+}
+
+func Test_ReshareAgedTxs(t *testing.T) {
+	const age = 100 * time.Millisecond
+
+	node := newNode(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.ReshareAge = age
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	worker := sharingWorker{shared: make(chan database.BlockTx, 1)}
+	node.Worker = worker
+
+	// The transaction was just shared, so it isn't reshared yet.
+	if queued := node.ReshareAgedTxs(); queued != 0 {
+		t.Fatalf("Error resharing aged transactions: got %d queued before the age, exp 0", queued)
+	}
+
+	time.Sleep(age)
+
+	// The transaction wasn't mined, so it's reshared after the age.
+	if queued := node.ReshareAgedTxs(); queued != 1 {
+		t.Fatalf("Error resharing aged transactions: got %d queued after the age, exp 1", queued)
+	}
+
+	if shared := <-worker.shared; shared.SignatureString() != signedTx.SignatureString() {
+		t.Fatalf("Error resharing aged transactions: shared an unknown transaction %s", shared)
+	}
+
+	// The age starts again from the reshare.
+	if queued := node.ReshareAgedTxs(); queued != 0 {
+		t.Fatalf("Error resharing aged transactions: got %d queued right after a reshare, exp 0", queued)
+	}
+}
+
+// =============================================================================
+
 // noopWorker implements the Worker interface which does nothing.
 type noopWorker struct{}
 
@@ -177,18 +2848,71 @@ func (n noopWorker) Shutdown() {}
 
 func (n noopWorker) Sync() {}
 
+func (n noopWorker) SyncPeer(pr peer.Peer) {}
+
 func (n noopWorker) SignalStartMining() {}
 
 func (n noopWorker) SignalCancelMining() {}
 
 func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
 
+func (n noopWorker) SignalReshareTx(blockTx database.BlockTx) bool { return false }
+
+func (n noopWorker) SignalGossipTip() {}
+
+// failingStorage implements the Storage interface and fails every write.
+type failingStorage struct {
+	database.Storage
+	err error
+}
+
+func (f failingStorage) Write(blockData database.BlockData) error {
+	return f.err
+}
+
+// blockingWorker implements the Worker interface and blocks inside
+// Sync until it is released.
+type blockingWorker struct {
+	noopWorker
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingWorker) Sync() {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	<-b.release
+}
+
+// sharingWorker implements the Worker interface and records the
+// transactions signaled to be shared.
+type sharingWorker struct {
+	noopWorker
+	shared chan database.BlockTx
+}
+
+func (s sharingWorker) SignalShareTx(blockTx database.BlockTx) {
+	s.shared <- blockTx
+}
+
+func (s sharingWorker) SignalReshareTx(blockTx database.BlockTx) bool {
+	select {
+	case s.shared <- blockTx:
+		return true
+	default:
+		return false
+	}
+}
+
 // =============================================================================
 
-// newGenesis will create a new Genesis.
+// newGenesis will create a new Genesis. The date is fixed so every node
+// built from it shares the same genesis hash.
 func newGenesis() genesis.Genesis {
 	g := genesis.Genesis{
-		Date:          time.Now().Add(time.Hour * 24 * -365),
+		Date:          time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
 		ChainID:       chainID,
 		TransPerBlock: 10,
 		Difficulty:    1,
@@ -219,7 +2943,7 @@ func newSignedTx(tx database.Tx, hexKey string, t *testing.T) database.SignedTx
 }
 
 // newNode will create an in memory miner.
-func newNode(hexKey string, t *testing.T) *state.State {
+func newNode(hexKey string, t *testing.T, options ...func(cfg *state.Config)) *state.State {
 	if hexKey == "" {
 		t.Fatalf("Error with hexKey being empty.")
 	}
@@ -234,7 +2958,7 @@ func newNode(hexKey string, t *testing.T) *state.State {
 		t.Fatalf("Error setting up memory storage: %v", err)
 	}
 
-	state, err := state.New(state.Config{
+	cfg := state.Config{
 		BeneficiaryID:  database.PublicKeyToAccountID(privateKey.PublicKey),
 		Host:           "http://localhost:9080",
 		Genesis:        newGenesis(),
@@ -242,7 +2966,13 @@ func newNode(hexKey string, t *testing.T) *state.State {
 		SelectStrategy: "Tip",
 		KnownPeers:     peer.NewSet(),
 		EvHandler:      func(v string, args ...any) {},
-	})
+	}
+
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	state, err := state.New(cfg)
 	if err != nil {
 		t.Fatalf("Error constructing node state: %v", err)
 	}
@@ -250,3 +2980,24 @@ func newNode(hexKey string, t *testing.T) *state.State {
 	state.Worker = noopWorker{}
 	return state
 }
+
+// withEvHandler sets the event handler for the node.
+func withEvHandler(evHandler state.EventHandler) func(cfg *state.Config) {
+	return func(cfg *state.Config) {
+		cfg.EvHandler = evHandler
+	}
+}
+
+// withForkChoice sets the fork choice rule for the node.
+func withForkChoice(forkChoice string) func(cfg *state.Config) {
+	return func(cfg *state.Config) {
+		cfg.ForkChoice = forkChoice
+	}
+}
+
+// withConsensus sets the consensus protocol for the node.
+func withConsensus(consensus string) func(cfg *state.Config) {
+	return func(cfg *state.Config) {
+		cfg.Consensus = consensus
+	}
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"time"
+)
+
+// MiningTimings represents the time spent in each phase of the last block
+// mined by this node. Durations are in nanoseconds when encoded as json.
+type MiningTimings struct {
+	Number    uint64        `json:"number"`     // Number of the mined block.
+	Selection time.Duration `json:"selection"`  // Picking the transactions from the mempool.
+	StateRoot time.Duration `json:"state_root"` // Calculating the state root after the transactions.
+	Merkle    time.Duration `json:"merkle"`     // Constructing the merkle tree of the transactions.
+	POW       time.Duration `json:"pow"`        // Finding a nonce that solves the POW puzzle.
+	Validate  time.Duration `json:"validate"`   // Validating the block and updating the database.
+	Total     time.Duration `json:"total"`      // Time spent on the whole mining operation.
+	TimeStamp uint64        `json:"timestamp"`  // Time the block was mined in milliseconds.
+}
+
+// MiningTimings returns the phase timings of the last block mined by this
+// node. The zero value is returned when no block has been mined.
+func (s *State) MiningTimings() MiningTimings {
+	s.timingsMu.Lock()
+	defer s.timingsMu.Unlock()
+
+	return s.timings
+}
+
+// recordMiningTimings stores the phase timings of a mined block and sends
+// them as an event.
+func (s *State) recordMiningTimings(timings MiningTimings) {
+	timings.TimeStamp = uint64(time.Now().UTC().UnixMilli())
+
+	s.timingsMu.Lock()
+	s.timings = timings
+	s.timingsMu.Unlock()
+
+	s.evHandler("state: MineNewBlock: MINING: timings: blk[%d]: selection[%v] stateroot[%v] merkle[%v] pow[%v] validate[%v] total[%v]", timings.Number, timings.Selection, timings.StateRoot, timings.Merkle, timings.POW, timings.Validate, timings.Total)
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+)
+
+// CORE NOTE: Without tip gossip a node only learns about a new block on its
+// next sync, unless the block was proposed to it directly. A tip notification
+// is small, so it's sent to every peer as soon as the latest block changes.
+// A peer that is behind requests the missing blocks from the node that sent
+// the notification. Peers that already have the block ignore it, so the
+// gossip comes to an end.
+
+// TipGossip reports whether the node notifies its peers of every new
+// latest block right away.
+func (s *State) TipGossip() bool {
+	return s.tipGossip
+}
+
+// ProcessPeerTip handles a tip notification from a peer. When the peer is
+// known and ahead of this node, the missing blocks are requested from it in
+// the background. Only one request runs at a time, a notification received
+// while one is running is left to the next sync. It reports whether the
+// blocks were requested.
+func (s *State) ProcessPeerTip(tip peer.Tip) bool {
+	if latest := s.LatestBlock().Header.Number; tip.Number <= latest {
+		return false
+	}
+
+	// Only request blocks from a known peer, so a notification can't send
+	// this node to an arbitrary host.
+	var pr peer.Peer
+	var known bool
+	for _, kp := range s.KnownExternalPeers() {
+		if kp.Match(tip.Host) {
+			pr, known = kp, true
+			break
+		}
+	}
+
+	if !known {
+		s.evHandler("state: ProcessPeerTip: unknown peer[%s]: blk[%d]", tip.Host, tip.Number)
+		return false
+	}
+
+	if !s.tipSyncing.CompareAndSwap(false, true) {
+		return false
+	}
+
+	s.evHandler("state: ProcessPeerTip: peer[%s]: blk[%d]: hash[%s]: requesting blocks", pr.Host, tip.Number, tip.Hash)
+
+	go func() {
+		defer s.tipSyncing.Store(false)
+
+		if err := s.NetRequestPeerBlocks(pr); err != nil {
+			s.evHandler("state: ProcessPeerTip: peer[%s]: ERROR: %s", pr.Host, err)
+		}
+	}()
+
+	return true
+}
+
+// signalTipChanged signals the worker to notify the peers of the new latest
+// block, when tip gossip is turned on.
+func (s *State) signalTipChanged() {
+	if s.tipGossip {
+		s.Worker.SignalGossipTip()
+	}
+}
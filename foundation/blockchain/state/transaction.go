@@ -1,9 +1,31 @@
 package state
 
 import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/codec"
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 )
 
+// ErrTxValueTooLow is returned when a transaction transfers less than the
+// minimum value configured in the genesis file.
+var ErrTxValueTooLow = errors.New("transaction value below minimum")
+
+// ErrTxNotAllowed is returned when a transaction is sent from an account that
+// isn't on the allowlist configured in the genesis file.
+var ErrTxNotAllowed = errors.New("transaction sender not on allowlist")
+
+// ErrInvalidBlockTx is returned when a block holds a transaction that would
+// not be accepted into the mempool.
+var ErrInvalidBlockTx = errors.New("invalid transaction in block")
+
+// ErrInsufficientFunds is returned when the sending account can't afford a
+// transaction along with the transactions it already has pending.
+var ErrInsufficientFunds = errors.New("insufficient funds for pending transactions")
+
 // UpsertWalletTransaction accepts a transaction from a wallet for inclusion.
 func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 
@@ -15,13 +37,23 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 	// Check the signed transaction has the proper signature, that the
 	// `from` matches the signature, and the `from` and `to` fields are
 	// properly formatted.
-	if err := signedTx.Validate(s.genesis.ChainID); err != nil {
+	if err := signedTx.Validate(s.genesis.ChainID, s.genesis.SigningDomain); err != nil {
 		return err
 	}
 
-	const oneUnitofGas = 1
-	tx := database.NewBlockTx(signedTx, s.genesis.GasPrice, oneUnitofGas)
-	if err := s.mempool.Upsert(tx); err != nil {
+	// The node decides the gas units for a wallet transaction based on the
+	// minimum gas required to process it.
+	tx := database.NewBlockTx(signedTx, s.genesis.GasPrice, signedTx.MinGasUnits())
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if err := s.filterTx(tx); err != nil {
+		return err
+	}
+
+	// The transaction was submitted directly to this node.
+	if err := s.mempool.UpsertLocal(tx); err != nil {
 		return err
 	}
 
@@ -34,18 +66,226 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 // UpsertNodeTransaction accepts a transaction from a node for inclusion.
 func (s *State) UpsertNodeTransaction(tx database.BlockTx) error {
 
+	// CORE NOTE: Peers are not trusted. A transaction shared by a peer goes
+	// through the same signature checks as a transaction from a wallet, so a
+	// peer can't inject a transaction with a forged from account.
+
 	// Check the signed transaction has the proper signature, that the
-	// `from` matches the signature, and the `from` and `to` fields are
-	// properly formatted.
-	if err := tx.Validate(s.genesis.ChainID); err != nil {
+	// `from` matches the signature, the `from` and `to` fields are
+	// properly formatted, and the declared gas units cover the minimum.
+	if err := tx.Validate(s.genesis.ChainID, s.genesis.SigningDomain); err != nil {
+		return err
+	}
+
+	// The timestamp was set by the node that first received the transaction,
+	// so make sure it's close to our clock.
+	if s.strict() {
+		if err := tx.ValidateTimeStamp(time.Now(), s.txTimeTol); err != nil {
+			return err
+		}
+	}
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if err := s.filterTx(tx); err != nil {
 		return err
 	}
 
+	// When sharing to a subset of peers, a new transaction needs to be
+	// shared again so it propagates through the network. Known transactions
+	// are not shared again so the gossip comes to an end.
+	gossip := s.txFanout > 0 && !s.mempool.Contains(tx)
+
 	if err := s.mempool.Upsert(tx); err != nil {
 		return err
 	}
 
+	if gossip {
+		s.Worker.SignalShareTx(tx)
+	}
 	s.Worker.SignalStartMining()
 
 	return nil
 }
+
+// =============================================================================
+
+// checkTx checks the transaction against the rules a transaction must meet
+// to be accepted into the mempool. The minimum value is a softer check that
+// only runs in strict mode.
+func (s *State) checkTx(tx database.BlockTx) error {
+	if err := s.validateSender(tx); err != nil {
+		return err
+	}
+
+	if err := s.validateData(tx); err != nil {
+		return err
+	}
+
+	// A transaction that can't make it into the next block never will.
+	if next := s.LatestBlock().Header.Number + 1; tx.Expired(next) {
+		return fmt.Errorf("%w, valid until block %d, next block %d", database.ErrTxExpired, tx.ValidUntilBlock, next)
+	}
+
+	if s.strict() {
+		if err := s.validateValue(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.validateNameOwner(tx); err != nil {
+		return err
+	}
+
+	return s.validateBalance(tx)
+}
+
+// CORE NOTE: A transaction that fails when it's applied, like one with the
+// wrong nonce, still has a place in a block. It pays its gas fee to the
+// miner, unless the genesis policy is to refund the fee of a failed
+// transaction. A transaction that doesn't recover to its from account, or breaks
+// the rules for the chain, has no place in a block at all. Accepting it would
+// let a miner pad blocks with junk, so the whole block is rejected. The
+// balance check is left out, since it depends on this node's mempool.
+
+// checkBlockTxs checks every transaction in the block recovers to a valid
+// from account and passes the rules a transaction must meet to be accepted
+// into the mempool that don't depend on the accounts. The nonce and balance
+// aren't checked, a transaction failing those only fails when it's applied.
+func (s *State) checkBlockTxs(block database.Block) error {
+	for _, tx := range block.MerkleTree.Values() {
+		if err := tx.Validate(s.genesis.ChainID, s.genesis.SigningDomain); err != nil {
+			return fmt.Errorf("%w, tx[%s]: %s", ErrInvalidBlockTx, tx, err)
+		}
+
+		if err := s.validateSender(tx); err != nil {
+			return fmt.Errorf("%w, tx[%s]: %s", ErrInvalidBlockTx, tx, err)
+		}
+
+		if err := s.validateData(tx); err != nil {
+			return fmt.Errorf("%w, tx[%s]: %s", ErrInvalidBlockTx, tx, err)
+		}
+
+		if s.strict() {
+			if err := s.validateValue(tx); err != nil {
+				return fmt.Errorf("%w, tx[%s]: %s", ErrInvalidBlockTx, tx, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSender checks the transaction is sent from an account permitted
+// to transact, when the genesis file restricts the chain to an allowlist.
+func (s *State) validateSender(tx database.BlockTx) error {
+	if !s.genesis.Allowed(string(tx.FromID)) {
+		return fmt.Errorf("%w: %s", ErrTxNotAllowed, tx.FromID)
+	}
+
+	return nil
+}
+
+// validateData checks the transaction data is valid for the data codec
+// configured in the genesis file. A name registration has its own encoding
+// whatever the codec, so it only needs to carry a valid name.
+func (s *State) validateData(tx database.BlockTx) error {
+	if name, isNameReg := database.ParseNameRegistration(tx.Data); isNameReg {
+		return database.ValidateName(name)
+	}
+
+	return codec.Validate(s.genesis.DataCodec, tx.Data)
+}
+
+// validateNameOwner checks a name registration isn't for a name that's
+// already registered to another account. It would only fail when applied.
+func (s *State) validateNameOwner(tx database.BlockTx) error {
+	name, isNameReg := database.ParseNameRegistration(tx.Data)
+	if !isNameReg {
+		return nil
+	}
+
+	owner, err := s.db.LookupName(name)
+	if err == nil && owner != tx.FromID {
+		return fmt.Errorf("%w: %s", database.ErrNameTaken, name)
+	}
+
+	return nil
+}
+
+// validateValue checks the transaction doesn't transfer less than the
+// minimum value, so tiny transfers don't clutter the ledger with dust.
+func (s *State) validateValue(tx database.BlockTx) error {
+	if tx.Value == 0 && s.genesis.ZeroValueTx {
+		return nil
+	}
+
+	if tx.Value < s.genesis.MinTxValue {
+		return fmt.Errorf("%w, got %d, min %d", ErrTxValueTooLow, tx.Value, s.genesis.MinTxValue)
+	}
+
+	return nil
+}
+
+// validateBalance checks the sending account's confirmed balance covers the
+// cost of the transaction and the transactions it already has pending, when
+// the node is configured to check balances. A transaction replacing a pending
+// one with the same nonce takes the place of its cost.
+func (s *State) validateBalance(tx database.BlockTx) error {
+	if !s.checkBalance {
+		return nil
+	}
+
+	var balance uint64
+	if account, err := s.db.Query(tx.FromID); err == nil {
+		balance = account.Balance
+	}
+
+	needed, err := tx.Cost()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInsufficientFunds, err)
+	}
+
+	var pending uint64
+	for _, ptx := range s.mempool.PendingTxs(tx.FromID) {
+		if ptx.Nonce == tx.Nonce {
+			continue
+		}
+
+		cost, err := ptx.Cost()
+		if err != nil {
+			return fmt.Errorf("%w: pending nonce %d: %s", ErrInsufficientFunds, ptx.Nonce, err)
+		}
+
+		var carry uint64
+		if pending, carry = bits.Add64(pending, cost, 0); carry != 0 {
+			return fmt.Errorf("%w: pending transactions overflow", ErrInsufficientFunds)
+		}
+	}
+
+	if needed > balance || pending > balance-needed {
+		return fmt.Errorf("%w, bal %d, needed %d, pending %d", ErrInsufficientFunds, balance, needed, pending)
+	}
+
+	return nil
+}
+
+// CORE NOTE: The transaction filter only decides what this node accepts into
+// its mempool and shares with its peers. Blocks mined by other nodes are not
+// filtered, since rejecting a valid block over a local rule would fork this
+// node off the chain.
+
+// filterTx runs the configured transaction filter, if there is one.
+func (s *State) filterTx(tx database.BlockTx) error {
+	if s.txFilter == nil {
+		return nil
+	}
+
+	if err := s.txFilter(tx); err != nil {
+		return fmt.Errorf("transaction rejected by filter: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package state
+
+// Set of validation modes that can be used. The mandatory checks always
+// run, like the block hash being solved, the merkle root matching the
+// transactions and the transaction signatures. The strict mode also runs
+// the softer checks:
+//
+//   - A transaction from a peer has a timestamp close to the node's clock.
+//   - A transaction in a block has a timestamp not after the block's.
+//   - A transaction transfers at least the genesis minimum value.
+//
+// The lenient mode skips the softer checks, which helps when testing with
+// nodes whose clocks or genesis settings don't quite agree. Production
+// nodes should run strict.
+const (
+	ValidationStrict  = "strict"
+	ValidationLenient = "lenient"
+)
+
+// ValidationMode returns the validation mode the node is running with.
+func (s *State) ValidationMode() string {
+	return s.validation
+}
+
+// strict reports whether the softer checks need to run.
+func (s *State) strict() bool {
+	return s.validation == ValidationStrict
+}
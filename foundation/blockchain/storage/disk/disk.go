@@ -3,31 +3,48 @@
 package disk
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
 )
 
+// snapshotFile is the name of the file holding the latest snapshot of the
+// accounts. It doesn't follow the naming convention of the block files so
+// it's never mistaken for a block.
+const snapshotFile = "snapshot.json"
+
 // Disk represents the storage implementation for reading and storing blocks
 // in their own separate files on storage. This implements the database.Storage
-// interface.
+// and database.Snapshotter interfaces.
 type Disk struct {
-	dbPath string
+	mu      sync.Mutex
+	dbPath  string
+	compact bool
 }
 
 // New constructs an Disk value for use.
 func New(dbPath string) (*Disk, error) {
+	return NewWithCompact(dbPath, false)
+}
+
+// NewWithCompact constructs a Disk value for use. When compact is true, the
+// blocks are written as compact json instead of the human readable format.
+func NewWithCompact(dbPath string, compact bool) (*Disk, error) {
 	if err := os.MkdirAll(dbPath, 0755); err != nil {
 		return nil, err
 	}
 
-	return &Disk{dbPath: dbPath}, nil
+	return &Disk{dbPath: dbPath, compact: compact}, nil
 }
 
 // Close in this implementation has nothing to do since a new file is
@@ -37,28 +54,29 @@ func (d *Disk) Close() error {
 }
 
 // Write takes the specified database blocks and stores it on storage in a
-// file labeled with the Block number.
+// file labeled with the Block number. The Block is written to a temporary
+// file and synced before it replaces the Block file, so a failed write never
+// leaves a partial or stale Block behind.
 func (d *Disk) Write(blockData database.BlockData) error {
 
-	// Marshal the Block for writing to storage in a more human readable format.
-	data, err := json.MarshalIndent(blockData, "", "  ")
-	if err != nil {
-		return err
+	// Marshal the Block for writing to storage in a more human readable
+	// format, unless the storage is configured to save space.
+	var data []byte
+	var err error
+	switch {
+	case d.compact:
+		data, err = json.Marshal(blockData)
+	default:
+		data, err = json.MarshalIndent(blockData, "", "  ")
 	}
-
-	// Create a new file for this Block and name it based on the Block number.
-	f, err := os.OpenFile(d.getPath(blockData.Header.Number), os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	// Write the new Block to storage.
-	if _, err := f.Write(data); err != nil {
-		return err
-	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	return nil
+	return d.writeFile(d.getPath(blockData.Header.Number), data)
 }
 
 // GetBlock searches the blockchain on storage to locate and return the
@@ -88,13 +106,219 @@ func (d *Disk) ForEach() database.Iterator {
 	return &diskIterator{storage: d}
 }
 
-// Reset will clear out the blockchain on storage.
+// ForEachFrom returns an iterator to walk through the blocks
+// starting with the Block after the specified number.
+func (d *Disk) ForEachFrom(num uint64) database.Iterator {
+	return &diskIterator{storage: d, current: num}
+}
+
+// ForEachReverse returns an iterator to walk through all the blocks
+// starting with the latest Block on storage and ending with Block number 1.
+func (d *Disk) ForEachReverse() database.Iterator {
+	latest, err := d.latestNumber()
+	if err != nil || latest == 0 {
+		return &diskReverseIterator{storage: d, eoc: true}
+	}
+
+	return &diskReverseIterator{storage: d, current: latest}
+}
+
+// WriteSnapshot stores the snapshot on storage, replacing the previous
+// snapshot. The snapshot is written to a temporary file first so a crash
+// can't leave a partially written snapshot behind.
+func (d *Disk) WriteSnapshot(snapshot database.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.writeFile(path.Join(d.dbPath, snapshotFile), data)
+}
+
+// ReadSnapshot returns the latest snapshot on storage.
+func (d *Disk) ReadSnapshot() (database.Snapshot, error) {
+	data, err := os.ReadFile(path.Join(d.dbPath, snapshotFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return database.Snapshot{}, database.ErrNoSnapshot
+		}
+		return database.Snapshot{}, err
+	}
+
+	var snapshot database.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return database.Snapshot{}, fmt.Errorf("corrupt snapshot file: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// Reset will clear out the blockchain on storage. Only the block files and
+// the snapshot are removed so a misconfigured path can't destroy unrelated data.
 func (d *Disk) Reset() error {
-	if err := os.RemoveAll(d.dbPath); err != nil {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries, err := os.ReadDir(d.dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || (!isBlockFile(entry.Name()) && entry.Name() != snapshotFile) {
+			continue
+		}
+
+		if err := os.Remove(path.Join(d.dbPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Truncate removes the Block files after the specified Block number. A
+// snapshot taken after one of the removed blocks is removed as well, since
+// it no longer describes a Block on storage.
+func (d *Disk) Truncate(num uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries, err := os.ReadDir(d.dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isBlockFile(entry.Name()) {
+			continue
+		}
+
+		blockNum, _ := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if blockNum <= num {
+			continue
+		}
+
+		if err := os.Remove(path.Join(d.dbPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	snapshot, err := d.ReadSnapshot()
+	if err != nil || snapshot.Number <= num {
+		return nil
+	}
+
+	return os.Remove(path.Join(d.dbPath, snapshotFile))
+}
+
+// Compact rewrites every Block file on storage as compact json and returns
+// the number of bytes reclaimed. The contents of the blocks are unchanged,
+// only the whitespace is removed. Each Block file is replaced atomically
+// while holding the write lock, so it's safe to compact while the node is
+// running.
+func (d *Disk) Compact() (int64, error) {
+	entries, err := os.ReadDir(d.dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var reclaimed int64
+	for _, entry := range entries {
+		if entry.IsDir() || !isBlockFile(entry.Name()) {
+			continue
+		}
+
+		n, err := d.compactFile(path.Join(d.dbPath, entry.Name()))
+		if err != nil {
+			return reclaimed, fmt.Errorf("compact %s: %w", entry.Name(), err)
+		}
+		reclaimed += n
+	}
+
+	return reclaimed, nil
+}
+
+// compactFile rewrites the specified Block file as compact json and returns
+// the number of bytes reclaimed.
+func (d *Disk) compactFile(name string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return 0, err
+	}
+
+	// The file is already compact.
+	if buf.Len() >= len(data) {
+		return 0, nil
+	}
+
+	if err := d.writeFile(name, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return int64(len(data) - buf.Len()), nil
+}
+
+// writeFile writes the data to a temporary file next to the named file and
+// syncs it before it replaces the named file. The caller must hold the
+// write lock.
+func (d *Disk) writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(d.dbPath, filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Write the data to storage and make sure it's durable.
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
 		return err
 	}
 
-	return os.MkdirAll(d.dbPath, 0755)
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// latestNumber returns the highest Block number on storage, or 0 when there
+// are no blocks.
+func (d *Disk) latestNumber() (uint64, error) {
+	entries, err := os.ReadDir(d.dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint64
+	for _, entry := range entries {
+		if entry.IsDir() || !isBlockFile(entry.Name()) {
+			continue
+		}
+
+		num, _ := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".json"), 10, 64)
+		if num > latest {
+			latest = num
+		}
+	}
+
+	return latest, nil
 }
 
 // getPath forms the path to the specified Block.
@@ -103,6 +327,17 @@ func (d *Disk) getPath(blockNum uint64) string {
 	return path.Join(d.dbPath, fmt.Sprintf("%s.json", name))
 }
 
+// isBlockFile validates the file name follows the naming convention used for
+// block files, which is the Block number with a json extension.
+func isBlockFile(name string) bool {
+	if !strings.HasSuffix(name, ".json") {
+		return false
+	}
+
+	_, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+	return err == nil
+}
+
 // diskIterator represents the iteration implementation for walking
 // through and reading blocks on storage. This implements the database
 // Iterator interface.
@@ -131,3 +366,32 @@ func (di *diskIterator) Next() (database.BlockData, error) {
 func (di *diskIterator) Done() bool {
 	return di.eoc
 }
+
+// diskReverseIterator represents the iteration implementation for walking
+// backwards through and reading blocks on storage. This implements the
+// database Iterator interface.
+type diskReverseIterator struct {
+	storage *Disk  // Access to the Disk storage API.
+	current uint64 // Block number to read next.
+	eoc     bool   // Represents the iterator is past Block number 1.
+}
+
+// Next retrieves the previous Block from storage.
+func (di *diskReverseIterator) Next() (database.BlockData, error) {
+	if di.eoc {
+		return database.BlockData{}, errors.New("end of chain")
+	}
+
+	blockData, err := di.storage.GetBlock(di.current)
+	di.current--
+	if err != nil || di.current == 0 {
+		di.eoc = true
+	}
+
+	return blockData, err
+}
+
+// Done returns the end of chain value.
+func (di *diskReverseIterator) Done() bool {
+	return di.eoc
+}
@@ -0,0 +1,207 @@
+package disk_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+)
+
+func Test_Reset(t *testing.T) {
+	dbPath := t.TempDir()
+
+	d, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := d.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	// Create a set of files and folders that are not blocks.
+	keep := []string{"notes.txt", "config.json", "1.json.bak", "genesis.json"}
+	for _, name := range keep {
+		if err := os.WriteFile(filepath.Join(dbPath, name), []byte("keep"), 0600); err != nil {
+			t.Fatalf("Should be able to write file %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dbPath, "4.json"), 0755); err != nil {
+		t.Fatalf("Should be able to create a folder: %v", err)
+	}
+	keep = append(keep, "4.json")
+
+	if err := d.Reset(); err != nil {
+		t.Fatalf("Should be able to reset the storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if _, err := d.GetBlock(i); err == nil {
+			t.Errorf("Should have removed block %d.", i)
+		}
+	}
+
+	for _, name := range keep {
+		if _, err := os.Stat(filepath.Join(dbPath, name)); err != nil {
+			t.Errorf("Should have left %s untouched: %v", name, err)
+		}
+	}
+}
+
+func Test_WriteReplace(t *testing.T) {
+	dbPath := t.TempDir()
+
+	d, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	long := database.BlockData{Hash: "0x" + strings.Repeat("a", 64), Header: database.BlockHeader{Number: 1, StateRoot: strings.Repeat("b", 64)}}
+	short := database.BlockData{Hash: "0x01", Header: database.BlockHeader{Number: 1}}
+
+	for _, blockData := range []database.BlockData{long, short} {
+		if err := d.Write(blockData); err != nil {
+			t.Fatalf("Should be able to write block: %v", err)
+		}
+	}
+
+	// A shorter block replacing a longer one must not leave any of the
+	// longer block behind.
+	got, err := d.GetBlock(1)
+	if err != nil {
+		t.Fatalf("Should be able to read back the replaced block: %v", err)
+	}
+
+	if got.Hash != short.Hash || got.Header.StateRoot != short.Header.StateRoot {
+		t.Fatalf("Should read back the replacing block, got hash %s", got.Hash)
+	}
+
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to read the storage folder: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "1.json" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("Should only have the block file in storage, got %v", names)
+	}
+}
+
+func Test_Compact(t *testing.T) {
+	dbPath := t.TempDir()
+
+	d, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	var blocks []database.BlockData
+	for i := uint64(1); i <= 3; i++ {
+		blockData := database.BlockData{
+			Hash: "0x" + strings.Repeat("a", 64),
+			Header: database.BlockHeader{
+				Number:        i,
+				PrevBlockHash: "0x" + strings.Repeat("b", 64),
+				StateRoot:     strings.Repeat("c", 64),
+			},
+		}
+
+		if err := d.Write(blockData); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+		blocks = append(blocks, blockData)
+	}
+
+	sizeOf := func() int64 {
+		var size int64
+		for i := range blocks {
+			info, err := os.Stat(filepath.Join(dbPath, fmt.Sprintf("%d.json", i+1)))
+			if err != nil {
+				t.Fatalf("Should be able to stat block %d: %v", i+1, err)
+			}
+			size += info.Size()
+		}
+		return size
+	}
+
+	before := sizeOf()
+
+	reclaimed, err := d.Compact()
+	if err != nil {
+		t.Fatalf("Should be able to compact the storage: %v", err)
+	}
+
+	after := sizeOf()
+
+	if reclaimed <= 0 || before-after != reclaimed {
+		t.Fatalf("Should reclaim %d bytes, got %d", before-after, reclaimed)
+	}
+
+	for _, exp := range blocks {
+		got, err := d.GetBlock(exp.Header.Number)
+		if err != nil {
+			t.Fatalf("Should be able to read block %d after compacting: %v", exp.Header.Number, err)
+		}
+
+		if !reflect.DeepEqual(got, exp) {
+			t.Logf("got: %+v", got)
+			t.Logf("exp: %+v", exp)
+			t.Fatalf("Should read back the same block %d after compacting.", exp.Header.Number)
+		}
+	}
+
+	// Compacting again has nothing left to reclaim.
+	if reclaimed, err := d.Compact(); err != nil || reclaimed != 0 {
+		t.Fatalf("Should not reclaim anything from compact storage, got %d: %v", reclaimed, err)
+	}
+}
+
+func Test_Truncate(t *testing.T) {
+	d, err := disk.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := d.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	if err := d.WriteSnapshot(database.Snapshot{Number: 3}); err != nil {
+		t.Fatalf("Should be able to write a snapshot: %v", err)
+	}
+
+	if err := d.Truncate(2); err != nil {
+		t.Fatalf("Should be able to truncate the blocks after block 2: %v", err)
+	}
+
+	if _, err := d.GetBlock(3); err == nil {
+		t.Fatal("Should not get back the truncated block 3.")
+	}
+
+	for i := uint64(1); i <= 2; i++ {
+		if _, err := d.GetBlock(i); err != nil {
+			t.Fatalf("Should keep block %d: %v", i, err)
+		}
+	}
+
+	if _, err := d.ReadSnapshot(); err == nil {
+		t.Fatal("Should remove the snapshot taken after the truncated block 3.")
+	}
+
+	// The next block takes the place of the truncated block.
+	if err := d.Write(database.BlockData{Header: database.BlockHeader{Number: 3}}); err != nil {
+		t.Fatalf("Should be able to write a new block 3: %v", err)
+	}
+}
@@ -47,11 +47,11 @@ func (m *Memory) GetBlock(num uint64) (database.BlockData, error) {
 	defer m.mu.Unlock()
 
 	l := uint64(len(m.blocks))
-	if l == 0 || num >= 1 {
+	if num == 0 || num > l {
 		return database.BlockData{}, errors.New("block does not exists")
 	}
 
-	return m.blocks[num], nil
+	return m.blocks[num-1], nil
 }
 
 // ForEach returns an iterator to walk through all
@@ -60,6 +60,17 @@ func (m *Memory) ForEach() database.Iterator {
 	return &memoryIterator{storage: m}
 }
 
+// ForEachReverse returns an iterator to walk through all the blocks
+// starting with the latest block and ending with block number 1.
+func (m *Memory) ForEachReverse() database.Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest := uint64(len(m.blocks))
+
+	return &memoryReverseIterator{storage: m, current: latest, eoc: latest == 0}
+}
+
 // Reset will clear out the blockchain on disk.
 func (m *Memory) Reset() error {
 	m.mu.Lock()
@@ -70,6 +81,18 @@ func (m *Memory) Reset() error {
 	return nil
 }
 
+// Truncate removes the blocks after the specified block number.
+func (m *Memory) Truncate(num uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if num < uint64(len(m.blocks)) {
+		m.blocks = m.blocks[:num]
+	}
+
+	return nil
+}
+
 // /////////////////////////////////////////////////////////////////
 
 // memoryIterator represents the iteration implementation for walking
@@ -87,13 +110,12 @@ func (mi *memoryIterator) Next() (database.BlockData, error) {
 		return database.BlockData{}, errors.New("end of chain")
 	}
 
+	mi.current++
 	blockData, err := mi.storage.GetBlock(mi.current)
 	if err != nil {
 		mi.eoc = true
 	}
 
-	mi.current++
-
 	return blockData, err
 }
 
@@ -101,3 +123,32 @@ func (mi *memoryIterator) Next() (database.BlockData, error) {
 func (mi *memoryIterator) Done() bool {
 	return mi.eoc
 }
+
+// memoryReverseIterator represents the iteration implementation for walking
+// backwards through and reading blocks in memory. This implements the
+// database Iterator interface.
+type memoryReverseIterator struct {
+	storage *Memory // Access to the storage API
+	current uint64  // Block number to read next.
+	eoc     bool    // Represents the iterator is past block number 1.
+}
+
+// Next retrieves the previous block from memory.
+func (mi *memoryReverseIterator) Next() (database.BlockData, error) {
+	if mi.eoc {
+		return database.BlockData{}, errors.New("end of chain")
+	}
+
+	blockData, err := mi.storage.GetBlock(mi.current)
+	mi.current--
+	if err != nil || mi.current == 0 {
+		mi.eoc = true
+	}
+
+	return blockData, err
+}
+
+// Done returns the end of chain value.
+func (mi *memoryReverseIterator) Done() bool {
+	return mi.eoc
+}
@@ -0,0 +1,73 @@
+// Package storage provides support for selecting the storage backend the
+// blockchain is read from and written to by name.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+// List of storage backends.
+const (
+	BackendDisk   = "disk"
+	BackendMemory = "memory"
+)
+
+// ErrUnknownBackend is returned when there is no storage backend by the
+// specified name.
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Config represents the settings the storage backends are constructed with.
+// Not every backend makes use of every setting.
+type Config struct {
+	DBPath  string // Directory the disk backend keeps the blocks in.
+	Compact bool   // Write the blocks as compact json on disk.
+}
+
+// Compacter interface represents the behavior of a storage backend that can
+// rewrite the blocks it holds to take up less space.
+type Compacter interface {
+	Compact() (int64, error)
+}
+
+// map of storage backends with their constructors.
+var backends = map[string]func(cfg Config) (database.Storage, error){
+	BackendDisk:   newDisk,
+	BackendMemory: newMemory,
+}
+
+// New constructs the storage backend by the specified name.
+func New(backend string, cfg Config) (database.Storage, error) {
+	fn, exists := backends[strings.ToLower(backend)]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backend)
+	}
+
+	return fn(cfg)
+}
+
+// newDisk constructs a disk backend, which keeps every block in its own file.
+func newDisk(cfg Config) (database.Storage, error) {
+	d, err := disk.NewWithCompact(cfg.DBPath, cfg.Compact)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// newMemory constructs a memory backend, which loses the blocks when the
+// node stops.
+func newMemory(cfg Config) (database.Storage, error) {
+	m, err := memory.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,91 @@
+package storage_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/disk"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_New(t *testing.T) {
+	type table struct {
+		name    string
+		backend string
+		check   func(v any) bool
+	}
+
+	isDisk := func(v any) bool { _, ok := v.(*disk.Disk); return ok }
+	isMemory := func(v any) bool { _, ok := v.(*memory.Memory); return ok }
+
+	tt := []table{
+		{name: "disk", backend: storage.BackendDisk, check: isDisk},
+		{name: "memory", backend: storage.BackendMemory, check: isMemory},
+		{name: "mixed case", backend: "Memory", check: isMemory},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			store, err := storage.New(tst.backend, storage.Config{DBPath: t.TempDir()})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct the %s backend: %v", tst.name, tst.backend, err)
+			}
+			defer store.Close()
+
+			if !tst.check(store) {
+				t.Fatalf("Test %s:\tShould construct the %s backend, got %T", tst.name, tst.backend, store)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+
+	if _, err := storage.New("bolt", storage.Config{}); !errors.Is(err, storage.ErrUnknownBackend) {
+		t.Fatalf("Should receive ErrUnknownBackend for an unknown backend, got %v", err)
+	}
+}
+
+func Test_ForEachReverse(t *testing.T) {
+	for _, backend := range []string{storage.BackendDisk, storage.BackendMemory} {
+		f := func(t *testing.T) {
+			store, err := storage.New(backend, storage.Config{DBPath: t.TempDir()})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct the backend: %v", backend, err)
+			}
+			defer store.Close()
+
+			if iter := store.ForEachReverse(); !iter.Done() {
+				t.Fatalf("Test %s:\tShould be done iterating an empty chain.", backend)
+			}
+
+			for i := uint64(1); i <= 3; i++ {
+				if err := store.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+					t.Fatalf("Test %s:\tShould be able to write block %d: %v", backend, i, err)
+				}
+			}
+
+			var got []uint64
+			iter := store.ForEachReverse()
+			for !iter.Done() {
+				blockData, err := iter.Next()
+				if err != nil {
+					t.Fatalf("Test %s:\tShould be able to read the next block: %v", backend, err)
+				}
+				got = append(got, blockData.Header.Number)
+			}
+
+			if exp := []uint64{3, 2, 1}; !reflect.DeepEqual(got, exp) {
+				t.Fatalf("Test %s:\tShould iterate the blocks in descending order, got %v, exp %v", backend, got, exp)
+			}
+
+			if _, err := iter.Next(); err == nil {
+				t.Fatalf("Test %s:\tShould stop iterating after block 1.", backend)
+			}
+		}
+
+		t.Run(backend, f)
+	}
+}
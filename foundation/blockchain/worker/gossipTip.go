@@ -0,0 +1,29 @@
+package worker
+
+// CORE NOTE: Notifying the peers of a new latest block is performed by this
+// goroutine. When the latest block changes, the state signals this goroutine
+// to send the tip over the p2p network. Signals received while a notification
+// is pending are collapsed into one, since only the latest block is sent.
+
+// gossipTipOperations handles notifying the peers of a new latest block.
+func (w *Worker) gossipTipOperations() {
+	w.evHandler("Worker: gossipTipOperations: G started")
+	defer w.evHandler("Worker: gossipTipOperations: G completed")
+
+	for {
+		select {
+		case <-w.tipGossip:
+			if !w.isShutdown() {
+				w.gossipTip()
+			}
+		case <-w.shut:
+			w.evHandler("Worker: gossipTipOperations: received shut signal")
+			return
+		}
+	}
+}
+
+// gossipTip sends the number and hash of the latest block to the peers.
+func (w *Worker) gossipTip() {
+	w.state.NetSendTipToPeers()
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_GossipTip(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10}
+
+	// The peer records the tip notifications it receives.
+	tips := make(chan peer.Tip, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/node/tip" {
+			var tip peer.Tip
+			json.NewDecoder(r.Body).Decode(&tip)
+			tips <- tip
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	newState := func(knownPeers *peer.Set, tipGossip bool) *state.State {
+		storage, err := memory.New()
+		if err != nil {
+			t.Fatalf("Should be able to construct memory storage: %v", err)
+		}
+
+		st, err := state.New(state.Config{
+			BeneficiaryID:  "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			Host:           "127.0.0.1:0",
+			Storage:        storage,
+			Genesis:        gen,
+			SelectStrategy: "Tip",
+			KnownPeers:     knownPeers,
+			Consensus:      state.ConsensusPOW,
+			TipGossip:      tipGossip,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to construct state: %v", err)
+		}
+
+		return st
+	}
+
+	// Another node mines the block this node accepts.
+	miner := newState(peer.NewSet(), false)
+	if err := miner.UpsertMempool(newBlockTx(t)); err != nil {
+		t.Fatalf("Should be able to add transaction to the mempool: %v", err)
+	}
+
+	block, err := miner.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	st := newState(knownPeers, true)
+
+	w := Worker{
+		state:     st,
+		shut:      make(chan struct{}),
+		tipGossip: make(chan bool, 1),
+		evHandler: func(v string, args ...any) {},
+	}
+	st.Worker = &w
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.gossipTipOperations()
+	}()
+	defer func() {
+		close(w.shut)
+		w.wg.Wait()
+	}()
+
+	if err := st.ProcessProposedBlock(block); err != nil {
+		t.Fatalf("Should be able to accept the block: %v", err)
+	}
+
+	select {
+	case tip := <-tips:
+		if tip.Number != 1 || tip.Hash != block.Hash() || tip.Host != st.Host() {
+			t.Logf("got: %+v", tip)
+			t.Logf("exp: number[1] hash[%s] host[%s]", block.Hash(), st.Host())
+			t.Fatal("Should notify the peer of the accepted block.")
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("Should notify the peer of the accepted block.")
+	}
+}
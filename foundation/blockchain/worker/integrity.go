@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"time"
+)
+
+// CORE NOTE: Blocks are only validated when they are added to the chain. A
+// node that runs for a long time can have a block in storage go bad without
+// noticing, until it serves the block to a peer. When configured, this
+// goroutine periodically reads the most recent blocks back from storage and
+// checks they still match. The check is bound to a window of blocks and
+// doesn't hold the state lock, so it doesn't hold up mining.
+
+// integrityOperations handles the periodic integrity check of the most
+// recent blocks in storage.
+func (w *Worker) integrityOperations() {
+	w.evHandler("Worker: integrityOperations: G started")
+	defer w.evHandler("Worker: integrityOperations: G completed")
+
+	ticker := time.NewTicker(w.state.IntegrityInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !w.isShutdown() {
+				w.runIntegrityCheck()
+			}
+		case <-w.shut:
+			w.evHandler("Worker: integrityOperations: received shut signal")
+			return
+		}
+	}
+}
+
+// runIntegrityCheck checks the most recent blocks in storage and resyncs
+// the chain on a mismatch when configured to.
+func (w *Worker) runIntegrityCheck() {
+	w.evHandler("Worker: runIntegrityCheck: started")
+	defer w.evHandler("Worker: runIntegrityCheck: completed")
+
+	mismatches := w.state.CheckIntegrity()
+	if len(mismatches) == 0 {
+		return
+	}
+
+	w.evHandler("Worker: runIntegrityCheck: ERROR: blocks in storage don't match: mismatches[%d]", len(mismatches))
+
+	if !w.state.IntegrityResync() {
+		return
+	}
+
+	w.evHandler("Worker: runIntegrityCheck: resyncing the chain")
+
+	if err := w.state.Reorganize(); err != nil {
+		w.evHandler("Worker: runIntegrityCheck: ERROR: resync: %s", err)
+	}
+}
@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_IntegrityCheck(t *testing.T) {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	var alerts []string
+	st, err := state.New(state.Config{
+		BeneficiaryID:     "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:              "127.0.0.1:0",
+		Storage:           storage,
+		Genesis:           genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10},
+		SelectStrategy:    "Tip",
+		KnownPeers:        peer.NewSet(),
+		Consensus:         state.ConsensusPOW,
+		IntegrityInterval: time.Hour,
+		EvHandler: func(v string, args ...any) {
+			if strings.HasPrefix(v, state.EventIntegrity) {
+				alerts = append(alerts, fmt.Sprintf(v, args...))
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	w := Worker{
+		state:     st,
+		evHandler: func(v string, args ...any) {},
+	}
+	st.Worker = &w
+
+	for i := 0; i < 3; i++ {
+		if err := st.UpsertMempool(newBlockTx(t)); err != nil {
+			t.Fatalf("Should be able to add transaction to the mempool: %v", err)
+		}
+
+		if _, err := st.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Should be able to mine a block: %v", err)
+		}
+	}
+
+	w.runIntegrityCheck()
+
+	if len(alerts) != 0 {
+		t.Fatalf("Should not alert on an intact chain, got %v", alerts)
+	}
+
+	// Corrupt a transaction in the latest block in storage. The memory
+	// storage hands out the stored transactions, so changing them changes
+	// the block in storage.
+	blockData, err := storage.GetBlock(3)
+	if err != nil {
+		t.Fatalf("Should be able to get the latest block: %v", err)
+	}
+	blockData.Trans[0].Value++
+
+	w.runIntegrityCheck()
+
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "blk[3]") {
+		t.Fatalf("Should alert on the corrupted block, got %v", alerts)
+	}
+}
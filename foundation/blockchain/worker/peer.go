@@ -1,6 +1,9 @@
 package worker
 
 import (
+	"math/rand"
+	"time"
+
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
 )
 
@@ -26,7 +29,7 @@ func (w *Worker) peerOperations() {
 
 	for {
 		select {
-		case <-w.ticker.C:
+		case <-w.peerTicker.C:
 			if !w.isShutdown() {
 				w.runPeersOperation()
 			}
@@ -42,12 +45,21 @@ func (w *Worker) runPeersOperation() {
 	w.evHandler("Worker: runPeersOperation: started")
 	defer w.evHandler("Worker: runPeersOperation: completed")
 
-	for _, pr := range w.state.KnownExternalPeers() {
+	// Retrieve the status of the peers concurrently.
+	for _, result := range w.queryPeers(w.state.KnownExternalPeers(), false) {
+		pr := result.peer
+
+		if result.genesisErr != nil {
+			w.evHandler("worker: runPeersOperation: verifyPeerGenesis: %s: ERROR: %s", pr.Host, result.genesisErr)
+
+			// Since this peer is on another chain, remove them from the list.
+			w.state.RemoveKnownPeer(pr)
 
-		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(pr)
-		if err != nil {
-			w.evHandler("worker: runPeersOperation: requestPeerStatus: %s: ERROR: %s", pr.Host, err)
+			continue
+		}
+
+		if result.statusErr != nil {
+			w.evHandler("worker: runPeersOperation: requestPeerStatus: %s: ERROR: %s", pr.Host, result.statusErr)
 
 			// Since this peer is unavailable, remove them from the list.
 			w.state.RemoveKnownPeer(pr)
@@ -56,13 +68,91 @@ func (w *Worker) runPeersOperation() {
 		}
 
 		// Add peers from this node's peer list that are currently missing.
-		w.addNewPeers(peerStatus.KnownPeers)
+		w.addNewPeers(result.status.KnownPeers)
 	}
 
 	// Share with peers that this node is available to participate in the network.
 	w.state.NetSendNodeAvailableToPeers()
 }
 
+// CORE NOTE: When the origin node restarts, the other nodes drop it from
+// their known peers and only find it again if another peer shares it. The
+// origin peers are retried on their own timer so the network re-forms
+// quickly. The interval is jittered so the nodes that lost the origin at the
+// same time don't all reconnect at the same time.
+
+// originOperations handles reconnecting to the origin peers that were lost.
+func (w *Worker) originOperations() {
+	w.evHandler("Worker: originOperations: G started")
+	defer w.evHandler("Worker: originOperations: G completed")
+
+	// Each node needs its own sequence of jitter, so the source is seeded
+	// with the time the node started.
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	timer := time.NewTimer(jitter(rnd, w.state.OriginRetryInterval()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if !w.isShutdown() {
+				w.runOriginOperation()
+			}
+			timer.Reset(jitter(rnd, w.state.OriginRetryInterval()))
+		case <-w.shut:
+			w.evHandler("Worker: originOperations: received shut signal")
+			return
+		}
+	}
+}
+
+// runOriginOperation adds back the origin peers that are missing from the
+// known peers once they respond again.
+func (w *Worker) runOriginOperation() {
+	known := make(map[peer.Peer]bool)
+	for _, pr := range w.state.KnownPeers() {
+		known[pr] = true
+	}
+
+	var reconnected bool
+	for _, pr := range w.state.OriginPeers() {
+		if known[pr] || w.state.IsSelf(pr.Host) {
+			continue
+		}
+
+		result := w.queryPeer(pr, false)
+		if result.statusErr != nil {
+			w.evHandler("Worker: runOriginOperation: requestPeerStatus: %s: unavailable: %s", pr.Host, result.statusErr)
+			continue
+		}
+
+		if result.genesisErr != nil {
+			w.evHandler("Worker: runOriginOperation: verifyPeerGenesis: %s: ERROR: %s", pr.Host, result.genesisErr)
+			continue
+		}
+
+		if w.state.AddKnownPeer(pr) {
+			w.evHandler("Worker: runOriginOperation: reconnected to origin peer %s", pr.Host)
+			reconnected = true
+		}
+
+		// Add peers from the origin's peer list that are currently missing.
+		w.addNewPeers(result.status.KnownPeers)
+	}
+
+	// Share with the origin peers that this node is available again.
+	if reconnected {
+		w.state.NetSendNodeAvailableToPeers()
+	}
+}
+
+// jitter returns a random duration between half and one and a half times
+// the interval.
+func jitter(rnd *rand.Rand, interval time.Duration) time.Duration {
+	return interval/2 + time.Duration(rnd.Int63n(int64(interval)))
+}
+
 // addNewPeers takes the list of known peers and makes sure
 // they are included in the node's list of known peers.
 func (w *Worker) addNewPeers(knownPeers []peer.Peer) error {
@@ -70,8 +160,9 @@ func (w *Worker) addNewPeers(knownPeers []peer.Peer) error {
 	defer w.evHandler("Worker: runPeerUpdatesOperation: addNewPeers: completed")
 
 	for _, pr := range knownPeers {
-		// Don't add this running node to the known peer list.
-		if pr.Match(w.state.Host()) {
+		// Don't add this running node to the known peer list under any
+		// of the addresses it can be reached at.
+		if w.state.IsSelf(pr.Host) {
 			continue
 		}
 
@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_AddNewPeersExcludesSelf(t *testing.T) {
+	const (
+		publicHost = "203.0.113.10:8080"
+		otherHost  = "203.0.113.20:9080"
+	)
+
+	w := newPowWorker(1, 0, t, func(cfg *state.Config) {
+		cfg.Host = "0.0.0.0:9080"
+		cfg.Addresses = []string{publicHost}
+	})
+	defer w.Shutdown()
+
+	// A peer announcing the node under its public and bound addresses.
+	announced := []peer.Peer{
+		peer.New(publicHost),
+		peer.New("0.0.0.0:9080"),
+		peer.New("127.0.0.1:9080"),
+		peer.New("localhost:9080"),
+		peer.New(otherHost),
+	}
+
+	if err := w.addNewPeers(announced); err != nil {
+		t.Fatalf("Should be able to add the new peers: %v", err)
+	}
+
+	peers := w.state.KnownPeers()
+	if len(peers) != 1 {
+		t.Fatalf("Should only add the other peer, got %v", peers)
+	}
+
+	if !peers[0].Match(otherHost) {
+		t.Fatalf("Should add the other peer %s, got %s", otherHost, peers[0].Host)
+	}
+}
+
+func Test_OriginReconnect(t *testing.T) {
+	const retryInterval = 50 * time.Millisecond
+
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10}
+
+	// The origin starts out down.
+	var up atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/node/genesis":
+			json.NewEncoder(w).Encode(gen)
+		case "/v1/node/status":
+			json.NewEncoder(w).Encode(peer.Status{NetworkID: gen.NetworkID()})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	origin := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(origin)
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:       "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:                "127.0.0.1:0",
+		Storage:             storage,
+		Genesis:             gen,
+		SelectStrategy:      "Tip",
+		KnownPeers:          knownPeers,
+		Consensus:           state.ConsensusPOW,
+		PeerUpdateInterval:  20 * time.Millisecond,
+		SyncInterval:        time.Hour,
+		InitialSyncBackoff:  time.Millisecond,
+		OriginPeers:         []string{origin.Host},
+		OriginRetryInterval: retryInterval,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	var reconnects atomic.Int32
+	ev := func(v string, args ...any) {
+		if strings.HasPrefix(v, "Worker: runOriginOperation: reconnected") {
+			reconnects.Add(1)
+		}
+	}
+
+	if err := Run(st, ev); err != nil {
+		t.Fatalf("Should be able to run the worker: %v", err)
+	}
+	defer st.Worker.Shutdown()
+
+	// The peer update drops the origin while it's down.
+	if !waitForPeer(st, origin, false, time.Second) {
+		t.Fatal("Should drop the origin peer while it's down.")
+	}
+
+	// The origin comes back and is retried within the jittered interval.
+	up.Store(true)
+
+	if !waitForPeer(st, origin, true, 3*retryInterval) {
+		t.Fatalf("Should reconnect to the origin peer within %v", 3*retryInterval)
+	}
+
+	if n := reconnects.Load(); n != 1 {
+		t.Fatalf("Should reconnect to the origin peer once, got %d", n)
+	}
+}
+
+func Test_Jitter(t *testing.T) {
+	const interval = time.Second
+
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		if d := jitter(rnd, interval); d < interval/2 || d >= interval*3/2 {
+			t.Fatalf("Should jitter between %v and %v, got %v", interval/2, interval*3/2, d)
+		}
+	}
+}
+
+// =============================================================================
+
+// waitForPeer waits up to the duration for the peer to be known, or not.
+func waitForPeer(st *state.State, pr peer.Peer, known bool, wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		found := false
+		for _, kp := range st.KnownPeers() {
+			if kp == pr {
+				found = true
+			}
+		}
+
+		if found == known {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return false
+}
@@ -12,24 +12,22 @@ import (
 )
 
 // CORE NOTE: PoA mining operations are managed by this function which runs
-// its own goroutine. The node starts a loop that is on a 12-second timer.
-// At the beginning of each cycle the selection algorithm is executed,
-// determining if this node needs to mine the next block. If this node
-// isn't selected, it waits for the next cycle to check the selection algorithm again.
-
-// cycleDuration sets the mining operation to happen every 12 seconds.
-const secondsPerCycle = 12
-const cycleDuration = secondsPerCycle * time.Second
+// its own goroutine. The node starts a loop that is on a configured timer,
+// 12 seconds by default. At the beginning of each cycle the selection
+// algorithm is executed, determining if this node needs to mine the next
+// block. If this node isn't selected, it waits for the next cycle to check
+// the selection algorithm again.
 
 // poaOperations handles mining
 func (w *Worker) poaOperations() {
 	w.evHandler("worker: poaOperations: G started")
 	defer w.evHandler("worker: poaOperations: G completed")
 
-	ticker := time.NewTicker(cycleDuration)
+	cycle := w.state.POACycle()
+	ticker := time.NewTicker(cycle)
 
-	// Start this on a secondsPerCycle mark: ex. MM.00, MM.12, MM.24, MM.36
-	resetTicker(ticker, secondsPerCycle*time.Second)
+	// Start this on a cycle mark: ex. MM.00, MM.12, MM.24, MM.36 for 12 seconds.
+	resetTicker(ticker, cycle, cycle)
 
 	for {
 		select {
@@ -43,7 +41,7 @@ func (w *Worker) poaOperations() {
 		}
 
 		// Reset the ticker for the next cycle.
-		resetTicker(ticker, 0)
+		resetTicker(ticker, cycle, 0)
 	}
 }
 
@@ -167,8 +165,13 @@ func (w *Worker) selection() string {
 // /////////////////////////////////////////////////////////////////
 
 // resetTicker ensures that the next tick happens on the described candence.
-func resetTicker(ticker *time.Ticker, waitOnSecond time.Duration) {
-	nextTick := time.Now().Add(cycleDuration).Round(waitOnSecond)
-	diff := time.Until(nextTick)
+func resetTicker(ticker *time.Ticker, cycle time.Duration, waitOnSecond time.Duration) {
+	diff := time.Until(nextTick(time.Now(), cycle, waitOnSecond))
 	ticker.Reset(diff)
 }
+
+// nextTick calculates when the next tick should happen, one cycle from now
+// and rounded to the specified alignment.
+func nextTick(now time.Time, cycle time.Duration, waitOnSecond time.Duration) time.Time {
+	return now.Add(cycle).Round(waitOnSecond)
+}
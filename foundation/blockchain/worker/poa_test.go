@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_NextTick(t *testing.T) {
+	const cycle = 2 * time.Second
+
+	now := time.Date(2023, time.January, 1, 10, 0, 3, int(400*time.Millisecond), time.UTC)
+
+	// The first tick is aligned on the cycle mark.
+	next := nextTick(now, cycle, cycle)
+	exp := time.Date(2023, time.January, 1, 10, 0, 6, 0, time.UTC)
+	if !next.Equal(exp) {
+		t.Logf("got: %s", next)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should align the first tick on the cycle mark.")
+	}
+
+	if next.Sub(next.Truncate(cycle)) != 0 {
+		t.Fatalf("Should produce a tick that is a multiple of the cycle.")
+	}
+
+	// Following ticks happen one cycle from now without alignment.
+	next = nextTick(exp, cycle, 0)
+	exp = exp.Add(cycle)
+	if !next.Equal(exp) {
+		t.Logf("got: %s", next)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should schedule the next tick one cycle later.")
+	}
+}
@@ -15,17 +15,56 @@ import (
 // operation starts. This operation can be cancelled if a proposed block is
 // received and is validated.
 
+// CORE NOTE: Mining a block for every transaction that arrives wastes energy
+// on near empty blocks. Mining starts once the mempool holds the configured
+// minimum number of transactions, or once the configured max wait has passed
+// since the first transaction was queued, whichever happens first.
+
 // powOperations handles mining.
 func (w *Worker) powOperations() {
 	w.evHandler("Worker: powOperations: G started")
 	defer w.evHandler("Worker: powOperations: G completed")
 
+	// The wait timer is only running while transactions are queued
+	// waiting for the mempool to reach the minimum.
+	var wait *time.Timer
+	var waitC <-chan time.Time
+
+	stopWait := func() {
+		if wait != nil {
+			wait.Stop()
+			wait, waitC = nil, nil
+		}
+	}
+	defer stopWait()
+
 	for {
 		select {
 		case <-w.startMining:
+			if w.isShutdown() {
+				continue
+			}
+
+			if length := w.state.MempoolLength(); length < w.state.MinTxToMine() {
+				if wait == nil {
+					w.evHandler("Worker: powOperations: MINING: waiting for transactions: Txs[%d]: maxWait[%v]", length, w.state.MaxMineWait())
+					wait = time.NewTimer(w.state.MaxMineWait())
+					waitC = wait.C
+				}
+				continue
+			}
+
+			stopWait()
+			w.runPowOperation()
+
+		case <-waitC:
+			wait, waitC = nil, nil
+
 			if !w.isShutdown() {
+				w.evHandler("Worker: powOperations: MINING: max wait elapsed")
 				w.runPowOperation()
 			}
+
 		case <-w.shut:
 			w.evHandler("Worker: powOperations: received shut signal")
 			return
@@ -45,6 +84,21 @@ func (w *Worker) runPowOperation() {
 		return
 	}
 
+	// Don't mine an isolated chain that will conflict with the network
+	// once this node connects to its peers.
+	if minPeers := w.state.MinPeersToMine(); minPeers > 0 {
+		if peers := len(w.state.KnownExternalPeers()); peers < minPeers {
+			w.evHandler("Worker: runMiningOperation: MINING: not enough peers: peers[%d]: min[%d]", peers, minPeers)
+			return
+		}
+	}
+
+	// Don't mine blocks with timestamps the peers may reject.
+	if w.state.StopMiningOnSkew() && w.state.ClockSkewed() {
+		w.evHandler("Worker: runMiningOperation: MINING: clock skewed from peers: skew[%v]: max[%v]", w.state.PeerClockSkew(), w.state.MaxClockSkew())
+		return
+	}
+
 	// Make sure there are at least transPerBlock in the mempool.
 	length := w.state.MempoolLength()
 	if length == 0 {
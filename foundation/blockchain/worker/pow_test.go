@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_MineDepthTrigger(t *testing.T) {
+	w := newPowWorker(3, time.Minute, t)
+	defer w.Shutdown()
+
+	queueTx(w, t)
+	queueTx(w, t)
+
+	if waitForBlock(w, 200*time.Millisecond) {
+		t.Fatal("Should not mine before the minimum number of transactions are queued")
+	}
+
+	queueTx(w, t)
+
+	if !waitForBlock(w, 5*time.Second) {
+		t.Fatal("Should mine once the minimum number of transactions are queued")
+	}
+}
+
+func Test_MineTimeoutTrigger(t *testing.T) {
+	const maxWait = 300 * time.Millisecond
+
+	w := newPowWorker(3, maxWait, t)
+	defer w.Shutdown()
+
+	start := time.Now()
+	queueTx(w, t)
+
+	if !waitForBlock(w, 5*time.Second) {
+		t.Fatal("Should mine once the max wait has elapsed")
+	}
+
+	if d := time.Since(start); d < maxWait {
+		t.Fatalf("Should wait for the max wait before mining, mined after %v", d)
+	}
+}
+
+func Test_MinPeersToMine(t *testing.T) {
+	w := newPowWorker(1, time.Minute, t, func(cfg *state.Config) {
+		cfg.MinPeersToMine = 1
+	})
+	defer w.Shutdown()
+
+	queueTx(w, t)
+
+	if waitForBlock(w, 200*time.Millisecond) {
+		t.Fatal("Should not mine before the minimum number of peers are known")
+	}
+
+	w.state.AddKnownPeer(peer.New("127.0.0.1:1"))
+	w.SignalStartMining()
+
+	if !waitForBlock(w, 5*time.Second) {
+		t.Fatal("Should mine once the minimum number of peers are known")
+	}
+}
+
+// =============================================================================
+
+// newPowWorker constructs a worker running only the POW operation.
+func newPowWorker(minTxToMine int, maxMineWait time.Duration, t *testing.T, options ...func(cfg *state.Config)) *Worker {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	cfg := state.Config{
+		BeneficiaryID:  "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:           "127.0.0.1:0",
+		Storage:        storage,
+		Genesis:        genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewSet(),
+		Consensus:      state.ConsensusPOW,
+		MinTxToMine:    minTxToMine,
+		MaxMineWait:    maxMineWait,
+	}
+
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	st, err := state.New(cfg)
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	w := Worker{
+		state:        st,
+		peerTicker:   time.NewTicker(time.Hour),
+		syncTicker:   time.NewTicker(time.Hour),
+		shut:         make(chan struct{}),
+		startMining:  make(chan bool, 1),
+		cancelMining: make(chan bool, 1),
+		txSharing:    make(chan database.BlockTx, maxTxShareRequests),
+		evHandler:    func(v string, args ...any) {},
+	}
+	st.Worker = &w
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.powOperations()
+	}()
+
+	return &w
+}
+
+// queueTx adds a transaction to the mempool and signals mining.
+func queueTx(w *Worker, t *testing.T) {
+	if err := w.state.UpsertMempool(newBlockTx(t)); err != nil {
+		t.Fatalf("Should be able to add transaction to the mempool: %v", err)
+	}
+
+	w.SignalStartMining()
+}
+
+// waitForBlock waits up to the duration for a block to be mined.
+func waitForBlock(w *Worker, d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		if w.state.LatestBlock().Header.Number > 0 {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
@@ -1,5 +1,9 @@
 package worker
 
+import (
+	"time"
+)
+
 // CORE NOTE: Sharing new transactions received directly by a wallet is
 // performed by this goroutine. When a wallet transaction is received,
 // the request goroutine shares it with this goroutine to send it over the
@@ -13,20 +17,113 @@ package worker
 // shared will not be accepted. This isn't production friendly.
 const maxTxShareRequests = 100
 
+// CORE NOTE: A transaction is signaled to be shared every time it's taken
+// into the mempool, including when it's received again through gossip from
+// another peer. Sharing it again every time amplifies the gossip into a
+// storm. When a dedup window is configured, a transaction shared within the
+// window is not shared again. Explicit reshares, like a mempool rebroadcast,
+// are meant to share the transaction again, so they skip the dedup.
+
 // shareTxOperations handles sharing new user transactions.
 func (w *Worker) shareTxOperations() {
 	w.evHandler("Worker: shareTxOperations: G started")
 	defer w.evHandler("Worker: shareTxOperations: G completed")
 
+	dedup := shareDedup{
+		window: w.state.ShareDedupWindow(),
+		shared: make(map[string]time.Time),
+	}
+
 	for {
 		select {
 		case tx := <-w.txSharing:
-			if !w.isShutdown() {
-				w.state.NetSendTxToPeers(tx)
+			if w.isShutdown() {
+				continue
 			}
+
+			if dedup.recent(tx.SignatureString(), time.Now()) {
+				w.evHandler("Worker: shareTxOperations: skip: tx[%s] shared within the dedup window", tx)
+				continue
+			}
+
+			w.state.NetSendTxToPeers(tx)
+		case tx := <-w.txResharing:
+			if w.isShutdown() {
+				continue
+			}
+
+			dedup.record(tx.SignatureString(), time.Now())
+			w.state.NetSendTxToPeers(tx)
 		case <-w.shut:
 			w.evHandler("Worker: shareTxOperations: received shut signal")
 			return
 		}
 	}
 }
+
+// shareDedup tracks the signatures of the transactions shared within the
+// dedup window. It's only used by the share goroutine, so it isn't safe for
+// concurrent use.
+type shareDedup struct {
+	window time.Duration
+	shared map[string]time.Time
+}
+
+// recent reports whether the transaction with the signature was shared
+// within the window. When it wasn't, it's recorded as shared at the specified
+// time. A window of 0 never reports a transaction as recent.
+func (d *shareDedup) recent(sig string, now time.Time) bool {
+	if d.window <= 0 {
+		return false
+	}
+
+	if at, exists := d.shared[sig]; exists && now.Sub(at) < d.window {
+		return true
+	}
+
+	d.record(sig, now)
+
+	return false
+}
+
+// record records the transaction with the signature as shared at the
+// specified time. A window of 0 records nothing.
+func (d *shareDedup) record(sig string, now time.Time) {
+	if d.window <= 0 {
+		return
+	}
+
+	// Forget the transactions shared before the window, so the set only
+	// grows with the number of transactions shared within the window.
+	for s, at := range d.shared {
+		if now.Sub(at) >= d.window {
+			delete(d.shared, s)
+		}
+	}
+
+	d.shared[sig] = now
+}
+
+// reshareOperations periodically shares the transactions that have been
+// pending in the mempool for the reshare age again, so the propagation of a
+// transaction this node doesn't mine can't stall. The mempool is checked
+// twice per age, so a transaction waits at most one and a half ages.
+func (w *Worker) reshareOperations() {
+	w.evHandler("Worker: reshareOperations: G started")
+	defer w.evHandler("Worker: reshareOperations: G completed")
+
+	ticker := time.NewTicker(w.state.ReshareAge() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !w.isShutdown() {
+				w.state.ReshareAgedTxs()
+			}
+		case <-w.shut:
+			w.evHandler("Worker: reshareOperations: received shut signal")
+			return
+		}
+	}
+}
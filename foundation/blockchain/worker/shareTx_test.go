@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ShareTxDedup(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10}
+
+	// The peer records the transactions forwarded to it.
+	forwarded := make(chan database.BlockTx, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/node/tx/submit" {
+			var tx database.BlockTx
+			json.NewDecoder(r.Body).Decode(&tx)
+			forwarded <- tx
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:    "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:             "127.0.0.1:0",
+		Storage:          storage,
+		Genesis:          gen,
+		SelectStrategy:   "Tip",
+		KnownPeers:       knownPeers,
+		ShareDedupWindow: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	w := Worker{
+		state:       st,
+		shut:        make(chan struct{}),
+		txSharing:   make(chan database.BlockTx, maxTxShareRequests),
+		txResharing: make(chan database.BlockTx, maxTxShareRequests),
+		evHandler:   func(v string, args ...any) {},
+	}
+	st.Worker = &w
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.shareTxOperations()
+	}()
+	defer func() {
+		close(w.shut)
+		w.wg.Wait()
+	}()
+
+	// The same transaction is signaled twice in quick succession, followed
+	// by another transaction.
+	tx := newBlockTx(t)
+	other := newBlockTx(t)
+
+	w.SignalShareTx(tx)
+	w.SignalShareTx(tx)
+	w.SignalShareTx(other)
+
+	// The signals are handled in order, so once the other transaction is
+	// forwarded the duplicate has been handled as well.
+	var got []string
+	for len(got) == 0 || got[len(got)-1] != other.SignatureString() {
+		select {
+		case ftx := <-forwarded:
+			got = append(got, ftx.SignatureString())
+
+		case <-time.After(time.Second):
+			t.Fatalf("Should forward the transactions to the peer, got %d", len(got))
+		}
+	}
+
+	if len(got) != 2 || got[0] != tx.SignatureString() {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", []string{tx.SignatureString(), other.SignatureString()})
+		t.Fatal("Should only forward the transaction shared twice once.")
+	}
+
+	// An explicit reshare within the window is still forwarded.
+	if !w.SignalReshareTx(tx) {
+		t.Fatal("Should be able to queue the reshare.")
+	}
+
+	select {
+	case ftx := <-forwarded:
+		if ftx.SignatureString() != tx.SignatureString() {
+			t.Fatalf("Should forward the reshared transaction, got %s", ftx)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("Should forward the reshared transaction within the dedup window.")
+	}
+}
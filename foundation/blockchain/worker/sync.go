@@ -1,45 +1,245 @@
 package worker
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+)
+
+// ErrInitialSync is returned when the node is required to sync with a peer
+// on startup and none of its peers could be reached.
+var ErrInitialSync = errors.New("initial sync did not reach any peers")
+
+// maxInitialSyncBackoff is the longest the initial sync waits between attempts.
+const maxInitialSyncBackoff = 30 * time.Second
+
 // CORE NOTE: On startup or when reorganizing the chain, the node needs to be
 // in sync with the rest of the network. This includes the mempool and
 // blockchain database. This operation needs to finish before the node can
 // participate in the network.
 
+// syncOperations handles keeping the mempool and blocks in sync with the
+// peers after startup.
+func (w *Worker) syncOperations() {
+	w.evHandler("Worker: syncOperations: G started")
+	defer w.evHandler("Worker: syncOperations: G completed")
+
+	for {
+		select {
+		case <-w.syncTicker.C:
+			if !w.isShutdown() {
+				w.Sync()
+			}
+		case <-w.shut:
+			w.evHandler("Worker: syncOperations: received shut signal")
+			return
+		}
+	}
+}
+
+// initialSync syncs the node with its peers on startup. When none of the
+// peers can be reached, the sync is retried with a doubling backoff until a
+// peer is reached or the configured attempts run out.
+func (w *Worker) initialSync() error {
+	attempts := w.state.InitialSyncAttempts()
+	backoff := w.state.InitialSyncBackoff()
+
+	for attempt := 1; ; attempt++ {
+		if w.sync() {
+			return nil
+		}
+
+		if attempt >= attempts {
+			break
+		}
+
+		w.evHandler("Worker: initialSync: no peers reached: attempt[%d/%d]: retry in %v", attempt, attempts, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-w.shut:
+			return ErrInitialSync
+		}
+
+		if backoff *= 2; backoff > maxInitialSyncBackoff {
+			backoff = maxInitialSyncBackoff
+		}
+	}
+
+	if w.state.RequireInitialSync() {
+		return fmt.Errorf("%w after %d attempts", ErrInitialSync, attempts)
+	}
+
+	w.evHandler("Worker: initialSync: WARNING: no peers reached after %d attempts, starting with a stale chain", attempts)
+
+	return nil
+}
+
 // Sync updates the peer list, mempool, and blocks.
 func (w *Worker) Sync() {
+	w.sync()
+}
+
+// sync updates the peer list, mempool, and blocks, reporting whether any of
+// the peers were reached. A node without peers has nothing to sync with, so
+// that is reported as reached.
+func (w *Worker) sync() bool {
 	w.evHandler("Worker: sync: started")
 	defer w.evHandler("Worker: sync: completed")
 
-	for _, pr := range w.state.KnownExternalPeers() {
-		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(pr)
-		if err != nil {
-			w.evHandler("Worker: sync: queryPeerStatus: %s: ERROR: %s", pr.Host, err)
+	peers := w.state.KnownExternalPeers()
+	reached := len(peers) == 0
+
+	// Query the peers concurrently, but merge the results and apply any
+	// missing blocks one peer at a time.
+	for _, result := range w.queryPeers(peers, true) {
+		if result.statusErr == nil && result.genesisErr == nil {
+			reached = true
 		}
+		w.syncPeerResult(result)
+	}
+
+	// Warn the operator if this node's clock doesn't agree with its peers.
+	w.checkClockSkew()
+
+	// Share with peers that this node is available to participate in the network.
+	w.state.NetSendNodeAvailableToPeers()
+
+	return reached
+}
+
+// SyncPeer updates the peer list, mempool, and blocks using only the
+// specified peer.
+func (w *Worker) SyncPeer(pr peer.Peer) {
+	w.evHandler("Worker: syncPeer: started: %s", pr.Host)
+	defer w.evHandler("Worker: syncPeer: completed: %s", pr.Host)
+
+	w.syncPeerResult(w.queryPeer(pr, true))
+	w.checkClockSkew()
+
+	// Share with peers that this node is available to participate in the network.
+	w.state.NetSendNodeAvailableToPeers()
+}
+
+// syncPeerResult merges the information retrieved from a peer into this node.
+func (w *Worker) syncPeerResult(result peerResult) {
+	pr := result.peer
+
+	// Refuse to sync with a peer that is running a different chain.
+	if result.genesisErr != nil {
+		w.evHandler("Worker: sync: verifyPeerGenesis: %s: ERROR: %s", pr.Host, result.genesisErr)
+		return
+	}
+
+	if result.statusErr != nil {
+		w.evHandler("Worker: sync: queryPeerStatus: %s: ERROR: %s", pr.Host, result.statusErr)
+	}
 
-		// Add new peers to this nodes list.
-		w.addNewPeers(peerStatus.KnownPeers)
+	// Add new peers to this nodes list.
+	w.addNewPeers(result.status.KnownPeers)
+
+	// Update the mempool.
+	if result.mempoolErr != nil {
+		w.evHandler("Worker: sync: retrievePeerMempool: %s: ERROR: %s", pr.Host, result.mempoolErr)
+	}
 
-		// Update the mempool.
-		pool, err := w.state.NetRequestPeerMempool(pr)
-		if err != nil {
-			w.evHandler("Worker: sync: retrievePeerMempool: %s: ERROR: %s", pr.Host, err)
+	// The peer isn't trusted, so every transaction goes through the same
+	// checks as a transaction shared directly. Invalid ones are skipped.
+	for _, tx := range result.mempool {
+		if err := w.state.UpsertMempool(tx); err != nil {
+			w.evHandler("Worker: sync: retrievePeerMempool: %s: Skip Tx: %s: ERROR: %s", pr.Host, tx.SignatureString()[:16], err)
+			continue
 		}
-		for _, tx := range pool {
-			w.evHandler("Worker: sync: retrievePeerMempool: %s: Add Tx: %s", pr.Host, tx.SignatureString()[:16])
-			w.state.UpsertMempool(tx)
+		w.evHandler("Worker: sync: retrievePeerMempool: %s: Add Tx: %s", pr.Host, tx.SignatureString()[:16])
+	}
+
+	// If this peer has blocks we don't have, we need to add them.
+	if result.status.LatestBlockNumber > w.state.LatestBlock().Header.Number {
+		w.evHandler("Worker: sync: writePeerBlocks: %s: latestBlockNumber[%d]", pr.Host, result.status.LatestBlockNumber)
+
+		if err := w.state.NetRequestPeerBlocks(pr); err != nil {
+			w.evHandler("Worker: sync: writePeerBlocks: %s: ERROR %s", pr.Host, err)
 		}
+	}
+}
 
-		// If this peer has blocks we don't have, we need to add them.
-		if peerStatus.LatestBlockNumber > w.state.LatestBlock().Header.Number {
-			w.evHandler("Worker: sync: writePeerBlocks: %s: latestBlockNumber[%d]", pr.Host, peerStatus.LatestBlockNumber)
+// checkClockSkew reports when the clock of this node is skewed from the
+// clocks of its peers by more than the max clock skew.
+func (w *Worker) checkClockSkew() {
+	if w.state.ClockSkewed() {
+		w.evHandler("Worker: sync: WARNING: clock skewed from peers: skew[%v]: max[%v]", w.state.PeerClockSkew(), w.state.MaxClockSkew())
+	}
+}
 
-			if err := w.state.NetRequestPeerBlocks(pr); err != nil {
-				w.evHandler("Worker: sync: writePeerBlocks: %s: ERROR %s", pr.Host, err)
-			}
+// /////////////////////////////////////////////////////////////////
+
+// peerResult represents the information retrieved from a single peer.
+type peerResult struct {
+	peer       peer.Peer
+	genesisErr error
+	status     peer.Status
+	statusErr  error
+	mempool    []database.BlockTx
+	mempoolErr error
+}
+
+// queryPeers retrieves the status, and optionally the mempool, from the
+// specified peers. The peers are queried concurrently, limited by the
+// configured sync concurrency. The results are returned in the same order
+// as the peers.
+func (w *Worker) queryPeers(peers []peer.Peer, withMempool bool) []peerResult {
+	results := make([]peerResult, len(peers))
+
+	sem := make(chan struct{}, w.state.SyncConcurrency())
+
+	var wg sync.WaitGroup
+	wg.Add(len(peers))
+
+	for i, pr := range peers {
+		go func(i int, pr peer.Peer) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = w.queryPeer(pr, withMempool)
+		}(i, pr)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// queryPeer retrieves the status, and optionally the mempool, from the
+// specified peer. The mempool is not retrieved if the peer is running a
+// chain with a different genesis.
+func (w *Worker) queryPeer(pr peer.Peer, withMempool bool) peerResult {
+	result := peerResult{peer: pr}
+
+	result.status, result.statusErr = w.state.NetRequestPeerStatus(pr)
+
+	// The network id is derived from the full genesis, so a peer with the
+	// same chain id but different genesis balances is still refused.
+	if result.statusErr == nil {
+		if result.genesisErr = w.state.VerifyPeerGenesis(pr); result.genesisErr != nil {
+			return result
+		}
+
+		// A peer running a different protocol version may not understand
+		// this node, so the operator is warned. Syncing still goes ahead.
+		if v := result.status.Version; v.Protocol != peer.ProtocolVersion {
+			w.evHandler("Worker: queryPeer: WARNING: peer[%s] runs protocol version %d build %q, exp %d", pr.Host, v.Protocol, v.Build, peer.ProtocolVersion)
 		}
 	}
 
-	// Share with peers that this node is available to participate in the network.
-	w.state.NetSendNodeAvailableToPeers()
+	if withMempool {
+		result.mempool, result.mempoolErr = w.state.NetRequestPeerMempool(pr)
+	}
+
+	return result
 }
@@ -0,0 +1,533 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_SyncConcurrency(t *testing.T) {
+	const (
+		peers       = 4
+		concurrency = 2
+	)
+
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1}
+
+	var mu sync.Mutex
+	var active, maxActive int
+
+	knownPeers := peer.NewSet()
+	for i := 0; i < peers; i++ {
+		tx := newBlockTx(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+
+			switch r.URL.Path {
+			case "/v1/node/genesis":
+				json.NewEncoder(w).Encode(gen)
+
+			case "/v1/node/status":
+				mu.Lock()
+				active++
+				if active > maxActive {
+					maxActive = active
+				}
+				mu.Unlock()
+
+				time.Sleep(50 * time.Millisecond)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+
+				json.NewEncoder(w).Encode(peer.Status{NetworkID: gen.NetworkID()})
+
+			case "/v1/node/tx/list":
+				json.NewEncoder(w).Encode([]database.BlockTx{tx})
+
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+		defer srv.Close()
+
+		knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		Host:            "127.0.0.1:0",
+		Storage:         storage,
+		Genesis:         gen,
+		SelectStrategy:  "Tip",
+		KnownPeers:      knownPeers,
+		SyncConcurrency: concurrency,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	w := Worker{
+		state:     st,
+		evHandler: func(v string, args ...any) {},
+	}
+	st.Worker = &w
+
+	w.Sync()
+
+	if st.MempoolLength() != peers {
+		t.Fatalf("Should have merged the mempool from every peer, got %d, exp %d", st.MempoolLength(), peers)
+	}
+
+	if maxActive > concurrency {
+		t.Fatalf("Should not query more than %d peers at the same time, got %d", concurrency, maxActive)
+	}
+
+	if maxActive < 2 {
+		t.Fatalf("Should query peers concurrently, got %d", maxActive)
+	}
+}
+
+func Test_SyncInvalidMempool(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1}
+
+	valid := newBlockTx(t)
+
+	forged := newBlockTx(t)
+	forged.Value = 1000
+
+	otherChain := newBlockTx(t)
+	otherChain.ChainID = 2
+
+	noGas := newBlockTx(t)
+	noGas.GasUnits = 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/node/genesis":
+			json.NewEncoder(w).Encode(gen)
+
+		case "/v1/node/status":
+			json.NewEncoder(w).Encode(peer.Status{NetworkID: gen.NetworkID()})
+
+		case "/v1/node/tx/list":
+			json.NewEncoder(w).Encode([]database.BlockTx{forged, valid, otherChain, noGas})
+
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		Host:           "127.0.0.1:0",
+		Storage:        storage,
+		Genesis:        gen,
+		SelectStrategy: "Tip",
+		KnownPeers:     knownPeers,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	var skipped atomic.Int32
+	w := Worker{
+		state: st,
+		evHandler: func(v string, args ...any) {
+			if strings.HasPrefix(v, "Worker: sync: retrievePeerMempool: %s: Skip Tx:") {
+				skipped.Add(1)
+			}
+		},
+	}
+	st.Worker = &w
+
+	w.Sync()
+
+	mempool := st.Mempool()
+	if len(mempool) != 1 {
+		t.Fatalf("Should only merge the valid transaction from the peer, got %d", len(mempool))
+	}
+
+	if mempool[0].SignatureString() != valid.SignatureString() {
+		t.Fatalf("Should merge the valid transaction from the peer, got %s", mempool[0])
+	}
+
+	if n := skipped.Load(); n != 3 {
+		t.Fatalf("Should log the skipped transactions, got %d, exp %d", n, 3)
+	}
+}
+
+func Test_SyncGenesisMismatch(t *testing.T) {
+	local := genesis.Genesis{
+		ChainID:    1,
+		Difficulty: 1,
+		Balances:   map[string]uint64{"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 1000},
+	}
+
+	type table struct {
+		name string
+		peer genesis.Genesis
+	}
+
+	tt := []table{
+		{
+			name: "different chain id",
+			peer: genesis.Genesis{ChainID: 2, Difficulty: 1, Balances: local.Balances},
+		},
+		{
+			name: "same chain id, different balances",
+			peer: genesis.Genesis{ChainID: 1, Difficulty: 1, Balances: map[string]uint64{"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 2000}},
+		},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			tx := newBlockTx(t)
+
+			var synced atomic.Bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				switch r.URL.Path {
+				case "/v1/node/genesis":
+					json.NewEncoder(w).Encode(tst.peer)
+
+				case "/v1/node/status":
+					json.NewEncoder(w).Encode(peer.Status{NetworkID: tst.peer.NetworkID(), LatestBlockNumber: 1})
+
+				case "/v1/node/tx/list", "/v1/node/block/list/1/latest":
+					synced.Store(true)
+					json.NewEncoder(w).Encode([]database.BlockTx{tx})
+
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer srv.Close()
+
+			pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+			knownPeers := peer.NewSet()
+			knownPeers.Add(pr)
+
+			storage, err := memory.New()
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct memory storage: %v", tst.name, err)
+			}
+
+			st, err := state.New(state.Config{
+				Host:           "127.0.0.1:0",
+				Storage:        storage,
+				Genesis:        local,
+				SelectStrategy: "Tip",
+				KnownPeers:     knownPeers,
+			})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct state: %v", tst.name, err)
+			}
+
+			if tst.peer.NetworkID() == local.NetworkID() {
+				t.Fatalf("Test %s:\tShould have a different network id.", tst.name)
+			}
+
+			if err := st.VerifyPeerGenesis(pr); !errors.Is(err, state.ErrGenesisMismatch) {
+				t.Fatalf("Test %s:\tShould receive ErrGenesisMismatch for a peer on another network, got %v", tst.name, err)
+			}
+
+			w := Worker{
+				state:     st,
+				evHandler: func(v string, args ...any) {},
+			}
+			st.Worker = &w
+
+			w.Sync()
+
+			if synced.Load() {
+				t.Fatalf("Test %s:\tShould not request the mempool or blocks from a peer on another network.", tst.name)
+			}
+
+			if st.MempoolLength() != 0 {
+				t.Fatalf("Test %s:\tShould not merge the mempool from a peer on another network, got %d", tst.name, st.MempoolLength())
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_SyncProtocolVersion(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1}
+
+	type table struct {
+		name    string
+		version peer.Version
+		warned  bool
+	}
+
+	tt := []table{
+		{name: "same protocol", version: peer.Version{Build: "v1.0.0", Protocol: peer.ProtocolVersion}, warned: false},
+		{name: "newer protocol", version: peer.Version{Build: "v2.0.0", Protocol: peer.ProtocolVersion + 1}, warned: true},
+		{name: "no version", version: peer.Version{}, warned: true},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				switch r.URL.Path {
+				case "/v1/node/genesis":
+					json.NewEncoder(w).Encode(gen)
+
+				case "/v1/node/status":
+					json.NewEncoder(w).Encode(peer.Status{NetworkID: gen.NetworkID(), Version: tst.version})
+
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer srv.Close()
+
+			knownPeers := peer.NewSet()
+			knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+			storage, err := memory.New()
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct memory storage: %v", tst.name, err)
+			}
+
+			st, err := state.New(state.Config{
+				Host:           "127.0.0.1:0",
+				Storage:        storage,
+				Genesis:        gen,
+				SelectStrategy: "Tip",
+				KnownPeers:     knownPeers,
+			})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct state: %v", tst.name, err)
+			}
+
+			var warned atomic.Bool
+			w := Worker{
+				state: st,
+				evHandler: func(v string, args ...any) {
+					if strings.HasPrefix(v, "Worker: queryPeer: WARNING: peer[%s] runs protocol version") {
+						warned.Store(true)
+					}
+				},
+			}
+			st.Worker = &w
+
+			w.Sync()
+
+			if warned.Load() != tst.warned {
+				t.Fatalf("Test %s:\tShould log a mismatched protocol version: %t", tst.name, tst.warned)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_OperationIntervals(t *testing.T) {
+	const (
+		peerInterval = 20 * time.Millisecond
+		syncInterval = 100 * time.Millisecond
+		runFor       = 550 * time.Millisecond
+	)
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:      "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:               "127.0.0.1:0",
+		Storage:            storage,
+		Genesis:            genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10},
+		SelectStrategy:     "Tip",
+		KnownPeers:         peer.NewSet(),
+		Consensus:          state.ConsensusPOW,
+		PeerUpdateInterval: peerInterval,
+		SyncInterval:       syncInterval,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	var peerRuns, syncRuns atomic.Int32
+	ev := func(v string, args ...any) {
+		switch v {
+		case "Worker: runPeersOperation: started":
+			peerRuns.Add(1)
+		case "Worker: sync: started":
+			syncRuns.Add(1)
+		}
+	}
+
+	if err := Run(st, ev); err != nil {
+		t.Fatalf("Should be able to run the worker: %v", err)
+	}
+	time.Sleep(runFor)
+	st.Worker.Shutdown()
+
+	// Sync runs once on startup and then on every sync tick.
+	peers, syncs := peerRuns.Load(), syncRuns.Load()-1
+
+	if syncs < 2 || syncs > int32(runFor/syncInterval) {
+		t.Fatalf("Should sync about every %v, got %d syncs in %v", syncInterval, syncs, runFor)
+	}
+
+	if peers < 2*syncs {
+		t.Fatalf("Should update peers more often than syncing, got %d peer updates and %d syncs", peers, syncs)
+	}
+}
+
+func Test_InitialSync(t *testing.T) {
+	const attempts = 5
+
+	type table struct {
+		name     string
+		failures int32
+		require  bool
+		success  bool
+		retries  int32
+	}
+
+	tt := []table{
+		{name: "peer comes up", failures: 2, require: true, success: true, retries: 2},
+		{name: "peer stays down", failures: attempts, require: true, success: false, retries: attempts - 1},
+		{name: "peer stays down stale", failures: attempts, require: false, success: true, retries: attempts - 1},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			gen := genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10}
+
+			// The peer fails the status requests of the first sync attempts.
+			var statusRequests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/node/status" && statusRequests.Add(1) <= tst.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+
+				switch r.URL.Path {
+				case "/v1/node/genesis":
+					json.NewEncoder(w).Encode(gen)
+
+				case "/v1/node/status":
+					json.NewEncoder(w).Encode(peer.Status{NetworkID: gen.NetworkID()})
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer srv.Close()
+
+			knownPeers := peer.NewSet()
+			knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+			storage, err := memory.New()
+			if err != nil {
+				t.Fatalf("Should be able to construct memory storage: %v", err)
+			}
+
+			st, err := state.New(state.Config{
+				BeneficiaryID:       "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+				Host:                "127.0.0.1:0",
+				Storage:             storage,
+				Genesis:             gen,
+				SelectStrategy:      "Tip",
+				KnownPeers:          knownPeers,
+				Consensus:           state.ConsensusPOW,
+				PeerUpdateInterval:  time.Hour,
+				SyncInterval:        time.Hour,
+				InitialSyncAttempts: attempts,
+				InitialSyncBackoff:  5 * time.Millisecond,
+				RequireInitialSync:  tst.require,
+			})
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to construct state: %v", tst.name, err)
+			}
+
+			var retries atomic.Int32
+			ev := func(v string, args ...any) {
+				if strings.HasPrefix(v, "Worker: initialSync: no peers reached") {
+					retries.Add(1)
+				}
+			}
+
+			err = Run(st, ev)
+			defer st.Worker.Shutdown()
+
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould start the worker: %v", tst.name, err)
+			}
+			if !tst.success && !errors.Is(err, ErrInitialSync) {
+				t.Fatalf("Test %s:\tShould fail the initial sync, got %v", tst.name, err)
+			}
+
+			if n := retries.Load(); n != tst.retries {
+				t.Fatalf("Test %s:\tShould retry the initial sync %d times, got %d", tst.name, tst.retries, n)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// newBlockTx constructs a block transaction signed by a new account.
+func newBlockTx(t *testing.T) database.BlockTx {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  database.PublicKeyToAccountID(privateKey.PublicKey),
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	return database.NewBlockTx(signedTx, 1, tx.MinGasUnits())
+}
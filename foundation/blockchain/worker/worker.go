@@ -10,34 +10,38 @@ import (
 	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
 )
 
-// peerUpdateInterval represents the interval of time to find new peer
-// nodes and update the blockchain on disk with missing blocks.
-const peerUpdateInterval = time.Second * 10
-
 // Worker manages the POW workflows for the blockchain.
 type Worker struct {
 	state        *state.State
 	wg           sync.WaitGroup
-	ticker       time.Ticker
+	peerTicker   *time.Ticker
+	syncTicker   *time.Ticker
 	shut         chan struct{}
 	startMining  chan bool
 	cancelMining chan bool
 	txSharing    chan database.BlockTx
+	txResharing  chan database.BlockTx
+	tipGossip    chan bool
 	evHandler    state.EventHandler
 }
 
 // Run creates a Worker, registers the Worker with the state package, and
-// starts up all the background processes.
-func Run(st *state.State, evHandler state.EventHandler) {
+// starts up all the background processes. An error is returned, without
+// starting anything, when the node is required to sync on startup and
+// none of its peers could be reached.
+func Run(st *state.State, evHandler state.EventHandler) error {
 	// Construct and register this Worker to the st. During
 	// initialization this Worker needs access to the st.
 	w := Worker{
 		state:        st,
-		ticker:       *time.NewTicker(peerUpdateInterval),
+		peerTicker:   time.NewTicker(st.PeerUpdateInterval()),
+		syncTicker:   time.NewTicker(st.SyncInterval()),
 		shut:         make(chan struct{}),
 		startMining:  make(chan bool, 1),
 		cancelMining: make(chan bool, 1),
 		txSharing:    make(chan database.BlockTx, maxTxShareRequests),
+		txResharing:  make(chan database.BlockTx, maxTxShareRequests),
+		tipGossip:    make(chan bool, 1),
 		evHandler:    evHandler,
 	}
 
@@ -45,19 +49,46 @@ func Run(st *state.State, evHandler state.EventHandler) {
 	st.Worker = &w
 
 	// Update this node before starting any support G's.
-	w.Sync()
-
-	// Select consensus operation to run.
-	consensusOperation := w.powOperations
-	if st.Consensus() == state.ConsensusPOA {
-		consensusOperation = w.poaOperations
+	if err := w.initialSync(); err != nil {
+		return err
 	}
 
 	// Load the set of operations needed to run.
 	operations := []func(){
 		w.peerOperations,
+		w.syncOperations,
 		w.shareTxOperations,
-		consensusOperation,
+	}
+
+	// Notify the peers of every new latest block when configured to.
+	if st.TipGossip() {
+		operations = append(operations, w.gossipTipOperations)
+	}
+
+	// Check the most recent blocks in storage when configured to.
+	if st.IntegrityInterval() > 0 {
+		operations = append(operations, w.integrityOperations)
+	}
+
+	// Share the transactions pending for too long again when configured to.
+	if st.ReshareAge() > 0 {
+		operations = append(operations, w.reshareOperations)
+	}
+
+	// Retry the origin peers when the node has any to retry.
+	if len(st.OriginPeers()) > 0 {
+		operations = append(operations, w.originOperations)
+	}
+
+	// Select consensus operation to run. A read-only node never mines, so
+	// it doesn't run one.
+	switch {
+	case st.ReadOnly():
+		evHandler("Worker: Run: read-only node, mining disabled")
+	case st.Consensus() == state.ConsensusPOA:
+		operations = append(operations, w.poaOperations)
+	default:
+		operations = append(operations, w.powOperations)
 	}
 
 	// Set waitgroup to match the number of G's needed
@@ -81,6 +112,8 @@ func Run(st *state.State, evHandler state.EventHandler) {
 	for i := 0; i < g; i++ {
 		<-hasStarted
 	}
+
+	return nil
 }
 
 // /////////////////////////////////////////////////////////////////
@@ -91,8 +124,9 @@ func (w *Worker) Shutdown() {
 	w.evHandler("Worker: Shutdown: started")
 	defer w.evHandler("Worker: Shutdown: completed")
 
-	w.evHandler("Worker: Shutdown: stop ticker")
-	w.ticker.Stop()
+	w.evHandler("Worker: Shutdown: stop tickers")
+	w.peerTicker.Stop()
+	w.syncTicker.Stop()
 
 	w.evHandler("Worker: Shutdown: signal cancel mining")
 	w.SignalCancelMining()
@@ -110,6 +144,11 @@ func (w *Worker) SignalStartMining() {
 		return
 	}
 
+	// A read-only node has no mining operation to signal.
+	if w.state.ReadOnly() {
+		return
+	}
+
 	// Only PoW requires signalling to start mining.
 	if w.state.Consensus() != state.ConsensusPOW {
 		return
@@ -148,6 +187,31 @@ func (w *Worker) SignalShareTx(blockTx database.BlockTx) {
 	}
 }
 
+// SignalReshareTx queues up a share transaction operation that isn't
+// subject to the share dedup, reporting whether it was queued. If
+// maxTxShareRequests signals exist in the channel, we won't send these.
+func (w *Worker) SignalReshareTx(blockTx database.BlockTx) bool {
+	select {
+	case w.txResharing <- blockTx:
+		w.evHandler("Worker: SignalReshareTx: reshare Tx signaled")
+		return true
+	default:
+		w.evHandler("Worker: SignalReshareTx: queue full, transactions won't be reshared.")
+		return false
+	}
+}
+
+// SignalGossipTip queues up a tip notification to the peers. If there is
+// already a signal pending in the channel, just return since the latest
+// block will be sent.
+func (w *Worker) SignalGossipTip() {
+	select {
+	case w.tipGossip <- true:
+		w.evHandler("Worker: SignalGossipTip: gossip tip signaled")
+	default:
+	}
+}
+
 // /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 // isShutdown is used to test if a Shutdown has been signaled.
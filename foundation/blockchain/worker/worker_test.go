@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/database"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/genesis"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/peer"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/state"
+	"github.com/adamwoolhether/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ReadOnly(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, TransPerBlock: 10}
+
+	// Mine the block the read-only node syncs from its peer.
+	origin := newTestState(gen, peer.NewSet(), false, t)
+	if err := origin.UpsertMempool(newBlockTx(t)); err != nil {
+		t.Fatalf("Should be able to add a transaction to the mempool: %v", err)
+	}
+
+	block, err := origin.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	// The peer also has a full mempool to share.
+	mempool := make([]database.BlockTx, int(gen.TransPerBlock))
+	for i := range mempool {
+		mempool[i] = newBlockTx(t)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// The blocks are requested a page at a time starting at block 1.
+		switch path := r.URL.Path; {
+		case path == "/v1/node/genesis":
+			json.NewEncoder(w).Encode(gen)
+		case path == "/v1/node/status":
+			json.NewEncoder(w).Encode(peer.Status{
+				NetworkID:         gen.NetworkID(),
+				LatestBlockHash:   block.Hash(),
+				LatestBlockNumber: block.Header.Number,
+			})
+		case path == "/v1/node/tx/list":
+			json.NewEncoder(w).Encode(mempool)
+		case strings.HasPrefix(path, "/v1/node/block/list/1/"):
+			json.NewEncoder(w).Encode([]database.BlockData{database.NewBlockData(block)})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	knownPeers := peer.NewSet()
+	knownPeers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	st := newTestState(gen, knownPeers, true, t)
+
+	var mining atomic.Bool
+	ev := func(v string, args ...any) {
+		if strings.HasPrefix(v, "Worker: powOperations") || strings.HasPrefix(v, "Worker: runPowOperation") {
+			mining.Store(true)
+		}
+	}
+
+	if err := Run(st, ev); err != nil {
+		t.Fatalf("Should be able to run the worker: %v", err)
+	}
+	defer st.Worker.Shutdown()
+
+	if n := st.LatestBlock().Header.Number; n != block.Header.Number {
+		t.Fatalf("Should sync the blocks from the peer, got block %d", n)
+	}
+
+	if n := st.MempoolLength(); n != len(mempool) {
+		t.Fatalf("Should sync the mempool from the peer, got %d transactions", n)
+	}
+
+	st.Worker.SignalStartMining()
+	time.Sleep(100 * time.Millisecond)
+
+	if mining.Load() {
+		t.Fatal("Should not start a mining operation on a read-only node.")
+	}
+
+	if n := st.LatestBlock().Header.Number; n != block.Header.Number {
+		t.Fatalf("Should not mine a block on a read-only node, got block %d", n)
+	}
+
+	if _, err := st.MineNewBlock(context.Background()); !errors.Is(err, state.ErrReadOnly) {
+		t.Fatalf("Should receive ErrReadOnly mining on a read-only node, got %v", err)
+	}
+}
+
+// newTestState constructs a POW state backed by memory storage.
+func newTestState(gen genesis.Genesis, knownPeers *peer.Set, readOnly bool, t *testing.T) *state.State {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:  "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:           "127.0.0.1:0",
+		Storage:        storage,
+		Genesis:        gen,
+		SelectStrategy: "Tip",
+		KnownPeers:     knownPeers,
+		Consensus:      state.ConsensusPOW,
+		ReadOnly:       readOnly,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct state: %v", err)
+	}
+
+	return st
+}
@@ -2,30 +2,43 @@
 package events
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 )
 
+// ErrTooManySubscribers is returned when acquiring a channel would go over
+// the maximum number of subscribers.
+var ErrTooManySubscribers = errors.New("too many event subscribers")
+
 // Events maintains a mapping of unique id and channels
 // so goroutines can register and received events.
 type Events struct {
-	m  map[string]chan string
-	mu sync.RWMutex
+	m   map[string]chan string
+	max int
+	mu  sync.RWMutex
 }
 
 // New constructs an events for registering and receiving events.
 func New() *Events {
+	return NewWithMax(0)
+}
 
+// NewWithMax constructs an events for registering and receiving events that
+// allows at most the specified number of subscribers at the same time. A max
+// of 0 means the number of subscribers isn't limited.
+func NewWithMax(maxSubscribers int) *Events {
 	return &Events{
-		m: make(map[string]chan string),
+		m:   make(map[string]chan string),
+		max: maxSubscribers,
 	}
 }
 
 // Shutdown closes and removes all channels that were
 // provided by the call to Acquire.
 func (evt *Events) Shutdown() {
-	evt.mu.RLock()
-	defer evt.mu.RUnlock()
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
 
 	for id, ch := range evt.m {
 		delete(evt.m, id)
@@ -33,15 +46,20 @@ func (evt *Events) Shutdown() {
 	}
 }
 
-// Acquire takes a unique id and returns a channel that can
-// be used to receive events.
-func (evt *Events) Acquire(id string) chan string {
-	evt.mu.RLock()
-	defer evt.mu.RUnlock()
+// Acquire takes a unique id and returns a channel that can be used to
+// receive events. ErrTooManySubscribers is returned when the maximum number
+// of subscribers already have a channel.
+func (evt *Events) Acquire(id string) (chan string, error) {
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
 
 	ch, exists := evt.m[id]
 	if exists {
-		return ch
+		return ch, nil
+	}
+
+	if evt.max > 0 && len(evt.m) >= evt.max {
+		return nil, ErrTooManySubscribers
 	}
 
 	// Because a message is dropped if the websocket receiver isn't
@@ -51,14 +69,14 @@ func (evt *Events) Acquire(id string) chan string {
 
 	evt.m[id] = make(chan string, messageBuffer)
 
-	return evt.m[id]
+	return evt.m[id], nil
 }
 
 // Release closes and removes the channel that was
 // provided by the call to Acquire.
 func (evt *Events) Release(id string) error {
-	evt.mu.RLock()
-	defer evt.mu.RUnlock()
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
 
 	ch, exists := evt.m[id]
 	if !exists {
@@ -71,6 +89,14 @@ func (evt *Events) Release(id string) error {
 	return nil
 }
 
+// Count returns the number of subscribers currently holding a channel.
+func (evt *Events) Count() int {
+	evt.mu.RLock()
+	defer evt.mu.RUnlock()
+
+	return len(evt.m)
+}
+
 // Send signals a message to a registered channel. Send will not
 // block waiting for a receiver on any given channel.
 func (evt *Events) Send(s string) {
@@ -0,0 +1,58 @@
+package events_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adamwoolhether/blockchain/foundation/events"
+)
+
+func Test_MaxSubscribers(t *testing.T) {
+	const maxSubscribers = 3
+
+	evts := events.NewWithMax(maxSubscribers)
+	defer evts.Shutdown()
+
+	for i := 0; i < maxSubscribers; i++ {
+		if _, err := evts.Acquire(fmt.Sprintf("sub-%d", i)); err != nil {
+			t.Fatalf("Should be able to acquire subscriber %d: %v", i, err)
+		}
+	}
+
+	if n := evts.Count(); n != maxSubscribers {
+		t.Fatalf("Should have %d active subscribers, got %d", maxSubscribers, n)
+	}
+
+	if _, err := evts.Acquire("sub-extra"); !errors.Is(err, events.ErrTooManySubscribers) {
+		t.Fatalf("Should not be able to acquire a subscriber over the max, got %v", err)
+	}
+
+	// An active subscriber acquiring its channel again isn't a new subscriber.
+	if _, err := evts.Acquire("sub-0"); err != nil {
+		t.Fatalf("Should be able to acquire an active subscriber again: %v", err)
+	}
+
+	if err := evts.Release("sub-0"); err != nil {
+		t.Fatalf("Should be able to release a subscriber: %v", err)
+	}
+
+	if n := evts.Count(); n != maxSubscribers-1 {
+		t.Fatalf("Should have %d active subscribers after a release, got %d", maxSubscribers-1, n)
+	}
+
+	if _, err := evts.Acquire("sub-extra"); err != nil {
+		t.Fatalf("Should be able to acquire a subscriber after a release: %v", err)
+	}
+}
+
+func Test_UnlimitedSubscribers(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	for i := 0; i < 1000; i++ {
+		if _, err := evts.Acquire(fmt.Sprintf("sub-%d", i)); err != nil {
+			t.Fatalf("Should be able to acquire subscriber %d: %v", i, err)
+		}
+	}
+}